@@ -0,0 +1,272 @@
+// Package auth logs the CLI in to an OpenID Connect provider with the device authorization grant (RFC 8628)
+// and keeps the obtained tokens fresh
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc"
+)
+
+const (
+	// DefaultScope is requested unless another scope is given; offline_access asks for a refresh token
+	DefaultScope = "openid profile email offline_access"
+
+	// grantDeviceCode is the grant type of device access token requests
+	grantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// defaultInterval is how often the token endpoint is polled unless the provider says otherwise
+	defaultInterval = 5 * time.Second
+
+	// slowDownStep is added to the polling interval when the provider asks to slow down
+	slowDownStep = 5 * time.Second
+
+	// maxResponseSize bounds the responses of the provider
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrAccessDenied is returned when the user declines the device authorization
+	ErrAccessDenied = errors.New("authorization denied")
+
+	// ErrExpired is returned when the device code expires before the user approves it
+	ErrExpired = errors.New("device code expired, run login again")
+)
+
+// OAuthError is an error response of the provider (RFC 6749, section 5.2)
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Error implements error
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// DeviceAuthorization is a pending device authorization the user approves on another device
+type DeviceAuthorization struct {
+	DeviceCode string `json:"device_code"`
+
+	// UserCode is the code the user enters at VerificationURI
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+
+	// VerificationURIComplete embeds the user code, when the provider supports it
+	VerificationURIComplete string `json:"verification_uri_complete"`
+
+	// ExpiresIn and Interval are the lifetime of the device code and the polling interval, in seconds
+	ExpiresIn int `json:"expires_in"`
+	Interval  int `json:"interval"`
+}
+
+// DeviceFlowOptions contains configuration for the DeviceFlow
+type DeviceFlowOptions struct {
+	// Issuer is the URL of the OpenID Connect provider
+	Issuer string
+
+	// ClientID identifies the CLI at the provider
+	ClientID string
+
+	// Scope is the space-separated scope requested (optional, defaults to DefaultScope)
+	Scope string
+
+	// HTTPClient sends requests to the provider (optional, defaults to a client with a 30s timeout)
+	HTTPClient *http.Client
+}
+
+// DeviceFlow obtains tokens with the device authorization grant
+type DeviceFlow struct {
+	issuer   string
+	clientID string
+	scope    string
+	client   *http.Client
+
+	// sleep waits between polls; tests replace it
+	sleep func(ctx context.Context, d time.Duration) error
+
+	provider *oidc.Provider
+}
+
+// NewDeviceFlow creates a new device flow
+func NewDeviceFlow(opts *DeviceFlowOptions) *DeviceFlow {
+	if opts == nil {
+		opts = &DeviceFlowOptions{}
+	}
+
+	scope := opts.Scope
+	if scope == "" {
+		scope = DefaultScope
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &DeviceFlow{
+		issuer:   opts.Issuer,
+		clientID: opts.ClientID,
+		scope:    scope,
+		client:   client,
+		sleep:    sleep,
+	}
+}
+
+// Start asks the provider for a device authorization the user then approves
+func (f *DeviceFlow) Start(ctx context.Context) (*DeviceAuthorization, error) {
+	provider, err := oidc.Discover(ctx, f.client, f.issuer)
+	if err != nil {
+		return nil, err
+	}
+	if provider.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("%s does not support the device authorization grant", f.issuer)
+	}
+	f.provider = provider
+
+	var authorization DeviceAuthorization
+	form := url.Values{"client_id": {f.clientID}, "scope": {f.scope}}
+	if err := postForm(ctx, f.client, provider.DeviceAuthorizationEndpoint, form, &authorization); err != nil {
+		return nil, fmt.Errorf("device authorization failed: %w", err)
+	}
+	if authorization.DeviceCode == "" || authorization.UserCode == "" || authorization.VerificationURI == "" {
+		return nil, errors.New("device authorization failed: incomplete response")
+	}
+	return &authorization, nil
+}
+
+// Poll waits until the user approves or declines the authorization and returns the issued tokens.
+// It returns ErrAccessDenied when the user declines, and ErrExpired when the device code expires first.
+func (f *DeviceFlow) Poll(ctx context.Context, authorization *DeviceAuthorization) (*Token, error) {
+	if f.provider == nil {
+		return nil, errors.New("device flow not started")
+	}
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	var deadline time.Time
+	if authorization.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	}
+
+	form := url.Values{
+		"grant_type":  {grantDeviceCode},
+		"device_code": {authorization.DeviceCode},
+		"client_id":   {f.clientID},
+	}
+	for {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, ErrExpired
+		}
+		if err := f.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		token, err := requestToken(ctx, f.client, f.provider, f.clientID, form)
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			return token, err
+		}
+
+		switch oauthErr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownStep
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpired
+		default:
+			return nil, fmt.Errorf("device authorization failed: %w", err)
+		}
+	}
+}
+
+// requestToken sends a token request to the token endpoint of the provider
+func requestToken(
+	ctx context.Context, client *http.Client, provider *oidc.Provider, clientID string, form url.Values,
+) (*Token, error) {
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := postForm(ctx, client, provider.TokenEndpoint, form, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" || !strings.EqualFold(resp.TokenType, "Bearer") {
+		return nil, fmt.Errorf("unexpected token response of type %q", resp.TokenType)
+	}
+
+	token := &Token{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		IDToken:      resp.IDToken,
+		Issuer:       provider.Issuer,
+		ClientID:     clientID,
+	}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).UTC()
+	}
+	return token, nil
+}
+
+// postForm posts a form to the provider and decodes its JSON response into out.
+// Error responses are returned as *OAuthError.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr OAuthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response of %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc"
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+// newTestFlow creates a device flow against issuer that records the polling intervals instead of sleeping
+func newTestFlow(issuer *oidctest.Issuer, waits *[]time.Duration) *DeviceFlow {
+	flow := NewDeviceFlow(&DeviceFlowOptions{Issuer: issuer.URL, ClientID: "azhexgate-cli"})
+	flow.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	return flow
+}
+
+func TestDeviceFlow(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{Interval: 2})
+	defer issuer.Close()
+	issuer.SetPendingPolls(2)
+
+	var waits []time.Duration
+	flow := newTestFlow(issuer, &waits)
+
+	authorization, err := flow.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the device authorization to start, got %v", err)
+	}
+	if authorization.UserCode != oidctest.UserCode || authorization.VerificationURI != issuer.URL+"/activate" {
+		t.Errorf("Expected user code %s at %s/activate, got %s at %s", oidctest.UserCode, issuer.URL,
+			authorization.UserCode, authorization.VerificationURI)
+	}
+
+	token, err := flow.Poll(context.Background(), authorization)
+	if err != nil {
+		t.Fatalf("Expected the device authorization to be approved, got %v", err)
+	}
+	if token.AccessToken == "" || token.RefreshToken == "" || token.IDToken == "" {
+		t.Errorf("Expected access, refresh and ID tokens, got %+v", token)
+	}
+	if token.Issuer != issuer.URL || token.ClientID != "azhexgate-cli" {
+		t.Errorf("Expected the token to remember its issuer and client, got %s and %s", token.Issuer, token.ClientID)
+	}
+	if until := time.Until(token.Expiry); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("Expected the token to expire in an hour, got %v", until)
+	}
+	if len(waits) != 3 || waits[0] != 2*time.Second {
+		t.Errorf("Expected 3 polls 2s apart, got %v", waits)
+	}
+}
+
+func TestDeviceFlow_Denied(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	issuer.Deny()
+
+	var waits []time.Duration
+	flow := newTestFlow(issuer, &waits)
+	authorization, err := flow.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the device authorization to start, got %v", err)
+	}
+
+	if _, err := flow.Poll(context.Background(), authorization); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+}
+
+func TestDeviceFlow_SlowDownAndExpiry(t *testing.T) {
+	var polls int
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if polls == 1 {
+			_, _ = w.Write([]byte(`{"error": "slow_down"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"error": "expired_token"}`))
+	}))
+	defer provider.Close()
+
+	var waits []time.Duration
+	flow := NewDeviceFlow(&DeviceFlowOptions{ClientID: "azhexgate-cli"})
+	flow.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	flow.provider = &oidc.Provider{TokenEndpoint: provider.URL}
+
+	_, err := flow.Poll(context.Background(), &DeviceAuthorization{DeviceCode: "code", Interval: 1})
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if len(waits) != 2 || waits[1] != 6*time.Second {
+		t.Errorf("Expected the interval to grow by 5s after slow_down, got %v", waits)
+	}
+}
+
+func TestDeviceFlow_Cancelled(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	issuer.SetPendingPolls(100)
+
+	flow := NewDeviceFlow(&DeviceFlowOptions{Issuer: issuer.URL, ClientID: "azhexgate-cli"})
+	authorization, err := flow.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the device authorization to start, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := flow.Poll(ctx, authorization); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected polling to stop with the context, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc"
+)
+
+// refreshMargin is how long before expiry an access token is refreshed
+const refreshMargin = time.Minute
+
+// ErrNotLoggedIn is returned when no usable token is stored
+var ErrNotLoggedIn = errors.New("not logged in, run azhexgate login")
+
+// Token holds the tokens issued to the CLI and what is needed to refresh them
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	// Expiry is when the access token expires, zero when the provider did not say
+	Expiry time.Time `json:"expiry,omitzero"`
+
+	// Issuer and ClientID are the provider and client the tokens were issued by and for
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+}
+
+// expiresWithin reports whether the access token expires within d of now
+func (t *Token) expiresWithin(d time.Duration, now time.Time) bool {
+	return !t.Expiry.IsZero() && !now.Add(d).Before(t.Expiry)
+}
+
+// DefaultTokenFile returns where tokens are stored unless configured otherwise:
+// azhexgate/token.json in the user config directory
+func DefaultTokenFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azhexgate", "token.json"), nil
+}
+
+// LoadToken reads the token stored at path. It returns ErrNotLoggedIn when there is none.
+func LoadToken(path string) (*Token, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotLoggedIn
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("invalid token file %s: %w", path, err)
+	}
+	if token.AccessToken == "" {
+		return nil, ErrNotLoggedIn
+	}
+	return &token, nil
+}
+
+// SaveToken stores the token at path, readable by the current user only.
+// The file is replaced atomically, so a concurrent reader never sees a partial token.
+func SaveToken(path string, token *Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".token-*.json")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// CreateTemp already creates the file with mode 0600
+	return os.Rename(file.Name(), path)
+}
+
+// TokenSourceOptions contains configuration for the TokenSource
+type TokenSourceOptions struct {
+	// Path is the token file written by login
+	Path string
+
+	// HTTPClient sends refresh requests to the provider (optional, defaults to a client with a 30s timeout)
+	HTTPClient *http.Client
+}
+
+// TokenSource returns the stored access token, refreshing it shortly before it expires
+type TokenSource struct {
+	path   string
+	client *http.Client
+
+	mu       sync.Mutex
+	token    *Token
+	provider *oidc.Provider
+}
+
+// NewTokenSource loads the stored token. It returns ErrNotLoggedIn when there is none.
+func NewTokenSource(opts *TokenSourceOptions) (*TokenSource, error) {
+	if opts == nil {
+		opts = &TokenSourceOptions{}
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	token, err := LoadToken(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSource{path: opts.Path, client: client, token: token}, nil
+}
+
+// Token returns a current access token. Tokens about to expire are refreshed and stored again;
+// expired tokens that cannot be refreshed return ErrNotLoggedIn.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	return s.tokenAt(ctx, time.Now())
+}
+
+// tokenAt returns an access token still valid shortly after now
+func (s *TokenSource) tokenAt(ctx context.Context, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.token.expiresWithin(refreshMargin, now) {
+		return s.token.AccessToken, nil
+	}
+	if s.token.RefreshToken == "" {
+		if s.token.expiresWithin(0, now) {
+			return "", ErrNotLoggedIn
+		}
+		return s.token.AccessToken, nil
+	}
+
+	token, err := s.refresh(ctx)
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			return "", fmt.Errorf("%w: %w", ErrNotLoggedIn, err)
+		}
+		return "", fmt.Errorf("failed to refresh access token: %w", err)
+	}
+	s.token = token
+	if err := SaveToken(s.path, token); err != nil {
+		return "", fmt.Errorf("failed to store refreshed token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// refresh exchanges the refresh token for new tokens
+func (s *TokenSource) refresh(ctx context.Context) (*Token, error) {
+	if s.provider == nil {
+		provider, err := oidc.Discover(ctx, s.client, s.token.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		s.provider = provider
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.token.RefreshToken},
+		"client_id":     {s.token.ClientID},
+	}
+	token, err := requestToken(ctx, s.client, s.provider, s.token.ClientID, form)
+	if err != nil {
+		return nil, err
+	}
+	// Providers that do not rotate refresh tokens leave them out of the response
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+	if token.IDToken == "" {
+		token.IDToken = s.token.IDToken
+	}
+	return token, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+func TestSaveAndLoadToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "azhexgate", "token.json")
+	token := &Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh-0",
+		Expiry:       time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		Issuer:       "https://issuer.example.com",
+		ClientID:     "azhexgate-cli",
+	}
+
+	if err := SaveToken(path, token); err != nil {
+		t.Fatalf("Expected the token to be saved, got %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the token file to exist, got %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("Expected the token file to be private, got mode %o", mode)
+	}
+
+	loaded, err := LoadToken(path)
+	if err != nil {
+		t.Fatalf("Expected the token to load, got %v", err)
+	}
+	if *loaded != *token {
+		t.Errorf("Expected %+v, got %+v", token, loaded)
+	}
+}
+
+func TestLoadToken_Missing(t *testing.T) {
+	if _, err := LoadToken(filepath.Join(t.TempDir(), "token.json")); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+}
+
+func TestTokenSource_Refresh(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	now := time.Now()
+	stored := &Token{
+		AccessToken:  "old-access",
+		RefreshToken: "refresh-0",
+		Expiry:       now.Add(10 * time.Minute),
+		Issuer:       issuer.URL,
+		ClientID:     "azhexgate-cli",
+	}
+	if err := SaveToken(path, stored); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+
+	source, err := NewTokenSource(&TokenSourceOptions{Path: path})
+	if err != nil {
+		t.Fatalf("Expected the token source to load, got %v", err)
+	}
+
+	access, err := source.tokenAt(context.Background(), now)
+	if err != nil || access != "old-access" {
+		t.Errorf("Expected the stored token while it is fresh, got %q and %v", access, err)
+	}
+	if issuer.Refreshes() != 0 {
+		t.Errorf("Expected no refresh while the token is fresh, got %d", issuer.Refreshes())
+	}
+
+	access, err = source.tokenAt(context.Background(), now.Add(9*time.Minute+30*time.Second))
+	if err != nil || access == "old-access" {
+		t.Fatalf("Expected a refreshed token shortly before expiry, got %q and %v", access, err)
+	}
+	if issuer.Refreshes() != 1 {
+		t.Errorf("Expected a single refresh, got %d", issuer.Refreshes())
+	}
+
+	saved, err := LoadToken(path)
+	if err != nil || saved.AccessToken != access {
+		t.Errorf("Expected the refreshed token to be stored, got %+v and %v", saved, err)
+	}
+}
+
+func TestTokenSource_ExpiredWithoutRefreshToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := SaveToken(path, &Token{AccessToken: "access", Expiry: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+
+	source, err := NewTokenSource(&TokenSourceOptions{Path: path})
+	if err != nil {
+		t.Fatalf("Expected the token source to load, got %v", err)
+	}
+	if _, err := source.Token(context.Background()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn for an expired token, got %v", err)
+	}
+}
+
+func TestTokenSource_RevokedRefreshToken(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	stored := &Token{
+		AccessToken:  "access",
+		RefreshToken: "revoked",
+		Expiry:       time.Now(),
+		Issuer:       issuer.URL,
+		ClientID:     "azhexgate-cli",
+	}
+	if err := SaveToken(path, stored); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+
+	source, err := NewTokenSource(&TokenSourceOptions{Path: path})
+	if err != nil {
+		t.Fatalf("Expected the token source to load, got %v", err)
+	}
+	if _, err := source.Token(context.Background()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn for a rejected refresh token, got %v", err)
+	}
+}
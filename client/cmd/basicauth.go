@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+)
+
+// requestedBasicAuth returns the credentials given with --basic-auth user:pass, nil when the tunnel is open
+func requestedBasicAuth() (*api.BasicAuth, error) {
+	if basicAuthFlag == "" {
+		return nil, nil
+	}
+
+	username, password, ok := strings.Cut(basicAuthFlag, ":")
+	if !ok || username == "" || password == "" {
+		return nil, fmt.Errorf("invalid --basic-auth: expected user:pass")
+	}
+	return &api.BasicAuth{Username: username, Password: password}, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// expiryWarning is how long before the tunnel expires a warning is printed
+	expiryWarning = 5 * time.Minute
+
+	// expiryCheckInterval is how often the expiry of the current tunnel is checked
+	expiryCheckInterval = time.Second
+)
+
+// errTunnelExpired is returned once the tunnel outlived its TTL and the gateway stopped forwarding to it
+var errTunnelExpired = errors.New("tunnel expired")
+
+// watchExpiry prints a warning when the current tunnel is about to expire and returns errTunnelExpired
+// once it has. The expiry is read on every check since a replaced tunnel comes with its own.
+func watchExpiry(ctx context.Context, cmd *cobra.Command, tunnel *currentTunnel, warnBefore time.Duration) error {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	var warned time.Time
+	for {
+		expiresAt := tunnel.get().ExpiresAt
+		if !expiresAt.IsZero() {
+			remaining := time.Until(expiresAt)
+			if remaining <= 0 {
+				return fmt.Errorf("%w at %s", errTunnelExpired, formatExpiry(expiresAt))
+			}
+			if remaining <= warnBefore && !warned.Equal(expiresAt) {
+				warned = expiresAt
+				cmd.Println(fmt.Sprintf("Warning: tunnel expires in %s", remaining.Round(time.Second)))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatExpiry formats when a tunnel expires for display in local time
+func formatExpiry(expiresAt time.Time) string {
+	return expiresAt.Local().Format(time.RFC3339)
+}
+
+// ttlSeconds returns the TTL requested with --ttl in whole seconds, rounded up
+func ttlSeconds() int {
+	return int((ttlFlag + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/spf13/cobra"
+)
+
+func TestWatchExpiry(t *testing.T) {
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+
+	current := &currentTunnel{response: &api.TunnelResponse{ExpiresAt: time.Now().Add(1500 * time.Millisecond)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := watchExpiry(ctx, cmd, current, time.Minute)
+	if !errors.Is(err, errTunnelExpired) {
+		t.Fatalf("Expected errTunnelExpired, got %v", err)
+	}
+	if n := strings.Count(out.String(), "Warning: tunnel expires in"); n != 1 {
+		t.Errorf("Expected a single expiry warning, got %d in %q", n, out.String())
+	}
+}
+
+func TestWatchExpiryWithoutTTL(t *testing.T) {
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+
+	current := &currentTunnel{response: &api.TunnelResponse{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := watchExpiry(ctx, cmd, current, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the watch to run until cancelled, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output for a tunnel without expiry, got %q", out.String())
+	}
+}
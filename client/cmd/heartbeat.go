@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/gateway"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// defaultHeartbeatInterval is how often heartbeats are sent when the gateway does not advertise an interval
+const defaultHeartbeatInterval = 30 * time.Second
+
+// currentTunnel holds the tunnel the client serves; it is replaced when the relay session is resumed
+type currentTunnel struct {
+	mu       sync.Mutex
+	response *api.TunnelResponse
+}
+
+// get returns the current tunnel
+func (c *currentTunnel) get() *api.TunnelResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.response
+}
+
+// set replaces the current tunnel
+func (c *currentTunnel) set(response *api.TunnelResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.response = response
+}
+
+// sendHeartbeats reports the current tunnel alive at the interval advertised by the gateway until ctx
+// is cancelled. Failed heartbeats are retried on the next tick. Once the gateway no longer knows the
+// tunnel, i.e. it was released after missed heartbeats or revoked, resume re-establishes it.
+func sendHeartbeats(ctx context.Context, client *gateway.Client, tunnel *currentTunnel,
+	resume func(context.Context) error, log *logging.Logger) error {
+	for {
+		interval := time.Duration(tunnel.get().HeartbeatInterval) * time.Second
+		if interval <= 0 {
+			interval = defaultHeartbeatInterval
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		current := tunnel.get()
+		err := client.Heartbeat(ctx, current.TunnelID, current.SessionID)
+		switch {
+		case err == nil:
+			log.Debug("Heartbeat sent", logging.String("tunnel_id", current.TunnelID))
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, gateway.ErrTunnelNotFound):
+			log.Warn("Tunnel is no longer registered with the gateway, re-establishing it",
+				logging.String("tunnel_id", current.TunnelID))
+			if err := resume(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("Failed to re-establish tunnel", logging.String("tunnel_id", current.TunnelID),
+					logging.Error(err))
+			}
+		default:
+			log.Warn("Heartbeat failed", logging.String("tunnel_id", current.TunnelID), logging.Error(err))
+		}
+	}
+}
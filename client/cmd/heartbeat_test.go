@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/gateway"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+func TestSendHeartbeats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var heartbeats, renewed atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request api.HeartbeatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if r.Method != http.MethodPut {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		switch heartbeats.Add(1) {
+		case 1:
+			if r.URL.Path != "/api/tunnels/12345678/heartbeat" || request.SessionID != "session-1" {
+				t.Errorf("Expected a heartbeat for tunnel 12345678 and session-1, got %s %q", r.URL.Path, request.SessionID)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case 2:
+			// The gateway released the tunnel after the first heartbeat
+			http.Error(w, "Tunnel not found", http.StatusNotFound)
+		default:
+			if r.URL.Path != "/api/tunnels/87654321/heartbeat" || request.SessionID != "session-2" {
+				t.Errorf("Expected a heartbeat for the new tunnel, got %s %q", r.URL.Path, request.SessionID)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			cancel()
+		}
+	}))
+	defer server.Close()
+
+	client := gateway.NewClient(&gateway.Options{BaseURL: server.URL})
+	current := &currentTunnel{response: &api.TunnelResponse{
+		TunnelID:          "12345678",
+		SessionID:         "session-1",
+		HeartbeatInterval: 1,
+	}}
+	resume := func(context.Context) error {
+		renewed.Add(1)
+		current.set(&api.TunnelResponse{TunnelID: "87654321", SessionID: "session-2", HeartbeatInterval: 1})
+		return nil
+	}
+
+	err := sendHeartbeats(ctx, client, current, resume, logging.New(logging.ErrorLevel))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected heartbeats to continue until cancelled, got %v", err)
+	}
+	if renewed.Load() != 1 {
+		t.Errorf("Expected the tunnel to be re-established once, got %d", renewed.Load())
+	}
+	if heartbeats.Load() != 3 {
+		t.Errorf("Expected 3 heartbeats, got %d", heartbeats.Load())
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+	"github.com/julienstroheker/AzHexGate/client/tunnel"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// startInspector starts the local traffic inspector when --inspect is set, serving until ctx is done.
+// It returns the inspector the tunnel listener records to, or nil when inspection is disabled.
+func startInspector(ctx context.Context, cmd *cobra.Command, mode tunnel.Mode,
+	log *logging.Logger) (*inspector.Inspector, error) {
+	if inspectFlag == "" {
+		return nil, nil
+	}
+	if mode != tunnel.ModeHTTP {
+		return nil, fmt.Errorf("--inspect requires --mode %s", tunnel.ModeHTTP)
+	}
+
+	// Replays go to the same local server as the tunnel traffic
+	recorder := inspector.New(&inspector.Options{
+		Target:       fmt.Sprintf("localhost:%d", portFlag),
+		PreserveHost: preserveHostFlag,
+	})
+	server := inspector.NewServer(&inspector.ServerOptions{
+		Addr:      inspectFlag,
+		Inspector: recorder,
+		Logger:    log,
+	})
+	addr, err := server.Listen(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start inspector: %w", err)
+	}
+
+	cmd.Println(fmt.Sprintf("Inspector: http://%s", addr))
+	return recorder, nil
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/spf13/cobra"
+)
+
+// printIPFilter prints the client IP ranges the gateway admits to and refuses from the tunnel
+func printIPFilter(cmd *cobra.Command, tunnel *api.TunnelResponse) {
+	if len(tunnel.AllowCIDRs) > 0 {
+		cmd.Println(fmt.Sprintf("Allowed client IPs: %s", strings.Join(tunnel.AllowCIDRs, ", ")))
+	}
+	if len(tunnel.DenyCIDRs) > 0 {
+		cmd.Println(fmt.Sprintf("Denied client IPs: %s", strings.Join(tunnel.DenyCIDRs, ", ")))
+	}
+}
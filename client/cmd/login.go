@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/auth"
+	"github.com/julienstroheker/AzHexGate/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	issuerFlag   string
+	clientIDFlag string
+	scopeFlag    string
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Sign in to the gateway identity provider",
+	Long: `Sign in to the OpenID Connect provider of a gateway started with --auth-mode oidc,
+using the device authorization flow: open the printed URL on any device and enter the code.
+The tokens are stored for later commands and refreshed before they expire.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		cfg := config.Load()
+		issuer, clientID := issuerFlag, clientIDFlag
+		if issuer == "" {
+			issuer = cfg.OIDCIssuer
+		}
+		if clientID == "" {
+			clientID = cfg.OIDCClientID
+		}
+		if issuer == "" || clientID == "" {
+			return errors.New("login requires --issuer and --client-id " +
+				"(or AZHEXGATE_OIDC_ISSUER and AZHEXGATE_OIDC_CLIENT_ID)")
+		}
+
+		path, err := GetTokenFile()
+		if err != nil {
+			return fmt.Errorf("failed to locate token file: %w", err)
+		}
+
+		flow := auth.NewDeviceFlow(&auth.DeviceFlowOptions{Issuer: issuer, ClientID: clientID, Scope: scopeFlag})
+		token, err := login(ctx, cmd, flow)
+		if err != nil {
+			return err
+		}
+		if err := auth.SaveToken(path, token); err != nil {
+			return fmt.Errorf("failed to store token: %w", err)
+		}
+
+		cmd.Println(fmt.Sprintf("Logged in to %s", issuer))
+		cmd.Println(fmt.Sprintf("Token stored in %s", path))
+		if !token.Expiry.IsZero() {
+			cmd.Println(fmt.Sprintf("Access token expires at: %s (in %s)", formatExpiry(token.Expiry),
+				time.Until(token.Expiry).Round(time.Second)))
+		}
+		return nil
+	},
+}
+
+// login runs the device flow, asking the user to approve the sign-in on the verification page
+func login(ctx context.Context, cmd *cobra.Command, flow *auth.DeviceFlow) (*auth.Token, error) {
+	authorization, err := flow.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start login: %w", err)
+	}
+
+	cmd.Println(fmt.Sprintf("To sign in, open %s and enter the code %s", authorization.VerificationURI,
+		authorization.UserCode))
+	if authorization.VerificationURIComplete != "" {
+		cmd.Println(fmt.Sprintf("Or open %s", authorization.VerificationURIComplete))
+	}
+	cmd.Println("Waiting for approval...")
+
+	token, err := flow.Poll(ctx, authorization)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	return token, nil
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().StringVar(&issuerFlag, "issuer", "",
+		"OpenID Connect issuer URL (defaults to AZHEXGATE_OIDC_ISSUER)")
+	loginCmd.Flags().StringVar(&clientIDFlag, "client-id", "",
+		"Client ID of the CLI at the issuer (defaults to AZHEXGATE_OIDC_CLIENT_ID)")
+	loginCmd.Flags().StringVar(&scopeFlag, "scope", auth.DefaultScope, "Scope to request")
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/auth"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+// runLoginCommand runs the login command with args
+func runLoginCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	rootCmd.SetArgs(append([]string{"login"}, args...))
+	loginCmd.SetContext(context.Background())
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	err := rootCmd.Execute()
+
+	// Reset flags for other tests
+	rootCmd.SetArgs(nil)
+	issuerFlag, clientIDFlag, scopeFlag = "", "", auth.DefaultScope
+
+	return buf.String(), err
+}
+
+func TestLoginCommand(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{Subject: "alice"})
+	defer issuer.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	t.Setenv("AZHEXGATE_TOKEN_FILE", path)
+	t.Setenv("AZHEXGATE_API_KEY", "")
+
+	output, err := runLoginCommand(t, "--issuer", issuer.URL, "--client-id", "azhexgate-cli")
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+	for _, want := range []string{
+		"open " + issuer.URL + "/activate and enter the code " + oidctest.UserCode,
+		"Logged in to " + issuer.URL,
+		"Token stored in " + path,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+
+	token, err := auth.LoadToken(path)
+	if err != nil {
+		t.Fatalf("Expected the token to be stored, got %v", err)
+	}
+
+	// Later commands send the stored access token to the gateway
+	var authorization string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.TunnelResponse{PublicURL: "https://mock123.azhexgate.com"})
+	}))
+	defer mockServer.Close()
+
+	_, _ = runStartCommandWithTimeout(t, []string{"start", "--api-url", mockServer.URL}, 300*time.Millisecond)
+	if authorization != "Bearer "+token.AccessToken {
+		t.Errorf("Expected the stored access token to be sent, got %q", authorization)
+	}
+}
+
+func TestLoginCommandDenied(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	issuer.Deny()
+	t.Setenv("AZHEXGATE_TOKEN_FILE", filepath.Join(t.TempDir(), "token.json"))
+
+	_, err := runLoginCommand(t, "--issuer", issuer.URL, "--client-id", "azhexgate-cli")
+	if err == nil || !strings.Contains(err.Error(), "authorization denied") {
+		t.Errorf("Expected login to fail when denied, got %v", err)
+	}
+}
+
+func TestLoginCommandRequiresIssuer(t *testing.T) {
+	t.Setenv("AZHEXGATE_OIDC_ISSUER", "")
+	t.Setenv("AZHEXGATE_OIDC_CLIENT_ID", "")
+
+	_, err := runLoginCommand(t, "--client-id", "azhexgate-cli")
+	if err == nil || !strings.Contains(err.Error(), "--issuer") {
+		t.Errorf("Expected an error naming --issuer, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/gateway"
+)
+
+// explainQuota describes a quota the gateway enforced and what the user can do about it
+func explainQuota(err *gateway.QuotaError) string {
+	switch err.Quota {
+	case "max_tunnels":
+		return fmt.Sprintf("Your API key already has %d of its %d allowed tunnels open. "+
+			"Stop one of them, or ask the gateway operator to raise the limit.", err.Current, err.Limit)
+	case "creations_per_hour":
+		return fmt.Sprintf("Your API key created %d of its %d allowed tunnels in the last hour. "+
+			"Try again in %s.", err.Current, err.Limit, err.RetryAfter.Round(time.Second))
+	default:
+		return fmt.Sprintf("Your API key exceeded its %s quota (%d of %d).", err.Quota, err.Current, err.Limit)
+	}
+}
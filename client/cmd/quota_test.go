@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/client/gateway"
+)
+
+func TestExplainQuota(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *gateway.QuotaError
+		want string
+	}{
+		{
+			name: "concurrent tunnels",
+			err:  &gateway.QuotaError{Quota: "max_tunnels", Limit: 3, Current: 3},
+			want: "already has 3 of its 3 allowed tunnels open",
+		},
+		{
+			name: "creation rate",
+			err:  &gateway.QuotaError{Quota: "creations_per_hour", Limit: 10, Current: 10, RetryAfter: 90 * time.Second},
+			want: "Try again in 1m30s",
+		},
+		{
+			name: "unknown quota",
+			err:  &gateway.QuotaError{Quota: "bandwidth", Limit: 1, Current: 2},
+			want: "exceeded its bandwidth quota (2 of 1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := explainQuota(tt.err); !strings.Contains(got, tt.want) {
+				t.Errorf("Expected explanation to contain %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+)
+
+// requestedRateLimit returns the rate limit asked for with the --rate-* flags, nil to use the gateway default
+func requestedRateLimit() *api.RateLimit {
+	if rateLimitFlag == 0 && rateBurstFlag == 0 && !rateLimitPerIPFlag {
+		return nil
+	}
+	return &api.RateLimit{
+		RequestsPerSecond: rateLimitFlag,
+		Burst:             rateBurstFlag,
+		PerIP:             rateLimitPerIPFlag,
+	}
+}
+
+// describeRateLimit formats the rate limit the gateway enforces on the tunnel
+func describeRateLimit(limit *api.RateLimit) string {
+	scope := "for the whole tunnel"
+	if limit.PerIP {
+		scope = "per client IP"
+	}
+	return fmt.Sprintf("%g requests/s, bursts of %d, %s", limit.RequestsPerSecond, limit.Burst, scope)
+}
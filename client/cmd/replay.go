@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectorAddrFlag   string
+	replayHeaderFlags   []string
+	replayRemoveHeaders []string
+	replayBodyFlag      string
+	replayBodyFileFlag  string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <request-id>",
+	Short: "Replay a request recorded by the inspector against the local app",
+	Long: `Replay a request recorded by the inspector of a running "azhexgate start --inspect"
+against the local app, optionally editing its headers and body first, and show how the
+response differs from the original one`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		client := inspector.NewClient(&inspector.ClientOptions{Addr: inspectorAddrFlag, Logger: GetLogger()})
+		edits, err := replayEdits(ctx, cmd, client, args[0])
+		if err != nil {
+			return err
+		}
+
+		result, err := client.Replay(ctx, args[0], edits)
+		if err != nil {
+			if errors.Is(err, inspector.ErrNotFound) {
+				return fmt.Errorf("request %s not found in the inspector", args[0])
+			}
+			return fmt.Errorf("failed to replay request %s: %w", args[0], err)
+		}
+
+		printReplay(cmd, args[0], result)
+		if result.Exchange.Error != "" {
+			return fmt.Errorf("replay failed: %s", result.Exchange.Error)
+		}
+		return nil
+	},
+}
+
+// replayEdits builds the edits requested by the flags, fetching the recorded request when its headers change
+func replayEdits(ctx context.Context, cmd *cobra.Command, client *inspector.Client,
+	id string) (*inspector.ReplayRequest, error) {
+	edits := &inspector.ReplayRequest{}
+
+	set := make(http.Header)
+	for _, field := range replayHeaderFlags {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --header %q (expected \"Name: value\")", field)
+		}
+		set.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	if len(set) > 0 || len(replayRemoveHeaders) > 0 {
+		recorded, err := client.Get(ctx, id)
+		if errors.Is(err, inspector.ErrNotFound) {
+			return nil, fmt.Errorf("request %s not found in the inspector", id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get request %s: %w", id, err)
+		}
+
+		header := recorded.Request.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		for _, name := range replayRemoveHeaders {
+			header.Del(name)
+		}
+		for name, values := range set {
+			header[name] = values
+		}
+		edits.Header = header
+	}
+
+	bodySet, bodyFileSet := cmd.Flags().Changed("body"), cmd.Flags().Changed("body-file")
+	switch {
+	case bodySet && bodyFileSet:
+		return nil, errors.New("--body and --body-file cannot be used together")
+	case bodySet:
+		body := inspector.NewBody([]byte(replayBodyFlag))
+		edits.Body = &body
+	case bodyFileSet:
+		data, err := os.ReadFile(replayBodyFileFlag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --body-file: %w", err)
+		}
+		body := inspector.NewBody(data)
+		edits.Body = &body
+	}
+	return edits, nil
+}
+
+// printReplay prints the outcome of a replay and how its response differs from the original one
+func printReplay(cmd *cobra.Command, id string, result *inspector.ReplayResponse) {
+	exchange := result.Exchange
+	status := "no response"
+	if exchange.Response != nil {
+		status = fmt.Sprintf("%d %s", exchange.Response.Status, http.StatusText(exchange.Response.Status))
+	}
+	cmd.Println(fmt.Sprintf("Replayed request %s as %s: %s %s -> %s (%.1f ms)",
+		id, exchange.ID, exchange.Request.Method, exchange.Request.URL, status, exchange.DurationMs))
+
+	if result.Diff == "" {
+		cmd.Println("Response unchanged")
+		return
+	}
+	cmd.Println("Response diff (- original, + replay):")
+	cmd.Println(result.Diff)
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().StringVar(&inspectorAddrFlag, "inspector", inspector.DefaultAddr,
+		"Address of the inspector of the running tunnel")
+	replayCmd.Flags().StringArrayVarP(&replayHeaderFlags, "header", "H", nil,
+		"Set a header before replaying, as \"Name: value\" (repeatable)")
+	replayCmd.Flags().StringArrayVar(&replayRemoveHeaders, "remove-header", nil,
+		"Remove a header before replaying (repeatable)")
+	replayCmd.Flags().StringVar(&replayBodyFlag, "body", "", "Replace the request body")
+	replayCmd.Flags().StringVar(&replayBodyFileFlag, "body-file", "", "Replace the request body with a file's content")
+}
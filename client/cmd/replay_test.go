@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+)
+
+// runReplayCommand runs the replay command against the inspector served by server
+func runReplayCommand(t *testing.T, server *httptest.Server, args ...string) (string, error) {
+	t.Helper()
+
+	args = append([]string{"replay", "--inspector", strings.TrimPrefix(server.URL, "http://")}, args...)
+	rootCmd.SetArgs(args)
+	replayCmd.SetContext(context.Background())
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	err := rootCmd.Execute()
+
+	// Reset flags for other tests
+	rootCmd.SetArgs(nil)
+	inspectorAddrFlag = inspector.DefaultAddr
+	replayHeaderFlags, replayRemoveHeaders = nil, nil
+	replayBodyFlag, replayBodyFileFlag = "", ""
+	for _, name := range []string{"header", "remove-header", "body", "body-file"} {
+		replayCmd.Flags().Lookup(name).Changed = false
+	}
+
+	return buf.String(), err
+}
+
+func TestReplayCommand(t *testing.T) {
+	var gotSignature, gotTrace, gotBody string
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotSignature, gotTrace, gotBody = r.Header.Get("X-Signature"), r.Header.Get("X-Trace"), string(body)
+		_, _ = w.Write([]byte("accepted"))
+	}))
+	defer localServer.Close()
+
+	recorder := inspector.New(&inspector.Options{Target: strings.TrimPrefix(localServer.URL, "http://")})
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("event"))
+	req.Header.Set("X-Trace", "1")
+	capture := recorder.Capture(req)
+	resp := &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("failed")),
+	}
+	capture.Response(resp)
+	_, _ = io.ReadAll(resp.Body)
+	capture.Finish(nil)
+	id := recorder.List()[0].ID
+
+	inspectorServer := httptest.NewServer(inspector.NewServer(&inspector.ServerOptions{Inspector: recorder}).Handler())
+	defer inspectorServer.Close()
+
+	output, err := runReplayCommand(t, inspectorServer, id, "-H", "X-Signature: sha256=new",
+		"--remove-header", "X-Trace", "--body", "edited")
+	if err != nil {
+		t.Fatalf("Expected replay to succeed, got %v: %s", err, output)
+	}
+
+	if gotSignature != "sha256=new" || gotTrace != "" || gotBody != "edited" {
+		t.Errorf("Expected the edited request to reach the local app, got X-Signature %q, X-Trace %q, body %q",
+			gotSignature, gotTrace, gotBody)
+	}
+	for _, want := range []string{"Replayed request " + id + " as ", "-> 200 OK", "-failed", "+accepted"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestReplayCommandErrors(t *testing.T) {
+	inspectorServer := httptest.NewServer(inspector.NewServer(nil).Handler())
+	defer inspectorServer.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown request", args: []string{"42"}, wantErr: "request 42 not found"},
+		{name: "conflicting bodies", args: []string{"42", "--body", "x", "--body-file", "f"},
+			wantErr: "--body and --body-file cannot be used together"},
+		{name: "invalid header", args: []string{"42", "-H", "X-Signature"}, wantErr: "invalid --header"},
+		{name: "missing id", args: nil, wantErr: "accepts 1 arg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runReplayCommand(t, inspectorServer, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
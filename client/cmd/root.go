@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/julienstroheker/AzHexGate/client/auth"
+	"github.com/julienstroheker/AzHexGate/internal/config"
+	"github.com/julienstroheker/AzHexGate/internal/httpclient"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 	"github.com/spf13/cobra"
 )
@@ -11,6 +15,7 @@ import (
 var (
 	logger      *logging.Logger
 	verboseFlag bool
+	apiKeyFlag  string
 )
 
 var rootCmd = &cobra.Command{
@@ -35,6 +40,8 @@ func init() {
 
 	// Add persistent flags
 	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "Enable verbose logging (debug level)")
+	rootCmd.PersistentFlags().StringVar(&apiKeyFlag, "api-key", "",
+		"Gateway API key (defaults to AZHEXGATE_API_KEY)")
 }
 
 // Execute runs the root command
@@ -49,3 +56,36 @@ func Execute() {
 func GetLogger() *logging.Logger {
 	return logger
 }
+
+// GetAPIKey returns the Gateway API key from the --api-key flag or AZHEXGATE_API_KEY
+func GetAPIKey() string {
+	if apiKeyFlag != "" {
+		return apiKeyFlag
+	}
+	return config.Load().APIKey
+}
+
+// GetTokenFile returns where login stores tokens, from AZHEXGATE_TOKEN_FILE or the user config directory
+func GetTokenFile() (string, error) {
+	if path := config.Load().TokenFile; path != "" {
+		return path, nil
+	}
+	return auth.DefaultTokenFile()
+}
+
+// GetTokenSource returns the access tokens stored by login, or nil when not logged in
+func GetTokenSource() (httpclient.TokenSource, error) {
+	path, err := GetTokenFile()
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := auth.NewTokenSource(&auth.TokenSourceOptions{Path: path})
+	if errors.Is(err, auth.ErrNotLoggedIn) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return source.Token, nil
+}
@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/julienstroheker/AzHexGate/client/gateway"
+	"github.com/julienstroheker/AzHexGate/client/inspector"
 	"github.com/julienstroheker/AzHexGate/client/tunnel"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 	"github.com/julienstroheker/AzHexGate/internal/relay"
@@ -22,6 +25,23 @@ const (
 var (
 	portFlag   int
 	apiURLFlag string
+	nameFlag   string
+
+	modeFlag         string
+	preserveHostFlag bool
+	multiplexFlag    bool
+
+	ttlFlag time.Duration
+
+	rateLimitFlag      float64
+	rateBurstFlag      int
+	rateLimitPerIPFlag bool
+
+	inspectFlag string
+
+	basicAuthFlag string
+	allowCIDRFlag []string
+	denyCIDRFlag  []string
 )
 
 var startCmd = &cobra.Command{
@@ -32,6 +52,21 @@ var startCmd = &cobra.Command{
 		log := GetLogger()
 		log.Info("Starting tunnel", logging.Int("port", portFlag))
 
+		mode, err := tunnel.ParseMode(modeFlag)
+		if err != nil {
+			return err
+		}
+		if ttlFlag < 0 {
+			return fmt.Errorf("invalid --ttl %s", ttlFlag)
+		}
+		if rateLimitFlag < 0 || rateBurstFlag < 0 {
+			return fmt.Errorf("invalid rate limit: --rate-limit and --rate-burst must not be negative")
+		}
+		basicAuth, err := requestedBasicAuth()
+		if err != nil {
+			return err
+		}
+
 		// Get context from command (supports timeout in tests)
 		ctx := cmd.Context()
 		if ctx == nil {
@@ -40,15 +75,34 @@ var startCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
+		recorder, err := startInspector(ctx, cmd, mode, log)
+		if err != nil {
+			return err
+		}
+
 		// Create Gateway API client with only overrides
-		gatewayClient := gateway.NewClient(&gateway.Options{
-			BaseURL: apiURLFlag,
-			Logger:  log,
-		})
+		gatewayClient, err := newGatewayClient(log)
+		if err != nil {
+			return err
+		}
 
 		// Call Gateway API to create tunnel with context
-		tunnelResp, err := gatewayClient.CreateTunnel(ctx, portFlag)
+		request := gateway.CreateTunnelRequest{
+			LocalPort:  portFlag,
+			Name:       nameFlag,
+			Multiplex:  multiplexFlag,
+			TTL:        ttlSeconds(),
+			RateLimit:  requestedRateLimit(),
+			BasicAuth:  basicAuth,
+			AllowCIDRs: allowCIDRFlag,
+			DenyCIDRs:  denyCIDRFlag,
+		}
+		tunnelResp, err := gatewayClient.CreateTunnel(ctx, &request)
 		if err != nil {
+			var quotaErr *gateway.QuotaError
+			if errors.As(err, &quotaErr) {
+				cmd.Println(explainQuota(quotaErr))
+			}
 			return fmt.Errorf("failed to create tunnel: %w", err)
 		}
 
@@ -56,32 +110,63 @@ var startCmd = &cobra.Command{
 		cmd.Println("Tunnel established")
 		cmd.Println(fmt.Sprintf("Public URL: %s", tunnelResp.PublicURL))
 		cmd.Println(fmt.Sprintf("Forwarding to: http://localhost:%d", portFlag))
+		if !tunnelResp.ExpiresAt.IsZero() {
+			cmd.Println(fmt.Sprintf("Expires at: %s (in %s)", formatExpiry(tunnelResp.ExpiresAt),
+				time.Until(tunnelResp.ExpiresAt).Round(time.Second)))
+		}
+		if tunnelResp.RateLimit != nil {
+			cmd.Println(fmt.Sprintf("Rate limit: %s", describeRateLimit(tunnelResp.RateLimit)))
+		}
+		if tunnelResp.BasicAuth && basicAuth != nil {
+			cmd.Println(fmt.Sprintf("Basic auth: enabled for user %s", basicAuth.Username))
+		}
+		printIPFilter(cmd, tunnelResp)
 
 		log.Info("Tunnel created, preparing to start listener",
 			logging.String("public_url", tunnelResp.PublicURL),
-			logging.String("session_id", tunnelResp.SessionID))
+			logging.String("session_id", tunnelResp.SessionID),
+			logging.Bool("multiplex", tunnelResp.Multiplex))
 
-		// TODO: In production, create Azure Relay listener using tunnelResp.RelayEndpoint,
-		// tunnelResp.HybridConnectionName, and tunnelResp.ListenerToken
-		// For now, create an in-memory relay listener for testing
-		relayListener := relay.NewMemoryListener()
+		// Create Azure Relay listener for the hybrid connection assigned to this tunnel
+		relayListener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+			Endpoint:             tunnelResp.RelayEndpoint,
+			HybridConnectionName: tunnelResp.HybridConnectionName,
+			Token:                tunnelResp.ListenerToken,
+		})
 		defer func() { _ = relayListener.Close() }()
 
-		// Create tunnel listener
+		// Create tunnel listener, resuming the same tunnel when the relay session is lost
+		current := &currentTunnel{response: tunnelResp}
 		localAddr := fmt.Sprintf("localhost:%d", portFlag)
 		tunnelListener := tunnel.NewListener(&tunnel.Options{
-			Relay:     relayListener,
-			LocalAddr: localAddr,
+			Relay:        relayListener,
+			LocalAddr:    localAddr,
+			Mode:         mode,
+			PreserveHost: preserveHostFlag,
+			Multiplex:    tunnelResp.Multiplex,
+			Inspector:    recorder,
+			Reconnect:    reconnect(cmd, gatewayClient, current, request),
 		})
 		defer func() { _ = tunnelListener.Close() }()
 
-		// Start the listener loop in a goroutine
-		errChan := make(chan error, 1)
+		// Start the listener loop, the heartbeats and the expiry watch in goroutines
+		errChan := make(chan error, 3)
 		go func() {
 			if err := tunnelListener.Start(ctx, log); err != nil && err != context.Canceled {
 				errChan <- err
 			}
 		}()
+		go func() {
+			err := sendHeartbeats(ctx, gatewayClient, current, tunnelListener.Resume, log)
+			if err != nil && err != context.Canceled {
+				errChan <- err
+			}
+		}()
+		go func() {
+			if err := watchExpiry(ctx, cmd, current, expiryWarning); err != nil && err != context.Canceled {
+				errChan <- err
+			}
+		}()
 
 		log.Info("Listener loop started, waiting for connections...")
 
@@ -98,7 +183,12 @@ var startCmd = &cobra.Command{
 			log.Info("Received interrupt signal, shutting down...")
 			cancel()
 		case err := <-errChan:
-			log.Error("Listener error", logging.Error(err))
+			if errors.Is(err, errTunnelExpired) {
+				cmd.Println(fmt.Sprintf("Tunnel closed: %v", err))
+				cancel()
+				break
+			}
+			log.Error("Tunnel error", logging.Error(err))
 			cancel()
 			return err
 		}
@@ -108,8 +198,73 @@ var startCmd = &cobra.Command{
 	},
 }
 
+// newGatewayClient creates the Gateway API client for --api-url. It authenticates with the API key when one is
+// set, and otherwise with the access tokens stored by login, if any.
+func newGatewayClient(log *logging.Logger) (*gateway.Client, error) {
+	opts := &gateway.Options{BaseURL: apiURLFlag, APIKey: GetAPIKey(), Logger: log}
+	if opts.APIKey == "" {
+		tokens, err := GetTokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load access token: %w", err)
+		}
+		opts.TokenSource = tokens
+	}
+	return gateway.NewClient(opts), nil
+}
+
+// reconnect returns a function resuming the current tunnel with a fresh listener token.
+// When the gateway no longer knows the tunnel, it hands out a new one created from the same request,
+// and its URL is printed.
+func reconnect(
+	cmd *cobra.Command, client *gateway.Client, current *currentTunnel, request gateway.CreateTunnelRequest,
+) func(context.Context) (relay.Listener, error) {
+	return func(ctx context.Context) (relay.Listener, error) {
+		previous := current.get()
+		request.TunnelID = previous.TunnelID
+		request.SessionID = previous.SessionID
+		resumed, err := client.CreateTunnel(ctx, &request)
+		if err != nil {
+			return nil, err
+		}
+		if resumed.PublicURL != previous.PublicURL {
+			cmd.Println(fmt.Sprintf("Tunnel re-established with a new Public URL: %s", resumed.PublicURL))
+		}
+		current.set(resumed)
+
+		return relay.NewHybridConnectionListener(&relay.ListenerOptions{
+			Endpoint:             resumed.RelayEndpoint,
+			HybridConnectionName: resumed.HybridConnectionName,
+			Token:                resumed.ListenerToken,
+		}), nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(startCmd)
 	startCmd.Flags().IntVarP(&portFlag, "port", "p", defaultPort, "Local port to forward traffic to")
 	startCmd.Flags().StringVar(&apiURLFlag, "api-url", defaultAPIURL, "Gateway API base URL")
+	startCmd.Flags().StringVar(&nameFlag, "name", "", "Optional prefix for the generated subdomain")
+	startCmd.Flags().StringVar(&modeFlag, "mode", tunnel.ModeHTTP.String(),
+		"Forwarding mode: http parses requests and rewrites Host, raw copies bytes unchanged")
+	startCmd.Flags().BoolVar(&preserveHostFlag, "preserve-host", false,
+		"Keep the public Host header instead of rewriting it to localhost in http mode")
+	startCmd.Flags().BoolVar(&multiplexFlag, "multiplex", false,
+		"Carry all public connections over a single relay connection when the gateway supports it")
+	startCmd.Flags().DurationVar(&ttlFlag, "ttl", 0,
+		"Requested tunnel lifetime, e.g. 2h, capped by the gateway maximum (0 requests the maximum)")
+	startCmd.Flags().Float64Var(&rateLimitFlag, "rate-limit", 0,
+		"Requests per second the gateway lets through to the tunnel, capped by its ceiling (0 uses its default)")
+	startCmd.Flags().IntVar(&rateBurstFlag, "rate-burst", 0,
+		"Requests allowed at once above the rate limit (0 uses the gateway default)")
+	startCmd.Flags().BoolVar(&rateLimitPerIPFlag, "rate-limit-per-ip", false,
+		"Apply the rate limit to each client IP separately instead of the whole tunnel")
+	startCmd.Flags().StringVar(&inspectFlag, "inspect", "",
+		"Record forwarded requests and serve them on a local inspector web page at this address (http mode only)")
+	startCmd.Flags().Lookup("inspect").NoOptDefVal = inspector.DefaultAddr
+	startCmd.Flags().StringVar(&basicAuthFlag, "basic-auth", "",
+		"Require HTTP Basic authentication with these user:pass credentials on the public URL")
+	startCmd.Flags().StringSliceVar(&allowCIDRFlag, "allow-cidr", nil,
+		"Only let client IPs in these CIDR ranges or addresses reach the tunnel (repeatable, comma-separated)")
+	startCmd.Flags().StringSliceVar(&denyCIDRFlag, "deny-cidr", nil,
+		"Refuse client IPs in these CIDR ranges or addresses, even when allowed (repeatable, comma-separated)")
 }
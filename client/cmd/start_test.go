@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -22,6 +23,9 @@ func runStartCommandWithTimeout(t *testing.T, args []string, timeout time.Durati
 
 	rootCmd.SetArgs(args)
 
+	// Cobra keeps the first context on subcommands, so give each run its own
+	startCmd.SetContext(ctx)
+
 	buf := new(bytes.Buffer)
 	rootCmd.SetOut(buf)
 	rootCmd.SetErr(buf)
@@ -248,3 +252,247 @@ func TestRootCommandHelp(t *testing.T) {
 	// Reset for next test
 	rootCmd.SetArgs(nil)
 }
+
+func TestStartCommandNameFlag(t *testing.T) {
+	// Create mock API server that records the tunnel request
+	var request api.CreateTunnelRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		response := api.TunnelResponse{
+			PublicURL:            "https://myapp-12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-myapp-12345678",
+			ListenerToken:        "name-token",
+			SessionID:            "name-session",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--name", "myapp", "--api-url", mockServer.URL}
+	_, _ = runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	if request.Name != "myapp" {
+		t.Errorf("Expected name 'myapp' to be sent to the API, got '%s'", request.Name)
+	}
+	if request.LocalPort != 3000 {
+		t.Errorf("Expected local_port 3000 to be sent to the API, got %d", request.LocalPort)
+	}
+
+	// Reset name flag for other tests
+	nameFlag = ""
+}
+
+func TestStartCommandTTLFlag(t *testing.T) {
+	// Create mock API server that records the tunnel request and grants an expiry
+	var request api.CreateTunnelRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		response := api.TunnelResponse{
+			PublicURL:            "https://12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-12345678",
+			ListenerToken:        "ttl-token",
+			SessionID:            "ttl-session",
+			ExpiresAt:            time.Now().Add(90 * time.Minute),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--ttl", "90m", "--api-url", mockServer.URL}
+	output, _ := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	if request.TTL != 5400 {
+		t.Errorf("Expected ttl 5400 to be sent to the API, got %d", request.TTL)
+	}
+	if !strings.Contains(output, "Expires at:") {
+		t.Errorf("Expected output to contain the expiry, got: %s", output)
+	}
+
+	// Reset ttl flag for other tests
+	ttlFlag = 0
+}
+
+func TestStartCommandRateLimitFlags(t *testing.T) {
+	// Create mock API server that records the tunnel request and echoes the granted limit
+	var request api.CreateTunnelRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		response := api.TunnelResponse{
+			PublicURL:            "https://12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-12345678",
+			ListenerToken:        "rate-token",
+			SessionID:            "rate-session",
+			RateLimit:            &api.RateLimit{RequestsPerSecond: 5, Burst: 10, PerIP: true},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--rate-limit", "5", "--rate-burst", "10", "--rate-limit-per-ip",
+		"--api-url", mockServer.URL}
+	output, _ := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	want := api.RateLimit{RequestsPerSecond: 5, Burst: 10, PerIP: true}
+	if request.RateLimit == nil || *request.RateLimit != want {
+		t.Errorf("Expected rate limit %+v to be sent to the API, got %+v", want, request.RateLimit)
+	}
+	if !strings.Contains(output, "Rate limit: 5 requests/s, bursts of 10, per client IP") {
+		t.Errorf("Expected output to contain the rate limit, got: %s", output)
+	}
+
+	// Reset rate limit flags for other tests
+	rateLimitFlag = 0
+	rateBurstFlag = 0
+	rateLimitPerIPFlag = false
+}
+
+func TestStartCommandInvalidMode(t *testing.T) {
+	args := []string{"start", "--port", "3000", "--mode", "udp"}
+	_, err := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	if err == nil || !strings.Contains(err.Error(), "unknown forwarding mode") {
+		t.Errorf("Expected an unknown forwarding mode error, got %v", err)
+	}
+
+	// Reset mode flag for other tests
+	modeFlag = "http"
+}
+
+func TestStartCommandInspectFlag(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.TunnelResponse{
+			PublicURL:            "https://12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-12345678",
+			ListenerToken:        "inspect-token",
+			SessionID:            "inspect-session",
+		})
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--inspect=127.0.0.1:0", "--api-url", mockServer.URL}
+	output, _ := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	if !strings.Contains(output, "Inspector: http://127.0.0.1:") {
+		t.Errorf("Expected output to contain the inspector address, got: %s", output)
+	}
+
+	// Reset inspect flag for other tests
+	inspectFlag = ""
+}
+
+func TestStartCommandInspectRequiresHTTPMode(t *testing.T) {
+	args := []string{"start", "--port", "3000", "--mode", "raw", "--inspect"}
+	_, err := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	if err == nil || !strings.Contains(err.Error(), "--inspect requires --mode http") {
+		t.Errorf("Expected the inspector to require http mode, got %v", err)
+	}
+
+	// Reset flags for other tests
+	inspectFlag = ""
+	modeFlag = "http"
+}
+
+func TestStartCommandBasicAuthFlag(t *testing.T) {
+	var request api.CreateTunnelRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.TunnelResponse{
+			PublicURL:            "https://12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-12345678",
+			ListenerToken:        "auth-token",
+			SessionID:            "auth-session",
+			BasicAuth:            true,
+		})
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--basic-auth", "alice:s3cret:x", "--api-url", mockServer.URL}
+	output, _ := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	// Only the first colon separates the username, so passwords may contain colons
+	want := api.BasicAuth{Username: "alice", Password: "s3cret:x"}
+	if request.BasicAuth == nil || *request.BasicAuth != want {
+		t.Errorf("Expected credentials %+v to be sent to the API, got %+v", want, request.BasicAuth)
+	}
+	if !strings.Contains(output, "Basic auth: enabled for user alice") {
+		t.Errorf("Expected output to report basic auth, got: %s", output)
+	}
+	if strings.Contains(output, "s3cret") {
+		t.Errorf("Expected the password not to be printed, got: %s", output)
+	}
+
+	// Reset basic auth flag for other tests
+	basicAuthFlag = ""
+}
+
+func TestStartCommandInvalidBasicAuth(t *testing.T) {
+	for _, value := range []string{"alice", ":s3cret", "alice:"} {
+		args := []string{"start", "--port", "3000", "--basic-auth", value}
+		_, err := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+		if err == nil || !strings.Contains(err.Error(), "invalid --basic-auth") {
+			t.Errorf("Expected an invalid --basic-auth error for %q, got %v", value, err)
+		}
+	}
+
+	// Reset basic auth flag for other tests
+	basicAuthFlag = ""
+}
+
+func TestStartCommandCIDRFlags(t *testing.T) {
+	var request api.CreateTunnelRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.TunnelResponse{
+			PublicURL:            "https://12345678.azhexgate.com",
+			RelayEndpoint:        "https://relay.servicebus.windows.net",
+			HybridConnectionName: "hc-12345678",
+			ListenerToken:        "cidr-token",
+			SessionID:            "cidr-session",
+			AllowCIDRs:           []string{"198.51.100.0/24", "203.0.113.0/24"},
+			DenyCIDRs:            []string{"198.51.100.66/32"},
+		})
+	}))
+	defer mockServer.Close()
+
+	args := []string{"start", "--port", "3000", "--allow-cidr", "198.51.100.0/24,203.0.113.0/24",
+		"--deny-cidr", "198.51.100.66", "--api-url", mockServer.URL}
+	output, _ := runStartCommandWithTimeout(t, args, 500*time.Millisecond)
+
+	wantAllow := []string{"198.51.100.0/24", "203.0.113.0/24"}
+	if !slices.Equal(request.AllowCIDRs, wantAllow) || !slices.Equal(request.DenyCIDRs, []string{"198.51.100.66"}) {
+		t.Errorf("Expected CIDR lists to be sent to the API, got allow %v and deny %v",
+			request.AllowCIDRs, request.DenyCIDRs)
+	}
+	if !strings.Contains(output, "Allowed client IPs: 198.51.100.0/24, 203.0.113.0/24") ||
+		!strings.Contains(output, "Denied client IPs: 198.51.100.66/32") {
+		t.Errorf("Expected output to contain the IP lists, got: %s", output)
+	}
+
+	// Reset CIDR flags for other tests
+	allowCIDRFlag = nil
+	denyCIDRFlag = nil
+}
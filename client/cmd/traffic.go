@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+	"github.com/julienstroheker/AzHexGate/internal/httpclient"
+	"github.com/spf13/cobra"
+)
+
+// formatHAR is the only export format
+const formatHAR = "har"
+
+var (
+	trafficInspectorFlag string
+	exportFormatFlag     string
+	exportOutputFlag     string
+	exportRedactFlags    []string
+	importPortFlag       int
+	importPreserveHost   bool
+)
+
+var trafficCmd = &cobra.Command{
+	Use:   "traffic",
+	Short: "Export and import the traffic recorded by the inspector",
+	Long:  `Export and import the traffic recorded by the inspector`,
+}
+
+var trafficExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the requests recorded by the inspector",
+	Long: `Export the requests recorded by the inspector of a running "azhexgate start --inspect" as HAR 1.2.
+Credential headers are redacted; binary bodies are base64-encoded.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportFormatFlag != formatHAR {
+			return fmt.Errorf("unsupported --format %q (expected %s)", exportFormatFlag, formatHAR)
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		client := inspector.NewClient(&inspector.ClientOptions{Addr: trafficInspectorFlag, Logger: GetLogger()})
+		exchanges, err := client.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list recorded requests: %w", err)
+		}
+
+		har := inspector.ExportHAR(exchanges, &inspector.HAROptions{
+			HeaderFilters: slices.Concat(httpclient.DefaultHeaderFilters, exportRedactFlags),
+		})
+		data, err := json.MarshalIndent(har, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode HAR: %w", err)
+		}
+		data = append(data, '\n')
+
+		if exportOutputFlag == "" || exportOutputFlag == "-" {
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		}
+		if err := os.WriteFile(exportOutputFlag, data, 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", exportOutputFlag, err)
+		}
+		cmd.PrintErrln(fmt.Sprintf("Exported %d requests to %s", len(har.Log.Entries), exportOutputFlag))
+		return nil
+	},
+}
+
+var trafficImportCmd = &cobra.Command{
+	Use:   "import <file.har>",
+	Short: "Replay the requests of a HAR file against the local app",
+	Long: `Replay the requests of a HAR file, e.g. one exported by "azhexgate traffic export", against the
+local app in order, and show how each response differs from the recorded one. Redacted headers are
+sent as recorded, so set them again on the local app side if it checks them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		exchanges, err := readHAR(cmd, args[0])
+		if err != nil {
+			return err
+		}
+
+		recorder := inspector.New(&inspector.Options{
+			Capacity:     2 * max(len(exchanges), 1),
+			Target:       fmt.Sprintf("localhost:%d", importPortFlag),
+			PreserveHost: importPreserveHost,
+		})
+
+		failed := 0
+		for _, exchange := range recorder.Import(exchanges) {
+			result, err := recorder.Replay(ctx, exchange.ID, nil)
+			if err != nil {
+				failed++
+				cmd.Println(fmt.Sprintf("Skipped %s %s: %v", exchange.Request.Method, exchange.Request.URL, err))
+				continue
+			}
+			if result.Exchange.Error != "" {
+				failed++
+			}
+			printReplay(cmd, exchange.ID, result)
+		}
+
+		cmd.Println(fmt.Sprintf("Replayed %d of %d requests", len(exchanges)-failed, len(exchanges)))
+		if failed > 0 {
+			return fmt.Errorf("%d requests could not be replayed", failed)
+		}
+		return nil
+	},
+}
+
+// readHAR reads the exchanges of a HAR file, or of standard input for "-"
+func readHAR(cmd *cobra.Command, path string) ([]inspector.Exchange, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAR: %w", err)
+	}
+
+	var har inspector.HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, errors.Join(inspector.ErrInvalidHAR, err)
+	}
+	return inspector.ImportHAR(&har)
+}
+
+func init() {
+	rootCmd.AddCommand(trafficCmd)
+	trafficCmd.AddCommand(trafficExportCmd, trafficImportCmd)
+
+	trafficExportCmd.Flags().StringVar(&trafficInspectorFlag, "inspector", inspector.DefaultAddr,
+		"Address of the inspector of the running tunnel")
+	trafficExportCmd.Flags().StringVar(&exportFormatFlag, "format", formatHAR, "Export format (har)")
+	trafficExportCmd.Flags().StringVarP(&exportOutputFlag, "output", "o", "",
+		"File to write the export to (defaults to standard output)")
+	trafficExportCmd.Flags().StringArrayVar(&exportRedactFlags, "redact-header", nil,
+		fmt.Sprintf("Redact another header besides %v (repeatable)", httpclient.DefaultHeaderFilters))
+
+	trafficImportCmd.Flags().IntVarP(&importPortFlag, "port", "p", defaultPort, "Local port to replay requests to")
+	trafficImportCmd.Flags().BoolVar(&importPreserveHost, "preserve-host", false,
+		"Keep the recorded Host header instead of rewriting it to localhost")
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+)
+
+// runTrafficCommand runs a traffic subcommand and returns its output
+func runTrafficCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	rootCmd.SetArgs(append([]string{"traffic"}, args...))
+	trafficExportCmd.SetContext(context.Background())
+	trafficImportCmd.SetContext(context.Background())
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	err := rootCmd.Execute()
+
+	// Reset flags for other tests
+	rootCmd.SetArgs(nil)
+	trafficInspectorFlag = inspector.DefaultAddr
+	exportFormatFlag, exportOutputFlag, exportRedactFlags = formatHAR, "", nil
+	importPortFlag, importPreserveHost = defaultPort, false
+
+	return buf.String(), err
+}
+
+func TestTrafficExportAndImport(t *testing.T) {
+	recorder := inspector.New(nil)
+	req := httptest.NewRequest(http.MethodPost, "/hooks/github", strings.NewReader(`{"action":"opened"}`))
+	req.Host = "63873749.azhexgate.com"
+	req.Header.Set("X-Hub-Signature-256", "sha256=secret")
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	capture := recorder.Capture(req)
+	_, _ = io.ReadAll(capture.RequestBody(req.Body))
+	resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: http.NoBody}
+	capture.Response(resp)
+	capture.Finish(nil)
+
+	inspectorServer := httptest.NewServer(inspector.NewServer(&inspector.ServerOptions{Inspector: recorder}).Handler())
+	defer inspectorServer.Close()
+
+	harPath := filepath.Join(t.TempDir(), "webhook.har")
+	output, err := runTrafficCommand(t, "export", "--format", "har", "--output", harPath,
+		"--inspector", strings.TrimPrefix(inspectorServer.URL, "http://"), "--redact-header", "X-Hub-Signature-256")
+	if err != nil {
+		t.Fatalf("Expected export to succeed, got %v: %s", err, output)
+	}
+
+	data, err := os.ReadFile(harPath)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if strings.Contains(string(data), "sha256=secret") || !strings.Contains(string(data), "pull_request") {
+		t.Errorf("Expected the signature to be redacted and other headers kept, got: %s", data)
+	}
+	var har inspector.HAR
+	if err := json.Unmarshal(data, &har); err != nil || har.Log.Version != "1.2" {
+		t.Fatalf("Expected a HAR 1.2 log, got %v", err)
+	}
+
+	// Replay the export against a local app that now handles the webhook
+	var gotEvent, gotBody string
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotEvent, gotBody = r.Header.Get("X-GitHub-Event"), string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer localServer.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(localServer.URL, "http://"))
+
+	output, err = runTrafficCommand(t, "import", harPath, "--port", port)
+	if err != nil {
+		t.Fatalf("Expected import to succeed, got %v: %s", err, output)
+	}
+	if gotEvent != "pull_request" || gotBody != `{"action":"opened"}` {
+		t.Errorf("Expected the recorded webhook to reach the local app, got event %q body %q", gotEvent, gotBody)
+	}
+	for _, want := range []string{"-> 204 No Content", "-502 Bad Gateway", "+204 No Content", "Replayed 1 of 1 requests"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestTrafficCommandErrors(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.har")
+	_ = os.WriteFile(invalid, []byte("not json"), 0o600)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "unsupported format", args: []string{"export", "--format", "csv"}, wantErr: "unsupported --format"},
+		{name: "inspector not running", args: []string{"export", "--inspector", "127.0.0.1:1"},
+			wantErr: "inspector not reachable"},
+		{name: "invalid HAR", args: []string{"import", invalid}, wantErr: "invalid HAR"},
+		{name: "missing file", args: []string{"import", filepath.Join(t.TempDir(), "missing.har")},
+			wantErr: "failed to read HAR"},
+		{name: "unreachable local app", args: []string{"import", "-", "--port", strconv.Itoa(1)},
+			wantErr: "1 requests could not be replayed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd.SetIn(strings.NewReader(`{"log":{"version":"1.2","creator":{"name":"t","version":"1"},` +
+				`"entries":[{"request":{"method":"GET","url":"https://example.com/"},"response":{"status":200}}]}}`))
+			defer rootCmd.SetIn(nil)
+
+			_, err := runTrafficCommand(t, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/julienstroheker/AzHexGate/internal/api"
@@ -14,6 +16,41 @@ import (
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 )
 
+var (
+	// ErrTunnelNotFound is returned when the Gateway API does not know the requested tunnel
+	ErrTunnelNotFound = errors.New("tunnel not found")
+	// ErrUnauthorized is returned when the Gateway API rejects the API key or access token
+	ErrUnauthorized = errors.New("unauthorized: missing or invalid credentials " +
+		"(set AZHEXGATE_API_KEY or --api-key, or run azhexgate login)")
+)
+
+// QuotaError is returned when the Gateway API refuses to create a tunnel because a quota
+// of the API key is exhausted
+type QuotaError struct {
+	// StatusCode is 403 for the concurrent tunnel limit and 429 for the creation rate limit
+	StatusCode int
+
+	// Quota names the exhausted limit, e.g. "max_tunnels" or "creations_per_hour"
+	Quota string
+
+	// Limit and Current are the configured value of the quota and the usage counted against it
+	Limit   int
+	Current int
+
+	// RetryAfter is how long until a creation may succeed again (zero when a tunnel must be closed first)
+	RetryAfter time.Duration
+
+	message string
+}
+
+// Error implements error
+func (e *QuotaError) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	return fmt.Sprintf("quota %s exceeded (%d of %d)", e.Quota, e.Current, e.Limit)
+}
+
 // Client provides methods to interact with the Gateway API
 type Client struct {
 	baseURL    string
@@ -32,6 +69,12 @@ type Options struct {
 	// MaxRetries is the maximum number of retry attempts (optional, defaults to 3)
 	MaxRetries int
 
+	// APIKey authenticates calls to the Gateway API (optional)
+	APIKey string
+
+	// TokenSource provides the access token sent as a bearer token to the Gateway API (optional)
+	TokenSource httpclient.TokenSource
+
 	// Logger is used for debug logging (optional)
 	Logger *logging.Logger
 }
@@ -60,11 +103,13 @@ func NewClient(opts *Options) *Client {
 
 	// Create HTTP client with policies
 	httpOpts := &httpclient.Options{
-		Timeout:    timeout,
-		MaxRetries: maxRetries,
-		RetryDelay: time.Second,
-		Logger:     opts.Logger,
-		UserAgent:  "azhexgate-client/1.0",
+		Timeout:     timeout,
+		MaxRetries:  maxRetries,
+		RetryDelay:  time.Second,
+		Logger:      opts.Logger,
+		UserAgent:   "azhexgate-client/1.0",
+		APIKey:      opts.APIKey,
+		TokenSource: opts.TokenSource,
 	}
 
 	return &Client{
@@ -75,23 +120,22 @@ func NewClient(opts *Options) *Client {
 }
 
 // CreateTunnelRequest represents the request to create a new tunnel
-type CreateTunnelRequest struct {
-	LocalPort int `json:"local_port"`
-}
+type CreateTunnelRequest = api.CreateTunnelRequest
 
 // CreateTunnel requests a new tunnel from the Gateway API
-func (c *Client) CreateTunnel(ctx context.Context, localPort int) (*api.TunnelResponse, error) {
-	// Log entry
-	if c.logger != nil {
-		c.logger.Info("Creating tunnel", logging.Int("local_port", localPort))
+func (c *Client) CreateTunnel(ctx context.Context, request *CreateTunnelRequest) (*api.TunnelResponse, error) {
+	if request == nil {
+		request = &CreateTunnelRequest{}
 	}
 
-	// Prepare request body
-	requestBody := CreateTunnelRequest{
-		LocalPort: localPort,
+	// Log entry
+	if c.logger != nil {
+		c.logger.Info("Creating tunnel",
+			logging.Int("local_port", request.LocalPort),
+			logging.String("name", request.Name))
 	}
 
-	bodyBytes, err := json.Marshal(requestBody)
+	bodyBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -120,8 +164,14 @@ func (c *Client) CreateTunnel(ctx context.Context, localPort int) (*api.TunnelRe
 	}()
 
 	// Check status code
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		if quotaErr := decodeQuotaError(resp, body); quotaErr != nil {
+			return nil, quotaErr
+		}
 		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
@@ -133,3 +183,103 @@ func (c *Client) CreateTunnel(ctx context.Context, localPort int) (*api.TunnelRe
 
 	return &tunnelResp, nil
 }
+
+// decodeQuotaError returns the quota error carried by a 403 or 429 response body, or nil for any other response
+func decodeQuotaError(resp *http.Response, body []byte) *QuotaError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	var quotaResp api.QuotaErrorResponse
+	if err := json.Unmarshal(body, &quotaResp); err != nil || quotaResp.Quota == "" {
+		return nil
+	}
+
+	return &QuotaError{
+		StatusCode: resp.StatusCode,
+		Quota:      quotaResp.Quota,
+		Limit:      quotaResp.Limit,
+		Current:    quotaResp.Current,
+		RetryAfter: time.Duration(quotaResp.RetryAfter) * time.Second,
+		message:    quotaResp.Error,
+	}
+}
+
+// ListTunnels returns every tunnel registered with the Gateway API
+func (c *Client) ListTunnels(ctx context.Context) ([]api.TunnelInfo, error) {
+	var listResp api.TunnelListResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/api/tunnels", nil, &listResp); err != nil {
+		return nil, err
+	}
+	return listResp.Tunnels, nil
+}
+
+// GetTunnel returns a single tunnel, or ErrTunnelNotFound if it does not exist
+func (c *Client) GetTunnel(ctx context.Context, tunnelID string) (*api.TunnelInfo, error) {
+	var info api.TunnelInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/api/tunnels/"+url.PathEscape(tunnelID), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// DeleteTunnel revokes a tunnel, or returns ErrTunnelNotFound if it does not exist.
+// The gateway stops routing to the tunnel and closes its open connections.
+func (c *Client) DeleteTunnel(ctx context.Context, tunnelID string) error {
+	if c.logger != nil {
+		c.logger.Info("Deleting tunnel", logging.String("tunnel_id", tunnelID))
+	}
+	return c.doJSON(ctx, http.MethodDelete, "/api/tunnels/"+url.PathEscape(tunnelID), nil, nil)
+}
+
+// Heartbeat reports the tunnel alive, or returns ErrTunnelNotFound once the gateway released it.
+// Tunnels that stop sending heartbeats are marked inactive and eventually deleted.
+func (c *Client) Heartbeat(ctx context.Context, tunnelID, sessionID string) error {
+	path := "/api/tunnels/" + url.PathEscape(tunnelID) + "/heartbeat"
+	return c.doJSON(ctx, http.MethodPut, path, &api.HeartbeatRequest{SessionID: sessionID}, nil)
+}
+
+// doJSON sends a request to the Gateway API with in as its JSON body (when non-nil)
+// and decodes the JSON response into out (when non-nil)
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	var bodyBytes []byte
+	if in != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err // Error is already wrapped by ErrorPolicy
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrTunnelNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	case out == nil:
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -3,11 +3,14 @@ package gateway
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/julienstroheker/AzHexGate/internal/api"
 	"github.com/julienstroheker/AzHexGate/internal/httpclient"
@@ -48,6 +51,14 @@ func TestCreateTunnelSuccess(t *testing.T) {
 			t.Errorf("Expected path /api/tunnels, got %s", r.URL.Path)
 		}
 
+		var request api.CreateTunnelRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if request.LocalPort != 3000 || request.Name != "myapp" {
+			t.Errorf("Expected local_port 3000 and name 'myapp', got %+v", request)
+		}
+
 		// Return mock response
 		response := api.TunnelResponse{
 			PublicURL:            "https://test123.azhexgate.com",
@@ -69,7 +80,7 @@ func TestCreateTunnelSuccess(t *testing.T) {
 	client := NewClient(opts)
 
 	ctx := context.Background()
-	resp, err := client.CreateTunnel(ctx, 3000)
+	resp, err := client.CreateTunnel(ctx, &CreateTunnelRequest{LocalPort: 3000, Name: "myapp"})
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -94,7 +105,7 @@ func TestCreateTunnelHTTPError(t *testing.T) {
 	client := NewClient(opts)
 
 	ctx := context.Background()
-	_, err := client.CreateTunnel(ctx, 3000)
+	_, err := client.CreateTunnel(ctx, &CreateTunnelRequest{LocalPort: 3000})
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -104,6 +115,89 @@ func TestCreateTunnelHTTPError(t *testing.T) {
 	}
 }
 
+func TestCreateTunnelQuotaError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       api.QuotaErrorResponse
+		retryAfter time.Duration
+	}{
+		{
+			name:   "concurrent tunnels",
+			status: http.StatusForbidden,
+			body: api.QuotaErrorResponse{
+				Error: "quota exceeded: 2 of 2 concurrent tunnels in use", Quota: "max_tunnels", Limit: 2, Current: 2,
+			},
+		},
+		{
+			name:   "creation rate",
+			status: http.StatusTooManyRequests,
+			body: api.QuotaErrorResponse{
+				Error: "quota exceeded", Quota: "creations_per_hour", Limit: 5, Current: 5, RetryAfter: 1200,
+			},
+			retryAfter: 20 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.body.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(tt.body.RetryAfter))
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(tt.body)
+			}))
+			defer server.Close()
+
+			client := NewClient(&Options{BaseURL: server.URL})
+			_, err := client.CreateTunnel(context.Background(), &CreateTunnelRequest{LocalPort: 3000})
+
+			var quotaErr *QuotaError
+			if !errors.As(err, &quotaErr) {
+				t.Fatalf("Expected a QuotaError, got %v", err)
+			}
+			if quotaErr.StatusCode != tt.status || quotaErr.Quota != tt.body.Quota {
+				t.Errorf("Expected quota %s with status %d, got %+v", tt.body.Quota, tt.status, quotaErr)
+			}
+			if quotaErr.Limit != tt.body.Limit || quotaErr.Current != tt.body.Current {
+				t.Errorf("Expected %d of %d, got %d of %d", tt.body.Current, tt.body.Limit, quotaErr.Current, quotaErr.Limit)
+			}
+			if quotaErr.RetryAfter != tt.retryAfter {
+				t.Errorf("Expected retry after %v, got %v", tt.retryAfter, quotaErr.RetryAfter)
+			}
+			if quotaErr.Error() != tt.body.Error {
+				t.Errorf("Expected message %q, got %q", tt.body.Error, quotaErr.Error())
+			}
+			// Waiting an hour is beyond any retry backoff
+			if calls != 1 {
+				t.Errorf("Expected a single request, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestCreateTunnelForbiddenWithoutQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Options{BaseURL: server.URL})
+	_, err := client.CreateTunnel(context.Background(), &CreateTunnelRequest{LocalPort: 3000})
+
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		t.Fatalf("Expected a plain status error, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "API returned status 403: Forbidden") {
+		t.Errorf("Expected error about status 403, got: %v", err)
+	}
+}
+
 func TestCreateTunnelInvalidJSON(t *testing.T) {
 	// Create mock server that returns invalid JSON
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -119,7 +213,7 @@ func TestCreateTunnelInvalidJSON(t *testing.T) {
 	client := NewClient(opts)
 
 	ctx := context.Background()
-	_, err := client.CreateTunnel(ctx, 3000)
+	_, err := client.CreateTunnel(ctx, &CreateTunnelRequest{LocalPort: 3000})
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -163,7 +257,7 @@ func TestCreateTunnelWithMockTransport(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	resp, err := apiClient.CreateTunnel(ctx, 3000)
+	resp, err := apiClient.CreateTunnel(ctx, &CreateTunnelRequest{LocalPort: 3000})
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
@@ -182,3 +276,173 @@ type MockTransport struct {
 func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return m.RoundTripFunc(req)
 }
+
+// newLifecycleServer serves a single tunnel for the lifecycle endpoints
+func newLifecycleServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	tunnel := api.TunnelInfo{
+		TunnelID:             "12345678",
+		PublicURL:            "https://12345678.azhexgate.com",
+		HybridConnectionName: "hc-12345678",
+		LocalPort:            3000,
+	}
+
+	var deleted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tunnels", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(api.TunnelListResponse{Tunnels: []api.TunnelInfo{tunnel}})
+	})
+	mux.HandleFunc("GET /api/tunnels/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != tunnel.TunnelID {
+			http.Error(w, "Tunnel not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tunnel)
+	})
+	mux.HandleFunc("DELETE /api/tunnels/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != tunnel.TunnelID {
+			http.Error(w, "Tunnel not found", http.StatusNotFound)
+			return
+		}
+		deleted = append(deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT /api/tunnels/{id}/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		var request api.HeartbeatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		switch {
+		case r.PathValue("id") != tunnel.TunnelID:
+			http.Error(w, "Tunnel not found", http.StatusNotFound)
+		case request.SessionID != "session-1":
+			http.Error(w, "tunnel belongs to another session", http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &deleted
+}
+
+func TestListTunnels(t *testing.T) {
+	server, _ := newLifecycleServer(t)
+	client := NewClient(&Options{BaseURL: server.URL})
+
+	tunnels, err := client.ListTunnels(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(tunnels) != 1 || tunnels[0].TunnelID != "12345678" {
+		t.Errorf("Expected tunnel 12345678, got %+v", tunnels)
+	}
+}
+
+func TestGetTunnel(t *testing.T) {
+	server, _ := newLifecycleServer(t)
+	client := NewClient(&Options{BaseURL: server.URL})
+
+	tunnel, err := client.GetTunnel(context.Background(), "12345678")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if tunnel.PublicURL != "https://12345678.azhexgate.com" || tunnel.LocalPort != 3000 {
+		t.Errorf("Unexpected tunnel: %+v", tunnel)
+	}
+
+	if _, err := client.GetTunnel(context.Background(), "unknown"); !errors.Is(err, ErrTunnelNotFound) {
+		t.Errorf("Expected ErrTunnelNotFound, got: %v", err)
+	}
+}
+
+func TestDeleteTunnel(t *testing.T) {
+	server, deleted := newLifecycleServer(t)
+	client := NewClient(&Options{BaseURL: server.URL})
+
+	if err := client.DeleteTunnel(context.Background(), "12345678"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(*deleted) != 1 || (*deleted)[0] != "12345678" {
+		t.Errorf("Expected tunnel 12345678 to be deleted, got %v", *deleted)
+	}
+
+	if err := client.DeleteTunnel(context.Background(), "unknown"); !errors.Is(err, ErrTunnelNotFound) {
+		t.Errorf("Expected ErrTunnelNotFound, got: %v", err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	server, _ := newLifecycleServer(t)
+	client := NewClient(&Options{BaseURL: server.URL})
+
+	if err := client.Heartbeat(context.Background(), "12345678", "session-1"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := client.Heartbeat(context.Background(), "unknown", "session-1"); !errors.Is(err, ErrTunnelNotFound) {
+		t.Errorf("Expected ErrTunnelNotFound, got: %v", err)
+	}
+	err := client.Heartbeat(context.Background(), "12345678", "session-2")
+	if err == nil || !strings.Contains(err.Error(), "API returned status 409") {
+		t.Errorf("Expected status error for another session, got: %v", err)
+	}
+}
+
+func TestLifecycleHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("forbidden"))
+	}))
+	defer server.Close()
+	client := NewClient(&Options{BaseURL: server.URL})
+
+	_, err := client.ListTunnels(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "API returned status 403") {
+		t.Errorf("Expected status error, got: %v", err)
+	}
+}
+
+func TestClientSendsAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(api.APIKeyHeader) != "secret-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.TunnelListResponse{})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Options{BaseURL: server.URL, APIKey: "secret-1"})
+	if _, err := client.ListTunnels(context.Background()); err != nil {
+		t.Errorf("Expected authenticated call to succeed, got: %v", err)
+	}
+
+	_, err := NewClient(&Options{BaseURL: server.URL}).ListTunnels(context.Background())
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got: %v", err)
+	}
+
+	_, err = NewClient(&Options{BaseURL: server.URL, APIKey: "wrong"}).CreateTunnel(context.Background(), nil)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized from CreateTunnel, got: %v", err)
+	}
+}
+
+func TestClientSendsBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.TunnelListResponse{})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Options{
+		BaseURL:     server.URL,
+		TokenSource: func(ctx context.Context) (string, error) { return "token-1", nil },
+	})
+	if _, err := client.ListTunnels(context.Background()); err != nil {
+		t.Errorf("Expected call with a bearer token to succeed, got: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package inspector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/httpclient"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// ErrUnavailable is returned when no inspector answers at the client address
+var ErrUnavailable = errors.New("inspector not reachable (is azhexgate start --inspect running?)")
+
+// ClientOptions contains configuration for the Client
+type ClientOptions struct {
+	// Addr is the address of the inspector (optional, defaults to DefaultAddr)
+	Addr string
+
+	// Timeout is the HTTP request timeout, replays included (optional, defaults to 60s)
+	Timeout time.Duration
+
+	// Logger is used for debug logging (optional)
+	Logger *logging.Logger
+}
+
+// Client calls the JSON API of a running inspector
+type Client struct {
+	baseURL    string
+	httpClient *httpclient.Client
+}
+
+// NewClient creates a new inspector API client
+func NewClient(opts *ClientOptions) *Client {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	baseURL := strings.TrimSuffix(addr, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+
+	// Replays are not idempotent, so requests are not retried
+	return &Client{
+		baseURL: baseURL,
+		httpClient: httpclient.NewClient(&httpclient.Options{
+			Timeout:   timeout,
+			Logger:    opts.Logger,
+			UserAgent: "azhexgate-client/1.0",
+		}),
+	}
+}
+
+// List returns the exchanges recorded by the inspector, most recent first
+func (c *Client) List(ctx context.Context) ([]Exchange, error) {
+	var list ListResponse
+	if err := c.call(ctx, http.MethodGet, "/api/requests", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Requests, nil
+}
+
+// Get returns the exchange with the given ID
+func (c *Client) Get(ctx context.Context, id string) (*Exchange, error) {
+	var exchange Exchange
+	if err := c.call(ctx, http.MethodGet, "/api/requests/"+url.PathEscape(id), nil, &exchange); err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+// Replay replays the exchange with the given ID after applying edits (optional)
+func (c *Client) Replay(ctx context.Context, id string, edits *ReplayRequest) (*ReplayResponse, error) {
+	if edits == nil {
+		edits = &ReplayRequest{}
+	}
+
+	var result ReplayResponse
+	path := "/api/requests/" + url.PathEscape(id) + "/replay"
+	if err := c.call(ctx, http.MethodPost, path, edits, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// call sends request, when not nil, as JSON to the API path and decodes the response into response
+func (c *Client) call(ctx context.Context, method, path string, request, response any) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Join(ErrUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("inspector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
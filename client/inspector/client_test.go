@@ -0,0 +1,53 @@
+package inspector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	i := replayTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, nil)
+	record(t, i, httptest.NewRequest(http.MethodGet, "/status", nil), response(http.StatusOK, ""), nil)
+	id := i.List()[0].ID
+
+	server := httptest.NewServer(NewServer(&ServerOptions{Inspector: i}).Handler())
+	defer server.Close()
+
+	client := NewClient(&ClientOptions{Addr: strings.TrimPrefix(server.URL, "http://")})
+	ctx := context.Background()
+
+	exchange, err := client.Get(ctx, id)
+	if err != nil || exchange.Request.URL != "/status" {
+		t.Fatalf("Expected exchange %s for /status, got %+v (%v)", id, exchange, err)
+	}
+
+	result, err := client.Replay(ctx, id, nil)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if result.Exchange.Response == nil || result.Exchange.Response.Status != http.StatusAccepted {
+		t.Errorf("Expected the replay to get status %d, got %+v", http.StatusAccepted, result.Exchange.Response)
+	}
+
+	exchanges, err := client.List(ctx)
+	if err != nil || len(exchanges) != 2 {
+		t.Errorf("Expected 2 exchanges after the replay, got %d (%v)", len(exchanges), err)
+	}
+
+	if _, err := client.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	client := NewClient(&ClientOptions{Addr: "127.0.0.1:1"})
+	if _, err := client.List(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+}
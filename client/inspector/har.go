@@ -0,0 +1,367 @@
+package inspector
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/httpclient"
+)
+
+const (
+	// harVersion is the HAR format version exports use
+	harVersion = "1.2"
+
+	// harCreator and harCreatorVersion name the application in exported HAR logs
+	harCreator        = "azhexgate"
+	harCreatorVersion = "1.0"
+)
+
+// ErrInvalidHAR is returned when a HAR log cannot be imported
+var ErrInvalidHAR = errors.New("invalid HAR")
+
+// HAR is an HTTP Archive (HAR 1.2) document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root log of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the application that created a HAR log
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single exchange of a HAR log
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest is the request of a HAR entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is the response of a HAR entry. Exchanges that got no response have status 0 and an _error.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Error       string         `json:"_error,omitempty"`
+}
+
+// HARNameValue is a header, cookie or query parameter of a HAR entry
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body of a HAR entry.
+// HAR 1.2 has no encoding for request bodies, so binary ones carry the custom _encoding "base64".
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+// HARContent is the response body of a HAR entry
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings splits the time of a HAR entry; phases that do not apply are -1
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HAROptions contains configuration for ExportHAR
+type HAROptions struct {
+	// HeaderFilters names the headers whose values are redacted
+	// (optional, defaults to httpclient.DefaultHeaderFilters)
+	HeaderFilters []string
+}
+
+// ExportHAR converts exchanges to a HAR log, oldest first, redacting sensitive headers.
+// Request URLs are rebuilt from the public Host header, so they point at the tunnel.
+func ExportHAR(exchanges []Exchange, opts *HAROptions) *HAR {
+	if opts == nil {
+		opts = &HAROptions{}
+	}
+
+	filters := opts.HeaderFilters
+	if filters == nil {
+		filters = httpclient.DefaultHeaderFilters
+	}
+
+	entries := make([]HAREntry, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		entries = append(entries, harEntry(exchange, filters))
+	}
+	slices.SortStableFunc(entries, func(a, b HAREntry) int {
+		return a.StartedDateTime.Compare(b.StartedDateTime)
+	})
+
+	return &HAR{Log: HARLog{
+		Version: harVersion,
+		Creator: HARCreator{Name: harCreator, Version: harCreatorVersion},
+		Entries: entries,
+	}}
+}
+
+// harEntry converts an exchange to a HAR entry
+func harEntry(exchange Exchange, filters []string) HAREntry {
+	req := exchange.Request
+	header := httpclient.RedactHeaders(req.Header, filters)
+
+	entry := HAREntry{
+		StartedDateTime: exchange.StartedAt,
+		Time:            exchange.DurationMs,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         publicURL(req),
+			HTTPVersion: req.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(header, req.Host),
+			QueryString: harQuery(req.URL),
+			HeadersSize: -1,
+			BodySize:    req.Body.Size,
+		},
+		Timings: HARTimings{Blocked: -1, DNS: -1, Connect: -1, Send: 0, Wait: exchange.WaitMs,
+			Receive: max(exchange.DurationMs-exchange.WaitMs, 0)},
+	}
+	if req.Body.Size > 0 {
+		entry.Request.PostData = &HARPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     req.Body.Content,
+			Encoding: req.Body.Encoding,
+		}
+	}
+	if exchange.ReplayOf != "" {
+		entry.Comment = "replay of request " + exchange.ReplayOf
+	}
+
+	resp := exchange.Response
+	if resp == nil {
+		entry.Response = HARResponse{
+			Cookies: []HARNameValue{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1,
+			Error: exchange.Error,
+		}
+		return entry
+	}
+
+	entry.Response = HARResponse{
+		Status:      resp.Status,
+		StatusText:  http.StatusText(resp.Status),
+		HTTPVersion: resp.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(httpclient.RedactHeaders(resp.Header, filters), ""),
+		Content: HARContent{
+			Size:     resp.Body.Size,
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     resp.Body.Content,
+			Encoding: resp.Body.Encoding,
+		},
+		HeadersSize: -1,
+		BodySize:    resp.Body.Size,
+		Error:       exchange.Error,
+	}
+	if resp.Body.Truncated {
+		entry.Response.Content.Comment = fmt.Sprintf("truncated, %d bytes in total", resp.Body.Size)
+	}
+	return entry
+}
+
+// publicURL rebuilds the absolute URL a recorded request was sent to
+func publicURL(req Request) string {
+	scheme := "https"
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + req.Host + req.URL
+}
+
+// harHeaders converts headers to HAR name/value pairs sorted by name, starting with host when set
+func harHeaders(header http.Header, host string) []HARNameValue {
+	pairs := make([]HARNameValue, 0, len(header)+1)
+	if host != "" {
+		pairs = append(pairs, HARNameValue{Name: "Host", Value: host})
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// harQuery returns the query parameters of a request URI
+func harQuery(requestURI string) []HARNameValue {
+	pairs := []HARNameValue{}
+	u, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return pairs
+	}
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// ImportHAR converts the entries of a HAR log to exchanges that can be replayed.
+// Entries without a response, e.g. failed requests, keep a nil Response.
+func ImportHAR(har *HAR) ([]Exchange, error) {
+	if har == nil || har.Log.Version == "" {
+		return nil, fmt.Errorf("%w: missing log", ErrInvalidHAR)
+	}
+
+	exchanges := make([]Exchange, 0, len(har.Log.Entries))
+	for n, entry := range har.Log.Entries {
+		exchange, err := importEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %w", ErrInvalidHAR, n, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, nil
+}
+
+// importEntry converts a HAR entry to an exchange
+func importEntry(entry HAREntry) (Exchange, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil || entry.Request.Method == "" {
+		return Exchange{}, fmt.Errorf("invalid request %s %q", entry.Request.Method, entry.Request.URL)
+	}
+
+	header := make(http.Header)
+	host := u.Host
+	for _, pair := range entry.Request.Headers {
+		// HTTP/2 pseudo-headers, e.g. from browser exports, map to the request line
+		if pair.Name == ":authority" || strings.EqualFold(pair.Name, "Host") {
+			host = pair.Value
+			continue
+		}
+		if strings.HasPrefix(pair.Name, ":") {
+			continue
+		}
+		header.Add(pair.Name, pair.Value)
+	}
+
+	body := Body{}
+	if data := entry.Request.PostData; data != nil {
+		content := []byte(data.Text)
+		if data.Encoding == encodingBase64 {
+			if content, err = base64.StdEncoding.DecodeString(data.Text); err != nil {
+				return Exchange{}, fmt.Errorf("invalid base64 request body: %w", err)
+			}
+		}
+		body = newBody(content, max(entry.Request.BodySize, int64(len(content))))
+		if header.Get("Content-Type") == "" && data.MimeType != "" {
+			header.Set("Content-Type", data.MimeType)
+		}
+	}
+
+	exchange := Exchange{
+		StartedAt:  entry.StartedDateTime,
+		DurationMs: entry.Time,
+		WaitMs:     entry.Timings.Wait,
+		Request: Request{
+			Method: entry.Request.Method,
+			URL:    u.RequestURI(),
+			Host:   host,
+			Proto:  entry.Request.HTTPVersion,
+			Header: header,
+			Body:   body,
+		},
+		Error: entry.Response.Error,
+	}
+	if entry.Response.Status > 0 {
+		exchange.Response, err = importResponse(entry.Response)
+		if err != nil {
+			return Exchange{}, err
+		}
+	}
+	return exchange, nil
+}
+
+// importResponse converts the response of a HAR entry
+func importResponse(resp HARResponse) (*Response, error) {
+	header := make(http.Header)
+	for _, pair := range resp.Headers {
+		if !strings.HasPrefix(pair.Name, ":") {
+			header.Add(pair.Name, pair.Value)
+		}
+	}
+
+	content := []byte(resp.Content.Text)
+	if resp.Content.Encoding == encodingBase64 {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(resp.Content.Text); err != nil {
+			return nil, fmt.Errorf("invalid base64 response body: %w", err)
+		}
+	}
+	if header.Get("Content-Type") == "" && resp.Content.MimeType != "" {
+		header.Set("Content-Type", resp.Content.MimeType)
+	}
+
+	return &Response{
+		Status: resp.Status,
+		Proto:  resp.HTTPVersion,
+		Header: header,
+		Body:   newBody(content, max(resp.Content.Size, int64(len(content)))),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package inspector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/internal/httpclient"
+)
+
+// harFixture records a webhook with a binary body and a failed request
+func harFixture(t *testing.T) *Inspector {
+	t.Helper()
+
+	i := New(nil)
+	req := httptest.NewRequest(http.MethodPost, "/hooks/stripe?attempt=2&id=7", strings.NewReader("\xff\x00binary"))
+	req.Host = "63873749.azhexgate.com"
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+	resp := response(http.StatusOK, `{"ok":true}`)
+	resp.Header.Set("Set-Cookie", "session=secret")
+	record(t, i, req, resp, nil)
+
+	record(t, i, httptest.NewRequest(http.MethodGet, "/down", nil), nil, errors.New("connection refused"))
+	return i
+}
+
+func TestExportHAR(t *testing.T) {
+	har := ExportHAR(harFixture(t).List(), nil)
+
+	if har.Log.Version != "1.2" || har.Log.Creator.Name != "azhexgate" {
+		t.Errorf("Expected a HAR 1.2 log created by azhexgate, got %+v", har.Log)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(har.Log.Entries))
+	}
+
+	entry := har.Log.Entries[0]
+	if entry.Request.URL != "https://63873749.azhexgate.com/hooks/stripe?attempt=2&id=7" {
+		t.Errorf("Expected the public URL, got %s", entry.Request.URL)
+	}
+	if len(entry.Request.QueryString) != 2 || entry.Request.QueryString[1] != (HARNameValue{Name: "id", Value: "7"}) {
+		t.Errorf("Expected the query parameters, got %+v", entry.Request.QueryString)
+	}
+
+	headers := map[string]string{}
+	for _, pair := range append(entry.Request.Headers, entry.Response.Headers...) {
+		headers[pair.Name] = pair.Value
+	}
+	for name, want := range map[string]string{
+		"Authorization":    httpclient.RedactedValue,
+		"Set-Cookie":       httpclient.RedactedValue,
+		"Stripe-Signature": "t=1,v1=abc",
+		"Host":             "63873749.azhexgate.com",
+	} {
+		if headers[name] != want {
+			t.Errorf("Expected header %s %q, got %q", name, want, headers[name])
+		}
+	}
+
+	if data := entry.Request.PostData; data == nil || data.Encoding != "base64" || data.Text != "/wBiaW5hcnk=" {
+		t.Errorf("Expected the binary body base64-encoded, got %+v", data)
+	}
+	if entry.Response.Status != http.StatusOK || entry.Response.Content.Text != `{"ok":true}` {
+		t.Errorf("Expected the response, got %+v", entry.Response)
+	}
+
+	failed := har.Log.Entries[1]
+	if failed.Response.Status != 0 || failed.Response.Error != "connection refused" {
+		t.Errorf("Expected a failed entry with status 0, got %+v", failed.Response)
+	}
+
+	if _, err := json.Marshal(har); err != nil {
+		t.Errorf("Expected the HAR to encode, got %v", err)
+	}
+}
+
+func TestImportHAR(t *testing.T) {
+	exported, err := json.Marshal(ExportHAR(harFixture(t).List(), &HAROptions{HeaderFilters: []string{}}))
+	if err != nil {
+		t.Fatalf("Failed to encode HAR: %v", err)
+	}
+
+	var har HAR
+	if err := json.Unmarshal(exported, &har); err != nil {
+		t.Fatalf("Failed to decode HAR: %v", err)
+	}
+	exchanges, err := ImportHAR(&har)
+	if err != nil {
+		t.Fatalf("Failed to import HAR: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("Expected 2 exchanges, got %d", len(exchanges))
+	}
+
+	req := exchanges[0].Request
+	if req.Method != http.MethodPost || req.URL != "/hooks/stripe?attempt=2&id=7" || req.Host != "63873749.azhexgate.com" {
+		t.Errorf("Expected POST /hooks/stripe?attempt=2&id=7 for the tunnel host, got %s %s %s",
+			req.Method, req.URL, req.Host)
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" || req.Header.Get("Host") != "" {
+		t.Errorf("Expected the unredacted headers without Host, got %v", req.Header)
+	}
+	if body, _ := req.Body.Bytes(); string(body) != "\xff\x00binary" || req.Body.Truncated {
+		t.Errorf("Expected the binary body to round-trip, got %q", body)
+	}
+	if resp := exchanges[0].Response; resp == nil || resp.Status != http.StatusOK || resp.Body.Content != `{"ok":true}` {
+		t.Errorf("Expected the recorded response, got %+v", resp)
+	}
+	if exchanges[1].Response != nil || exchanges[1].Error != "connection refused" {
+		t.Errorf("Expected the failed exchange without response, got %+v", exchanges[1])
+	}
+}
+
+func TestImportHARInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		har  *HAR
+	}{
+		{name: "missing log", har: &HAR{}},
+		{name: "invalid url", har: &HAR{Log: HARLog{Version: "1.2", Entries: []HAREntry{
+			{Request: HARRequest{Method: http.MethodGet, URL: "://"}},
+		}}}},
+		{name: "invalid base64", har: &HAR{Log: HARLog{Version: "1.2", Entries: []HAREntry{
+			{Request: HARRequest{Method: http.MethodPost, URL: "https://example.com/",
+				PostData: &HARPostData{Text: "!", Encoding: "base64"}}},
+		}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportHAR(tt.har); !errors.Is(err, ErrInvalidHAR) {
+				t.Errorf("Expected ErrInvalidHAR, got %v", err)
+			}
+		})
+	}
+}
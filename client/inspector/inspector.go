@@ -0,0 +1,385 @@
+package inspector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultAddr is the address the inspector listens on unless another one is given
+	DefaultAddr = "127.0.0.1:4040"
+
+	// defaultCapacity is how many exchanges the inspector keeps unless configured otherwise
+	defaultCapacity = 100
+
+	// defaultMaxBodySize is how many bytes of each body are kept unless configured otherwise
+	defaultMaxBodySize = 16 << 10
+
+	// encodingBase64 marks a body that is not valid UTF-8 and is kept base64-encoded
+	encodingBase64 = "base64"
+)
+
+// Exchange is a request forwarded through the tunnel and the response of the local server
+type Exchange struct {
+	// ID identifies the exchange within the inspector
+	ID string `json:"id"`
+
+	// StartedAt is when the request was read off the relay
+	StartedAt time.Time `json:"started_at"`
+
+	// WaitMs is how long the local server took to send the response headers
+	WaitMs float64 `json:"wait_ms"`
+
+	// DurationMs is how long the whole exchange took, bodies included
+	DurationMs float64 `json:"duration_ms"`
+
+	Request  Request   `json:"request"`
+	Response *Response `json:"response,omitempty"`
+
+	// ReplayOf is the ID of the exchange this one replayed, if any
+	ReplayOf string `json:"replay_of,omitempty"`
+
+	// Error describes why the exchange failed, e.g. the local server was unreachable
+	Error string `json:"error,omitempty"`
+}
+
+// Request is the recorded request of an exchange
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   Body        `json:"body"`
+}
+
+// Response is the recorded response of an exchange
+type Response struct {
+	Status int         `json:"status"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   Body        `json:"body"`
+}
+
+// Body is a recorded message body, truncated to the inspector's maximum body size
+type Body struct {
+	// Content holds the kept bytes, as text or base64 depending on Encoding
+	Content string `json:"content,omitempty"`
+
+	// Encoding is "base64" when the content is not valid UTF-8 text, and empty otherwise
+	Encoding string `json:"encoding,omitempty"`
+
+	// Size is the full size of the body in bytes
+	Size int64 `json:"size"`
+
+	// Truncated reports whether only the first bytes of the body were kept
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// NewBody creates a complete body holding data
+func NewBody(data []byte) Body {
+	return newBody(data, int64(len(data)))
+}
+
+// newBody records data, the first bytes of a body of size bytes
+func newBody(data []byte, size int64) Body {
+	body := Body{Size: size, Truncated: int64(len(data)) < size}
+	if utf8.Valid(data) {
+		body.Content = string(data)
+	} else {
+		body.Content = base64.StdEncoding.EncodeToString(data)
+		body.Encoding = encodingBase64
+	}
+	return body
+}
+
+// Bytes returns the kept bytes of the body
+func (b Body) Bytes() ([]byte, error) {
+	if b.Encoding == encodingBase64 {
+		return base64.StdEncoding.DecodeString(b.Content)
+	}
+	return []byte(b.Content), nil
+}
+
+// Options contains configuration for the Inspector
+type Options struct {
+	// Capacity is how many exchanges are kept; older ones are dropped (optional, defaults to 100)
+	Capacity int
+
+	// MaxBodySize is how many bytes of each request and response body are kept (optional, defaults to 16 KiB)
+	MaxBodySize int
+
+	// Target is the address of the local server requests are replayed to, e.g. "localhost:3000".
+	// Replays fail when it is empty.
+	Target string
+
+	// PreserveHost keeps the recorded Host header on replays instead of rewriting it to Target
+	PreserveHost bool
+
+	// Transport sends replayed requests (optional, defaults to a transport without compression)
+	Transport http.RoundTripper
+}
+
+// Inspector records the exchanges passing through the tunnel listener.
+// A nil Inspector records nothing.
+type Inspector struct {
+	capacity     int
+	maxBodySize  int
+	target       string
+	preserveHost bool
+	transport    http.RoundTripper
+
+	mu        sync.Mutex
+	nextID    uint64
+	exchanges []Exchange
+}
+
+// New creates a new inspector
+func New(opts *Options) *Inspector {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	capacity := opts.Capacity
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	transport := opts.Transport
+	if transport == nil {
+		// Bodies are replayed and recorded as the local server encoded them
+		transport = &http.Transport{DisableCompression: true}
+	}
+
+	return &Inspector{
+		capacity:     capacity,
+		maxBodySize:  maxBodySize,
+		target:       opts.Target,
+		preserveHost: opts.PreserveHost,
+		transport:    transport,
+	}
+}
+
+// Capture starts recording an exchange for req, as read off the relay.
+// The exchange is stored once Finish is called on the returned capture.
+func (i *Inspector) Capture(req *http.Request) *Capture {
+	if i == nil {
+		return nil
+	}
+
+	return i.capture(Request{
+		Method: req.Method,
+		URL:    req.RequestURI,
+		Host:   req.Host,
+		Proto:  req.Proto,
+		Header: req.Header.Clone(),
+	})
+}
+
+// capture starts recording an exchange of request
+func (i *Inspector) capture(request Request) *Capture {
+	return &Capture{
+		inspector:    i,
+		started:      time.Now(),
+		request:      request,
+		requestBody:  &captureBuffer{limit: i.maxBodySize},
+		responseBody: &captureBuffer{limit: i.maxBodySize},
+	}
+}
+
+// List returns the recorded exchanges, most recent first
+func (i *Inspector) List() []Exchange {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	exchanges := make([]Exchange, 0, len(i.exchanges))
+	for n := len(i.exchanges) - 1; n >= 0; n-- {
+		exchanges = append(exchanges, i.exchanges[n])
+	}
+	return exchanges
+}
+
+// Get returns the recorded exchange with the given ID
+func (i *Inspector) Get(id string) (Exchange, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, exchange := range i.exchanges {
+		if exchange.ID == id {
+			return exchange, true
+		}
+	}
+	return Exchange{}, false
+}
+
+// Import stores exchanges recorded elsewhere, e.g. read from a HAR log, so they can be replayed.
+// It returns them with the IDs they were given.
+func (i *Inspector) Import(exchanges []Exchange) []Exchange {
+	imported := make([]Exchange, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		imported = append(imported, i.store(exchange))
+	}
+	return imported
+}
+
+// Clear forgets every recorded exchange
+func (i *Inspector) Clear() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.exchanges = nil
+}
+
+// store assigns the exchange an ID and keeps it, dropping the oldest exchange when full.
+// It returns the stored exchange.
+func (i *Inspector) store(exchange Exchange) Exchange {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.nextID++
+	exchange.ID = strconv.FormatUint(i.nextID, 10)
+	if len(i.exchanges) >= i.capacity {
+		i.exchanges = append(i.exchanges[:0], i.exchanges[len(i.exchanges)-i.capacity+1:]...)
+	}
+	i.exchanges = append(i.exchanges, exchange)
+	return exchange
+}
+
+// Capture records a single exchange while it is forwarded.
+// A nil Capture records nothing, so callers need not check whether inspection is enabled.
+type Capture struct {
+	inspector *Inspector
+	started   time.Time
+	replayOf  string
+
+	mu           sync.Mutex
+	request      Request
+	response     *Response
+	responded    time.Time
+	requestBody  *captureBuffer
+	responseBody *captureBuffer
+	finished     bool
+}
+
+// RequestBody returns body wrapped so the bytes read from it are recorded
+func (c *Capture) RequestBody(body io.ReadCloser) io.ReadCloser {
+	if c == nil {
+		return body
+	}
+	return &teeBody{ReadCloser: body, buffer: c.requestBody}
+}
+
+// Response records the status and headers of resp and wraps its body so the bytes read from it are recorded.
+// Bodies of protocol switches are left alone as they carry the upgraded connection.
+func (c *Capture) Response(resp *http.Response) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.responded = time.Now()
+	c.response = &Response{Status: resp.StatusCode, Proto: resp.Proto, Header: resp.Header.Clone()}
+	c.mu.Unlock()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.Body != nil {
+		resp.Body = &teeBody{ReadCloser: resp.Body, buffer: c.responseBody}
+	}
+}
+
+// Finish stores the exchange in the inspector; err is the error that ended it, if any.
+// Only the first call has an effect.
+func (c *Capture) Finish(err error) {
+	if c == nil {
+		return
+	}
+	c.finish(err)
+}
+
+// finish stores the exchange unless it already was, and returns it
+func (c *Capture) finish(err error) Exchange {
+	c.mu.Lock()
+	if c.finished {
+		c.mu.Unlock()
+		return Exchange{}
+	}
+	c.finished = true
+
+	now := time.Now()
+	exchange := Exchange{
+		StartedAt:  c.started,
+		DurationMs: milliseconds(now.Sub(c.started)),
+		Request:    c.request,
+		ReplayOf:   c.replayOf,
+	}
+	exchange.Request.Body = c.requestBody.body()
+	if c.response != nil {
+		exchange.WaitMs = milliseconds(c.responded.Sub(c.started))
+		exchange.Response = c.response
+		exchange.Response.Body = c.responseBody.body()
+	}
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	c.mu.Unlock()
+
+	return c.inspector.store(exchange)
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// captureBuffer keeps the first limit bytes written to it and counts the rest
+type captureBuffer struct {
+	limit int
+
+	mu   sync.Mutex
+	data bytes.Buffer
+	size int64
+}
+
+// Write implements io.Writer; it never fails
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size += int64(len(p))
+	if remaining := b.limit - b.data.Len(); remaining > 0 {
+		b.data.Write(p[:min(len(p), remaining)])
+	}
+	return len(p), nil
+}
+
+// body returns the recorded body
+func (b *captureBuffer) body() Body {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return newBody(b.data.Bytes(), b.size)
+}
+
+// teeBody is a body that copies the bytes read from it to a capture buffer
+type teeBody struct {
+	io.ReadCloser
+
+	buffer *captureBuffer
+}
+
+// Read implements io.Reader
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = b.buffer.Write(p[:n])
+	}
+	return n, err
+}
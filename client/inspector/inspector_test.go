@@ -0,0 +1,161 @@
+package inspector
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// record captures an exchange of req and resp through the inspector, reading both bodies fully
+func record(t *testing.T, i *Inspector, req *http.Request, resp *http.Response, err error) {
+	t.Helper()
+
+	capture := i.Capture(req)
+	if req.Body != nil {
+		_, _ = io.ReadAll(capture.RequestBody(req.Body))
+	}
+	if resp != nil {
+		capture.Response(resp)
+		_, _ = io.ReadAll(resp.Body)
+	}
+	capture.Finish(err)
+}
+
+// response builds a response with the given status and body
+func response(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestInspector_Capture(t *testing.T) {
+	i := New(nil)
+	req := httptest.NewRequest(http.MethodPost, "/hook?id=1", strings.NewReader(`{"event":"push"}`))
+	req.Header.Set("Content-Type", "application/json")
+	record(t, i, req, response(http.StatusAccepted, "ok"), nil)
+
+	exchanges := i.List()
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 exchange, got %d", len(exchanges))
+	}
+
+	exchange := exchanges[0]
+	if exchange.ID == "" {
+		t.Error("Expected the exchange to get an ID")
+	}
+	if exchange.Request.Method != http.MethodPost || exchange.Request.URL != "/hook?id=1" {
+		t.Errorf("Expected POST /hook?id=1, got %s %s", exchange.Request.Method, exchange.Request.URL)
+	}
+	if exchange.Request.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected request headers to be recorded, got %v", exchange.Request.Header)
+	}
+	if exchange.Request.Body.Content != `{"event":"push"}` || exchange.Request.Body.Size != 16 {
+		t.Errorf("Expected the request body to be recorded, got %+v", exchange.Request.Body)
+	}
+	if exchange.Response == nil || exchange.Response.Status != http.StatusAccepted {
+		t.Fatalf("Expected response status %d, got %+v", http.StatusAccepted, exchange.Response)
+	}
+	if exchange.Response.Body.Content != "ok" {
+		t.Errorf("Expected response body %q, got %q", "ok", exchange.Response.Body.Content)
+	}
+	if exchange.DurationMs < exchange.WaitMs {
+		t.Errorf("Expected duration %f to include the wait %f", exchange.DurationMs, exchange.WaitMs)
+	}
+
+	if got, ok := i.Get(exchange.ID); !ok || got.ID != exchange.ID {
+		t.Errorf("Expected Get to return exchange %s, got %+v", exchange.ID, got)
+	}
+}
+
+func TestInspector_Bodies(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantContent   string
+		wantEncoding  string
+		wantTruncated bool
+	}{
+		{name: "text", body: "hello", wantContent: "hello"},
+		{name: "truncated", body: strings.Repeat("a", 12), wantContent: "aaaaaaaa", wantTruncated: true},
+		{name: "binary", body: "\xff\xfe\x00", wantContent: "//4A", wantEncoding: encodingBase64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := New(&Options{MaxBodySize: 8})
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			record(t, i, req, nil, nil)
+
+			body := i.List()[0].Request.Body
+			if body.Content != tt.wantContent || body.Encoding != tt.wantEncoding {
+				t.Errorf("Expected content %q encoded %q, got %q encoded %q",
+					tt.wantContent, tt.wantEncoding, body.Content, body.Encoding)
+			}
+			if body.Truncated != tt.wantTruncated || body.Size != int64(len(tt.body)) {
+				t.Errorf("Expected size %d truncated %v, got size %d truncated %v",
+					len(tt.body), tt.wantTruncated, body.Size, body.Truncated)
+			}
+
+			data, err := body.Bytes()
+			if err != nil || !strings.HasPrefix(tt.body, string(data)) {
+				t.Errorf("Expected Bytes to return the kept prefix of %q, got %q (%v)", tt.body, data, err)
+			}
+		})
+	}
+}
+
+func TestInspector_Error(t *testing.T) {
+	i := New(nil)
+	record(t, i, httptest.NewRequest(http.MethodGet, "/", nil), nil, errors.New("connection refused"))
+
+	exchange := i.List()[0]
+	if exchange.Error != "connection refused" {
+		t.Errorf("Expected error %q, got %q", "connection refused", exchange.Error)
+	}
+	if exchange.Response != nil {
+		t.Errorf("Expected no response, got %+v", exchange.Response)
+	}
+}
+
+func TestInspector_Capacity(t *testing.T) {
+	i := New(&Options{Capacity: 3})
+	for _, path := range []string{"/1", "/2", "/3", "/4", "/5"} {
+		record(t, i, httptest.NewRequest(http.MethodGet, path, nil), response(http.StatusOK, ""), nil)
+	}
+
+	exchanges := i.List()
+	if len(exchanges) != 3 {
+		t.Fatalf("Expected 3 exchanges, got %d", len(exchanges))
+	}
+	for n, want := range []string{"/5", "/4", "/3"} {
+		if exchanges[n].Request.URL != want {
+			t.Errorf("Expected exchange %d to be %s, got %s", n, want, exchanges[n].Request.URL)
+		}
+	}
+	if _, ok := i.Get(exchanges[2].ID); !ok {
+		t.Errorf("Expected exchange %s to be kept", exchanges[2].ID)
+	}
+
+	i.Clear()
+	if len(i.List()) != 0 {
+		t.Errorf("Expected no exchanges after Clear, got %d", len(i.List()))
+	}
+}
+
+func TestInspector_Nil(t *testing.T) {
+	var i *Inspector
+	capture := i.Capture(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := io.NopCloser(strings.NewReader("x"))
+	if capture.RequestBody(body) != body {
+		t.Error("Expected a nil capture to leave the body alone")
+	}
+	capture.Response(response(http.StatusOK, ""))
+	capture.Finish(nil)
+}
@@ -0,0 +1,217 @@
+package inspector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when no recorded exchange has the requested ID
+	ErrNotFound = errors.New("request not found")
+
+	// ErrTruncatedBody is returned when replaying a request whose body was only partly recorded
+	// without providing a replacement body
+	ErrTruncatedBody = errors.New("recorded request body is truncated, provide the body to replay")
+
+	// ErrNoTarget is returned when the inspector does not know the local server to replay to
+	ErrNoTarget = errors.New("no replay target configured")
+)
+
+// replayedHeaders are headers recomputed for the replayed request instead of copied from the recording
+var replayedHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReplayRequest holds the edits applied to a recorded request before it is replayed
+type ReplayRequest struct {
+	// Header replaces the recorded request headers (optional)
+	Header http.Header `json:"header,omitempty"`
+
+	// Body replaces the recorded request body (optional)
+	Body *Body `json:"body,omitempty"`
+}
+
+// ReplayResponse is the result of replaying a recorded request
+type ReplayResponse struct {
+	// Exchange is the replayed exchange, recorded like the forwarded ones
+	Exchange Exchange `json:"exchange"`
+
+	// Diff compares the original response with the new one line by line, prefixing lines only in the
+	// original with "-" and lines only in the new response with "+". It is empty when nothing changed.
+	Diff string `json:"diff"`
+}
+
+// Replay re-sends the recorded exchange with the given ID to the local server, applying edits
+// (optional), and records the new exchange. A failure to reach the local server is reported in the
+// returned exchange rather than as an error.
+func (i *Inspector) Replay(ctx context.Context, id string, edits *ReplayRequest) (*ReplayResponse, error) {
+	original, ok := i.Get(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if i.target == "" {
+		return nil, ErrNoTarget
+	}
+
+	request := original.Request
+	request.Header = request.Header.Clone()
+	if edits != nil && edits.Header != nil {
+		request.Header = edits.Header.Clone()
+	}
+
+	body := request.Body
+	if edits != nil && edits.Body != nil {
+		body = *edits.Body
+	} else if body.Truncated {
+		return nil, ErrTruncatedBody
+	}
+	content, err := body.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+
+	req, err := i.replayRequest(ctx, request, content)
+	if err != nil {
+		return nil, err
+	}
+	request.Host = req.Host
+
+	capture := i.capture(request)
+	capture.replayOf = original.ID
+	req.Body = capture.RequestBody(req.Body)
+
+	resp, err := i.transport.RoundTrip(req)
+	if err == nil {
+		capture.Response(resp)
+		_, err = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	exchange := capture.finish(err)
+
+	return &ReplayResponse{Exchange: exchange, Diff: Diff(original.Response, exchange.Response)}, nil
+}
+
+// replayRequest builds the request sending the recorded request, with the given body, to the local server
+func (i *Inspector) replayRequest(ctx context.Context, request Request, body []byte) (*http.Request, error) {
+	url := "http://" + i.target + request.URL
+	req, err := http.NewRequestWithContext(ctx, request.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded request: %w", err)
+	}
+
+	req.Header = request.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for _, name := range replayedHeaders {
+		req.Header.Del(name)
+	}
+	if i.preserveHost && request.Host != "" {
+		req.Host = request.Host
+	}
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+	return req, nil
+}
+
+// Diff compares two responses line by line: the status, the headers sorted by name and the body.
+// Date headers are left out as they always differ. Either response may be nil, e.g. when the local
+// server was unreachable. Diff returns an empty string when the responses are the same.
+func Diff(original, replayed *Response) string {
+	before, after := responseLines(original), responseLines(replayed)
+	lines := diffLines(before, after)
+
+	changed := false
+	for _, line := range lines {
+		if !strings.HasPrefix(line, " ") {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
+
+// responseLines renders a response as the lines Diff compares
+func responseLines(resp *Response) []string {
+	if resp == nil {
+		return []string{"(no response)"}
+	}
+
+	lines := []string{fmt.Sprintf("%d %s", resp.Status, http.StatusText(resp.Status))}
+	header := resp.Header.Clone()
+	header.Del("Date")
+	var buf bytes.Buffer
+	_ = header.WriteSubset(&buf, nil)
+	if buf.Len() > 0 {
+		lines = append(lines, strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")...)
+	}
+	lines = append(lines, "")
+
+	body := resp.Body.Content
+	if resp.Body.Encoding == encodingBase64 {
+		body = fmt.Sprintf("(binary body, %d bytes, base64) %s", resp.Body.Size, body)
+	}
+	lines = append(lines, strings.Split(body, "\n")...)
+	if resp.Body.Truncated {
+		lines = append(lines, fmt.Sprintf("(truncated, %d bytes in total)", resp.Body.Size))
+	}
+	return lines
+}
+
+// diffLines returns the lines of a and b marked with " ", "-" or "+" along their longest common subsequence
+func diffLines(a, b []string) []string {
+	// common[x][y] is the length of the longest common subsequence of a[x:] and b[y:]
+	common := make([][]int, len(a)+1)
+	for x := range common {
+		common[x] = make([]int, len(b)+1)
+	}
+	for x := len(a) - 1; x >= 0; x-- {
+		for y := len(b) - 1; y >= 0; y-- {
+			if a[x] == b[y] {
+				common[x][y] = common[x+1][y+1] + 1
+			} else {
+				common[x][y] = max(common[x+1][y], common[x][y+1])
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	x, y := 0, 0
+	for x < len(a) && y < len(b) {
+		switch {
+		case a[x] == b[y]:
+			lines = append(lines, " "+a[x])
+			x++
+			y++
+		case common[x+1][y] >= common[x][y+1]:
+			lines = append(lines, "-"+a[x])
+			x++
+		default:
+			lines = append(lines, "+"+b[y])
+			y++
+		}
+	}
+	for ; x < len(a); x++ {
+		lines = append(lines, "-"+a[x])
+	}
+	for ; y < len(b); y++ {
+		lines = append(lines, "+"+b[y])
+	}
+	return lines
+}
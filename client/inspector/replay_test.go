@@ -0,0 +1,161 @@
+package inspector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// replayTarget starts a local server answering with handler and an inspector replaying to it
+func replayTarget(t *testing.T, handler http.HandlerFunc, opts *Options) *Inspector {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.Target = strings.TrimPrefix(server.URL, "http://")
+	return New(opts)
+}
+
+func TestInspector_Replay(t *testing.T) {
+	var gotHeader, gotBody, gotHost string
+	i := replayTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotHeader, gotBody, gotHost = r.Header.Get("X-Signature"), string(body), r.Host
+		_, _ = w.Write([]byte("processed " + string(body)))
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("event"))
+	req.Host = "63873749.azhexgate.com"
+	req.Header.Set("X-Signature", "old")
+	record(t, i, req, response(http.StatusInternalServerError, "boom"), nil)
+	original := i.List()[0]
+
+	edited := NewBody([]byte("edited"))
+	result, err := i.Replay(context.Background(), original.ID, &ReplayRequest{
+		Header: http.Header{"X-Signature": {"new"}},
+		Body:   &edited,
+	})
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+
+	if gotHeader != "new" || gotBody != "edited" {
+		t.Errorf("Expected the edited request to reach the local app, got X-Signature %q and body %q",
+			gotHeader, gotBody)
+	}
+	if gotHost != i.target {
+		t.Errorf("Expected Host to be rewritten to %s, got %s", i.target, gotHost)
+	}
+
+	exchange := result.Exchange
+	if exchange.ReplayOf != original.ID || exchange.ID == original.ID {
+		t.Errorf("Expected a new exchange replaying %s, got ID %s replaying %q",
+			original.ID, exchange.ID, exchange.ReplayOf)
+	}
+	if exchange.Response == nil || exchange.Response.Body.Content != "processed edited" {
+		t.Fatalf("Expected the new response to be recorded, got %+v", exchange.Response)
+	}
+	if _, ok := i.Get(exchange.ID); !ok {
+		t.Errorf("Expected the replay to be recorded as %s", exchange.ID)
+	}
+
+	for _, want := range []string{"-500 Internal Server Error", "+200 OK", "-boom", "+processed edited"} {
+		if !strings.Contains(result.Diff, want) {
+			t.Errorf("Expected diff to contain %q, got:\n%s", want, result.Diff)
+		}
+	}
+}
+
+func TestInspector_ReplayUnchanged(t *testing.T) {
+	i := replayTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(body)
+	}, &Options{PreserveHost: true})
+
+	req := httptest.NewRequest(http.MethodPut, "/echo", strings.NewReader("same"))
+	resp := response(http.StatusOK, "same")
+	resp.Header.Set("Content-Length", "4")
+	record(t, i, req, resp, nil)
+
+	result, err := i.Replay(context.Background(), i.List()[0].ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if result.Diff != "" {
+		t.Errorf("Expected no diff for the same response, got:\n%s", result.Diff)
+	}
+	if result.Exchange.Request.Host != "example.com" {
+		t.Errorf("Expected the recorded Host to be preserved, got %q", result.Exchange.Request.Host)
+	}
+}
+
+func TestInspector_ReplayErrors(t *testing.T) {
+	i := replayTarget(t, func(w http.ResponseWriter, r *http.Request) {}, &Options{MaxBodySize: 4})
+	record(t, i, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long")), nil, nil)
+	id := i.List()[0].ID
+
+	if _, err := i.Replay(context.Background(), "missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := i.Replay(context.Background(), id, nil); !errors.Is(err, ErrTruncatedBody) {
+		t.Errorf("Expected ErrTruncatedBody, got %v", err)
+	}
+
+	complete := NewBody([]byte("too long"))
+	if _, err := i.Replay(context.Background(), id, &ReplayRequest{Body: &complete}); err != nil {
+		t.Errorf("Expected a replay with a complete body to succeed, got %v", err)
+	}
+
+	untargeted := New(nil)
+	record(t, untargeted, httptest.NewRequest(http.MethodGet, "/", nil), nil, nil)
+	if _, err := untargeted.Replay(context.Background(), "1", nil); !errors.Is(err, ErrNoTarget) {
+		t.Errorf("Expected ErrNoTarget, got %v", err)
+	}
+}
+
+func TestInspector_ReplayUnreachable(t *testing.T) {
+	i := New(&Options{Target: "127.0.0.1:1"})
+	record(t, i, httptest.NewRequest(http.MethodGet, "/", nil), response(http.StatusOK, "ok"), nil)
+
+	result, err := i.Replay(context.Background(), i.List()[0].ID, nil)
+	if err != nil {
+		t.Fatalf("Expected the failure to be reported in the exchange, got %v", err)
+	}
+	if result.Exchange.Error == "" || result.Exchange.Response != nil {
+		t.Errorf("Expected a failed exchange without response, got %+v", result.Exchange)
+	}
+	if !strings.Contains(result.Diff, "+(no response)") {
+		t.Errorf("Expected the diff to show the missing response, got:\n%s", result.Diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	original := &Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"text/plain"}, "Date": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+		Body:   NewBody([]byte("a\nb\nc")),
+	}
+	replayed := &Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"text/plain"}, "Date": {"Tue, 02 Jan 2024 00:00:00 GMT"}},
+		Body:   NewBody([]byte("a\nx\nc")),
+	}
+
+	want := strings.Join([]string{" 200 OK", " Content-Type: text/plain", " ", " a", "-b", "+x", " c"}, "\n")
+	if got := Diff(original, replayed); got != want {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := Diff(original, original); got != "" {
+		t.Errorf("Expected no diff for the same response, got:\n%s", got)
+	}
+}
@@ -0,0 +1,231 @@
+package inspector
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// maxReplayRequestSize bounds the edits accepted by the replay endpoint, bodies included
+const maxReplayRequestSize = 10 << 20
+
+// indexPage is the web page listing the recorded exchanges through the JSON API
+//
+//go:embed index.html
+var indexPage []byte
+
+// ListResponse is the response of the exchange list endpoint
+type ListResponse struct {
+	Requests []Exchange `json:"requests"`
+}
+
+// ServerOptions contains configuration for the Server
+type ServerOptions struct {
+	// Addr is the address to listen on (optional, defaults to DefaultAddr)
+	Addr string
+
+	// Inspector holds the exchanges the server shows (optional, defaults to an empty inspector)
+	Inspector *Inspector
+
+	// Logger is used for server errors (optional)
+	Logger *logging.Logger
+}
+
+// Server serves the inspector web page and its JSON API:
+//
+//	GET    /                          web page
+//	GET    /api/requests              recorded exchanges, most recent first
+//	GET    /api/requests/{id}         a single exchange
+//	POST   /api/requests/{id}/replay  replay an exchange, with a ReplayRequest body of edits
+//	DELETE /api/requests              forget every exchange
+//	GET    /api/har                   recorded exchanges as a HAR 1.2 log, credentials redacted
+type Server struct {
+	addr      string
+	inspector *Inspector
+	logger    *logging.Logger
+	server    *http.Server
+}
+
+// NewServer creates a new inspector server
+func NewServer(opts *ServerOptions) *Server {
+	if opts == nil {
+		opts = &ServerOptions{}
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	inspector := opts.Inspector
+	if inspector == nil {
+		inspector = New(nil)
+	}
+
+	s := &Server{addr: addr, inspector: inspector, logger: opts.Logger}
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the handler serving the web page and the JSON API, guarded against other web sites
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.index)
+	mux.HandleFunc("GET /api/requests", s.list)
+	mux.HandleFunc("DELETE /api/requests", s.clear)
+	mux.HandleFunc("GET /api/requests/{id}", s.get)
+	mux.HandleFunc("POST /api/requests/{id}/replay", s.replay)
+	mux.HandleFunc("GET /api/har", s.har)
+	return s.guard(mux)
+}
+
+// guard keeps web pages of other sites away from the inspector. Requests must name it by an IP address,
+// localhost or the configured host, so a DNS rebinding name cannot reach it, and changes must come from
+// the inspector page itself or carry a JSON body, which other sites cannot send without a CORS preflight.
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			http.Error(w, "Invalid Host header", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			http.Error(w, "Cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a Host header names the inspector rather than another site
+func (s *Server) allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if configured, _, err := net.SplitHostPort(s.addr); err == nil && configured != "" &&
+		strings.EqualFold(host, configured) {
+		return true
+	}
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
+
+// sameOrigin reports whether a request changing state was sent by the inspector page, or by a client
+// sending JSON when the request has no Origin
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		return mediaType == "application/json"
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// Listen binds the server address and serves in the background until ctx is done.
+// It returns the bound address, e.g. to report the port chosen for ":0".
+func (s *Server) Listen(ctx context.Context) (net.Addr, error) {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && s.logger != nil {
+			s.logger.Error("Inspector server failed", logging.Error(err))
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = s.server.Close()
+	}()
+
+	return ln.Addr(), nil
+}
+
+// Close immediately closes the server
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// index serves the web page
+func (s *Server) index(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(indexPage)
+}
+
+// list serves the recorded exchanges
+func (s *Server) list(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, ListResponse{Requests: s.inspector.List()})
+}
+
+// get serves the exchange named by the id path value
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	exchange, ok := s.inspector.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, exchange)
+}
+
+// replay replays the exchange named by the id path value with the edits in the request body
+func (s *Server) replay(w http.ResponseWriter, r *http.Request) {
+	var edits ReplayRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxReplayRequestSize)).Decode(&edits)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.inspector.Replay(r.Context(), r.PathValue("id"), &edits)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Request not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// har serves the recorded exchanges as a HAR log to download
+func (s *Server) har(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Disposition", `attachment; filename="azhexgate.har"`)
+	writeJSON(w, http.StatusOK, ExportHAR(s.inspector.List(), nil))
+}
+
+// clear forgets every recorded exchange
+func (s *Server) clear(w http.ResponseWriter, _ *http.Request) {
+	s.inspector.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as a JSON response, marshaling first so errors can still change the status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,226 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_API(t *testing.T) {
+	i := New(nil)
+	record(t, i, httptest.NewRequest(http.MethodGet, "/first", nil), response(http.StatusOK, "one"), nil)
+	record(t, i, httptest.NewRequest(http.MethodGet, "/second", nil), response(http.StatusNotFound, "two"), nil)
+
+	server := httptest.NewServer(NewServer(&ServerOptions{Inspector: i}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/requests")
+	if err != nil {
+		t.Fatalf("Failed to list requests: %v", err)
+	}
+	var list ListResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+
+	if len(list.Requests) != 2 || list.Requests[0].Request.URL != "/second" {
+		t.Fatalf("Expected 2 requests, most recent first, got %+v", list.Requests)
+	}
+
+	resp, err = http.Get(server.URL + "/api/requests/" + list.Requests[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get request: %v", err)
+	}
+	var exchange Exchange
+	_ = json.NewDecoder(resp.Body).Decode(&exchange)
+	_ = resp.Body.Close()
+
+	if exchange.Request.URL != "/first" || exchange.Response == nil || exchange.Response.Body.Content != "one" {
+		t.Errorf("Expected the /first exchange, got %+v", exchange)
+	}
+
+	resp, err = http.Get(server.URL + "/api/requests/404")
+	if err != nil {
+		t.Fatalf("Failed to get request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown request, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/requests", nil)
+	req.Header.Set("Origin", server.URL)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to clear requests: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || len(i.List()) != 0 {
+		t.Errorf("Expected status %d and no requests left, got %d and %d requests",
+			http.StatusNoContent, resp.StatusCode, len(i.List()))
+	}
+}
+
+func TestServer_RefusesOtherSites(t *testing.T) {
+	handler := NewServer(&ServerOptions{Addr: "127.0.0.1:4040"}).Handler()
+
+	tests := []struct {
+		name        string
+		method      string
+		host        string
+		origin      string
+		contentType string
+		wantStatus  int
+	}{
+		{name: "loopback address", method: http.MethodGet, host: "127.0.0.1:4040", wantStatus: http.StatusOK},
+		{name: "localhost", method: http.MethodGet, host: "localhost:4040", wantStatus: http.StatusOK},
+		{name: "IPv6 loopback", method: http.MethodGet, host: "[::1]:4040", wantStatus: http.StatusOK},
+		// A page on a rebinding name reaches the inspector with its own name in Host
+		{name: "DNS rebinding", method: http.MethodGet, host: "rebind.example.com:4040",
+			wantStatus: http.StatusForbidden},
+		{name: "same-origin delete", method: http.MethodDelete, host: "127.0.0.1:4040",
+			origin: "http://127.0.0.1:4040", wantStatus: http.StatusNoContent},
+		{name: "cross-origin delete", method: http.MethodDelete, host: "127.0.0.1:4040",
+			origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "JSON delete without origin", method: http.MethodDelete, host: "127.0.0.1:4040",
+			contentType: "application/json", wantStatus: http.StatusNoContent},
+		// A cross-site form can post text/plain without a preflight
+		{name: "text post without origin", method: http.MethodPost, host: "127.0.0.1:4040",
+			contentType: "text/plain", wantStatus: http.StatusForbidden},
+		{name: "cross-origin JSON post", method: http.MethodPost, host: "127.0.0.1:4040",
+			origin: "null", contentType: "application/json", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/requests"
+			if tt.method == http.MethodPost {
+				path = "/api/requests/missing/replay"
+			}
+			req := httptest.NewRequest(tt.method, path, nil)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestServer_Page(t *testing.T) {
+	server := httptest.NewServer(NewServer(nil).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to get page: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("Expected an HTML page, got Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "/api/requests") {
+		t.Error("Expected the page to load requests from the JSON API")
+	}
+}
+
+func TestServer_Listen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := NewServer(&ServerOptions{Addr: "127.0.0.1:0"}).Listen(ctx)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr.String() + "/api/requests")
+	if err != nil {
+		t.Fatalf("Failed to reach the inspector: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestServer_Replay(t *testing.T) {
+	i := replayTarget(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fixed"))
+	}, nil)
+	record(t, i, httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("event")),
+		response(http.StatusInternalServerError, "broken"), nil)
+	id := i.List()[0].ID
+
+	server := httptest.NewServer(NewServer(&ServerOptions{Inspector: i}).Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{name: "without edits", id: id, wantStatus: http.StatusOK},
+		{name: "with edits", id: id, body: `{"header":{"X-Test":["1"]},"body":{"content":"edited"}}`,
+			wantStatus: http.StatusOK},
+		{name: "unknown request", id: "missing", wantStatus: http.StatusNotFound},
+		{name: "invalid edits", id: id, body: "{", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/api/requests/"+tt.id+"/replay", "application/json",
+				strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to replay: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result ReplayResponse
+			_ = json.NewDecoder(resp.Body).Decode(&result)
+			if result.Exchange.ReplayOf != id || !strings.Contains(result.Diff, "+fixed") {
+				t.Errorf("Expected a replay of %s with a diff, got %+v", id, result)
+			}
+		})
+	}
+}
+
+func TestServer_HAR(t *testing.T) {
+	server := httptest.NewServer(NewServer(&ServerOptions{Inspector: harFixture(t)}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/har")
+	if err != nil {
+		t.Fatalf("Failed to export HAR: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var har HAR
+	_ = json.NewDecoder(resp.Body).Decode(&har)
+	if len(har.Log.Entries) != 2 || har.Log.Entries[0].Request.Headers[1].Value == "Bearer secret" {
+		t.Errorf("Expected 2 redacted entries, got %+v", har.Log.Entries)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), "azhexgate.har") {
+		t.Errorf("Expected the HAR as a download, got Content-Disposition %q", resp.Header.Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+const (
+	// defaultMinBackoff is the first delay after an Accept failure
+	defaultMinBackoff = 500 * time.Millisecond
+
+	// defaultMaxBackoff caps the delay between reconnect attempts
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// errorClass is how the listener reacts to an Accept error
+type errorClass int
+
+const (
+	// errorTransient errors are retried on the same relay listener after a backoff
+	errorTransient errorClass = iota
+
+	// errorSessionLost errors need a new relay session (e.g. an expired or revoked token)
+	errorSessionLost
+
+	// errorPermanent errors stop the listener
+	errorPermanent
+)
+
+// classifyAcceptError decides whether an Accept error is worth retrying
+func classifyAcceptError(err error) errorClass {
+	switch {
+	case errors.Is(err, relay.ErrListenerClosed):
+		return errorPermanent
+	case errors.Is(err, relay.ErrUnauthorized):
+		return errorSessionLost
+	default:
+		// Network failures, DNS errors and dropped control channels recover on their own
+		return errorTransient
+	}
+}
+
+// backoff computes jittered exponential delays between reconnect attempts
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// next returns the delay before the next attempt.
+// Half of the delay is fixed and half is random, so clients that lost the relay
+// together do not reconnect in lockstep.
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		delay = b.min << b.attempt
+	}
+	b.attempt++
+
+	half := delay / 2
+	//nolint:gosec // jitter does not need a cryptographically secure source
+	return half + rand.N(half+1)
+}
+
+// reset starts the delays over after a successful Accept
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+func TestClassifyAcceptError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{name: "listener closed", err: relay.ErrListenerClosed, want: errorPermanent},
+		{name: "unauthorized", err: fmt.Errorf("listen failed: %w", relay.ErrUnauthorized), want: errorSessionLost},
+		{name: "network error", err: errors.New("dial tcp: connection refused"), want: errorTransient},
+		{name: "offline", err: relay.ErrListenerOffline, want: errorTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyAcceptError(tt.err); got != tt.want {
+				t.Errorf("Expected class %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBackoff_Bounds(t *testing.T) {
+	b := &backoff{min: 100 * time.Millisecond, max: time.Second}
+
+	// Delays double from min and stop growing at max
+	want := []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond,
+		time.Second, time.Second,
+	}
+	for i, full := range want {
+		delay := b.next()
+		if delay < full/2 || delay > full {
+			t.Errorf("Attempt %d: expected delay in [%s, %s], got %s", i, full/2, full, delay)
+		}
+	}
+
+	b.reset()
+	if delay := b.next(); delay > 100*time.Millisecond {
+		t.Errorf("Expected delay to restart from min after reset, got %s", delay)
+	}
+}
+
+func TestBackoff_ManyAttemptsDoNotOverflow(t *testing.T) {
+	b := &backoff{min: time.Second, max: time.Minute}
+	for i := 0; i < 100; i++ {
+		if delay := b.next(); delay <= 0 || delay > time.Minute {
+			t.Fatalf("Attempt %d: expected delay in (0, 1m], got %s", i, delay)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// Mode selects how relay connections are forwarded to the local server
+type Mode int
+
+const (
+	// ModeRaw copies bytes between the relay and the local server unchanged
+	ModeRaw Mode = iota
+	// ModeHTTP parses each request off the relay stream and forwards it through a pooled transport
+	ModeHTTP
+)
+
+// String returns the string representation of a Mode
+func (m Mode) String() string {
+	switch m {
+	case ModeRaw:
+		return "raw"
+	case ModeHTTP:
+		return "http"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseMode converts a string to a Mode
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "raw", "tcp":
+		return ModeRaw, nil
+	case "http":
+		return ModeHTTP, nil
+	default:
+		return ModeRaw, fmt.Errorf("unknown forwarding mode %q (expected raw or http)", s)
+	}
+}
+
+// hopHeaders are connection-scoped headers that are not forwarded (RFC 9110, section 7.6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// newTransport creates the pooled transport used to reach the local server
+func newTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		// Bodies are forwarded as the local server encoded them
+		DisableCompression: true,
+	}
+}
+
+// serveHTTP reads requests off the relay connection until it is closed, forwarding each one
+// to the local server and writing the response back
+func (l *Listener) serveHTTP(ctx context.Context, relayConn relay.Connection, logger *logging.Logger) {
+	defer func() {
+		_ = relayConn.Close()
+	}()
+
+	reader := bufio.NewReader(relayConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if logger != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Debug("Failed to read request from relay", logging.Error(err))
+			}
+			if !errors.Is(err, io.EOF) {
+				writeErrorResponse(relayConn, http.StatusBadRequest)
+			}
+			return
+		}
+
+		keepAlive, err := l.forwardRequest(ctx, relayConn, reader, req, logger)
+		if err != nil || !keepAlive {
+			return
+		}
+	}
+}
+
+// forwardRequest sends one request to the local server and writes the response to the relay.
+// It reports whether the relay connection can carry another request.
+// reader is the buffered relay stream the request was read from; after a protocol switch
+// (e.g. a WebSocket upgrade) its remaining bytes are copied to the local server unchanged.
+func (l *Listener) forwardRequest(ctx context.Context, relayConn relay.Connection, reader *bufio.Reader,
+	req *http.Request, logger *logging.Logger) (keepAlive bool, err error) {
+	outReq := l.outgoingRequest(ctx, req)
+	capture := l.inspector.Capture(req)
+	defer func() { capture.Finish(err) }()
+
+	// The transport may finish with the body after RoundTrip returns; closing it drains the rest
+	var body *signalingBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &signalingBody{ReadCloser: capture.RequestBody(req.Body), closed: make(chan struct{})}
+		outReq.Body = body
+	}
+
+	resp, err := l.transport.RoundTrip(outReq)
+	if err != nil {
+		if logger != nil {
+			logger.Error("Failed to forward request to local server",
+				logging.String("method", req.Method),
+				logging.String("path", req.URL.Path),
+				logging.Error(err))
+		}
+		writeErrorResponse(relayConn, http.StatusBadGateway)
+		return false, err
+	}
+	capture.Response(resp)
+	defer func() { _ = resp.Body.Close() }()
+
+	if logger != nil {
+		logger.Debug("Forwarded request",
+			logging.String("method", req.Method),
+			logging.String("path", req.URL.Path),
+			logging.Int("status", resp.StatusCode))
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return false, switchProtocols(relayConn, reader, req, resp, logger)
+	}
+
+	// A body without a length ends when the relay connection is closed
+	chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+	keepAlive = !req.Close && !resp.Close && (resp.ContentLength >= 0 || chunked)
+
+	removeHopHeaders(resp.Header)
+	resp.ProtoMajor, resp.ProtoMinor = 1, 1
+	resp.Close = !keepAlive
+	if err := resp.Write(relayConn); err != nil {
+		return false, err
+	}
+	if !keepAlive {
+		return false, nil
+	}
+
+	// Wait until the body is consumed so the next request starts at a message boundary
+	if body != nil {
+		select {
+		case <-body.closed:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return true, nil
+}
+
+// outgoingRequest converts a request read off the relay into a client request for the local server
+func (l *Listener) outgoingRequest(ctx context.Context, req *http.Request) *http.Request {
+	outReq := req.Clone(ctx)
+	outReq.RequestURI = ""
+	outReq.URL.Scheme = "http"
+	outReq.URL.Host = l.localAddr
+	if !l.preserveHost {
+		outReq.Host = l.localAddr
+	}
+	outReq.Close = false
+
+	removeHopHeaders(outReq.Header)
+	if protocol := upgradeProtocol(req.Header); protocol != "" {
+		outReq.Header.Set("Connection", "Upgrade")
+		outReq.Header.Set("Upgrade", protocol)
+	}
+	return outReq
+}
+
+// switchProtocols completes a protocol upgrade: it relays the 101 response and then copies
+// bytes both ways between the relay and the local server until either side closes
+func switchProtocols(relayConn relay.Connection, reader *bufio.Reader, req *http.Request, resp *http.Response,
+	logger *logging.Logger) error {
+	protocol := upgradeProtocol(resp.Header)
+	localConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok || protocol == "" || !strings.EqualFold(protocol, upgradeProtocol(req.Header)) {
+		writeErrorResponse(relayConn, http.StatusBadGateway)
+		return fmt.Errorf("local server switched to unexpected protocol %q", protocol)
+	}
+	defer func() { _ = localConn.Close() }()
+
+	removeHopHeaders(resp.Header)
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Upgrade", protocol)
+	if _, err := fmt.Fprintf(relayConn, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(relayConn); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(relayConn, "\r\n"); err != nil {
+		return err
+	}
+
+	if logger != nil {
+		logger.Debug("Switched protocols", logging.String("protocol", protocol), logging.String("path", req.URL.Path))
+	}
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(localConn, reader)
+		done <- err
+	}()
+	go func() {
+		_, err := io.Copy(relayConn, localConn)
+		done <- err
+	}()
+
+	// Closing both sides unblocks the other direction
+	err := <-done
+	_ = relayConn.Close()
+	_ = localConn.Close()
+	<-done
+	return err
+}
+
+// upgradeProtocol returns the protocol requested by the Upgrade header when the Connection
+// header carries the upgrade option, and an empty string otherwise
+func upgradeProtocol(header http.Header) string {
+	for _, value := range header.Values("Connection") {
+		for _, option := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "upgrade") {
+				return header.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// removeHopHeaders deletes hop-by-hop headers, including those named by the Connection header
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// signalingBody is a request body that reports when the transport closes it
+type signalingBody struct {
+	io.ReadCloser
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Close closes the body and signals waiters
+func (b *signalingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { close(b.closed) })
+	return err
+}
+
+// writeErrorResponse writes a minimal HTTP error response and asks the peer to close the connection
+func writeErrorResponse(w io.Writer, status int) {
+	body := http.StatusText(status)
+	_, _ = fmt.Fprintf(w,
+		"HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, http.StatusText(status), len(body), body)
+}
@@ -0,0 +1,418 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienstroheker/AzHexGate/client/inspector"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// startHTTPListener runs an HTTP mode listener forwarding to handler and returns a sender reaching it
+func startHTTPListener(t *testing.T, handler http.HandlerFunc, preserveHost bool) *relay.MemorySender {
+	t.Helper()
+
+	localServer := httptest.NewServer(handler)
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	listener := NewListener(&Options{
+		Relay:        memoryListener,
+		LocalAddr:    strings.TrimPrefix(localServer.URL, "http://"),
+		Mode:         ModeHTTP,
+		PreserveHost: preserveHost,
+	})
+	t.Cleanup(func() { _ = listener.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	return relay.NewMemorySender(memoryListener)
+}
+
+// dialRelay opens a relay connection and returns it with a reader for responses
+func dialRelay(t *testing.T, sender relay.Sender) (relay.Connection, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := sender.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, bufio.NewReader(conn)
+}
+
+// readBody reads a response off the relay and returns its status and body
+func readBody(t *testing.T, reader *bufio.Reader, method string) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := http.ReadResponse(reader, &http.Request{Method: method})
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	return resp, string(body)
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Mode
+		wantErr bool
+	}{
+		{input: "http", want: ModeHTTP},
+		{input: "HTTP", want: ModeHTTP},
+		{input: "raw", want: ModeRaw},
+		{input: "tcp", want: ModeRaw},
+		{input: "udp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mode, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && mode != tt.want {
+				t.Errorf("Expected mode %s, got %s", tt.want, mode)
+			}
+		})
+	}
+}
+
+func TestHTTPMode_HostHeader(t *testing.T) {
+	echoHost := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}
+
+	tests := []struct {
+		name         string
+		preserveHost bool
+		wantPublic   bool
+	}{
+		{name: "rewritten to local target", preserveHost: false, wantPublic: false},
+		{name: "preserved", preserveHost: true, wantPublic: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, reader := dialRelay(t, startHTTPListener(t, echoHost, tt.preserveHost))
+
+			_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: 63873749.azhexgate.com\r\n\r\n"))
+			_, body := readBody(t, reader, http.MethodGet)
+
+			if isPublic := body == "63873749.azhexgate.com"; isPublic != tt.wantPublic {
+				t.Errorf("Expected public Host %v, local app saw %q", tt.wantPublic, body)
+			}
+			if !tt.wantPublic && !strings.HasPrefix(body, "127.0.0.1:") {
+				t.Errorf("Expected Host to be the local target, got %q", body)
+			}
+		})
+	}
+}
+
+func TestHTTPMode_KeepAlive(t *testing.T) {
+	sender := startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}, false)
+	conn, reader := dialRelay(t, sender)
+
+	for _, path := range []string{"/first", "/second", "/third"} {
+		_, _ = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		resp, body := readBody(t, reader, http.MethodGet)
+		if body != path {
+			t.Errorf("Expected body %q, got %q", path, body)
+		}
+		if resp.Close {
+			t.Errorf("Expected the relay connection to stay open after %s", path)
+		}
+	}
+
+	// Connection: close ends the relay connection after the response
+	_, _ = conn.Write([]byte("GET /last HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	resp, _ := readBody(t, reader, http.MethodGet)
+	if !resp.Close {
+		t.Error("Expected Connection: close on the last response")
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the relay connection to be closed, got %v", err)
+	}
+}
+
+func TestHTTPMode_ResponseEndsConnection(t *testing.T) {
+	sender := startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/close" {
+			w.Header().Set("Connection", "close")
+			_, _ = w.Write([]byte("closing"))
+			return
+		}
+
+		// Without a length or chunking, the body is delimited by closing the connection
+		conn, buffered, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = buffered.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nstreamed")
+		_ = buffered.Flush()
+	}, false)
+
+	for _, path := range []string{"/close", "/unknown-length"} {
+		t.Run(path, func(t *testing.T) {
+			conn, reader := dialRelay(t, sender)
+			_, _ = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+			resp, body := readBody(t, reader, http.MethodGet)
+			if body != "closing" && body != "streamed" {
+				t.Errorf("Expected the local response body, got %q", body)
+			}
+			if !resp.Close {
+				t.Error("Expected Connection: close on the response")
+			}
+			if _, err := reader.ReadByte(); err != io.EOF {
+				t.Errorf("Expected the relay connection to be closed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHTTPMode_ChunkedBodies(t *testing.T) {
+	sender := startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// Flushing before the end forces a chunked response
+		_, _ = w.Write([]byte("got:"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(body)
+	}, false)
+	conn, reader := dialRelay(t, sender)
+
+	request := "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\npay\r\n4\r\nload\r\n0\r\n\r\n"
+	for i := 0; i < 2; i++ {
+		_, _ = conn.Write([]byte(request))
+		resp, body := readBody(t, reader, http.MethodPost)
+
+		if body != "got:payload" {
+			t.Errorf("Expected body %q, got %q", "got:payload", body)
+		}
+		if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+			t.Errorf("Expected a chunked response, got %v", resp.TransferEncoding)
+		}
+	}
+}
+
+func TestHTTPMode_UnreadRequestBody(t *testing.T) {
+	sender := startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}, false)
+	conn, reader := dialRelay(t, sender)
+
+	// The local app ignores the body; the next request must still be parsed correctly
+	_, _ = conn.Write([]byte("POST /ignored HTTP/1.1\r\nHost: example.com\r\nContent-Length: 7\r\n\r\npayload"))
+	if _, body := readBody(t, reader, http.MethodPost); body != "/ignored" {
+		t.Errorf("Expected body %q, got %q", "/ignored", body)
+	}
+
+	_, _ = conn.Write([]byte("GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	if _, body := readBody(t, reader, http.MethodGet); body != "/next" {
+		t.Errorf("Expected body %q, got %q", "/next", body)
+	}
+}
+
+func TestHTTPMode_LocalServerUnreachable(t *testing.T) {
+	memoryListener := relay.NewMemoryListener()
+	listener := NewListener(&Options{
+		Relay:     memoryListener,
+		LocalAddr: "127.0.0.1:1",
+		Mode:      ModeHTTP,
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	conn, reader := dialRelay(t, relay.NewMemorySender(memoryListener))
+	_, _ = conn.Write([]byte(testHTTPRequest))
+
+	if resp, _ := readBody(t, reader, http.MethodGet); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+}
+
+func TestHTTPMode_MalformedRequest(t *testing.T) {
+	conn, reader := dialRelay(t, startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Local server should not receive a malformed request")
+	}, false))
+	_, _ = conn.Write([]byte("NOT HTTP\r\n\r\n"))
+
+	if resp, _ := readBody(t, reader, http.MethodGet); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+// relayNetConn adapts a relay connection to net.Conn for clients that dial through the relay
+type relayNetConn struct {
+	relay.Connection
+}
+
+func (relayNetConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (relayNetConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (relayNetConn) SetDeadline(t time.Time) error      { return nil }
+func (relayNetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (relayNetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// websocketEcho echoes every WebSocket message back to the sender
+func websocketEcho(t *testing.T) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestHTTPMode_WebSocketUpgrade(t *testing.T) {
+	sender := startHTTPListener(t, websocketEcho(t), false)
+
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := sender.Dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return relayNetConn{Connection: conn}, nil
+		},
+	}
+	conn, resp, err := dialer.Dial("ws://63873749.azhexgate.com/ws", nil)
+	if err != nil {
+		t.Fatalf("WebSocket handshake failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = resp.Body.Close()
+
+	for _, message := range []string{"hello", "hot reload", strings.Repeat("x", 64*1024)} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		_, echoed, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if string(echoed) != message {
+			t.Errorf("Expected echo of %d bytes, got %d bytes", len(message), len(echoed))
+		}
+	}
+}
+
+func TestHTTPMode_UpgradeRefused(t *testing.T) {
+	sender := startHTTPListener(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no websockets here", http.StatusNotFound)
+	}, false)
+	conn, reader := dialRelay(t, sender)
+
+	// A refused upgrade is an ordinary response and the connection stays usable
+	_, _ = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	if resp, _ := readBody(t, reader, http.MethodGet); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	_, _ = conn.Write([]byte(testHTTPRequest))
+	if resp, _ := readBody(t, reader, http.MethodGet); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d on the same connection, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestHTTPMode_Inspector(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", "yes")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	}))
+	defer localServer.Close()
+
+	recorder := inspector.New(nil)
+	memoryListener := relay.NewMemoryListener()
+	listener := NewListener(&Options{
+		Relay:     memoryListener,
+		LocalAddr: strings.TrimPrefix(localServer.URL, "http://"),
+		Mode:      ModeHTTP,
+		Inspector: recorder,
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	conn, reader := dialRelay(t, relay.NewMemorySender(memoryListener))
+	_, _ = conn.Write([]byte("POST /hooks/github?x=1 HTTP/1.1\r\nHost: 63873749.azhexgate.com\r\n" +
+		"X-Hub-Signature: sha256=abc\r\nContent-Length: 7\r\n\r\npayload"))
+	if resp, body := readBody(t, reader, http.MethodPost); resp.StatusCode != http.StatusCreated || body != "payload" {
+		t.Fatalf("Expected echoed payload with status %d, got %d %q", http.StatusCreated, resp.StatusCode, body)
+	}
+
+	// The exchange is stored once the listener finished writing the response
+	var exchanges []inspector.Exchange
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if exchanges = recorder.List(); len(exchanges) > 0 {
+			break
+		}
+	}
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 recorded exchange, got %d", len(exchanges))
+	}
+
+	exchange := exchanges[0]
+	if exchange.Request.Method != http.MethodPost || exchange.Request.URL != "/hooks/github?x=1" {
+		t.Errorf("Expected POST /hooks/github?x=1, got %s %s", exchange.Request.Method, exchange.Request.URL)
+	}
+	if exchange.Request.Host != "63873749.azhexgate.com" {
+		t.Errorf("Expected the public Host to be recorded, got %q", exchange.Request.Host)
+	}
+	if got := exchange.Request.Header.Get("X-Hub-Signature"); got != "sha256=abc" {
+		t.Errorf("Expected the request headers to be recorded, got X-Hub-Signature %q", got)
+	}
+	if exchange.Request.Body.Content != "payload" {
+		t.Errorf("Expected request body %q, got %q", "payload", exchange.Request.Body.Content)
+	}
+	if exchange.Response == nil {
+		t.Fatal("Expected a recorded response")
+	}
+	if exchange.Response.Status != http.StatusCreated || exchange.Response.Header.Get("X-Echo") != "yes" {
+		t.Errorf("Expected status %d with X-Echo, got %d %v",
+			http.StatusCreated, exchange.Response.Status, exchange.Response.Header)
+	}
+	if exchange.Response.Body.Content != "payload" {
+		t.Errorf("Expected response body %q, got %q", "payload", exchange.Response.Body.Content)
+	}
+}
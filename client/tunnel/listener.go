@@ -1,18 +1,39 @@
 package tunnel
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"io"
 	"net"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/julienstroheker/AzHexGate/client/inspector"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/mux"
 	"github.com/julienstroheker/AzHexGate/internal/relay"
 )
 
+// ErrSessionLost is returned by Start when the relay session is lost and cannot be re-established
+var ErrSessionLost = errors.New("relay session lost")
+
 // Listener handles incoming connections from the relay and forwards them to localhost
 type Listener struct {
-	relay     relay.Listener
-	localAddr string
+	localAddr    string
+	mode         Mode
+	preserveHost bool
+	transport    http.RoundTripper
+	multiplex    bool
+	inspector    *inspector.Inspector
+	reconnect    func(ctx context.Context) (relay.Listener, error)
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	mu     sync.Mutex
+	relay  relay.Listener
+	closed bool
 }
 
 // Options contains configuration for the Listener
@@ -22,6 +43,32 @@ type Options struct {
 
 	// LocalAddr is the address of the local HTTP server (e.g., "localhost:3000")
 	LocalAddr string
+
+	// Mode selects raw byte forwarding or HTTP-aware forwarding (optional, defaults to ModeRaw)
+	Mode Mode
+
+	// PreserveHost keeps the public Host header in HTTP mode instead of rewriting it to LocalAddr
+	PreserveHost bool
+
+	// Transport forwards requests to the local server in HTTP mode (optional, defaults to a pooled transport)
+	Transport http.RoundTripper
+
+	// Multiplex accepts connections as streams of multiplexed relay connections. It must match
+	// the multiplex setting the gateway returned for the tunnel.
+	Multiplex bool
+
+	// Inspector records the requests and responses forwarded in HTTP mode (optional)
+	Inspector *inspector.Inspector
+
+	// Reconnect re-establishes the relay session when it is lost, e.g. after the
+	// listener token expired (optional). Without it, a lost session stops the listener.
+	Reconnect func(ctx context.Context) (relay.Listener, error)
+
+	// MinBackoff is the first delay after a failed Accept (optional, defaults to 500ms)
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the delay between reconnect attempts (optional, defaults to 30s)
+	MaxBackoff time.Duration
 }
 
 // NewListener creates a new tunnel listener
@@ -30,18 +77,54 @@ func NewListener(opts *Options) *Listener {
 		opts = &Options{}
 	}
 
-	return &Listener{
-		relay:     opts.Relay,
-		localAddr: opts.LocalAddr,
+	minBackoff := opts.MinBackoff
+	if minBackoff == 0 {
+		minBackoff = defaultMinBackoff
+	}
+
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	transport := opts.Transport
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	l := &Listener{
+		localAddr:    opts.LocalAddr,
+		mode:         opts.Mode,
+		preserveHost: opts.PreserveHost,
+		transport:    transport,
+		multiplex:    opts.Multiplex,
+		inspector:    opts.Inspector,
+		reconnect:    opts.Reconnect,
+		minBackoff:   minBackoff,
+		maxBackoff:   maxBackoff,
 	}
+	l.relay = l.wrap(opts.Relay)
+	return l
+}
+
+// wrap demultiplexes streams from r when multiplexing is enabled
+func (l *Listener) wrap(r relay.Listener) relay.Listener {
+	if !l.multiplex || r == nil {
+		return r
+	}
+	return mux.NewListener(r, nil)
 }
 
 // Start begins the listener loop, accepting connections and forwarding requests
 func (l *Listener) Start(ctx context.Context, logger *logging.Logger) error {
 	if logger != nil {
-		logger.Info("Starting listener loop", logging.String("local_addr", l.localAddr))
+		logger.Info("Starting listener loop",
+			logging.String("local_addr", l.localAddr),
+			logging.String("mode", l.mode.String()))
 	}
 
+	retry := &backoff{min: l.minBackoff, max: l.maxBackoff}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -53,25 +136,119 @@ func (l *Listener) Start(ctx context.Context, logger *logging.Logger) error {
 		}
 
 		// Accept incoming connection from relay
-		relayConn, err := l.relay.Accept(ctx)
+		current := l.currentRelay()
+		relayConn, err := current.Accept(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
 				// Context cancelled, stop gracefully
 				return ctx.Err()
 			}
-			if logger != nil {
-				logger.Error("Failed to accept connection", logging.Error(err))
+			if current != l.currentRelay() {
+				// Resume replaced the session while accepting
+				continue
+			}
+			if err := l.recover(ctx, err, retry, logger); err != nil {
+				return err
 			}
 			continue
 		}
+		retry.reset()
 
 		// Handle connection in a separate goroutine
-		go l.handleConnection(ctx, relayConn, logger)
+		if l.mode == ModeHTTP {
+			go l.serveHTTP(ctx, relayConn, logger)
+		} else {
+			go l.handleConnection(ctx, relayConn, logger)
+		}
 	}
 }
 
+// recover handles an Accept error: it waits out transient failures and re-establishes
+// lost sessions. It returns an error when the listener should stop.
+func (l *Listener) recover(ctx context.Context, acceptErr error, retry *backoff, logger *logging.Logger) error {
+	class := classifyAcceptError(acceptErr)
+	if class == errorPermanent {
+		return acceptErr
+	}
+	if class == errorSessionLost && l.reconnect == nil {
+		return errors.Join(ErrSessionLost, acceptErr)
+	}
+
+	delay := retry.next()
+	if logger != nil {
+		logger.Warn("Relay unavailable, retrying",
+			logging.Error(acceptErr),
+			logging.Bool("session_lost", class == errorSessionLost),
+			logging.String("retry_in", delay.String()))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	if class != errorSessionLost {
+		return nil
+	}
+
+	if err := l.Resume(ctx); err != nil {
+		if errors.Is(err, relay.ErrListenerClosed) {
+			return err
+		}
+		// Keep the old relay; its next Accept fails the same way and is retried after a longer delay
+		if logger != nil {
+			logger.Warn("Failed to re-establish relay session", logging.Error(err))
+		}
+		return nil
+	}
+
+	if logger != nil {
+		logger.Info("Relay session re-established")
+	}
+	return nil
+}
+
+// Resume re-establishes the relay session with Reconnect and replaces the current one. Start calls it
+// when the relay rejects the session; callers use it when they learn the session is gone by other
+// means, e.g. the gateway no longer knows the tunnel. It returns ErrSessionLost without Reconnect.
+func (l *Listener) Resume(ctx context.Context) error {
+	if l.reconnect == nil {
+		return ErrSessionLost
+	}
+
+	newRelay, err := l.reconnect(ctx)
+	if err != nil {
+		return err
+	}
+	newRelay = l.wrap(newRelay)
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		_ = newRelay.Close()
+		return relay.ErrListenerClosed
+	}
+	oldRelay := l.relay
+	l.relay = newRelay
+	l.mu.Unlock()
+	_ = oldRelay.Close()
+	return nil
+}
+
+// currentRelay returns the relay listener of the current session
+func (l *Listener) currentRelay() relay.Listener {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.relay
+}
+
 // handleConnection processes a single relay connection by establishing a TCP connection
-// to the local server and bidirectionally copying data between them
+// to the local server and bidirectionally copying data between them.
+// The gateway may dial relay connections ahead of demand and keep them idle, so the local server
+// is only dialed once the first bytes of a request arrive.
 func (l *Listener) handleConnection(ctx context.Context, relayConn relay.Connection, logger *logging.Logger) {
 	defer func() {
 		_ = relayConn.Close()
@@ -81,6 +258,14 @@ func (l *Listener) handleConnection(ctx context.Context, relayConn relay.Connect
 		logger.Debug("Handling new connection")
 	}
 
+	relayReader := bufio.NewReader(relayConn)
+	if _, err := relayReader.Peek(1); err != nil {
+		if logger != nil {
+			logger.Debug("Relay connection closed before any data", logging.Error(err))
+		}
+		return
+	}
+
 	// Dial the local TCP server
 	var dialer net.Dialer
 	localConn, err := dialer.DialContext(ctx, "tcp", l.localAddr)
@@ -103,7 +288,7 @@ func (l *Listener) handleConnection(ctx context.Context, relayConn relay.Connect
 
 	// Copy from relay to local server
 	go func() {
-		_, err := io.Copy(localConn, relayConn)
+		_, err := io.Copy(localConn, relayReader)
 		done <- err
 	}()
 
@@ -134,8 +319,17 @@ func (l *Listener) handleConnection(ctx context.Context, relayConn relay.Connect
 
 // Close closes the listener
 func (l *Listener) Close() error {
-	if l.relay != nil {
-		return l.relay.Close()
+	l.mu.Lock()
+	l.closed = true
+	current := l.relay
+	l.mu.Unlock()
+
+	if idle, ok := l.transport.(interface{ CloseIdleConnections() }); ok {
+		idle.CloseIdleConnections()
+	}
+
+	if current != nil {
+		return current.Close()
 	}
 	return nil
 }
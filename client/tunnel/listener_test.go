@@ -3,15 +3,19 @@ package tunnel
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/julienstroheker/AzHexGate/internal/mux"
 	"github.com/julienstroheker/AzHexGate/internal/relay"
 )
 
@@ -106,6 +110,62 @@ func TestListener_HandleHTTPRequest(t *testing.T) {
 	}
 }
 
+func TestListener_IdleConnectionsDoNotDialLocal(t *testing.T) {
+	var localConns atomic.Int32
+	localServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	localServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			localConns.Add(1)
+		}
+	}
+	localServer.Start()
+
+	memoryListener := relay.NewMemoryListener()
+	memorySender := relay.NewMemorySender(memoryListener)
+	listener := NewListener(&Options{
+		Relay:     memoryListener,
+		LocalAddr: strings.TrimPrefix(localServer.URL, "http://"),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = listener.Start(ctx, nil)
+	}()
+	defer cleanupTestEnvironment(localServer, listener, memorySender, cancel, wg)
+
+	// A relay connection the gateway keeps idle in its pool
+	conn, err := memorySender.Dial(ctx)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := localConns.Load(); n != 0 {
+		t.Fatalf("Expected no local connection while the relay connection is idle, got %d", n)
+	}
+
+	if _, err := conn.Write([]byte(testHTTPRequest)); err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if n := localConns.Load(); n != 1 {
+		t.Errorf("Expected one local connection once the request arrived, got %d", n)
+	}
+}
+
 func TestListener_HandlePOSTRequest(t *testing.T) {
 	localServer, listener, memorySender, ctx, cancel, wg := setupTestEnvironment(t,
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -408,3 +468,241 @@ func TestListener_InvalidHTTPRequest(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+// flakyListener fails the first Accept calls with errs before accepting from the wrapped listener
+type flakyListener struct {
+	relay.Listener
+
+	mu      sync.Mutex
+	errs    []error
+	accepts int
+}
+
+func (f *flakyListener) Accept(ctx context.Context) (relay.Connection, error) {
+	f.mu.Lock()
+	f.accepts++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		f.mu.Unlock()
+		return nil, err
+	}
+	f.mu.Unlock()
+	return f.Listener.Accept(ctx)
+}
+
+func (f *flakyListener) acceptCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accepts
+}
+
+// roundTrip sends a request through the relay and returns the response body
+func roundTrip(ctx context.Context, t *testing.T, sender relay.Sender) string {
+	t.Helper()
+
+	conn, err := sender.Dial(ctx)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(testHTTPRequest)); err != nil {
+		t.Fatalf("Failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestListener_RetriesTransientErrors(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer localServer.Close()
+
+	memoryListener := relay.NewMemoryListener()
+	flaky := &flakyListener{
+		Listener: memoryListener,
+		errs:     []error{errors.New("connection reset"), errors.New("connection reset"), errors.New("timeout")},
+	}
+	listener := NewListener(&Options{
+		Relay:      flaky,
+		LocalAddr:  strings.TrimPrefix(localServer.URL, "http://"),
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	if body := roundTrip(ctx, t, relay.NewMemorySender(memoryListener)); body != "ok" {
+		t.Errorf("Expected body %q after transient errors, got %q", "ok", body)
+	}
+	// Three failures plus the successful Accept; a hot loop would not stop at the error list
+	if count := flaky.acceptCount(); count < 4 || count > 5 {
+		t.Errorf("Expected 4 or 5 Accept calls, got %d", count)
+	}
+}
+
+func TestListener_ReconnectsLostSession(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer localServer.Close()
+
+	expired := &flakyListener{
+		Listener: relay.NewMemoryListener(),
+		// The first reconnect fails, so the expired relay reports the lost session twice
+		errs: []error{fmt.Errorf("listen: %w", relay.ErrUnauthorized), fmt.Errorf("listen: %w", relay.ErrUnauthorized)},
+	}
+	renewed := relay.NewMemoryListener()
+
+	var reconnects int
+	listener := NewListener(&Options{
+		Relay:     expired,
+		LocalAddr: strings.TrimPrefix(localServer.URL, "http://"),
+		Reconnect: func(ctx context.Context) (relay.Listener, error) {
+			reconnects++
+			if reconnects == 1 {
+				return nil, errors.New("gateway unavailable")
+			}
+			return renewed, nil
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	if body := roundTrip(ctx, t, relay.NewMemorySender(renewed)); body != "ok" {
+		t.Errorf("Expected body %q on the renewed session, got %q", "ok", body)
+	}
+	if reconnects != 2 {
+		t.Errorf("Expected 2 reconnect attempts, got %d", reconnects)
+	}
+}
+
+func TestListener_Resume(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer localServer.Close()
+
+	previous := relay.NewMemoryListener()
+	renewed := relay.NewMemoryListener()
+	listener := NewListener(&Options{
+		Relay:     previous,
+		LocalAddr: strings.TrimPrefix(localServer.URL, "http://"),
+		Reconnect: func(ctx context.Context) (relay.Listener, error) {
+			return renewed, nil
+		},
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- listener.Start(ctx, nil) }()
+
+	if err := listener.Resume(ctx); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	// The listener keeps running on the renewed session, and the previous one is closed
+	if body := roundTrip(ctx, t, relay.NewMemorySender(renewed)); body != "ok" {
+		t.Errorf("Expected body %q on the renewed session, got %q", "ok", body)
+	}
+	if _, err := relay.NewMemorySender(previous).Dial(ctx); err == nil {
+		t.Error("Expected the previous session to be closed")
+	}
+	select {
+	case err := <-done:
+		t.Errorf("Expected the listener to keep running, got %v", err)
+	default:
+	}
+
+	if err := NewListener(&Options{Relay: previous}).Resume(ctx); !errors.Is(err, ErrSessionLost) {
+		t.Errorf("Expected ErrSessionLost without Reconnect, got %v", err)
+	}
+}
+
+func TestListener_SessionLostWithoutReconnect(t *testing.T) {
+	listener := NewListener(&Options{
+		Relay: &flakyListener{
+			Listener: relay.NewMemoryListener(),
+			errs:     []error{fmt.Errorf("listen: %w", relay.ErrUnauthorized)},
+		},
+	})
+
+	err := listener.Start(context.Background(), nil)
+	if !errors.Is(err, ErrSessionLost) || !errors.Is(err, relay.ErrUnauthorized) {
+		t.Errorf("Expected ErrSessionLost wrapping ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestListener_StopsWhenClosed(t *testing.T) {
+	listener := NewListener(&Options{Relay: relay.NewMemoryListener()})
+
+	done := make(chan error, 1)
+	go func() { done <- listener.Start(context.Background(), nil) }()
+	_ = listener.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, relay.ErrListenerClosed) {
+			t.Errorf("Expected ErrListenerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Start to return after Close")
+	}
+}
+
+func TestListener_Multiplex(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer localServer.Close()
+
+	expired := &flakyListener{
+		Listener: relay.NewMemoryListener(),
+		errs:     []error{fmt.Errorf("listen: %w", relay.ErrUnauthorized)},
+	}
+	renewed := relay.NewMemoryListener()
+
+	listener := NewListener(&Options{
+		Relay:     expired,
+		LocalAddr: strings.TrimPrefix(localServer.URL, "http://"),
+		Multiplex: true,
+		Reconnect: func(ctx context.Context) (relay.Listener, error) {
+			return renewed, nil
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	// The reconnected relay is demultiplexed too, so every request is a stream of one connection
+	sender := mux.NewSender(relay.NewMemorySender(renewed), nil)
+	defer func() { _ = sender.Close() }()
+
+	for i := 0; i < 3; i++ {
+		if body := roundTrip(ctx, t, sender); body != "ok" {
+			t.Errorf("Request %d: expected body %q, got %q", i, "ok", body)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package apikey
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hashPrefix marks an entry that holds the SHA-256 hash of a key instead of the key itself
+const hashPrefix = "sha256:"
+
+// ErrMalformedEntry is returned when a key store entry cannot be parsed
+var ErrMalformedEntry = errors.New("malformed API key entry")
+
+// Key is an API key known to the gateway, stored only as its SHA-256 hash
+type Key struct {
+	// ID identifies the key in logs and quotas; it never reveals the key
+	ID string
+
+	hash [sha256.Size]byte
+}
+
+// Hash returns the hex-encoded SHA-256 hash of a key, as accepted in "sha256:<hex>" entries
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseEntry parses a key store entry of the form "[id] <key>" or "[id] sha256:<hex>".
+// When no ID is given, one is derived from the hash.
+func ParseEntry(entry string) (Key, error) {
+	fields := strings.Fields(entry)
+
+	var id, secret string
+	switch len(fields) {
+	case 1:
+		secret = fields[0]
+	case 2:
+		id, secret = fields[0], fields[1]
+	default:
+		return Key{}, ErrMalformedEntry
+	}
+
+	var key Key
+	if encoded, ok := strings.CutPrefix(secret, hashPrefix); ok {
+		decoded, err := hex.DecodeString(encoded)
+		if err != nil || len(decoded) != sha256.Size {
+			return Key{}, fmt.Errorf("%w: invalid sha256 hash", ErrMalformedEntry)
+		}
+		copy(key.hash[:], decoded)
+	} else {
+		key.hash = sha256.Sum256([]byte(secret))
+	}
+
+	key.ID = id
+	if key.ID == "" {
+		key.ID = "key-" + hex.EncodeToString(key.hash[:4])
+	}
+	return key, nil
+}
+
+// Store holds the API keys accepted by the gateway
+type Store struct {
+	keys []Key
+}
+
+// NewStore creates a store accepting the given keys
+func NewStore(keys ...Key) *Store {
+	return &Store{keys: keys}
+}
+
+// ParseEntries creates a store from comma-separated entries, e.g. the AZHEXGATE_API_KEYS value
+func ParseEntries(entries string) (*Store, error) {
+	var keys []Key
+	for _, entry := range strings.Split(entries, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, err := ParseEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewStore(keys...), nil
+}
+
+// LoadFile creates a store from a file with one entry per line.
+// Blank lines and lines starting with '#' are ignored.
+func LoadFile(path string) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open API key file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var keys []Key
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+	return NewStore(keys...), nil
+}
+
+// Add adds keys to the store
+func (s *Store) Add(keys ...Key) {
+	s.keys = append(s.keys, keys...)
+}
+
+// Merge adds every key of other to the store
+func (s *Store) Merge(other *Store) {
+	s.keys = append(s.keys, other.keys...)
+}
+
+// Len returns the number of keys in the store
+func (s *Store) Len() int {
+	return len(s.keys)
+}
+
+// Verify reports whether key is accepted and returns its ID.
+// Every stored hash is compared in constant time so timing does not reveal which key matched.
+func (s *Store) Verify(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	matched := -1
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare(sum[:], s.keys[i].hash[:]) == 1 && matched < 0 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return "", false
+	}
+	return s.keys[matched].ID, true
+}
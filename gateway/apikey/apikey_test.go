@@ -0,0 +1,122 @@
+package apikey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  string
+		wantID string
+		key    string
+	}{
+		{name: "raw key", entry: "secret-1", wantID: "key-" + Hash("secret-1")[:8], key: "secret-1"},
+		{name: "named raw key", entry: "ci secret-2", wantID: "ci", key: "secret-2"},
+		{name: "named hash", entry: "ops sha256:" + Hash("secret-3"), wantID: "ops", key: "secret-3"},
+		{name: "surrounding whitespace", entry: "  dev   secret-4 ", wantID: "dev", key: "secret-4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseEntry(tt.entry)
+			if err != nil {
+				t.Fatalf("ParseEntry failed: %v", err)
+			}
+			if key.ID != tt.wantID {
+				t.Errorf("Expected ID %q, got %q", tt.wantID, key.ID)
+			}
+			if id, ok := NewStore(key).Verify(tt.key); !ok || id != tt.wantID {
+				t.Errorf("Expected key to verify as %q, got (%q, %v)", tt.wantID, id, ok)
+			}
+		})
+	}
+}
+
+func TestParseEntry_Malformed(t *testing.T) {
+	tests := []string{
+		"",
+		"a b c",
+		"ops sha256:nothex",
+		"ops sha256:abcd",
+	}
+
+	for _, entry := range tests {
+		t.Run(entry, func(t *testing.T) {
+			if _, err := ParseEntry(entry); !errors.Is(err, ErrMalformedEntry) {
+				t.Errorf("Expected ErrMalformedEntry, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_Verify(t *testing.T) {
+	store, err := ParseEntries("ci secret-1, ops sha256:" + Hash("secret-2") + ",,")
+	if err != nil {
+		t.Fatalf("ParseEntries failed: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Expected 2 keys, got %d", store.Len())
+	}
+
+	tests := []struct {
+		key    string
+		wantID string
+		wantOK bool
+	}{
+		{key: "secret-1", wantID: "ci", wantOK: true},
+		{key: "secret-2", wantID: "ops", wantOK: true},
+		{key: "sha256:" + Hash("secret-2"), wantOK: false},
+		{key: "wrong", wantOK: false},
+		{key: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			id, ok := store.Verify(tt.key)
+			if ok != tt.wantOK || id != tt.wantID {
+				t.Errorf("Verify(%q) = (%q, %v), want (%q, %v)", tt.key, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStore_Empty(t *testing.T) {
+	if _, ok := NewStore().Verify("anything"); ok {
+		t.Error("Expected an empty store to reject every key")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# gateway API keys\n\nci secret-1\nops sha256:" + Hash("secret-2") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	store, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", store.Len())
+	}
+	if id, ok := store.Verify("secret-2"); !ok || id != "ops" {
+		t.Errorf("Expected secret-2 to verify as ops, got (%q, %v)", id, ok)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	_ = os.WriteFile(path, []byte("ok secret\na b c\n"), 0o600)
+	if _, err := LoadFile(path); !errors.Is(err, ErrMalformedEntry) {
+		t.Errorf("Expected ErrMalformedEntry, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package basicauth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// scheme prefixes hashes produced by Hash
+	scheme = "pbkdf2-sha256"
+
+	// iterations makes guessing a password from a leaked tunnel record costly while keeping the
+	// first check of a credential in the tens of milliseconds; later checks hit the Verifier cache
+	iterations = 100000
+
+	saltSize = 16
+	keySize  = 32
+
+	// maxVerified bounds how many verified credentials a Verifier remembers
+	maxVerified = 1024
+)
+
+var (
+	// ErrInvalidCredentials is returned for credentials that cannot protect a tunnel
+	ErrInvalidCredentials = errors.New("invalid basic auth credentials")
+
+	// ErrMalformedHash is returned when a stored hash cannot be parsed
+	ErrMalformedHash = errors.New("malformed basic auth hash")
+)
+
+// Validate checks that username and password can be sent with HTTP Basic authentication:
+// neither is empty and the username has no colon
+func Validate(username, password string) error {
+	switch {
+	case username == "" || password == "":
+		return fmt.Errorf("%w: username and password are required", ErrInvalidCredentials)
+	case strings.Contains(username, ":"):
+		return fmt.Errorf("%w: username must not contain a colon", ErrInvalidCredentials)
+	default:
+		return nil
+	}
+}
+
+// Hash returns the salted PBKDF2-SHA256 hash of the credentials, as
+// "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64 salt and key
+func Hash(username, password string) (string, error) {
+	if err := Validate(username, password); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := derive(username, password, salt, iterations)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		scheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// Verify reports whether the credentials match a hash produced by Hash
+func Verify(hash, username, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != scheme {
+		return false, ErrMalformedHash
+	}
+
+	rounds, err := strconv.Atoi(parts[1])
+	if err != nil || rounds <= 0 {
+		return false, fmt.Errorf("%w: invalid iterations", ErrMalformedHash)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid salt", ErrMalformedHash)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, fmt.Errorf("%w: invalid key", ErrMalformedHash)
+	}
+
+	got, err := derive(username, password, salt, rounds)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// derive computes the key of the credentials; the username is bound to the password so neither can be swapped
+func derive(username, password string, salt []byte, rounds int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, username+":"+password, salt, rounds, keySize)
+}
+
+// Verifier checks credentials against hashes, remembering the ones it verified so that
+// the key derivation runs once per credential rather than on every request
+type Verifier struct {
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]struct{}
+}
+
+// NewVerifier creates a new verifier
+func NewVerifier() *Verifier {
+	return &Verifier{verified: make(map[[sha256.Size]byte]struct{})}
+}
+
+// Verify reports whether the credentials match hash. Malformed hashes match nothing.
+func (v *Verifier) Verify(hash, username, password string) bool {
+	// The hash is part of the cache key so credentials verified for one tunnel do not open another
+	key := sha256.Sum256([]byte(hash + "\x00" + username + ":" + password))
+
+	v.mu.Lock()
+	_, ok := v.verified[key]
+	v.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	if ok, err := Verify(hash, username, password); err != nil || !ok {
+		return false
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.verified) >= maxVerified {
+		clear(v.verified)
+	}
+	v.verified[key] = struct{}{}
+	return true
+}
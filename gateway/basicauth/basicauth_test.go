@@ -0,0 +1,118 @@
+package basicauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid", username: "alice", password: "s3cret:with:colons"},
+		{name: "empty username", username: "", password: "s3cret", wantErr: true},
+		{name: "empty password", username: "alice", password: "", wantErr: true},
+		{name: "colon in username", username: "al:ice", password: "s3cret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("alice", "s3cret")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, scheme+"$") || strings.Contains(hash, "s3cret") {
+		t.Errorf("Expected a %s hash without the password, got %q", scheme, hash)
+	}
+
+	again, _ := Hash("alice", "s3cret")
+	if again == hash {
+		t.Error("Expected hashes of the same credentials to use different salts")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     bool
+	}{
+		{name: "match", username: "alice", password: "s3cret", want: true},
+		{name: "wrong password", username: "alice", password: "s3cret!", want: false},
+		{name: "wrong username", username: "bob", password: "s3cret", want: false},
+		// The username is bound to the password, so the separator cannot move
+		{name: "shifted separator", username: "alice:s3", password: "cret", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := Verify(hash, tt.username, tt.password)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if ok != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, ok)
+			}
+		})
+	}
+}
+
+func TestHash_InvalidCredentials(t *testing.T) {
+	if _, err := Hash("", "s3cret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestVerify_MalformedHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"bcrypt$10$c2FsdA$a2V5",
+		"pbkdf2-sha256$zero$c2FsdA$a2V5",
+		"pbkdf2-sha256$1000$!!$a2V5",
+		"pbkdf2-sha256$1000$c2FsdA$",
+	} {
+		if _, err := Verify(hash, "alice", "s3cret"); !errors.Is(err, ErrMalformedHash) {
+			t.Errorf("Expected ErrMalformedHash for %q, got %v", hash, err)
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	hash, _ := Hash("alice", "s3cret")
+	other, _ := Hash("alice", "other")
+	verifier := NewVerifier()
+
+	// Repeated checks hit the cache and keep their result
+	for i := 0; i < 2; i++ {
+		if !verifier.Verify(hash, "alice", "s3cret") {
+			t.Fatalf("Expected check %d of valid credentials to pass", i+1)
+		}
+		if verifier.Verify(hash, "alice", "wrong") {
+			t.Fatalf("Expected check %d of a wrong password to fail", i+1)
+		}
+	}
+
+	// Credentials verified for one hash do not match another
+	if verifier.Verify(other, "alice", "s3cret") {
+		t.Error("Expected verified credentials not to match another hash")
+	}
+	if verifier.Verify("malformed", "alice", "s3cret") {
+		t.Error("Expected a malformed hash to match nothing")
+	}
+}
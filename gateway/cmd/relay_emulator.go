@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay/emulator"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
+	"github.com/spf13/cobra"
+)
+
+const defaultEmulatorPort = 9090
+
+var emulatorPortFlag int
+
+var relayEmulatorCmd = &cobra.Command{
+	Use:   "relay-emulator",
+	Short: "Start a local Azure Relay Hybrid Connections emulator",
+	Long: `Start a local Azure Relay Hybrid Connections emulator for development and end-to-end tests.
+Listeners and senders connect to it exactly as they would to an Azure Relay namespace,
+using http://localhost:<port> as the relay endpoint.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRelayEmulator()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(relayEmulatorCmd)
+	relayEmulatorCmd.Flags().IntVarP(&emulatorPortFlag, "port", "p", defaultEmulatorPort, "Port to listen on")
+}
+
+func runRelayEmulator() error {
+	log := GetLogger()
+	log.Info("Starting relay emulator", logging.Int("port", emulatorPortFlag))
+
+	// Validate SAS tokens with the same keys the gateway signs them with
+	cfg := GetConfig()
+	var keys, listenKeys []sas.Key
+	if cfg.RelayKey != "" {
+		keys = append(keys, sas.Key{Name: cfg.RelayKeyName, Value: cfg.RelayKey})
+	} else {
+		log.Warn("AZHEXGATE_RELAY_KEY is not set, relay emulator accepts any token")
+	}
+	if cfg.RelayKey != "" && cfg.RelayListenKey != "" {
+		listenKeys = append(listenKeys, sas.Key{Name: cfg.RelayListenKeyName, Value: cfg.RelayListenKey})
+	}
+
+	relayEmulator := emulator.New(&emulator.Options{
+		Logger:     log,
+		Keys:       keys,
+		ListenKeys: listenKeys,
+	})
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", emulatorPortFlag),
+		Handler:           relayEmulator,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Channel to listen for errors coming from the listener.
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		log.Info("Relay emulator listening", logging.Int("port", emulatorPortFlag))
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	// Channel to listen for an interrupt or terminate signal from the OS.
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		return fmt.Errorf("relay emulator error: %w", err)
+
+	case sig := <-shutdown:
+		log.Info("Received shutdown signal", logging.String("signal", sig.String()))
+
+		// Hijacked WebSockets are not tracked by Shutdown, so drop control channels first
+		_ = relayEmulator.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(defaultShutdownTimeout)*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			return fmt.Errorf("could not gracefully shutdown the relay emulator: %w", err)
+		}
+
+		log.Info("Relay emulator stopped gracefully")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRelayEmulatorCommandHelp(t *testing.T) {
+	rootCmd.SetArgs([]string{"relay-emulator", "--help"})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+
+	err := rootCmd.Execute()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "relay-emulator") {
+		t.Errorf("Expected output to contain 'relay-emulator', got: %s", output)
+	}
+
+	if !strings.Contains(output, "--port") {
+		t.Errorf("Expected output to contain '--port' flag, got: %s", output)
+	}
+
+	// Reset for next test
+	rootCmd.SetArgs(nil)
+}
+
+func TestRelayEmulatorCommandDefaultValues(t *testing.T) {
+	emulatorPortFlag = defaultEmulatorPort
+
+	if emulatorPortFlag != 9090 {
+		t.Errorf("Expected default emulator port to be 9090, got: %d", emulatorPortFlag)
+	}
+}
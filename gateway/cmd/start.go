@@ -2,25 +2,62 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/gateway/forwarded"
 	"github.com/julienstroheker/AzHexGate/gateway/http"
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+	"github.com/julienstroheker/AzHexGate/gateway/jwtauth"
+	"github.com/julienstroheker/AzHexGate/gateway/quota"
+	"github.com/julienstroheker/AzHexGate/gateway/ratelimit"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
 	"github.com/spf13/cobra"
 )
 
 const (
 	defaultPort            = 8080
 	defaultShutdownTimeout = 30
+
+	// authModeAPIKey and authModeOIDC are the values of --auth-mode
+	authModeAPIKey = "apikey"
+	authModeOIDC   = "oidc"
+
+	// senderTokenTTL is how long the SAS tokens the gateway presents to the relay stay valid
+	senderTokenTTL = 5 * time.Minute
 )
 
 var (
 	portFlag            int
 	shutdownTimeoutFlag int
+	relayPoolSizeFlag   int
+	authModeFlag        string
+
+	heartbeatTimeoutFlag int
+	gracePeriodFlag      int
+	maxTTLFlag           int
+
+	keyMaxTunnelsFlag int
+	keyCreationsFlag  int
+	keyMaxTTLFlag     int
+
+	rateLimitFlag      float64
+	rateBurstFlag      int
+	rateLimitPerIPFlag bool
+	maxRateLimitFlag   float64
+	maxRateBurstFlag   int
 )
 
 var startCmd = &cobra.Command{
@@ -37,14 +74,88 @@ func init() {
 	startCmd.Flags().IntVarP(&portFlag, "port", "p", defaultPort, "Port to listen on")
 	startCmd.Flags().IntVar(&shutdownTimeoutFlag, "shutdown-timeout", defaultShutdownTimeout,
 		"Graceful shutdown timeout in seconds")
+	startCmd.Flags().IntVar(&relayPoolSizeFlag, "relay-pool-size", 0,
+		"Idle relay connections to keep dialed per tunnel (0 dials the relay for every request)")
+	startCmd.Flags().StringVar(&authModeFlag, "auth-mode", authModeAPIKey,
+		"How management API calls are authenticated: \"apikey\" (X-AzHexGate-ApiKey header) "+
+			"or \"oidc\" (bearer JWTs of AZHEXGATE_OIDC_ISSUER)")
+	startCmd.Flags().IntVar(&heartbeatTimeoutFlag, "heartbeat-timeout",
+		int(registry.DefaultHeartbeatTimeout/time.Second),
+		"Seconds without a client heartbeat before a tunnel is marked inactive (0 disables expiry)")
+	startCmd.Flags().IntVar(&gracePeriodFlag, "tunnel-grace-period", int(registry.DefaultGracePeriod/time.Second),
+		"Seconds an inactive tunnel keeps its subdomain before it is deleted")
+	startCmd.Flags().IntVar(&maxTTLFlag, "max-ttl", 0,
+		"Maximum tunnel lifetime in seconds, also applied to tunnels requesting no TTL (0 is unlimited)")
+	startCmd.Flags().IntVar(&keyMaxTunnelsFlag, "key-max-tunnels", 0,
+		"Concurrent tunnels each API key may have (0 is unlimited)")
+	startCmd.Flags().IntVar(&keyCreationsFlag, "key-creations-per-hour", 0,
+		"Tunnels each API key may create per hour (0 is unlimited)")
+	startCmd.Flags().IntVar(&keyMaxTTLFlag, "key-max-ttl", 0,
+		"Maximum lifetime in seconds of the tunnels of each API key (0 is unlimited)")
+	startCmd.Flags().Float64Var(&rateLimitFlag, "rate-limit", 0,
+		"Default requests per second allowed to each tunnel that does not request a limit (0 is unlimited)")
+	startCmd.Flags().IntVar(&rateBurstFlag, "rate-burst", 0,
+		"Default burst of requests allowed to each tunnel (0 allows one second worth of requests)")
+	startCmd.Flags().BoolVar(&rateLimitPerIPFlag, "rate-limit-per-ip", false,
+		"Apply tunnel rate limits to each client IP separately by default")
+	startCmd.Flags().Float64Var(&maxRateLimitFlag, "max-rate-limit", 0,
+		"Highest requests per second a tunnel may request (0 is unbounded)")
+	startCmd.Flags().IntVar(&maxRateBurstFlag, "max-rate-burst", 0,
+		"Highest burst of requests a tunnel may request (0 is unbounded)")
 }
 
 func runServer() error {
 	log := GetLogger()
 	log.Info("Starting gateway server", logging.Int("port", portFlag))
 
+	endpoint := relayEndpoint()
+	sendKey := relayKey(log)
+	listenKey := relayListenKey(log, sendKey)
+
+	keys, validator, err := authentication(log)
+	if err != nil {
+		return err
+	}
+
+	trusted, err := trustedProxies(log)
+	if err != nil {
+		return err
+	}
+
+	if relayPoolSizeFlag < 0 {
+		return fmt.Errorf("invalid --relay-pool-size %d", relayPoolSizeFlag)
+	}
+	if relayPoolSizeFlag > 0 {
+		log.Info("Pre-warming relay connections", logging.Int("pool_size", relayPoolSizeFlag))
+	}
+
+	reg, err := openRegistry(log)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reg.Close() }()
+
+	tunnels, reaper, err := tunnelsOptions(log, endpoint, listenKey)
+	if err != nil {
+		return err
+	}
+
 	// Create server with the logger from root command
-	server := http.NewServer(portFlag, log)
+	server := http.NewServer(&http.Options{
+		Port:       portFlag,
+		Logger:     log,
+		BaseDomain: GetConfig().BaseDomain,
+		Registry:   reg,
+		APIKeys:    keys,
+		OIDC:       validator,
+		Reaper:     reaper,
+		Tunnels:    tunnels,
+		Proxy: &handlers.ProxyOptions{
+			NewSender:      newRelaySender(endpoint, sendKey),
+			TrustedProxies: trusted,
+			PoolSize:       relayPoolSizeFlag,
+		},
+	})
 
 	// Channel to listen for errors coming from the listener.
 	serverErrors := make(chan error, 1)
@@ -86,3 +197,281 @@ func runServer() error {
 
 	return nil
 }
+
+// authentication configures how the management API authenticates callers from --auth-mode:
+// with the API key store, or with a validator of the bearer tokens of the OIDC provider
+func authentication(log *logging.Logger) (*apikey.Store, *jwtauth.Validator, error) {
+	switch authModeFlag {
+	case authModeAPIKey:
+		keys, err := apiKeyStore(log)
+		return keys, nil, err
+	case authModeOIDC:
+		validator, err := oidcValidator(log)
+		return nil, validator, err
+	default:
+		return nil, nil, fmt.Errorf("invalid --auth-mode %q, expected %q or %q", authModeFlag, authModeAPIKey,
+			authModeOIDC)
+	}
+}
+
+// oidcValidator creates the validator of bearer tokens from AZHEXGATE_OIDC_ISSUER, AZHEXGATE_OIDC_AUDIENCE
+// and AZHEXGATE_OIDC_JWKS_URL
+func oidcValidator(log *logging.Logger) (*jwtauth.Validator, error) {
+	cfg := GetConfig()
+	if cfg.OIDCIssuer == "" || cfg.OIDCAudience == "" {
+		return nil, fmt.Errorf("--auth-mode %s requires AZHEXGATE_OIDC_ISSUER and AZHEXGATE_OIDC_AUDIENCE", authModeOIDC)
+	}
+
+	log.Info("Management API authentication enabled with bearer tokens",
+		logging.String("issuer", cfg.OIDCIssuer),
+		logging.String("audience", cfg.OIDCAudience))
+	return jwtauth.NewValidator(&jwtauth.Options{
+		Issuer:   cfg.OIDCIssuer,
+		Audience: cfg.OIDCAudience,
+		JWKSURL:  cfg.OIDCJWKSURL,
+	}), nil
+}
+
+// apiKeyStore loads the keys accepted by the management API from AZHEXGATE_API_KEY,
+// AZHEXGATE_API_KEYS and AZHEXGATE_API_KEYS_FILE.
+// It returns nil, disabling authentication, when no key is configured.
+func apiKeyStore(log *logging.Logger) (*apikey.Store, error) {
+	cfg := GetConfig()
+
+	store := apikey.NewStore()
+	if cfg.APIKeysFile != "" {
+		fileStore, err := apikey.LoadFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+
+	entries, err := apikey.ParseEntries(cfg.APIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AZHEXGATE_API_KEYS: %w", err)
+	}
+	store.Merge(entries)
+
+	if cfg.APIKey != "" {
+		key, err := apikey.ParseEntry("default " + cfg.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AZHEXGATE_API_KEY: %w", err)
+		}
+		store.Add(key)
+	}
+
+	if store.Len() == 0 {
+		log.Warn("No API keys configured, the management API is not authenticated")
+		return nil, nil
+	}
+	log.Info("Management API authentication enabled", logging.Int("keys", store.Len()))
+	return store, nil
+}
+
+// trustedProxies parses AZHEXGATE_TRUSTED_PROXIES, the upstream proxies whose forwarding headers are kept
+func trustedProxies(log *logging.Logger) (*forwarded.TrustedProxies, error) {
+	trusted, err := forwarded.ParseTrustedProxies(GetConfig().TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AZHEXGATE_TRUSTED_PROXIES: %w", err)
+	}
+	if trusted.Len() > 0 {
+		log.Info("Trusting forwarding headers from upstream proxies", logging.Int("ranges", trusted.Len()))
+	}
+	return trusted, nil
+}
+
+// tunnelsOptions configures the tunnel management API and the reaper from the tunnel policy flags
+func tunnelsOptions(
+	log *logging.Logger, endpoint string, listenKey sas.Key,
+) (*handlers.TunnelsOptions, *registry.ReaperOptions, error) {
+	maxTTL, err := maxTunnelTTL(log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quotas, err := quotaEnforcer(log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rateLimits, err := rateLimitPolicy(log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reaper, heartbeatInterval := reaperOptions(log)
+	return &handlers.TunnelsOptions{
+		RelayEndpoint:     endpoint,
+		ListenerKey:       listenKey,
+		HeartbeatInterval: heartbeatInterval,
+		MaxTTL:            maxTTL,
+		Quotas:            quotas,
+		RateLimits:        rateLimits,
+	}, reaper, nil
+}
+
+// maxTunnelTTL returns the maximum tunnel lifetime from --max-ttl, zero when unlimited
+func maxTunnelTTL(log *logging.Logger) (time.Duration, error) {
+	if maxTTLFlag < 0 {
+		return 0, fmt.Errorf("invalid --max-ttl %d", maxTTLFlag)
+	}
+	maxTTL := time.Duration(maxTTLFlag) * time.Second
+	if maxTTL > 0 {
+		log.Info("Limiting tunnel lifetime", logging.String("max_ttl", maxTTL.String()))
+	}
+	return maxTTL, nil
+}
+
+// quotaEnforcer builds the per-key quotas from the --key-* flags and the AZHEXGATE_API_KEY_QUOTAS overrides.
+// It returns nil, disabling quotas, when no limit is configured.
+func quotaEnforcer(log *logging.Logger) (*quota.Enforcer, error) {
+	if keyMaxTunnelsFlag < 0 || keyCreationsFlag < 0 || keyMaxTTLFlag < 0 {
+		return nil, fmt.Errorf("invalid quota: --key-max-tunnels, --key-creations-per-hour and --key-max-ttl " +
+			"must not be negative")
+	}
+
+	defaults := quota.Limits{
+		MaxTunnels:       keyMaxTunnelsFlag,
+		CreationsPerHour: keyCreationsFlag,
+		MaxTTL:           time.Duration(keyMaxTTLFlag) * time.Second,
+	}
+	keys, err := quota.ParseEntries(GetConfig().APIKeyQuotas, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AZHEXGATE_API_KEY_QUOTAS: %w", err)
+	}
+
+	if defaults == (quota.Limits{}) && len(keys) == 0 {
+		return nil, nil
+	}
+	log.Info("Enforcing API key quotas",
+		logging.Int("max_tunnels", defaults.MaxTunnels),
+		logging.Int("creations_per_hour", defaults.CreationsPerHour),
+		logging.String("max_ttl", defaults.MaxTTL.String()),
+		logging.Int("key_overrides", len(keys)))
+	return quota.NewEnforcer(&quota.Options{Default: defaults, Keys: keys}), nil
+}
+
+// rateLimitPolicy builds the defaults and ceilings of tunnel rate limits from the rate flags
+func rateLimitPolicy(log *logging.Logger) (ratelimit.Policy, error) {
+	if rateLimitFlag < 0 || rateBurstFlag < 0 || maxRateLimitFlag < 0 || maxRateBurstFlag < 0 {
+		return ratelimit.Policy{}, fmt.Errorf("invalid rate limit: --rate-limit, --rate-burst, " +
+			"--max-rate-limit and --max-rate-burst must not be negative")
+	}
+
+	policy := ratelimit.Policy{
+		Default: ratelimit.Limit{
+			RequestsPerSecond: rateLimitFlag,
+			Burst:             rateBurstFlag,
+			PerSource:         rateLimitPerIPFlag,
+		},
+		Max: ratelimit.Limit{RequestsPerSecond: maxRateLimitFlag, Burst: maxRateBurstFlag},
+	}
+	if policy != (ratelimit.Policy{}) {
+		log.Info("Rate limiting tunnels",
+			logging.String("default", strconv.FormatFloat(rateLimitFlag, 'f', -1, 64)+"/s"),
+			logging.String("max", strconv.FormatFloat(maxRateLimitFlag, 'f', -1, 64)+"/s"),
+			logging.Bool("per_ip", rateLimitPerIPFlag))
+	}
+	return policy, nil
+}
+
+// reaperOptions configures stale tunnel expiry from the heartbeat flags and returns the heartbeat
+// interval advertised to clients, a third of the timeout so a single lost heartbeat is tolerated.
+// When the timeout is not positive, only tunnels past their TTL are deleted.
+func reaperOptions(log *logging.Logger) (*registry.ReaperOptions, time.Duration) {
+	if heartbeatTimeoutFlag <= 0 {
+		log.Warn("Heartbeat timeout disabled, tunnels of vanished clients are never released")
+		return &registry.ReaperOptions{Timeout: -1}, 0
+	}
+
+	timeout := time.Duration(heartbeatTimeoutFlag) * time.Second
+	gracePeriod := time.Duration(gracePeriodFlag) * time.Second
+	log.Info("Expiring stale tunnels",
+		logging.String("heartbeat_timeout", timeout.String()),
+		logging.String("grace_period", gracePeriod.String()))
+
+	return &registry.ReaperOptions{Timeout: timeout, GracePeriod: gracePeriod}, timeout / 3
+}
+
+// openRegistry opens the tunnel registry.
+// Tunnels are persisted to AZHEXGATE_REGISTRY_PATH when set and kept in memory otherwise.
+func openRegistry(log *logging.Logger) (registry.TunnelRegistry, error) {
+	path := GetConfig().RegistryPath
+	if path == "" {
+		log.Warn("AZHEXGATE_REGISTRY_PATH is not set, tunnels will not survive a restart")
+		return registry.NewMemoryRegistry(), nil
+	}
+
+	reg, err := registry.NewBoltRegistry(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Using persistent tunnel registry", logging.String("path", path))
+	return reg, nil
+}
+
+// relayEndpoint returns the relay namespace endpoint from configuration, defaulting to
+// handlers.DefaultRelayEndpoint so the senders dial the namespace handed out to clients.
+// A bare namespace host is treated as an https endpoint.
+func relayEndpoint() string {
+	namespace := GetConfig().RelayNamespace
+	if namespace == "" {
+		return handlers.DefaultRelayEndpoint
+	}
+	if !strings.Contains(namespace, "://") {
+		namespace = "https://" + namespace
+	}
+	return namespace
+}
+
+// relayKey returns the shared access key the gateway signs its Relay sender tokens with.
+// When none is configured an ephemeral key is generated, so tokens are only
+// accepted by a relay emulator started without keys.
+func relayKey(log *logging.Logger) sas.Key {
+	cfg := GetConfig()
+	if cfg.RelayKey != "" {
+		return sas.Key{Name: cfg.RelayKeyName, Value: cfg.RelayKey}
+	}
+
+	log.Warn("AZHEXGATE_RELAY_KEY is not set, signing Relay tokens with an ephemeral key")
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return sas.Key{Name: cfg.RelayKeyName, Value: base64.StdEncoding.EncodeToString(buf)}
+}
+
+// relayListenKey returns the listen-only shared access key client listener tokens are signed with.
+// A SAS token carries the rights of the policy of its key, so without one the listener tokens fall back
+// to sendKey and grant clients its Send and Manage rights too.
+func relayListenKey(log *logging.Logger, sendKey sas.Key) sas.Key {
+	cfg := GetConfig()
+	if cfg.RelayListenKey != "" {
+		return sas.Key{Name: cfg.RelayListenKeyName, Value: cfg.RelayListenKey}
+	}
+
+	if cfg.RelayKey != "" {
+		log.Warn("AZHEXGATE_RELAY_LISTEN_KEY is not set, listener tokens carry every right of AZHEXGATE_RELAY_KEY",
+			logging.String("key_name", sendKey.Name))
+	}
+	return sendKey
+}
+
+// newRelaySender returns a factory for relay senders that authenticate with
+// short-lived SAS tokens scoped to their hybrid connection
+func newRelaySender(endpoint string, key sas.Key) func(string) *gatewayrelay.Sender {
+	return func(hybridConnectionName string) *gatewayrelay.Sender {
+		return gatewayrelay.NewSender(&gatewayrelay.Options{
+			Relay: relay.NewHybridConnectionSender(&relay.SenderOptions{
+				Endpoint:             endpoint,
+				HybridConnectionName: hybridConnectionName,
+				TokenProvider: func(ctx context.Context) (string, error) {
+					resourceURI, err := sas.ResourceURI(endpoint, hybridConnectionName)
+					if err != nil {
+						return "", err
+					}
+					return sas.Generate(resourceURI, key, time.Now().Add(senderTokenTTL))
+				},
+			}),
+		})
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+	"github.com/julienstroheker/AzHexGate/internal/config"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
 )
 
 func TestStartCommandHelp(t *testing.T) {
@@ -28,6 +33,27 @@ func TestStartCommandHelp(t *testing.T) {
 		t.Errorf("Expected output to contain '--port' flag, got: %s", output)
 	}
 
+	if !strings.Contains(output, "--heartbeat-timeout") {
+		t.Errorf("Expected output to contain '--heartbeat-timeout' flag, got: %s", output)
+	}
+	if !strings.Contains(output, "--max-ttl") {
+		t.Errorf("Expected output to contain '--max-ttl' flag, got: %s", output)
+	}
+	if !strings.Contains(output, "--key-max-tunnels") {
+		t.Errorf("Expected output to contain '--key-max-tunnels' flag, got: %s", output)
+	}
+	if !strings.Contains(output, "--rate-limit") {
+		t.Errorf("Expected output to contain '--rate-limit' flag, got: %s", output)
+	}
+
+	if !strings.Contains(output, "--auth-mode") {
+		t.Errorf("Expected output to contain '--auth-mode' flag, got: %s", output)
+	}
+
+	if !strings.Contains(output, "--relay-pool-size") {
+		t.Errorf("Expected output to contain '--relay-pool-size' flag, got: %s", output)
+	}
+
 	if !strings.Contains(output, "--shutdown-timeout") {
 		t.Errorf("Expected output to contain '--shutdown-timeout' flag, got: %s", output)
 	}
@@ -50,3 +76,78 @@ func TestStartCommandDefaultValues(t *testing.T) {
 		t.Errorf("Expected default shutdown timeout to be 30, got: %d", shutdownTimeoutFlag)
 	}
 }
+
+func TestRelayEndpoint(t *testing.T) {
+	defer func() { cfg = nil }()
+
+	tests := []struct {
+		namespace string
+		want      string
+	}{
+		// Senders and tunnel responses must agree on the namespace when none is configured
+		{namespace: "", want: handlers.DefaultRelayEndpoint},
+		{namespace: "test-relay.servicebus.windows.net", want: "https://test-relay.servicebus.windows.net"},
+		{namespace: "http://localhost:9090", want: "http://localhost:9090"},
+	}
+
+	for _, tt := range tests {
+		cfg = &config.Config{RelayNamespace: tt.namespace}
+		if got := relayEndpoint(); got != tt.want {
+			t.Errorf("Expected relay endpoint %q for namespace %q, got %q", tt.want, tt.namespace, got)
+		}
+	}
+}
+
+func TestRelayListenKey(t *testing.T) {
+	log := logging.New(logging.ErrorLevel)
+	defer func() { cfg = nil }()
+
+	cfg = &config.Config{
+		RelayKeyName:       "RootManageSharedAccessKey",
+		RelayKey:           "send-secret",
+		RelayListenKeyName: "Listen",
+		RelayListenKey:     "listen-secret",
+	}
+	sendKey := relayKey(log)
+	if listenKey := relayListenKey(log, sendKey); listenKey != (sas.Key{Name: "Listen", Value: "listen-secret"}) {
+		t.Errorf("Expected listener tokens to be signed with the listen-only key, got %+v", listenKey)
+	}
+	if sendKey != (sas.Key{Name: "RootManageSharedAccessKey", Value: "send-secret"}) {
+		t.Errorf("Expected sender tokens to be signed with the send key, got %+v", sendKey)
+	}
+
+	// Without a listen-only key, listener tokens fall back to the send key
+	cfg.RelayListenKey = ""
+	if listenKey := relayListenKey(log, sendKey); listenKey != sendKey {
+		t.Errorf("Expected the send key as fallback, got %+v", listenKey)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	log := logging.New(logging.ErrorLevel)
+	defer func() { authModeFlag, cfg = authModeAPIKey, nil }()
+
+	authModeFlag = authModeAPIKey
+	cfg = &config.Config{APIKey: "secret-1", OIDCIssuer: "https://issuer.example.com"}
+	keys, validator, err := authentication(log)
+	if err != nil || keys == nil || validator != nil {
+		t.Errorf("Expected API key authentication only, got keys %v, validator %v and error %v", keys, validator, err)
+	}
+
+	authModeFlag = authModeOIDC
+	cfg = &config.Config{APIKey: "secret-1", OIDCIssuer: "https://issuer.example.com", OIDCAudience: "azhexgate"}
+	keys, validator, err = authentication(log)
+	if err != nil || keys != nil || validator == nil {
+		t.Errorf("Expected bearer token authentication only, got keys %v, validator %v and error %v", keys, validator, err)
+	}
+
+	cfg = &config.Config{OIDCIssuer: "https://issuer.example.com"}
+	if _, _, err := authentication(log); err == nil || !strings.Contains(err.Error(), "AZHEXGATE_OIDC_AUDIENCE") {
+		t.Errorf("Expected an error naming the missing audience, got %v", err)
+	}
+
+	authModeFlag = "ldap"
+	if _, _, err := authentication(log); err == nil {
+		t.Error("Expected an error for an unknown auth mode")
+	}
+}
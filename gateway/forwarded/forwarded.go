@@ -0,0 +1,198 @@
+// Package forwarded resolves the original client of a proxied request and writes the
+// X-Forwarded-* and RFC 7239 Forwarded headers for the local app
+package forwarded
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/gateway/ipfilter"
+)
+
+const (
+	// HeaderForwardedFor lists the client and the proxies a request went through
+	HeaderForwardedFor = "X-Forwarded-For"
+
+	// HeaderForwardedProto is the scheme the client used
+	HeaderForwardedProto = "X-Forwarded-Proto"
+
+	// HeaderForwardedHost is the Host the client requested
+	HeaderForwardedHost = "X-Forwarded-Host"
+
+	// HeaderForwarded is the standard header defined by RFC 7239
+	HeaderForwarded = "Forwarded"
+)
+
+// ErrInvalidProxy is returned when a trusted proxy is neither an IP address nor a CIDR range
+var ErrInvalidProxy = errors.New("invalid trusted proxy")
+
+// TrustedProxies is the set of upstream proxies (e.g. Azure Front Door) whose forwarding
+// headers are kept. Forwarding headers from any other peer are replaced, so clients cannot
+// spoof their address. A nil *TrustedProxies trusts no one.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(list string) (*TrustedProxies, error) {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	prefixes, err := ipfilter.Parse(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxy, err)
+	}
+	return &TrustedProxies{prefixes: prefixes}, nil
+}
+
+// Len returns the number of trusted ranges
+func (t *TrustedProxies) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.prefixes)
+}
+
+// Contains reports whether addr belongs to a trusted proxy
+func (t *TrustedProxies) Contains(addr netip.Addr) bool {
+	if t == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Proxied reports whether the request was sent by a trusted proxy, which may carry requests of several clients
+func (t *TrustedProxies) Proxied(r *http.Request) bool {
+	return t.Contains(remoteAddr(r))
+}
+
+// ClientIP returns the address of the original client.
+// X-Forwarded-For is only followed through trusted proxies, from the closest hop outwards,
+// so an address a client put in the header itself is never returned.
+func (t *TrustedProxies) ClientIP(r *http.Request) netip.Addr {
+	client := remoteAddr(r)
+	if !t.Contains(client) {
+		return client
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !t.Contains(client) {
+			break
+		}
+	}
+	return client
+}
+
+// SetHeaders writes the forwarding headers for a request about to be relayed.
+// When the peer is a trusted proxy its headers are extended; otherwise they are replaced.
+func (t *TrustedProxies) SetHeaders(r *http.Request) {
+	peer := remoteAddr(r)
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if !t.Contains(peer) {
+		r.Header.Del(HeaderForwardedFor)
+		r.Header.Del(HeaderForwardedProto)
+		r.Header.Del(HeaderForwardedHost)
+		r.Header.Del(HeaderForwarded)
+	}
+
+	hops := forwardedFor(r.Header)
+	if peer.IsValid() {
+		hops = append(hops, peer.String())
+	}
+	if len(hops) > 0 {
+		r.Header.Set(HeaderForwardedFor, strings.Join(hops, ", "))
+	}
+	if r.Header.Get(HeaderForwardedProto) == "" {
+		r.Header.Set(HeaderForwardedProto, proto)
+	}
+	if r.Header.Get(HeaderForwardedHost) == "" {
+		r.Header.Set(HeaderForwardedHost, r.Host)
+	}
+
+	element := fmt.Sprintf("for=%s;host=%s;proto=%s", nodeName(peer), quote(r.Host), proto)
+	if previous := strings.Join(r.Header.Values(HeaderForwarded), ", "); previous != "" {
+		element = previous + ", " + element
+	}
+	r.Header.Set(HeaderForwarded, element)
+}
+
+// remoteAddr returns the IP address of the connected peer
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// forwardedFor returns the X-Forwarded-For entries in order, across repeated headers
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values(HeaderForwardedFor) {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// nodeName formats an address as a Forwarded node (RFC 7239, section 6).
+// IPv6 addresses are bracketed and quoted; an unknown peer is "unknown".
+func nodeName(addr netip.Addr) string {
+	switch {
+	case !addr.IsValid():
+		return "unknown"
+	case addr.Is6():
+		return `"[` + addr.String() + `]"`
+	default:
+		return addr.String()
+	}
+}
+
+// quote returns value as a token, or as a quoted string when it contains other characters
+func quote(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+// isTokenChar reports whether c may appear in an RFC 9110 token
+func isTokenChar(c rune) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
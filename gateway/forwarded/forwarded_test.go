@@ -0,0 +1,175 @@
+package forwarded
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.7 ,2001:db8::/32,")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if proxies.Len() != 3 {
+		t.Errorf("Expected 3 ranges, got %d", proxies.Len())
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "10.1.2.3", want: true},
+		{addr: "::ffff:10.1.2.3", want: true},
+		{addr: "192.168.1.7", want: true},
+		{addr: "192.168.1.8", want: false},
+		{addr: "2001:db8::1", want: true},
+		{addr: "203.0.113.9", want: false},
+	}
+	for _, tt := range tests {
+		if got := proxies.Contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	mapped, err := ParseTrustedProxies("::ffff:192.0.2.10")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !mapped.Contains(netip.MustParseAddr("192.0.2.10")) {
+		t.Error("Expected an IPv4-mapped proxy to match its IPv4 address")
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0"} {
+		if _, err := ParseTrustedProxies(invalid); !errors.Is(err, ErrInvalidProxy) {
+			t.Errorf("Expected ErrInvalidProxy for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestNilTrustedProxies(t *testing.T) {
+	var proxies *TrustedProxies
+	if proxies.Len() != 0 || proxies.Contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Error("Expected a nil set to trust no one")
+	}
+}
+
+// newRequest returns a request from remoteAddr with the given X-Forwarded-For header
+func newRequest(remoteAddr, forwardedFor string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/callback", nil)
+	req.Host = "63873749.azhexgate.com"
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set(HeaderForwardedFor, forwardedFor)
+	}
+	return req
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.9:5000", want: "203.0.113.9"},
+		{name: "untrusted peer cannot spoof", remoteAddr: "203.0.113.9:5000", forwardedFor: "1.2.3.4",
+			want: "203.0.113.9"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:5000", forwardedFor: "198.51.100.7", want: "198.51.100.7"},
+		{name: "spoofed entry before the real client", remoteAddr: "10.0.0.1:5000",
+			forwardedFor: "1.2.3.4, 198.51.100.7, 10.0.0.2", want: "198.51.100.7"},
+		{name: "only trusted hops", remoteAddr: "10.0.0.1:5000", forwardedFor: "10.0.0.3", want: "10.0.0.3"},
+		{name: "garbage entry", remoteAddr: "10.0.0.1:5000", forwardedFor: "garbage", want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := proxies.ClientIP(newRequest(tt.remoteAddr, tt.forwardedFor))
+			if got.String() != tt.want {
+				t.Errorf("Expected client %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProxied(t *testing.T) {
+	proxies, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	if !proxies.Proxied(newRequest("10.0.0.1:5000", "198.51.100.7")) {
+		t.Error("Expected a request from a trusted proxy to be proxied")
+	}
+	if proxies.Proxied(newRequest("203.0.113.9:5000", "10.0.0.1")) {
+		t.Error("Expected a request from an untrusted peer not to be proxied")
+	}
+	var none *TrustedProxies
+	if none.Proxied(newRequest("10.0.0.1:5000", "")) {
+		t.Error("Expected nil trusted proxies to trust no one")
+	}
+}
+
+func TestSetHeaders_DirectClient(t *testing.T) {
+	req := newRequest("203.0.113.9:5000", "1.2.3.4")
+	req.Header.Set(HeaderForwardedProto, "https")
+	req.Header.Set(HeaderForwardedHost, "evil.example.com")
+	req.Header.Set(HeaderForwarded, "for=1.2.3.4")
+
+	var proxies *TrustedProxies
+	proxies.SetHeaders(req)
+
+	want := map[string]string{
+		HeaderForwardedFor:   "203.0.113.9",
+		HeaderForwardedProto: "http",
+		HeaderForwardedHost:  "63873749.azhexgate.com",
+		HeaderForwarded:      "for=203.0.113.9;host=63873749.azhexgate.com;proto=http",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestSetHeaders_TrustedProxy(t *testing.T) {
+	proxies, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	req := newRequest("10.0.0.1:5000", "198.51.100.7")
+	req.Header.Set(HeaderForwardedProto, "https")
+	req.Header.Set(HeaderForwardedHost, "app.example.com")
+	req.Header.Set(HeaderForwarded, "for=198.51.100.7;proto=https")
+	req.TLS = &tls.ConnectionState{}
+
+	proxies.SetHeaders(req)
+
+	want := map[string]string{
+		HeaderForwardedFor:   "198.51.100.7, 10.0.0.1",
+		HeaderForwardedProto: "https",
+		HeaderForwardedHost:  "app.example.com",
+		HeaderForwarded:      "for=198.51.100.7;proto=https, for=10.0.0.1;host=63873749.azhexgate.com;proto=https",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestSetHeaders_IPv6AndPort(t *testing.T) {
+	req := newRequest("[2001:db8::1]:5000", "")
+	req.Host = "63873749.azhexgate.com:8443"
+
+	var proxies *TrustedProxies
+	proxies.SetHeaders(req)
+
+	want := `for="[2001:db8::1]";host="63873749.azhexgate.com:8443";proto=http`
+	if got := req.Header.Get(HeaderForwarded); got != want {
+		t.Errorf("Expected Forwarded %q, got %q", want, got)
+	}
+	if got := req.Header.Get(HeaderForwardedFor); got != "2001:db8::1" {
+		t.Errorf("Expected X-Forwarded-For %q, got %q", "2001:db8::1", got)
+	}
+}
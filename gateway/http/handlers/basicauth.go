@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienstroheker/AzHexGate/gateway/basicauth"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// basicAuthHash hashes the credentials asked for in a tunnel creation request (empty when there are none)
+func basicAuthHash(request *api.CreateTunnelRequest) (string, error) {
+	if request.BasicAuth == nil {
+		return "", nil
+	}
+	return basicauth.Hash(request.BasicAuth.Username, request.BasicAuth.Password)
+}
+
+// authorize checks the Basic credentials of a request to a protected tunnel, answering 401 when they are
+// missing or wrong. Accepted credentials are removed so they never reach the local server.
+func (h *ProxyHandler) authorize(w http.ResponseWriter, r *http.Request, tunnel *registry.Tunnel) bool {
+	if tunnel.BasicAuthHash == "" {
+		return true
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || !h.credentials.Verify(tunnel.BasicAuthHash, username, password) {
+		logging.FromContext(r.Context()).Debug("Tunnel basic auth failed",
+			logging.String("tunnel_id", tunnel.ID),
+			logging.Bool("credentials_sent", ok))
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="azhexgate tunnel %s", charset="UTF-8"`, tunnel.ID))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	r.Header.Del("Authorization")
+	return true
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// exchange is a request written to the relay, or a response refusing it, in the order the client sent them
+type exchange struct {
+	request *http.Request
+
+	// refusal is the response to a request that failed the tunnel checks; it ends the connection
+	refusal *responseBuffer
+
+	// switched receives whether the local server accepted the protocol upgrade asked for by request
+	switched chan bool
+}
+
+// forward relays the requests of a hijacked client connection one at a time, so every request gets
+// the tunnel checks and forwarding headers, not only the first one. first has already been checked
+// by ServeHTTP. Responses are copied back in order; after a protocol switch both directions are
+// copied raw. Both connections are closed when forward returns.
+func (h *ProxyHandler) forward(first *http.Request, conn net.Conn, client *bufio.Reader,
+	relayConn relay.Connection) error {
+	exchanges := make(chan exchange)
+	done := make(chan struct{})
+	sent := make(chan error, 1)
+	go func() {
+		sent <- h.sendRequests(first, client, relayConn, exchanges, done)
+	}()
+
+	err := relayResponses(conn, bufio.NewReader(relayConn), exchanges)
+
+	// Closing both connections unblocks the other direction
+	_ = relayConn.Close()
+	_ = conn.Close()
+	close(done)
+	if sendErr := <-sent; err == nil {
+		err = sendErr
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// sendRequests reads requests off the client connection, checks them and writes them to the relay
+func (h *ProxyHandler) sendRequests(first *http.Request, client *bufio.Reader, relayConn relay.Connection,
+	exchanges chan<- exchange, done <-chan struct{}) error {
+	defer close(exchanges)
+
+	send := func(e exchange) bool {
+		select {
+		case exchanges <- e:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for n := 0; ; n++ {
+		// The first request was checked and rewritten by ServeHTTP before it was replayed here
+		req, refusal, err := h.readRequest(first, client, n > 0)
+		if refusal != nil {
+			send(exchange{refusal: refusal})
+			return err
+		}
+		if err != nil {
+			// Drop the exchange in progress, as nobody is left to read its response
+			_ = relayConn.Close()
+			return err
+		}
+
+		e := exchange{request: req}
+		if upgrades(req.Header) {
+			e.switched = make(chan bool, 1)
+		}
+		if !send(e) {
+			return nil
+		}
+		if err := writeRequest(relayConn, req); err != nil {
+			return err
+		}
+
+		if e.switched == nil {
+			continue
+		}
+		select {
+		case switched := <-e.switched:
+			if switched {
+				_, err := io.Copy(relayConn, client)
+				return err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// readRequest reads the next request off the client connection, applying the tunnel checks and
+// forwarding headers when check is set. refusal is the response to send instead of forwarding it.
+func (h *ProxyHandler) readRequest(first *http.Request, client *bufio.Reader, check bool) (
+	req *http.Request, refusal *responseBuffer, err error) {
+	req, err = http.ReadRequest(client)
+	if clientGone(err) {
+		return nil, nil, err
+	}
+	if err != nil {
+		refusal = newResponseBuffer()
+		http.Error(refusal, "Bad request", http.StatusBadRequest)
+		return nil, refusal, err
+	}
+	req = req.WithContext(first.Context())
+	req.RemoteAddr = first.RemoteAddr
+	req.TLS = first.TLS
+	if !check {
+		return req, nil, nil
+	}
+
+	refusal = newResponseBuffer()
+	if _, ok := h.permit(refusal, req, GetTunnelID(req.Context())); !ok {
+		return nil, refusal, nil
+	}
+	h.trusted.SetHeaders(req)
+	return req, nil, nil
+}
+
+// relayResponses copies the response to every exchange from the relay to the client connection.
+// It returns when a response ends the connection, after a protocol switch or once exchanges is closed.
+func relayResponses(conn net.Conn, relayReader *bufio.Reader, exchanges <-chan exchange) error {
+	for e := range exchanges {
+		if e.refusal != nil {
+			return e.refusal.writeTo(conn)
+		}
+
+		resp, err := readResponse(conn, relayReader, e.request)
+		if err != nil {
+			return err
+		}
+
+		if e.switched != nil {
+			e.switched <- resp.StatusCode == http.StatusSwitchingProtocols
+		}
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			if err := writeResponseHead(conn, resp); err != nil {
+				return err
+			}
+			_, err := io.Copy(conn, relayReader)
+			return err
+		}
+
+		// A body of unknown length ends when the connection closes
+		if resp.ContentLength < 0 && !chunked(resp.TransferEncoding) {
+			resp.Close = true
+		}
+		err = resp.Write(conn)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.Close || e.request.Close {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readResponse reads the final response to req from the relay, passing interim 1xx responses such as
+// 100 Continue on to the client
+func readResponse(conn net.Conn, relayReader *bufio.Reader, req *http.Request) (*http.Response, error) {
+	for {
+		resp, err := http.ReadResponse(relayReader, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusOK || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+		if err := writeResponseHead(conn, resp); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeResponseHead writes the status line and headers of a response without a body
+func writeResponseHead(w io.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// writeRequest writes a request to the relay as the client sent it, re-encoding a chunked body
+func writeRequest(w io.Writer, r *http.Request) error {
+	defer func() { _ = r.Body.Close() }()
+
+	// The head goes out on its own, as a client expecting 100 Continue waits before sending the body
+	if _, err := w.Write(requestHead(r)); err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriter(w)
+	switch {
+	case chunked(r.TransferEncoding):
+		if err := writeChunked(buffered, r.Body); err != nil {
+			return err
+		}
+		if err := r.Trailer.Write(buffered); err != nil {
+			return err
+		}
+		if _, err := buffered.WriteString("\r\n"); err != nil {
+			return err
+		}
+	case r.ContentLength > 0:
+		if _, err := io.Copy(buffered, r.Body); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// writeChunked writes body in chunked encoding, flushing every chunk so streamed uploads are not held back
+func writeChunked(w *bufio.Writer, body io.Reader) error {
+	chunks := httputil.NewChunkedWriter(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := chunks.Write(buf[:n]); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return chunks.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// requestHead serializes the request line and headers as received from the client.
+// The body is not included.
+func requestHead(r *http.Request) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/%d.%d\r\n", r.Method, r.RequestURI, r.ProtoMajor, r.ProtoMinor)
+	fmt.Fprintf(&buf, "Host: %s\r\n", r.Host)
+
+	// net/http moves framing headers out of Header, so restore them
+	switch {
+	case len(r.TransferEncoding) > 0:
+		fmt.Fprintf(&buf, "Transfer-Encoding: %s\r\n", r.TransferEncoding[len(r.TransferEncoding)-1])
+	case r.ContentLength > 0:
+		fmt.Fprintf(&buf, "Content-Length: %s\r\n", strconv.FormatInt(r.ContentLength, 10))
+	}
+	if len(r.Trailer) > 0 {
+		names := make([]string, 0, len(r.Trailer))
+		for name := range r.Trailer {
+			names = append(names, name)
+		}
+		fmt.Fprintf(&buf, "Trailer: %s\r\n", strings.Join(names, ", "))
+	}
+
+	_ = r.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// clientGone reports whether reading a request failed because the client connection ended
+func clientGone(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &opErr)
+}
+
+// chunked reports whether the last transfer coding is chunked
+func chunked(transferEncoding []string) bool {
+	return len(transferEncoding) > 0 && transferEncoding[len(transferEncoding)-1] == "chunked"
+}
+
+// upgrades reports whether a request asks to switch protocols (e.g. a WebSocket handshake)
+func upgrades(header http.Header) bool {
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// responseBuffer is a ResponseWriter that keeps the response so it can be written on a hijacked connection
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newResponseBuffer creates an empty response buffer
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+// Header returns the response headers
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader records the status code of the response
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// Write appends to the response body
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// writeTo writes the response to the client, closing the connection after it
+func (b *responseBuffer) writeTo(conn net.Conn) error {
+	b.WriteHeader(http.StatusOK)
+	resp := &http.Response{
+		StatusCode:    b.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        b.header,
+		Body:          io.NopCloser(&b.body),
+		ContentLength: int64(b.body.Len()),
+		Close:         true,
+	}
+	return resp.Write(conn)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// Heartbeat serves PUT /api/tunnels/{id}/heartbeat, recording that the client of a tunnel is alive.
+// A heartbeat marks an inactive tunnel active again; only the session that owns the tunnel may send it.
+// Tunnels of other owners look like unknown tunnels.
+func (h *TunnelsHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	logger := logging.FromContext(r.Context())
+	tunnelID := r.PathValue("id")
+
+	var request api.HeartbeatRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxCreateRequestSize)).Decode(&request); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tunnel, err := h.owned(r, tunnelID)
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get tunnel", logging.String("tunnel_id", tunnelID), logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ownsSession(r, tunnel, request.SessionID) {
+		http.Error(w, errSessionMismatch.Error(), http.StatusConflict)
+		return
+	}
+
+	err = h.registry.Touch(r.Context(), tunnelID, time.Now().UTC())
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to record heartbeat", logging.String("tunnel_id", tunnelID), logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	if tunnel.Inactive {
+		logger.Info("Tunnel active again", logging.String("tunnel_id", tunnelID))
+	}
+}
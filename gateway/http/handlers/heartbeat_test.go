@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+)
+
+func TestTunnelsHandlerHeartbeat(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey:       testListenerKey,
+		Registry:          reg,
+		HeartbeatInterval: 20 * time.Second,
+	})
+	keys, _ := apikey.ParseEntries("ci secret-1, ops secret-2")
+	heartbeat := middleware.APIKey(keys)(http.HandlerFunc(handler.Heartbeat))
+
+	var created api.TunnelResponse
+	w := createTunnelAs(middleware.APIKey(keys)(handler), "secret-1", `{"local_port": 3000}`)
+	_ = json.NewDecoder(w.Body).Decode(&created)
+	if created.HeartbeatInterval != 20 {
+		t.Errorf("Expected heartbeat_interval 20, got %d", created.HeartbeatInterval)
+	}
+	_ = reg.MarkInactive(context.Background(), created.TunnelID)
+
+	tests := []struct {
+		name       string
+		method     string
+		tunnelID   string
+		key        string
+		body       string
+		wantStatus int
+	}{
+		{name: "owner session", method: http.MethodPut, tunnelID: created.TunnelID,
+			body: `{"session_id": "` + created.SessionID + `"}`, wantStatus: http.StatusNoContent},
+		{name: "other session", method: http.MethodPut, tunnelID: created.TunnelID,
+			body: `{"session_id": "other"}`, wantStatus: http.StatusConflict},
+		// Tunnels of other owners look like unknown tunnels, whatever the session
+		{name: "other owner", method: http.MethodPut, tunnelID: created.TunnelID, key: "secret-2",
+			body: `{"session_id": "` + created.SessionID + `"}`, wantStatus: http.StatusNotFound},
+		{name: "other owner and session", method: http.MethodPut, tunnelID: created.TunnelID, key: "secret-2",
+			body: `{"session_id": "other"}`, wantStatus: http.StatusNotFound},
+		{name: "unknown tunnel", method: http.MethodPut, tunnelID: "12345678",
+			body: `{"session_id": "` + created.SessionID + `"}`, wantStatus: http.StatusNotFound},
+		{name: "invalid body", method: http.MethodPut, tunnelID: created.TunnelID,
+			body: `not json`, wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, tunnelID: created.TunnelID,
+			wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/tunnels/"+tt.tunnelID+"/heartbeat", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.tunnelID)
+			key := tt.key
+			if key == "" {
+				key = "secret-1"
+			}
+			req.Header.Set(api.APIKeyHeader, key)
+			w := httptest.NewRecorder()
+			heartbeat.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+
+	tunnel, _ := reg.Get(context.Background(), created.TunnelID)
+	if tunnel.Inactive {
+		t.Error("Expected the heartbeat to mark the tunnel active again")
+	}
+}
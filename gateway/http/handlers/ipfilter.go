@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/julienstroheker/AzHexGate/gateway/ipfilter"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// requestedCIDRs returns the normalized client IP ranges asked for in a tunnel creation request
+func requestedCIDRs(request *api.CreateTunnelRequest) (allow, deny []string, err error) {
+	if allow, err = ipfilter.Canonical(request.AllowCIDRs); err != nil {
+		return nil, nil, err
+	}
+	if deny, err = ipfilter.Canonical(request.DenyCIDRs); err != nil {
+		return nil, nil, err
+	}
+	return allow, deny, nil
+}
+
+// admit applies the IP allow and deny lists of the tunnel to the client of a request, answering 403
+// when it is refused
+func (h *ProxyHandler) admit(w http.ResponseWriter, r *http.Request, tunnel *registry.Tunnel) bool {
+	logger := logging.FromContext(r.Context())
+
+	filter, err := ipfilter.New(tunnel.AllowCIDRs, tunnel.DenyCIDRs)
+	if err != nil {
+		logger.Error("Invalid tunnel IP filter", logging.String("tunnel_id", tunnel.ID), logging.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if filter == nil {
+		return true
+	}
+
+	client := h.trusted.ClientIP(r)
+	if !filter.Allows(client) {
+		logger.Info("Client IP refused by tunnel IP filter",
+			logging.String("tunnel_id", tunnel.ID),
+			logging.String("client_ip", client.String()))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// PoolStatsHandler serves the relay connection pool activity of the tunnels of the caller, ordered by tunnel ID
+func PoolStatsHandler(proxy *ProxyHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		tunnels, err := proxy.registry.List(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to list tunnels", logging.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		owner := middleware.GetOwner(r.Context())
+		owned := make(map[string]bool, len(tunnels))
+		for _, tunnel := range tunnels {
+			owned[tunnel.ID] = tunnel.Owner == owner
+		}
+
+		stats := proxy.PoolStats()
+		response := api.RelayPoolStatsResponse{Pools: make([]api.RelayPoolStats, 0, len(stats))}
+		for tunnelID, pool := range stats {
+			if !owned[tunnelID] {
+				continue
+			}
+			response.Pools = append(response.Pools, api.RelayPoolStats{
+				TunnelID:      tunnelID,
+				Size:          pool.Size,
+				Idle:          pool.Idle,
+				Hits:          pool.Hits,
+				Misses:        pool.Misses,
+				Evictions:     pool.Evictions,
+				Dials:         pool.Dials,
+				DialFailures:  pool.DialFailures,
+				DialLatencyMs: float64(pool.DialLatency) / float64(time.Millisecond),
+			})
+		}
+		slices.SortFunc(response.Pools, func(a, b api.RelayPoolStats) int {
+			return strings.Compare(a.TunnelID, b.TunnelID)
+		})
+		writeJSON(w, http.StatusOK, response)
+	}
+}
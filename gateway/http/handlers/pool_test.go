@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+func TestPoolStatsHandler(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go serveRelay(ctx, memoryListener, strings.TrimPrefix(localServer.URL, "http://"))
+
+	var senders int
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: newTestRegistry(t, "63873749"),
+		NewSender: func(string) *gatewayrelay.Sender {
+			senders++
+			return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+		},
+		PoolSize: 2,
+	})
+	defer proxy.CloseTunnel("63873749")
+	server := newProxyServer(t, proxy, "63873749")
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		req.Close = true
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != "hello" {
+			t.Errorf("Expected body %q, got %q", "hello", string(body))
+		}
+	}
+	if senders != 1 {
+		t.Errorf("Expected one pooled sender for the tunnel, got %d", senders)
+	}
+
+	w := httptest.NewRecorder()
+	PoolStatsHandler(proxy).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/relay/pool", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response api.RelayPoolStatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if len(response.Pools) != 1 {
+		t.Fatalf("Expected 1 pool, got %d", len(response.Pools))
+	}
+	pool := response.Pools[0]
+	if pool.TunnelID != "63873749" || pool.Size != 2 {
+		t.Errorf("Expected a pool of 2 for tunnel 63873749, got %+v", pool)
+	}
+	if pool.Hits+pool.Misses != 3 {
+		t.Errorf("Expected 3 connections served, got %d hits and %d misses", pool.Hits, pool.Misses)
+	}
+}
+
+func TestProxyHandler_WarmFillsPool(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go serveRelay(ctx, memoryListener, strings.TrimPrefix(localServer.URL, "http://"))
+
+	reg := newTestRegistry(t, "63873749")
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: reg,
+		NewSender: func(string) *gatewayrelay.Sender {
+			return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+		},
+		PoolSize: 2,
+	})
+	defer proxy.CloseTunnel("63873749")
+
+	tunnel, _ := reg.Get(context.Background(), "63873749")
+	proxy.Warm(tunnel)
+
+	// The pool fills before any public request arrives
+	deadline := time.Now().Add(2 * time.Second)
+	for proxy.PoolStats()["63873749"].Idle < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pool to fill after warming, got %+v", proxy.PoolStats()["63873749"])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server := newProxyServer(t, proxy, "63873749")
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	req.Close = true
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if stats := proxy.PoolStats()["63873749"]; stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Expected the first request to be served from the pool, got %+v", stats)
+	}
+}
+
+func TestPoolStatsHandlerScopesToOwner(t *testing.T) {
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+
+	reg := registry.NewMemoryRegistry()
+	tunnels := []*registry.Tunnel{
+		{ID: "11111111", HybridConnectionName: "hc-11111111", Owner: "ci"},
+		{ID: "22222222", HybridConnectionName: "hc-22222222", Owner: "ops"},
+	}
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: reg,
+		NewSender: func(string) *gatewayrelay.Sender {
+			return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+		},
+		PoolSize: 1,
+	})
+	for _, tunnel := range tunnels {
+		_ = reg.Create(context.Background(), tunnel)
+		proxy.Warm(tunnel)
+		defer proxy.CloseTunnel(tunnel.ID)
+	}
+
+	keys, _ := apikey.ParseEntries("ci secret-1, ops secret-2, dev secret-3")
+	handler := middleware.APIKey(keys)(PoolStatsHandler(proxy))
+	pools := func(key string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/relay/pool", nil)
+		req.Header.Set(api.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		var response api.RelayPoolStatsResponse
+		_ = json.NewDecoder(w.Body).Decode(&response)
+		var ids []string
+		for _, pool := range response.Pools {
+			ids = append(ids, pool.TunnelID)
+		}
+		return ids
+	}
+
+	if ids := pools("secret-1"); !slices.Equal(ids, []string{"11111111"}) {
+		t.Errorf("Expected only the pool of tunnel 11111111, got %v", ids)
+	}
+	if ids := pools("secret-2"); !slices.Equal(ids, []string{"22222222"}) {
+		t.Errorf("Expected only the pool of tunnel 22222222, got %v", ids)
+	}
+	if ids := pools("secret-3"); len(ids) != 0 {
+		t.Errorf("Expected no pools for a key without tunnels, got %v", ids)
+	}
+}
+
+func TestPoolStatsHandlerMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	PoolStatsHandler(NewProxyHandler(nil)).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/relay/pool", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
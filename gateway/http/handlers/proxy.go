@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/basicauth"
+	"github.com/julienstroheker/AzHexGate/gateway/forwarded"
+	"github.com/julienstroheker/AzHexGate/gateway/ratelimit"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// tunnelIDKey is the context key for the tunnel ID resolved from the Host header
+type tunnelIDKey struct{}
+
+// WithTunnelID stores the tunnel ID in the context
+func WithTunnelID(ctx context.Context, tunnelID string) context.Context {
+	return context.WithValue(ctx, tunnelIDKey{}, tunnelID)
+}
+
+// GetTunnelID retrieves the tunnel ID from the context
+func GetTunnelID(ctx context.Context) string {
+	if id, ok := ctx.Value(tunnelIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// ProxyOptions contains configuration for the ProxyHandler
+type ProxyOptions struct {
+	// Registry resolves tunnel IDs to their hybrid connection (optional, defaults to an empty in-memory registry)
+	Registry registry.TunnelRegistry
+
+	// NewSender creates a relay sender for a hybrid connection
+	NewSender func(hybridConnectionName string) *gatewayrelay.Sender
+
+	// TrustedProxies are upstream proxies whose X-Forwarded-* and Forwarded headers are kept (optional).
+	// Forwarding headers from other peers are replaced.
+	TrustedProxies *forwarded.TrustedProxies
+
+	// PoolSize is how many idle relay connections are kept dialed per tunnel (optional).
+	// Zero dials the relay for every connection. Multiplexed tunnels are never pooled.
+	PoolSize int
+}
+
+// ProxyHandler forwards public traffic for a tunnel through the relay
+type ProxyHandler struct {
+	registry  registry.TunnelRegistry
+	newSender func(hybridConnectionName string) *gatewayrelay.Sender
+	trusted   *forwarded.TrustedProxies
+	poolSize  int
+
+	mu       sync.Mutex
+	active   map[string]map[net.Conn]struct{}
+	senders  map[string]*gatewayrelay.Sender
+	limiters map[string]*ratelimit.Limiter
+
+	credentials *basicauth.Verifier
+}
+
+// NewProxyHandler creates a new proxy handler
+func NewProxyHandler(opts *ProxyOptions) *ProxyHandler {
+	if opts == nil {
+		opts = &ProxyOptions{}
+	}
+
+	reg := opts.Registry
+	if reg == nil {
+		reg = registry.NewMemoryRegistry()
+	}
+
+	return &ProxyHandler{
+		registry:  reg,
+		newSender: opts.NewSender,
+		trusted:   opts.TrustedProxies,
+		poolSize:  opts.PoolSize,
+		active:    make(map[string]map[net.Conn]struct{}),
+		senders:   make(map[string]*gatewayrelay.Sender),
+		limiters:  make(map[string]*ratelimit.Limiter),
+
+		credentials: basicauth.NewVerifier(),
+	}
+}
+
+// ServeHTTP hijacks the client connection and forwards its requests through the relay.
+// The request already parsed by the server is re-serialized ahead of the remaining stream,
+// and later requests on the connection are checked again before they are forwarded.
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	tunnelID := GetTunnelID(r.Context())
+	if tunnelID == "" {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+
+	tunnel, ok := h.permit(w, r, tunnelID)
+	if !ok {
+		return
+	}
+	hybridConnectionName := tunnel.HybridConnectionName
+
+	if h.newSender == nil {
+		http.Error(w, "Relay is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		logger.Error("Connection does not support hijacking", logging.String("tunnel_id", tunnelID))
+		http.Error(w, "Unsupported connection", http.StatusInternalServerError)
+		return
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		logger.Error("Failed to hijack connection", logging.Error(err))
+		return
+	}
+
+	defer h.track(tunnelID, conn)()
+
+	// Closing the connection at expiry also ends its relay connection
+	if !tunnel.ExpiresAt.IsZero() {
+		expiry := time.AfterFunc(time.Until(tunnel.ExpiresAt), func() { _ = conn.Close() })
+		defer expiry.Stop()
+	}
+
+	// Upgraded connections (e.g. WebSockets) stay open long after the request, so drop server deadlines
+	_ = conn.SetDeadline(time.Time{})
+
+	// The tunnel may have been revoked between the lookup and tracking the connection
+	if _, err := h.registry.Get(r.Context(), tunnelID); err != nil {
+		writeRawError(conn, http.StatusNotFound)
+		_ = conn.Close()
+		return
+	}
+
+	sender, release := h.sender(tunnel)
+	defer release()
+
+	logger.Debug("Forwarding request through relay",
+		logging.String("tunnel_id", tunnelID),
+		logging.String("hybrid_connection", hybridConnectionName),
+		logging.Bool("multiplex", tunnel.Multiplex))
+
+	relayConn, err := sender.Dial(r.Context())
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, relay.ErrListenerOffline) {
+			status = http.StatusServiceUnavailable
+		}
+		logger.Warn("Tunnel unavailable",
+			logging.String("tunnel_id", tunnelID),
+			logging.Int("status", status),
+			logging.Error(err))
+		writeRawError(conn, status)
+		_ = conn.Close()
+		return
+	}
+
+	h.trusted.SetHeaders(r)
+	client := bufio.NewReader(io.MultiReader(bytes.NewReader(requestHead(r)), buffered.Reader))
+	if err := h.forward(r, conn, client, relayConn); err != nil {
+		logger.Debug("Forwarding ended with error", logging.String("tunnel_id", tunnelID), logging.Error(err))
+	}
+}
+
+// permit resolves the tunnel of a request and applies its per-request checks, writing an error
+// response when the request is refused
+func (h *ProxyHandler) permit(w http.ResponseWriter, r *http.Request, tunnelID string) (*registry.Tunnel, bool) {
+	tunnel, ok := h.lookup(w, r, tunnelID)
+	if !ok || !h.admit(w, r, tunnel) || !h.allow(w, r, tunnel) || !h.authorize(w, r, tunnel) {
+		return nil, false
+	}
+	return tunnel, true
+}
+
+// lookup returns the tunnel traffic is forwarded to, writing an error response when it is missing or expired
+func (h *ProxyHandler) lookup(w http.ResponseWriter, r *http.Request, tunnelID string) (*registry.Tunnel, bool) {
+	logger := logging.FromContext(r.Context())
+
+	tunnel, err := h.registry.Get(r.Context(), tunnelID)
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Tunnel lookup failed", logging.String("tunnel_id", tunnelID), logging.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if tunnel.Expired(time.Now()) {
+		logger.Debug("Refusing traffic to an expired tunnel", logging.String("tunnel_id", tunnelID))
+		http.Error(w, "Tunnel expired", http.StatusGone)
+		return nil, false
+	}
+	return tunnel, true
+}
+
+// CloseTunnel closes every open connection forwarded to the tunnel and returns how many were closed
+func (h *ProxyHandler) CloseTunnel(tunnelID string) int {
+	h.mu.Lock()
+	conns := h.active[tunnelID]
+	delete(h.active, tunnelID)
+	sender := h.senders[tunnelID]
+	delete(h.senders, tunnelID)
+	delete(h.limiters, tunnelID)
+	h.mu.Unlock()
+
+	for conn := range conns {
+		_ = conn.Close()
+	}
+	if sender != nil {
+		_ = sender.Close()
+	}
+	return len(conns)
+}
+
+// PoolStats returns the connection pool activity of every tunnel with a pooled sender
+func (h *ProxyHandler) PoolStats() map[string]gatewayrelay.PoolStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := make(map[string]gatewayrelay.PoolStats)
+	for tunnelID, sender := range h.senders {
+		if poolStats, ok := sender.PoolStats(); ok {
+			stats[tunnelID] = poolStats
+		}
+	}
+	return stats
+}
+
+// sender returns the relay sender for a connection to the tunnel and a function releasing it.
+// Multiplexed and pooled tunnels share one sender until the tunnel is closed, so they keep their
+// relay connections across requests; other tunnels get a sender per connection.
+func (h *ProxyHandler) sender(tunnel *registry.Tunnel) (*gatewayrelay.Sender, func()) {
+	if sender := h.shared(tunnel); sender != nil {
+		return sender, func() {}
+	}
+	sender := h.newSender(tunnel.HybridConnectionName)
+	return sender, func() { _ = sender.Close() }
+}
+
+// Warm creates the shared sender of a multiplexed or pooled tunnel, so the pool starts dialing
+// relay connections as soon as the tunnel is registered or resumed instead of on its first request
+func (h *ProxyHandler) Warm(tunnel *registry.Tunnel) {
+	h.shared(tunnel)
+}
+
+// shared returns the sender shared by the connections to a multiplexed or pooled tunnel, creating it
+// when needed, or nil when the tunnel does not share one
+func (h *ProxyHandler) shared(tunnel *registry.Tunnel) *gatewayrelay.Sender {
+	if !tunnel.Multiplex && h.poolSize <= 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sender, ok := h.senders[tunnel.ID]
+	if !ok {
+		sender = h.newSender(tunnel.HybridConnectionName)
+		if tunnel.Multiplex {
+			sender = sender.Multiplexed()
+		} else {
+			sender = sender.Pooled(h.poolSize)
+		}
+		h.senders[tunnel.ID] = sender
+	}
+	return sender
+}
+
+// track records an open connection for the tunnel and returns a function that forgets it
+func (h *ProxyHandler) track(tunnelID string, conn net.Conn) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.active[tunnelID] == nil {
+		h.active[tunnelID] = make(map[net.Conn]struct{})
+	}
+	h.active[tunnelID][conn] = struct{}{}
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.active[tunnelID], conn)
+		if len(h.active[tunnelID]) == 0 {
+			delete(h.active, tunnelID)
+		}
+	}
+}
+
+// writeRawError writes a minimal HTTP error response on a hijacked connection
+func writeRawError(conn net.Conn, status int) {
+	body := http.StatusText(status)
+	_, _ = fmt.Fprintf(conn,
+		"HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, http.StatusText(status), len(body), body)
+}
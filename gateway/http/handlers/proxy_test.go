@@ -0,0 +1,725 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/basicauth"
+	"github.com/julienstroheker/AzHexGate/gateway/forwarded"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
+	"github.com/julienstroheker/AzHexGate/internal/mux"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// failingSender is a relay.Sender whose Dial always fails
+type failingSender struct {
+	err error
+}
+
+func (s *failingSender) Dial(ctx context.Context) (relay.Connection, error) { return nil, s.err }
+func (s *failingSender) Close() error                                       { return nil }
+
+// newTestRegistry returns a registry with a tunnel registered for each ID
+func newTestRegistry(t *testing.T, tunnelIDs ...string) registry.TunnelRegistry {
+	t.Helper()
+
+	reg := registry.NewMemoryRegistry()
+	for _, id := range tunnelIDs {
+		err := reg.Create(context.Background(), &registry.Tunnel{ID: id, HybridConnectionName: "hc-" + id})
+		if err != nil {
+			t.Fatalf("Failed to register tunnel %s: %v", id, err)
+		}
+	}
+	return reg
+}
+
+// serveRelay accepts relay connections and forwards them raw to the local server
+func serveRelay(ctx context.Context, listener relay.Listener, localAddr string) {
+	for {
+		relayConn, err := listener.Accept(ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = relayConn.Close() }()
+			localConn, err := net.Dial("tcp", localAddr)
+			if err != nil {
+				return
+			}
+			defer func() { _ = localConn.Close() }()
+
+			done := make(chan struct{}, 2)
+			go func() { _, _ = io.Copy(localConn, relayConn); done <- struct{}{} }()
+			go func() { _, _ = io.Copy(relayConn, localConn); done <- struct{}{} }()
+			<-done
+		}()
+	}
+}
+
+// newProxyServer starts a public server that routes every request to tunnelID through proxy
+func newProxyServer(t *testing.T, proxy *ProxyHandler, tunnelID string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, r.WithContext(WithTunnelID(r.Context(), tunnelID)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newRelayedProxy wires a proxy to a local server through an in-memory relay
+func newRelayedProxy(t *testing.T, handler http.HandlerFunc) (*ProxyHandler, *[]string) {
+	t.Helper()
+
+	localServer := httptest.NewServer(handler)
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go serveRelay(ctx, memoryListener, strings.TrimPrefix(localServer.URL, "http://"))
+
+	var dialed []string
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: newTestRegistry(t, "63873749"),
+		NewSender: func(hybridConnectionName string) *gatewayrelay.Sender {
+			dialed = append(dialed, hybridConnectionName)
+			return gatewayrelay.NewSender(&gatewayrelay.Options{
+				Relay: relay.NewMemorySender(memoryListener),
+			})
+		},
+	})
+	return proxy, &dialed
+}
+
+func TestProxyHandler_ForwardsGET(t *testing.T) {
+	proxy, dialed := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Host", r.Host)
+		_, _ = w.Write([]byte("hello from " + r.URL.RequestURI()))
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/foo?bar=1", nil)
+	req.Host = "63873749.azhexgate.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if string(body) != "hello from /foo?bar=1" {
+		t.Errorf("Expected body %q, got %q", "hello from /foo?bar=1", string(body))
+	}
+	if resp.Header.Get("X-Seen-Host") != "63873749.azhexgate.com" {
+		t.Errorf("Expected original Host to reach the local app, got %q", resp.Header.Get("X-Seen-Host"))
+	}
+	if len(*dialed) != 1 || (*dialed)[0] != "hc-63873749" {
+		t.Errorf("Expected relay sender for hc-63873749, got %v", *dialed)
+	}
+}
+
+func TestProxyHandler_ForwardsPOSTBody(t *testing.T) {
+	proxy, _ := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + ":" + string(body)))
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{name: "content length", body: strings.NewReader("payload")},
+		// A reader without a known length is sent chunked
+		{name: "chunked", body: io.MultiReader(strings.NewReader("pay"), strings.NewReader("load"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/echo", "text/plain", tt.body)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "POST:payload" {
+				t.Errorf("Expected %q, got %q", "POST:payload", string(body))
+			}
+		})
+	}
+}
+
+func TestProxyHandler_ForwardingHeaders(t *testing.T) {
+	proxy, _ := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"} {
+			w.Header().Set("Seen-"+name, r.Header.Get(name))
+		}
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	// The test client is not a trusted proxy, so its forwarding headers are replaced
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	req.Host = "63873749.azhexgate.com"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Host", "evil.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	want := map[string]string{
+		"Seen-X-Forwarded-For":   "127.0.0.1",
+		"Seen-X-Forwarded-Proto": "http",
+		"Seen-X-Forwarded-Host":  "63873749.azhexgate.com",
+		"Seen-Forwarded":         "for=127.0.0.1;host=63873749.azhexgate.com;proto=http",
+	}
+	for name, value := range want {
+		if got := resp.Header.Get(name); got != value {
+			t.Errorf("Expected local app to see %s %q, got %q", strings.TrimPrefix(name, "Seen-"), value, got)
+		}
+	}
+}
+
+// sendOnConnection sends every request on a single connection to the server, reading each response
+// before the next request. The responses are returned with their bodies read.
+func sendOnConnection(t *testing.T, server *httptest.Server, requests ...*http.Request) []*http.Response {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	var responses []*http.Response
+	for i, req := range requests {
+		if err := req.Write(conn); err != nil {
+			t.Fatalf("Failed to write request %d: %v", i+1, err)
+		}
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Fatalf("Failed to read response %d: %v", i+1, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		responses = append(responses, resp)
+		if resp.Close {
+			break
+		}
+	}
+	return responses
+}
+
+func TestProxyHandler_ForwardingHeadersOnKeepAlive(t *testing.T) {
+	proxy, _ := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Seen-X-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	var requests []*http.Request
+	for _, path := range []string{"/first", "/second", "/third"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Host = "63873749.azhexgate.com"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		requests = append(requests, req)
+	}
+
+	// Every request on the connection has its forwarding headers replaced, not only the first one
+	responses := sendOnConnection(t, server, requests...)
+	if len(responses) != len(requests) {
+		t.Fatalf("Expected %d responses on one connection, got %d", len(requests), len(responses))
+	}
+	for i, resp := range responses {
+		if got := resp.Header.Get("Seen-X-Forwarded-For"); got != "127.0.0.1" {
+			t.Errorf("Expected request %d to reach the local app with X-Forwarded-For %q, got %q",
+				i+1, "127.0.0.1", got)
+		}
+	}
+}
+
+func TestProxyHandler_RelayErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "listener offline", err: relay.ErrListenerOffline, status: http.StatusServiceUnavailable},
+		{name: "unauthorized", err: relay.ErrUnauthorized, status: http.StatusBadGateway},
+		{name: "other dial error", err: errors.New("boom"), status: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewProxyHandler(&ProxyOptions{
+				Registry: newTestRegistry(t, "63873749"),
+				NewSender: func(string) *gatewayrelay.Sender {
+					return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: &failingSender{err: tt.err}})
+				},
+			})
+			server := newProxyServer(t, proxy, "63873749")
+
+			resp, err := http.Get(server.URL + "/")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_TunnelNotFound(t *testing.T) {
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: newTestRegistry(t, "63873749"),
+		NewSender: func(string) *gatewayrelay.Sender {
+			t.Error("Sender should not be created for an unknown tunnel")
+			return nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithTunnelID(req.Context(), "unknown"))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestProxyHandler_TunnelExpired(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{ID: "63873749", ExpiresAt: time.Now().Add(-time.Second)})
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: reg,
+		NewSender: func(string) *gatewayrelay.Sender {
+			t.Error("Sender should not be created for an expired tunnel")
+			return nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithTunnelID(req.Context(), "63873749"))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestProxyHandler_ClosesConnectionsAtExpiry(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stream until the connection is gone
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go serveRelay(ctx, memoryListener, strings.TrimPrefix(localServer.URL, "http://"))
+
+	reg := registry.NewMemoryRegistry()
+	expiresAt := time.Now().Add(300 * time.Millisecond)
+	_ = reg.Create(context.Background(), &registry.Tunnel{ID: "63873749", ExpiresAt: expiresAt})
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: reg,
+		NewSender: func(string) *gatewayrelay.Sender {
+			return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+		},
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if time.Now().Before(expiresAt) {
+			t.Error("Expected the connection to stay open until the tunnel expires")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the connection to be closed when the tunnel expired")
+	}
+}
+
+func TestProxyHandler_RateLimit(t *testing.T) {
+	tests := []struct {
+		name             string
+		perIP            bool
+		wantOtherLimited bool
+	}{
+		{name: "whole tunnel", perIP: false, wantOtherLimited: true},
+		{name: "per client IP", perIP: true, wantOtherLimited: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registry.NewMemoryRegistry()
+			_ = reg.Create(context.Background(), &registry.Tunnel{
+				ID: "63873749", RateLimit: 0.5, RateBurst: 1, RateLimitPerIP: tt.perIP,
+			})
+			proxy := NewProxyHandler(&ProxyOptions{
+				Registry: reg,
+				NewSender: func(string) *gatewayrelay.Sender {
+					return gatewayrelay.NewSender(&gatewayrelay.Options{
+						Relay: &failingSender{err: relay.ErrListenerOffline},
+					})
+				},
+			})
+
+			serve := func(remoteAddr string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = remoteAddr
+				req = req.WithContext(WithTunnelID(req.Context(), "63873749"))
+				w := httptest.NewRecorder()
+				proxy.ServeHTTP(w, req)
+				return w
+			}
+
+			// The recorder cannot be hijacked, so a request let through fails further on
+			if w := serve("198.51.100.1:1234"); w.Code == http.StatusTooManyRequests {
+				t.Fatal("Expected the first request to pass the rate limit")
+			}
+
+			w := serve("198.51.100.1:1235")
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != "2" {
+				t.Errorf("Expected Retry-After 2 at 0.5 requests per second, got %q", got)
+			}
+
+			limited := serve("203.0.113.7:1234").Code == http.StatusTooManyRequests
+			if limited != tt.wantOtherLimited {
+				t.Errorf("Expected another client IP to be limited: %v, got %v", tt.wantOtherLimited, limited)
+			}
+
+			// Closing the tunnel forgets its limiter
+			proxy.CloseTunnel("63873749")
+			if w := serve("198.51.100.1:1236"); w.Code == http.StatusTooManyRequests {
+				t.Error("Expected a fresh rate limit after the tunnel was closed")
+			}
+		})
+	}
+}
+
+func TestProxyHandler_RateLimitOnKeepAlive(t *testing.T) {
+	proxy, _ := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {})
+	err := proxy.registry.Create(context.Background(), &registry.Tunnel{
+		ID: "24681357", HybridConnectionName: "hc-24681357", RateLimit: 1, RateBurst: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register tunnel: %v", err)
+	}
+	server := newProxyServer(t, proxy, "24681357")
+
+	var requests []*http.Request
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		requests = append(requests, req)
+	}
+
+	// The second request on the connection is over the limit, and the gateway closes the connection after it
+	responses := sendOnConnection(t, server, requests...)
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses before the connection was closed, got %d", len(responses))
+	}
+	if responses[0].StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d for the first request, got %d", http.StatusOK, responses[0].StatusCode)
+	}
+	if responses[1].StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for the second request, got %d", http.StatusTooManyRequests, responses[1].StatusCode)
+	}
+	if got := responses[1].Header.Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+}
+
+func TestProxyHandler_BasicAuth(t *testing.T) {
+	proxy, _ := newRelayedProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Seen-Authorization", r.Header.Get("Authorization"))
+	})
+	hash, err := basicauth.Hash("alice", "s3cret")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	err = proxy.registry.Create(context.Background(), &registry.Tunnel{
+		ID: "24681357", HybridConnectionName: "hc-24681357", BasicAuthHash: hash,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register tunnel: %v", err)
+	}
+	protected := newProxyServer(t, proxy, "24681357")
+	open := newProxyServer(t, proxy, "63873749")
+
+	send := func(server *httptest.Server, username, password string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	for _, credentials := range [][2]string{{"", ""}, {"alice", "wrong"}, {"bob", "s3cret"}} {
+		resp := send(protected, credentials[0], credentials[1])
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusUnauthorized, credentials, resp.StatusCode)
+		}
+		want := `Basic realm="azhexgate tunnel 24681357", charset="UTF-8"`
+		if got := resp.Header.Get("WWW-Authenticate"); got != want {
+			t.Errorf("Expected WWW-Authenticate %q, got %q", want, got)
+		}
+	}
+
+	resp := send(protected, "alice", "s3cret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d with valid credentials, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Seen-Authorization"); got != "" {
+		t.Errorf("Expected the credentials to be stripped before the local app, got %q", got)
+	}
+
+	// Every request on a kept-alive connection is checked, not only the first one
+	authorized, _ := http.NewRequest(http.MethodGet, protected.URL+"/", nil)
+	authorized.SetBasicAuth("alice", "s3cret")
+	anonymous, _ := http.NewRequest(http.MethodGet, protected.URL+"/", nil)
+	upgrade, _ := http.NewRequest(http.MethodGet, protected.URL+"/", nil)
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	for _, second := range []*http.Request{anonymous, upgrade} {
+		responses := sendOnConnection(t, protected, authorized, second)
+		if len(responses) != 2 || responses[0].StatusCode != http.StatusOK {
+			t.Fatalf("Expected an authorized request followed by another on one connection, got %d responses",
+				len(responses))
+		}
+		if responses[1].StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status %d for a later request without credentials, got %d",
+				http.StatusUnauthorized, responses[1].StatusCode)
+		}
+		if !responses[1].Close {
+			t.Error("Expected the connection to be closed after refusing a later request")
+		}
+	}
+
+	// Open tunnels pass the Authorization header of the local app through
+	resp = send(open, "alice", "s3cret")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Seen-Authorization") == "" {
+		t.Errorf("Expected an open tunnel to forward the Authorization header, got %d %q",
+			resp.StatusCode, resp.Header.Get("Seen-Authorization"))
+	}
+}
+
+func TestProxyHandler_IPFilter(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{
+		ID: "63873749", AllowCIDRs: []string{"198.51.100.0/24"}, DenyCIDRs: []string{"198.51.100.66/32"},
+	})
+	trusted, _ := forwarded.ParseTrustedProxies("10.0.0.0/8")
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry:       reg,
+		TrustedProxies: trusted,
+		NewSender: func(string) *gatewayrelay.Sender {
+			return gatewayrelay.NewSender(&gatewayrelay.Options{
+				Relay: &failingSender{err: relay.ErrListenerOffline},
+			})
+		},
+	})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantRefused  bool
+	}{
+		{name: "allowed client", remoteAddr: "198.51.100.1:1234"},
+		{name: "client outside the allow list", remoteAddr: "203.0.113.7:1234", wantRefused: true},
+		{name: "denied client", remoteAddr: "198.51.100.66:1234", wantRefused: true},
+		{name: "untrusted peer cannot spoof", remoteAddr: "203.0.113.7:1234", forwardedFor: "198.51.100.1",
+			wantRefused: true},
+		{name: "allowed client behind a trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "198.51.100.1"},
+		{name: "denied client behind a trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "198.51.100.66",
+			wantRefused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			req = req.WithContext(WithTunnelID(req.Context(), "63873749"))
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			// The recorder cannot be hijacked, so an admitted request fails further on
+			if refused := w.Code == http.StatusForbidden; refused != tt.wantRefused {
+				t.Fatalf("Expected refused: %v, got status %d", tt.wantRefused, w.Code)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_RegistryError(t *testing.T) {
+	reg := newTestRegistry(t, "63873749")
+	_ = reg.Close()
+	proxy := NewProxyHandler(&ProxyOptions{Registry: reg})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithTunnelID(req.Context(), "63873749"))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestProxyHandler_MissingTunnelID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	NewProxyHandler(nil).ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestProxyHandler_RelayNotConfigured(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithTunnelID(req.Context(), "63873749"))
+	w := httptest.NewRecorder()
+	NewProxyHandler(&ProxyOptions{Registry: newTestRegistry(t, "63873749")}).ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestGetTunnelID_EmptyContext(t *testing.T) {
+	if id := GetTunnelID(context.Background()); id != "" {
+		t.Errorf("Expected empty tunnel ID, got %q", id)
+	}
+}
+
+// countingListener counts the relay connections it accepts
+type countingListener struct {
+	relay.Listener
+
+	accepted atomic.Int32
+}
+
+func (c *countingListener) Accept(ctx context.Context) (relay.Connection, error) {
+	conn, err := c.Listener.Accept(ctx)
+	if err == nil {
+		c.accepted.Add(1)
+	}
+	return conn, err
+}
+
+func TestProxyHandler_MultiplexedTunnelSharesRelayConnection(t *testing.T) {
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(localServer.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	counting := &countingListener{Listener: memoryListener}
+	muxListener := mux.NewListener(counting, nil)
+	t.Cleanup(func() { _ = muxListener.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go serveRelay(ctx, muxListener, strings.TrimPrefix(localServer.URL, "http://"))
+
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{
+		ID:                   "63873749",
+		HybridConnectionName: "hc-63873749",
+		Multiplex:            true,
+	})
+
+	var senders atomic.Int32
+	proxy := NewProxyHandler(&ProxyOptions{
+		Registry: reg,
+		NewSender: func(string) *gatewayrelay.Sender {
+			senders.Add(1)
+			return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+		},
+	})
+	server := newProxyServer(t, proxy, "63873749")
+
+	get := func() {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		req.Close = true
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != "hello" {
+			t.Errorf("Expected body %q, got %q", "hello", string(body))
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	if senders.Load() != 1 || counting.accepted.Load() != 1 {
+		t.Errorf("Expected 3 requests over 1 sender and 1 relay connection, got %d senders and %d connections",
+			senders.Load(), counting.accepted.Load())
+	}
+
+	// Closing the tunnel releases the shared sender
+	proxy.CloseTunnel("63873749")
+	get()
+	if senders.Load() != 2 {
+		t.Errorf("Expected a new sender after the tunnel was closed, got %d", senders.Load())
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/ratelimit"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// requestedRateLimit returns the limit asked for in a tunnel creation request
+func requestedRateLimit(request *api.CreateTunnelRequest) ratelimit.Limit {
+	if request.RateLimit == nil {
+		return ratelimit.Limit{}
+	}
+	return ratelimit.Limit{
+		RequestsPerSecond: request.RateLimit.RequestsPerSecond,
+		Burst:             request.RateLimit.Burst,
+		PerSource:         request.RateLimit.PerIP,
+	}
+}
+
+// tunnelRateLimit returns the limit stored with a tunnel
+func tunnelRateLimit(tunnel *registry.Tunnel) ratelimit.Limit {
+	return ratelimit.Limit{
+		RequestsPerSecond: tunnel.RateLimit,
+		Burst:             tunnel.RateBurst,
+		PerSource:         tunnel.RateLimitPerIP,
+	}
+}
+
+// apiRateLimit describes the limit of a tunnel in API responses, nil when it is unlimited
+func apiRateLimit(tunnel *registry.Tunnel) *api.RateLimit {
+	if tunnel.RateLimit <= 0 {
+		return nil
+	}
+	return &api.RateLimit{
+		RequestsPerSecond: tunnel.RateLimit,
+		Burst:             tunnel.RateBurst,
+		PerIP:             tunnel.RateLimitPerIP,
+	}
+}
+
+// allow applies the rate limit of the tunnel to a request, answering 429 with Retry-After when it is exceeded
+func (h *ProxyHandler) allow(w http.ResponseWriter, r *http.Request, tunnel *registry.Tunnel) bool {
+	limit := tunnelRateLimit(tunnel)
+	if limit.Unlimited() {
+		return true
+	}
+
+	source := h.trusted.ClientIP(r).String()
+	ok, wait := h.limiter(tunnel.ID, limit).Allow(source, time.Now())
+	if ok {
+		return true
+	}
+
+	logging.FromContext(r.Context()).Debug("Tunnel rate limit exceeded",
+		logging.String("tunnel_id", tunnel.ID),
+		logging.String("client_ip", source))
+
+	// Round up so clients never come back before a token is available
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	return false
+}
+
+// limiter returns the limiter of the tunnel, replacing it when the tunnel was registered again with another limit
+func (h *ProxyHandler) limiter(tunnelID string, limit ratelimit.Limit) *ratelimit.Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	limiter, ok := h.limiters[tunnelID]
+	if !ok || limiter.Limit() != limit {
+		limiter = ratelimit.NewLimiter(limit)
+		h.limiters[tunnelID] = limiter
+	}
+	return limiter
+}
@@ -1,43 +1,618 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/julienstroheker/AzHexGate/gateway/basicauth"
+	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/gateway/ipfilter"
+	"github.com/julienstroheker/AzHexGate/gateway/quota"
+	"github.com/julienstroheker/AzHexGate/gateway/ratelimit"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
 	"github.com/julienstroheker/AzHexGate/internal/api"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
 )
 
-// TunnelsHandler handles POST requests to create new tunnels
-// This is a mock implementation that returns static data
-func TunnelsHandler(w http.ResponseWriter, r *http.Request) {
-	// Retrieve logger from context to establish the pattern for future handlers
-	// Will be used for actual logging when real tunnel creation logic is implemented
-	_ = logging.FromContext(r.Context())
+// DefaultRelayEndpoint is the relay namespace used when none is configured
+const DefaultRelayEndpoint = "https://azhexgate-relay.servicebus.windows.net"
 
-	// Only accept POST requests
-	if r.Method != http.MethodPost {
+const (
+	// defaultListenerTokenTTL is how long minted listener tokens stay valid
+	defaultListenerTokenTTL = time.Hour
+
+	// defaultBaseDomain is the domain public URLs are created under when none is configured
+	defaultBaseDomain = "azhexgate.com"
+
+	// subdomainDigits is the length of the random part of generated subdomains
+	subdomainDigits = 8
+
+	// maxNameLength bounds the name hint so subdomains stay well within the 63 character label limit
+	maxNameLength = 32
+
+	// maxCreateAttempts is how many random subdomains are tried before giving up
+	maxCreateAttempts = 10
+
+	// maxCreateRequestSize bounds the tunnel creation request body
+	maxCreateRequestSize = 4096
+
+	// defaultHeartbeatInterval is how often clients are asked to send heartbeats when none is configured
+	defaultHeartbeatInterval = 30 * time.Second
+)
+
+var (
+	// errSessionMismatch is returned when resuming a tunnel owned by another session
+	errSessionMismatch = errors.New("tunnel belongs to another session")
+
+	// errTunnelExpired is returned when resuming a tunnel that outlived its TTL
+	errTunnelExpired = errors.New("tunnel has expired")
+)
+
+// nameHintPattern matches a valid subdomain prefix: lowercase letters, digits and inner hyphens
+var nameHintPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// TunnelsOptions contains configuration for the TunnelsHandler
+type TunnelsOptions struct {
+	// RelayEndpoint is the relay namespace endpoint returned to clients (optional)
+	RelayEndpoint string
+
+	// ListenerKey is the shared access key used to sign listener tokens
+	ListenerKey sas.Key
+
+	// ListenerTokenTTL is how long listener tokens stay valid (optional, defaults to 1h)
+	ListenerTokenTTL time.Duration
+
+	// Registry stores created tunnels (optional, defaults to an in-memory registry)
+	Registry registry.TunnelRegistry
+
+	// BaseDomain is the domain public URLs are created under (optional, defaults to azhexgate.com)
+	BaseDomain string
+
+	// OnCreate is called after a tunnel is created or resumed, e.g. to dial its relay connections (optional)
+	OnCreate func(tunnel *registry.Tunnel)
+
+	// OnDelete is called after a tunnel is revoked, e.g. to close its open connections (optional)
+	OnDelete func(tunnelID string)
+
+	// HeartbeatInterval is how often clients are asked to send heartbeats (optional, defaults to 30s)
+	HeartbeatInterval time.Duration
+
+	// MaxTTL caps the lifetime of tunnels (optional). Tunnels that do not request a TTL get MaxTTL;
+	// when zero, tunnels only expire if they request a TTL.
+	MaxTTL time.Duration
+
+	// Quotas limits the tunnels each API key, or token subject, creates (optional, unlimited when nil)
+	Quotas *quota.Enforcer
+
+	// RateLimits holds the defaults and ceilings of the inbound rate limits requested for tunnels
+	// (optional, tunnels are unlimited unless they request a limit)
+	RateLimits ratelimit.Policy
+}
+
+// TunnelsHandler serves the tunnel management API: create, list, inspect and revoke
+type TunnelsHandler struct {
+	relayEndpoint     string
+	listenerKey       sas.Key
+	listenerTokenTTL  time.Duration
+	registry          registry.TunnelRegistry
+	baseDomain        string
+	onCreate          func(tunnel *registry.Tunnel)
+	onDelete          func(tunnelID string)
+	heartbeatInterval time.Duration
+	maxTTL            time.Duration
+	quotas            *quota.Enforcer
+	rateLimits        ratelimit.Policy
+
+	// createMu makes counting the tunnels of a caller and registering a new one a single step
+	createMu sync.Mutex
+}
+
+// NewTunnelsHandler creates a new tunnels handler
+func NewTunnelsHandler(opts *TunnelsOptions) *TunnelsHandler {
+	if opts == nil {
+		opts = &TunnelsOptions{}
+	}
+
+	relayEndpoint := opts.RelayEndpoint
+	if relayEndpoint == "" {
+		relayEndpoint = DefaultRelayEndpoint
+	}
+
+	listenerTokenTTL := opts.ListenerTokenTTL
+	if listenerTokenTTL == 0 {
+		listenerTokenTTL = defaultListenerTokenTTL
+	}
+
+	reg := opts.Registry
+	if reg == nil {
+		reg = registry.NewMemoryRegistry()
+	}
+
+	baseDomain := strings.ToLower(strings.Trim(opts.BaseDomain, "."))
+	if baseDomain == "" {
+		baseDomain = defaultBaseDomain
+	}
+
+	heartbeatInterval := opts.HeartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = defaultHeartbeatInterval
+	}
+
+	return &TunnelsHandler{
+		relayEndpoint:     relayEndpoint,
+		listenerKey:       opts.ListenerKey,
+		listenerTokenTTL:  listenerTokenTTL,
+		registry:          reg,
+		baseDomain:        baseDomain,
+		onCreate:          opts.OnCreate,
+		onDelete:          opts.OnDelete,
+		heartbeatInterval: heartbeatInterval,
+		maxTTL:            opts.MaxTTL,
+		quotas:            opts.Quotas,
+		rateLimits:        opts.RateLimits,
+	}
+}
+
+// ServeHTTP dispatches tunnel management requests.
+// The collection supports POST (create) and GET (list); /api/tunnels/{id} supports GET and DELETE.
+func (h *TunnelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tunnelID := r.PathValue("id")
+
+	switch {
+	case tunnelID == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case tunnelID == "" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case tunnelID != "" && r.Method == http.MethodGet:
+		h.get(w, r, tunnelID)
+	case tunnelID != "" && r.Method == http.MethodDelete:
+		h.delete(w, r, tunnelID)
+	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// create registers a tunnel and returns a listener token scoped to its hybrid connection
+func (h *TunnelsHandler) create(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	request, err := decodeCreateTunnelRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tunnel, resumed, err := h.resume(r, request)
+	if errors.Is(err, errSessionMismatch) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errTunnelExpired) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err == nil && tunnel == nil {
+		var allowed bool
+		tunnel, allowed, err = h.createWithinQuota(w, r, request)
+		if !allowed {
+			return
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to register tunnel", logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	listenerToken, err := h.listenerToken(tunnel.HybridConnectionName)
+	if err != nil {
+		logger.Error("SAS generation failed", logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if h.onCreate != nil {
+		h.onCreate(tunnel)
+	}
+
+	writeJSON(w, http.StatusOK, api.TunnelResponse{
+		TunnelID:             tunnel.ID,
+		PublicURL:            h.publicURL(tunnel.ID),
+		RelayEndpoint:        h.relayEndpoint,
+		HybridConnectionName: tunnel.HybridConnectionName,
+		ListenerToken:        listenerToken,
+		SessionID:            tunnel.SessionID,
+		Multiplex:            tunnel.Multiplex,
+		HeartbeatInterval:    int(h.heartbeatInterval / time.Second),
+		ExpiresAt:            tunnel.ExpiresAt,
+		RateLimit:            apiRateLimit(tunnel),
+		BasicAuth:            tunnel.BasicAuthHash != "",
+		AllowCIDRs:           tunnel.AllowCIDRs,
+		DenyCIDRs:            tunnel.DenyCIDRs,
+	})
+
+	logger.Info("Tunnel created",
+		logging.String("tunnel_id", tunnel.ID),
+		logging.Bool("resumed", resumed),
+		logging.String("owner", tunnel.Owner),
+		logging.String("session_id", tunnel.SessionID),
+		logging.Int("local_port", tunnel.LocalPort),
+		logging.Bool("multiplex", tunnel.Multiplex),
+		logging.Bool("basic_auth", tunnel.BasicAuthHash != ""),
+		logging.String("expires_at", formatExpiry(tunnel.ExpiresAt)))
+}
+
+// list returns the registered tunnels of the caller
+func (h *TunnelsHandler) list(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := h.registry.List(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list tunnels", logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	owner := middleware.GetOwner(r.Context())
+	response := api.TunnelListResponse{Tunnels: make([]api.TunnelInfo, 0, len(tunnels))}
+	for _, tunnel := range tunnels {
+		if tunnel.Owner == owner {
+			response.Tunnels = append(response.Tunnels, h.tunnelInfo(tunnel))
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// get returns a single tunnel of the caller
+func (h *TunnelsHandler) get(w http.ResponseWriter, r *http.Request, tunnelID string) {
+	tunnel, err := h.owned(r, tunnelID)
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to get tunnel",
+			logging.String("tunnel_id", tunnelID), logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.tunnelInfo(tunnel))
+}
+
+// delete revokes a tunnel of the caller: it is removed from the registry and its open connections are closed
+func (h *TunnelsHandler) delete(w http.ResponseWriter, r *http.Request, tunnelID string) {
+	logger := logging.FromContext(r.Context())
+
+	_, err := h.owned(r, tunnelID)
+	if err == nil {
+		err = h.registry.Delete(r.Context(), tunnelID)
+	}
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete tunnel", logging.String("tunnel_id", tunnelID), logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Return mock tunnel data
-	response := api.TunnelResponse{
-		PublicURL:            "https://63873749.azhexgate.com",
-		RelayEndpoint:        "https://azhexgate-relay.servicebus.windows.net",
-		HybridConnectionName: "hc-63873749",
-		ListenerToken:        "mock-listener-token",
-		SessionID:            "mock-session-id",
+	if h.onDelete != nil {
+		h.onDelete(tunnelID)
 	}
 
-	// Marshal response to check for errors before writing status
-	data, err := json.Marshal(response)
+	w.WriteHeader(http.StatusNoContent)
+	logger.Info("Tunnel revoked", logging.String("tunnel_id", tunnelID))
+}
+
+// owned returns a tunnel of the caller. Tunnels of other owners are reported as not found,
+// so their IDs cannot be probed.
+func (h *TunnelsHandler) owned(r *http.Request, tunnelID string) (*registry.Tunnel, error) {
+	tunnel, err := h.registry.Get(r.Context(), tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	if tunnel.Owner != middleware.GetOwner(r.Context()) {
+		return nil, registry.ErrNotFound
+	}
+	return tunnel, nil
+}
+
+// publicURL returns the public URL of a tunnel
+func (h *TunnelsHandler) publicURL(tunnelID string) string {
+	return "https://" + tunnelID + "." + h.baseDomain
+}
+
+// tunnelInfo converts a registry tunnel to its API representation
+func (h *TunnelsHandler) tunnelInfo(tunnel *registry.Tunnel) api.TunnelInfo {
+	return api.TunnelInfo{
+		TunnelID:             tunnel.ID,
+		PublicURL:            h.publicURL(tunnel.ID),
+		HybridConnectionName: tunnel.HybridConnectionName,
+		Owner:                tunnel.Owner,
+		LocalPort:            tunnel.LocalPort,
+		CreatedAt:            tunnel.CreatedAt,
+		LastHeartbeat:        tunnel.LastHeartbeat,
+		Active:               !tunnel.Inactive,
+		ExpiresAt:            tunnel.ExpiresAt,
+		Multiplex:            tunnel.Multiplex,
+		RateLimit:            apiRateLimit(tunnel),
+		BasicAuth:            tunnel.BasicAuthHash != "",
+		AllowCIDRs:           tunnel.AllowCIDRs,
+		DenyCIDRs:            tunnel.DenyCIDRs,
+	}
+}
+
+// writeJSON writes v as a JSON response, marshaling first so errors can still change the status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	_, _ = w.Write(data)
 }
+
+// decodeCreateTunnelRequest reads and validates the tunnel creation request.
+// An empty body is accepted and requests a tunnel without a name hint.
+func decodeCreateTunnelRequest(r *http.Request) (*api.CreateTunnelRequest, error) {
+	var request api.CreateTunnelRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxCreateRequestSize)).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	if request.LocalPort < 0 || request.LocalPort > 65535 {
+		return nil, fmt.Errorf("invalid local_port %d", request.LocalPort)
+	}
+
+	if request.TTL < 0 {
+		return nil, fmt.Errorf("invalid ttl %d", request.TTL)
+	}
+
+	if limit := request.RateLimit; limit != nil && (limit.RequestsPerSecond < 0 || limit.Burst < 0) {
+		return nil, fmt.Errorf("invalid rate_limit: requests_per_second and burst must not be negative")
+	}
+
+	if auth := request.BasicAuth; auth != nil {
+		if err := basicauth.Validate(auth.Username, auth.Password); err != nil {
+			return nil, fmt.Errorf("invalid basic_auth: %w", err)
+		}
+	}
+
+	if _, err := ipfilter.New(request.AllowCIDRs, request.DenyCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid allow_cidrs or deny_cidrs: %w", err)
+	}
+
+	request.Name = strings.ToLower(strings.TrimSpace(request.Name))
+	if request.Name != "" && (len(request.Name) > maxNameLength || !nameHintPattern.MatchString(request.Name)) {
+		return nil, fmt.Errorf("invalid name %q: use up to %d lowercase letters, digits or hyphens",
+			request.Name, maxNameLength)
+	}
+
+	return &request, nil
+}
+
+// resume returns the tunnel named by the request when its session can be resumed.
+// It returns a nil tunnel when the request does not resume a session or the tunnel is gone.
+func (h *TunnelsHandler) resume(r *http.Request, request *api.CreateTunnelRequest) (*registry.Tunnel, bool, error) {
+	if request.TunnelID == "" {
+		return nil, false, nil
+	}
+
+	tunnel, err := h.registry.Get(r.Context(), request.TunnelID)
+	if errors.Is(err, registry.ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ownsSession(r, tunnel, request.SessionID) {
+		return nil, false, errSessionMismatch
+	}
+	// Resuming never extends the lifetime of a tunnel
+	if tunnel.Expired(time.Now()) {
+		return nil, false, errTunnelExpired
+	}
+
+	if err := h.registry.Touch(r.Context(), tunnel.ID, time.Now().UTC()); err != nil {
+		return nil, false, err
+	}
+	return tunnel, true, nil
+}
+
+// ownsSession reports whether the caller holds the session of the tunnel
+func ownsSession(r *http.Request, tunnel *registry.Tunnel, sessionID string) bool {
+	owner := middleware.GetOwner(r.Context())
+	return subtle.ConstantTimeCompare([]byte(tunnel.SessionID), []byte(sessionID)) == 1 && tunnel.Owner == owner
+}
+
+// register records a new tunnel under a random subdomain, retrying on collisions
+func (h *TunnelsHandler) register(r *http.Request, request *api.CreateTunnelRequest) (*registry.Tunnel, error) {
+	authHash, err := basicAuthHash(request)
+	if err != nil {
+		return nil, err
+	}
+	allowCIDRs, denyCIDRs, err := requestedCIDRs(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxCreateAttempts; attempt++ {
+		id, err := newSubdomain(request.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		limit := h.rateLimits.Resolve(requestedRateLimit(request))
+		tunnel := &registry.Tunnel{
+			ID:                   id,
+			HybridConnectionName: "hc-" + id,
+			SessionID:            uuid.New().String(),
+			Owner:                middleware.GetOwner(r.Context()),
+			LocalPort:            request.LocalPort,
+			CreatedAt:            now,
+			LastHeartbeat:        now,
+			ExpiresAt:            h.expiresAt(now, request.TTL, middleware.GetOwner(r.Context())),
+			Multiplex:            request.Multiplex,
+			RateLimit:            limit.RequestsPerSecond,
+			RateBurst:            limit.Burst,
+			RateLimitPerIP:       limit.PerSource,
+			BasicAuthHash:        authHash,
+			AllowCIDRs:           allowCIDRs,
+			DenyCIDRs:            denyCIDRs,
+		}
+
+		err = h.registry.Create(r.Context(), tunnel)
+		if errors.Is(err, registry.ErrAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return tunnel, nil
+	}
+	return nil, fmt.Errorf("no free subdomain after %d attempts", maxCreateAttempts)
+}
+
+// createWithinQuota registers a new tunnel unless a quota of the caller is exhausted, in which case it
+// writes the quota error response and returns false. The quotas are checked and the tunnel registered
+// under one lock so concurrent creations cannot exceed MaxTunnels, and only registered tunnels count
+// against the creation rate.
+func (h *TunnelsHandler) createWithinQuota(w http.ResponseWriter, r *http.Request,
+	request *api.CreateTunnelRequest) (*registry.Tunnel, bool, error) {
+	if h.quotas == nil {
+		tunnel, err := h.register(r, request)
+		return tunnel, true, err
+	}
+
+	h.createMu.Lock()
+	defer h.createMu.Unlock()
+
+	if !h.allowCreate(w, r) {
+		return nil, false, nil
+	}
+	tunnel, err := h.register(r, request)
+	if err == nil {
+		h.quotas.Record(middleware.GetOwner(r.Context()), time.Now())
+	}
+	return tunnel, true, err
+}
+
+// allowCreate checks the quotas of the calling API key or token subject before a tunnel is registered,
+// writing a quota error response and returning false when one is exhausted
+func (h *TunnelsHandler) allowCreate(w http.ResponseWriter, r *http.Request) bool {
+	logger := logging.FromContext(r.Context())
+	owner := middleware.GetOwner(r.Context())
+
+	tunnels, err := h.registry.List(r.Context())
+	if err != nil {
+		logger.Error("Failed to count tunnels for quota", logging.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	active := 0
+	for _, tunnel := range tunnels {
+		if tunnel.Owner == owner {
+			active++
+		}
+	}
+
+	err = h.quotas.Allow(owner, active, time.Now())
+	var quotaErr *quota.Error
+	if !errors.As(err, &quotaErr) {
+		return true
+	}
+
+	logger.Warn("Tunnel quota exceeded",
+		logging.String("owner", owner),
+		logging.String("quota", quotaErr.Quota),
+		logging.Int("limit", quotaErr.Limit),
+		logging.Int("current", quotaErr.Current))
+
+	status := http.StatusForbidden
+	retryAfter := 0
+	if quotaErr.RetryAfter > 0 {
+		status = http.StatusTooManyRequests
+		// Round up so clients never retry before the quota allows it
+		retryAfter = int((quotaErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	writeJSON(w, status, api.QuotaErrorResponse{
+		Error:      quotaErr.Error(),
+		Quota:      quotaErr.Quota,
+		Limit:      quotaErr.Limit,
+		Current:    quotaErr.Current,
+		RetryAfter: retryAfter,
+	})
+	return false
+}
+
+// expiresAt returns when a tunnel created at now by owner with the requested TTL in seconds expires,
+// capped by the maximum TTL of the gateway and of the owner, or zero when it does not expire
+func (h *TunnelsHandler) expiresAt(now time.Time, ttlSeconds int, owner string) time.Time {
+	maxTTL := h.maxTTL
+	if h.quotas != nil {
+		if keyMax := h.quotas.Limits(owner).MaxTTL; keyMax > 0 && (maxTTL == 0 || keyMax < maxTTL) {
+			maxTTL = keyMax
+		}
+	}
+
+	ttl := time.Duration(ttlSeconds) * time.Second
+	if maxTTL > 0 && (ttl == 0 || ttl > maxTTL) {
+		ttl = maxTTL
+	}
+	if ttl == 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// formatExpiry formats an expiry time for logs, "never" when the tunnel does not expire
+func formatExpiry(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return "never"
+	}
+	return expiresAt.Format(time.RFC3339)
+}
+
+// newSubdomain generates a random numeric subdomain, prefixed with the name hint when set
+func newSubdomain(name string) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(subdomainDigits), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate subdomain: %w", err)
+	}
+
+	id := fmt.Sprintf("%0*d", subdomainDigits, n)
+	if name != "" {
+		id = name + "-" + id
+	}
+	return id, nil
+}
+
+// listenerToken mints a short-lived SAS token scoped to a single hybrid connection
+func (h *TunnelsHandler) listenerToken(hybridConnectionName string) (string, error) {
+	resourceURI, err := sas.ResourceURI(h.relayEndpoint, hybridConnectionName)
+	if err != nil {
+		return "", err
+	}
+	return sas.Generate(resourceURI, h.listenerKey, time.Now().Add(h.listenerTokenTTL))
+}
@@ -1,19 +1,47 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/gateway/basicauth"
+	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/gateway/quota"
+	"github.com/julienstroheker/AzHexGate/gateway/ratelimit"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
 	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
 )
 
+var testListenerKey = sas.Key{Name: "ListenPolicy", Value: "test-relay-key"}
+
+// tunnelIDPattern matches the hybrid connection of a tunnel without a name hint
+var tunnelIDPattern = regexp.MustCompile(`^hc-[0-9]{8}$`)
+
+// newTestTunnelsHandler creates a tunnels handler signing tokens with testListenerKey
+func newTestTunnelsHandler() *TunnelsHandler {
+	return NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+	})
+}
+
 func TestTunnelsHandlerPost(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", nil)
 	w := httptest.NewRecorder()
 
-	TunnelsHandler(w, req)
+	newTestTunnelsHandler().ServeHTTP(w, req)
 
 	resp := w.Result()
 	defer func() {
@@ -57,21 +85,124 @@ func TestTunnelsHandlerPost(t *testing.T) {
 	}
 }
 
-func TestTunnelsHandlerGet(t *testing.T) {
+func TestTunnelsHandlerList(t *testing.T) {
+	handler := newTestTunnelsHandler()
+	_, first := createTunnel(t, handler, `{"local_port": 3000}`)
+	_, second := createTunnel(t, handler, `{"local_port": 4000}`)
+
 	req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
 	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
 
-	TunnelsHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
 
-	resp := w.Result()
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			t.Logf("Error closing response body: %v", err)
+	var response api.TunnelListResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if len(response.Tunnels) != 2 {
+		t.Fatalf("Expected 2 tunnels, got %d", len(response.Tunnels))
+	}
+
+	seen := map[string]api.TunnelInfo{}
+	for _, info := range response.Tunnels {
+		seen[info.TunnelID] = info
+	}
+	for _, created := range []api.TunnelResponse{first, second} {
+		info, ok := seen[created.TunnelID]
+		if !ok {
+			t.Errorf("Expected tunnel %s to be listed", created.TunnelID)
+			continue
 		}
-	}()
+		if info.PublicURL != created.PublicURL || info.HybridConnectionName != created.HybridConnectionName {
+			t.Errorf("Expected listed tunnel to match created tunnel, got %+v", info)
+		}
+	}
+}
 
-	if resp.StatusCode != http.StatusMethodNotAllowed {
-		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+func TestTunnelsHandlerListEmpty(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+	w := httptest.NewRecorder()
+	newTestTunnelsHandler().ServeHTTP(w, req)
+
+	if body := strings.TrimSpace(w.Body.String()); body != `{"tunnels":[]}` {
+		t.Errorf("Expected an empty tunnel list, got %s", body)
+	}
+}
+
+func TestTunnelsHandlerGetByID(t *testing.T) {
+	handler := newTestTunnelsHandler()
+	_, created := createTunnel(t, handler, `{"local_port": 3000}`)
+
+	tests := []struct {
+		name     string
+		tunnelID string
+		status   int
+	}{
+		{name: "existing tunnel", tunnelID: created.TunnelID, status: http.StatusOK},
+		{name: "unknown tunnel", tunnelID: "unknown", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/tunnels/"+tt.tunnelID, nil)
+			req.SetPathValue("id", tt.tunnelID)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d", tt.status, w.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var info api.TunnelInfo
+			if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+				t.Fatalf("Failed to decode response body: %v", err)
+			}
+			if info.TunnelID != created.TunnelID || info.LocalPort != 3000 {
+				t.Errorf("Expected tunnel %s on port 3000, got %+v", created.TunnelID, info)
+			}
+		})
+	}
+}
+
+func TestTunnelsHandlerDeleteByID(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	var revoked []string
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    reg,
+		OnDelete:    func(tunnelID string) { revoked = append(revoked, tunnelID) },
+	})
+	_, created := createTunnel(t, handler, `{"local_port": 3000}`)
+
+	deleteTunnel := func() int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/tunnels/"+created.TunnelID, nil)
+		req.SetPathValue("id", created.TunnelID)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if status := deleteTunnel(); status != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, status)
+	}
+	if _, err := reg.Get(context.Background(), created.TunnelID); !errors.Is(err, registry.ErrNotFound) {
+		t.Errorf("Expected tunnel to be removed from the registry, got %v", err)
+	}
+	if len(revoked) != 1 || revoked[0] != created.TunnelID {
+		t.Errorf("Expected OnDelete to be called for %s, got %v", created.TunnelID, revoked)
+	}
+
+	if status := deleteTunnel(); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d deleting twice, got %d", http.StatusNotFound, status)
+	}
+	if len(revoked) != 1 {
+		t.Errorf("Expected OnDelete not to be called for an unknown tunnel, got %v", revoked)
 	}
 }
 
@@ -79,7 +210,7 @@ func TestTunnelsHandlerPut(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPut, "/api/tunnels", nil)
 	w := httptest.NewRecorder()
 
-	TunnelsHandler(w, req)
+	newTestTunnelsHandler().ServeHTTP(w, req)
 
 	resp := w.Result()
 	defer func() {
@@ -97,7 +228,7 @@ func TestTunnelsHandlerDelete(t *testing.T) {
 	req := httptest.NewRequest(http.MethodDelete, "/api/tunnels", nil)
 	w := httptest.NewRecorder()
 
-	TunnelsHandler(w, req)
+	newTestTunnelsHandler().ServeHTTP(w, req)
 
 	resp := w.Result()
 	defer func() {
@@ -115,7 +246,7 @@ func TestTunnelsHandlerResponseFormat(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", nil)
 	w := httptest.NewRecorder()
 
-	TunnelsHandler(w, req)
+	newTestTunnelsHandler().ServeHTTP(w, req)
 
 	resp := w.Result()
 	defer func() {
@@ -130,8 +261,16 @@ func TestTunnelsHandlerResponseFormat(t *testing.T) {
 		t.Fatalf("Response is not valid JSON: %v", err)
 	}
 
-	// Verify mock values match expected static data
-	expectedURL := "https://63873749.azhexgate.com"
+	// Verify the public URL and hybrid connection are derived from the generated subdomain
+	if !tunnelIDPattern.MatchString(response.HybridConnectionName) {
+		t.Fatalf("Expected hybrid_connection_name 'hc-<8 digits>', got '%s'", response.HybridConnectionName)
+	}
+	tunnelID := strings.TrimPrefix(response.HybridConnectionName, "hc-")
+	if response.TunnelID != tunnelID {
+		t.Errorf("Expected tunnel_id '%s', got '%s'", tunnelID, response.TunnelID)
+	}
+
+	expectedURL := "https://" + tunnelID + ".azhexgate.com"
 	if response.PublicURL != expectedURL {
 		t.Errorf("Expected public_url '%s', got '%s'", expectedURL, response.PublicURL)
 	}
@@ -141,18 +280,727 @@ func TestTunnelsHandlerResponseFormat(t *testing.T) {
 		t.Errorf("Expected relay_endpoint '%s', got '%s'", expectedRelay, response.RelayEndpoint)
 	}
 
-	expectedHC := "hc-63873749"
-	if response.HybridConnectionName != expectedHC {
-		t.Errorf("Expected hybrid_connection_name '%s', got '%s'", expectedHC, response.HybridConnectionName)
+	if _, err := sas.Parse(response.ListenerToken); err != nil {
+		t.Errorf("Expected listener_token to be a SAS token, got '%s': %v", response.ListenerToken, err)
+	}
+
+	if _, err := uuid.Parse(response.SessionID); err != nil {
+		t.Errorf("Expected session_id to be a UUID, got '%s'", response.SessionID)
+	}
+}
+
+func TestTunnelsHandlerListenerTokenScope(t *testing.T) {
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		RelayEndpoint:    "http://localhost:9090",
+		ListenerKey:      testListenerKey,
+		ListenerTokenTTL: time.Minute,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer func() { _ = resp.Body.Close() }()
+
+	var response api.TunnelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+
+	if response.RelayEndpoint != "http://localhost:9090" {
+		t.Errorf("Expected configured relay endpoint, got '%s'", response.RelayEndpoint)
+	}
+
+	validator := sas.NewValidator(testListenerKey)
+
+	// Token is valid for the tunnel's hybrid connection
+	resourceURI, _ := sas.ResourceURI(response.RelayEndpoint, response.HybridConnectionName)
+	token, err := validator.Validate(response.ListenerToken, resourceURI)
+	if err != nil {
+		t.Fatalf("Expected listener token to be valid, got: %v", err)
+	}
+	if time.Until(token.Expiry) > time.Minute {
+		t.Errorf("Expected token to expire within the configured TTL, expires at %v", token.Expiry)
+	}
+
+	// Token is not valid for any other hybrid connection
+	otherURI, _ := sas.ResourceURI(response.RelayEndpoint, "hc-other")
+	if _, err := validator.Validate(response.ListenerToken, otherURI); !errors.Is(err, sas.ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope for another hybrid connection, got: %v", err)
+	}
+}
+
+func TestTunnelsHandlerMissingListenerKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", nil)
+	w := httptest.NewRecorder()
+
+	NewTunnelsHandler(nil).ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+// createTunnel posts body to handler and decodes the response
+func createTunnel(t *testing.T, handler http.Handler, body string) (int, api.TunnelResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response api.TunnelResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response body: %v", err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestTunnelsHandlerRegistersTunnel(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    reg,
+		BaseDomain:  "tunnels.example.com",
+	})
+
+	status, first := createTunnel(t, handler, `{"local_port": 3000}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	status, second := createTunnel(t, handler, `{"local_port": 3000}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	if first.PublicURL == second.PublicURL {
+		t.Errorf("Expected each tunnel to get its own public URL, both got '%s'", first.PublicURL)
+	}
+	if first.SessionID == second.SessionID {
+		t.Errorf("Expected unique session IDs, both got '%s'", first.SessionID)
+	}
+	if !strings.HasSuffix(first.PublicURL, ".tunnels.example.com") {
+		t.Errorf("Expected public_url under the configured base domain, got '%s'", first.PublicURL)
+	}
+
+	tunnel, err := reg.Get(context.Background(), strings.TrimPrefix(first.HybridConnectionName, "hc-"))
+	if err != nil {
+		t.Fatalf("Expected tunnel to be registered: %v", err)
+	}
+	if tunnel.SessionID != first.SessionID {
+		t.Errorf("Expected session_id '%s', got '%s'", first.SessionID, tunnel.SessionID)
+	}
+	if tunnel.LocalPort != 3000 {
+		t.Errorf("Expected local_port 3000, got %d", tunnel.LocalPort)
+	}
+	if tunnel.CreatedAt.IsZero() {
+		t.Error("Expected created_at to be set")
+	}
+}
+
+func TestTunnelsHandlerRecordsOwner(t *testing.T) {
+	keys, _ := apikey.ParseEntries("ci secret-1")
+	handler := middleware.APIKey(keys)(newTestTunnelsHandler())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", strings.NewReader(`{"local_port": 3000}`))
+	req.Header.Set(api.APIKeyHeader, "secret-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var created api.TunnelResponse
+	_ = json.NewDecoder(w.Body).Decode(&created)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+	req.Header.Set(api.APIKeyHeader, "secret-1")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var listed api.TunnelListResponse
+	_ = json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Tunnels) != 1 || listed.Tunnels[0].Owner != "ci" {
+		t.Errorf("Expected tunnel %s owned by 'ci', got %+v", created.TunnelID, listed.Tunnels)
+	}
+}
+
+func TestTunnelsHandlerScopesToOwner(t *testing.T) {
+	keys, _ := apikey.ParseEntries("ci secret-1, ops secret-2")
+	handler := middleware.APIKey(keys)(newTestTunnelsHandler())
+
+	send := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if tunnelID, ok := strings.CutPrefix(path, "/api/tunnels/"); ok {
+			req.SetPathValue("id", tunnelID)
+		}
+		req.Header.Set(api.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	var created api.TunnelResponse
+	_ = json.NewDecoder(send(http.MethodPost, "/api/tunnels", "secret-1", `{"local_port": 3000}`).Body).Decode(&created)
+	path := "/api/tunnels/" + created.TunnelID
+
+	var listed api.TunnelListResponse
+	_ = json.NewDecoder(send(http.MethodGet, "/api/tunnels", "secret-2", "").Body).Decode(&listed)
+	if len(listed.Tunnels) != 0 {
+		t.Errorf("Expected no tunnels listed for another key, got %+v", listed.Tunnels)
+	}
+
+	// Tunnels of other owners look like unknown tunnels
+	if w := send(http.MethodGet, path, "secret-2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d getting another owner's tunnel, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := send(http.MethodDelete, path, "secret-2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d deleting another owner's tunnel, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := send(http.MethodGet, path, "secret-1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d getting an own tunnel, got %d", http.StatusOK, w.Code)
+	}
+	if w := send(http.MethodDelete, path, "secret-1", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d deleting an own tunnel, got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestTunnelsHandlerNameHint(t *testing.T) {
+	status, response := createTunnel(t, newTestTunnelsHandler(), `{"local_port": 3000, "name": "MyApp"}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	if !regexp.MustCompile(`^hc-myapp-[0-9]{8}$`).MatchString(response.HybridConnectionName) {
+		t.Errorf("Expected hybrid_connection_name 'hc-myapp-<8 digits>', got '%s'", response.HybridConnectionName)
+	}
+	if !strings.HasPrefix(response.PublicURL, "https://myapp-") {
+		t.Errorf("Expected public_url to start with the name hint, got '%s'", response.PublicURL)
+	}
+}
+
+func TestTunnelsHandlerInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "malformed JSON", body: `{"local_port":`},
+		{name: "port out of range", body: `{"local_port": 70000}`},
+		{name: "name with dots", body: `{"local_port": 3000, "name": "a.b"}`},
+		{name: "name with leading hyphen", body: `{"local_port": 3000, "name": "-app"}`},
+		{name: "name too long", body: `{"local_port": 3000, "name": "` + strings.Repeat("a", 33) + `"}`},
+		{name: "negative ttl", body: `{"local_port": 3000, "ttl": -1}`},
+		{name: "basic auth without password", body: `{"local_port": 3000, "basic_auth": {"username": "alice"}}`},
+		{name: "invalid allow CIDR", body: `{"local_port": 3000, "allow_cidrs": ["10.0.0.0/33"]}`},
+		{name: "invalid deny CIDR", body: `{"local_port": 3000, "deny_cidrs": ["office"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := createTunnel(t, newTestTunnelsHandler(), tt.body)
+			if status != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, status)
+			}
+		})
+	}
+}
+
+// collidingRegistry reports the first collisions creates as already taken
+type collidingRegistry struct {
+	registry.TunnelRegistry
+
+	collisions int
+	attempted  []string
+}
+
+func (c *collidingRegistry) Create(ctx context.Context, tunnel *registry.Tunnel) error {
+	c.attempted = append(c.attempted, tunnel.ID)
+	if len(c.attempted) <= c.collisions {
+		return registry.ErrAlreadyExists
+	}
+	return c.TunnelRegistry.Create(ctx, tunnel)
+}
+
+func TestTunnelsHandlerRetriesOnCollision(t *testing.T) {
+	reg := &collidingRegistry{TunnelRegistry: registry.NewMemoryRegistry(), collisions: 2}
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+
+	status, response := createTunnel(t, handler, `{"local_port": 3000}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if len(reg.attempted) != 3 {
+		t.Errorf("Expected 3 create attempts, got %d", len(reg.attempted))
+	}
+	if response.HybridConnectionName != "hc-"+reg.attempted[2] {
+		t.Errorf("Expected the free subdomain to be returned, got '%s'", response.HybridConnectionName)
+	}
+}
+
+func TestTunnelsHandlerGivesUpOnCollisions(t *testing.T) {
+	reg := &collidingRegistry{TunnelRegistry: registry.NewMemoryRegistry(), collisions: maxCreateAttempts}
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+
+	status, _ := createTunnel(t, handler, `{"local_port": 3000}`)
+	if status != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
+	}
+}
+
+func TestTunnelsHandlerRegistryError(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", nil)
+	w := httptest.NewRecorder()
+	NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg}).ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestTunnelsHandlerResumesSession(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+	_, created := createTunnel(t, handler, `{"local_port": 3000}`)
+
+	tests := []struct {
+		name       string
+		tunnelID   string
+		sessionID  string
+		wantStatus int
+		wantSame   bool
+	}{
+		{name: "matching session", tunnelID: created.TunnelID, sessionID: created.SessionID,
+			wantStatus: http.StatusOK, wantSame: true},
+		{name: "other session", tunnelID: created.TunnelID, sessionID: uuid.NewString(),
+			wantStatus: http.StatusConflict},
+		{name: "tunnel gone", tunnelID: "12345678", sessionID: created.SessionID,
+			wantStatus: http.StatusOK, wantSame: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"local_port": 3000, "tunnel_id": "` + tt.tunnelID + `", "session_id": "` + tt.sessionID + `"}`
+			status, response := createTunnel(t, handler, body)
+			if status != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.wantStatus, status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			same := response.TunnelID == created.TunnelID && response.SessionID == created.SessionID
+			if same != tt.wantSame {
+				t.Errorf("Expected same tunnel %v, got %+v", tt.wantSame, response)
+			}
+			if response.ListenerToken == "" {
+				t.Error("Expected a fresh listener token")
+			}
+		})
+	}
+
+	tunnel, err := reg.Get(context.Background(), created.TunnelID)
+	if err != nil {
+		t.Fatalf("Expected resumed tunnel to stay registered: %v", err)
+	}
+	if tunnel.LastHeartbeat.IsZero() {
+		t.Error("Expected resuming to record a heartbeat")
+	}
+}
+
+func TestTunnelsHandlerMultiplex(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+
+	for _, multiplex := range []bool{false, true} {
+		body := `{"local_port": 3000, "multiplex": ` + strconv.FormatBool(multiplex) + `}`
+		status, created := createTunnel(t, handler, body)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+		}
+		if created.Multiplex != multiplex {
+			t.Errorf("Expected multiplex %v in the response, got %v", multiplex, created.Multiplex)
+		}
+
+		tunnel, err := reg.Get(context.Background(), created.TunnelID)
+		if err != nil {
+			t.Fatalf("Expected tunnel to be registered: %v", err)
+		}
+		if tunnel.Multiplex != multiplex {
+			t.Errorf("Expected multiplex %v to be stored, got %v", multiplex, tunnel.Multiplex)
+		}
+
+		// Resuming keeps the setting the tunnel was created with
+		body = `{"local_port": 3000, "tunnel_id": "` + created.TunnelID + `", "session_id": "` + created.SessionID + `"}`
+		if _, resumed := createTunnel(t, handler, body); resumed.Multiplex != multiplex {
+			t.Errorf("Expected resumed tunnel to keep multiplex %v, got %v", multiplex, resumed.Multiplex)
+		}
+	}
+}
+
+func TestTunnelsHandlerTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxTTL  time.Duration
+		ttl     int
+		wantTTL time.Duration
+	}{
+		{name: "no ttl and no maximum", ttl: 0, wantTTL: 0},
+		{name: "requested ttl without maximum", ttl: 600, wantTTL: 10 * time.Minute},
+		{name: "requested ttl below maximum", maxTTL: time.Hour, ttl: 600, wantTTL: 10 * time.Minute},
+		{name: "requested ttl above maximum", maxTTL: time.Hour, ttl: 7200, wantTTL: time.Hour},
+		{name: "no ttl defaults to maximum", maxTTL: time.Hour, ttl: 0, wantTTL: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registry.NewMemoryRegistry()
+			handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg, MaxTTL: tt.maxTTL})
+
+			before := time.Now()
+			status, created := createTunnel(t, handler, `{"local_port": 3000, "ttl": `+strconv.Itoa(tt.ttl)+`}`)
+			if status != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+			}
+
+			if tt.wantTTL == 0 {
+				if !created.ExpiresAt.IsZero() {
+					t.Errorf("Expected no expiry, got %v", created.ExpiresAt)
+				}
+				return
+			}
+			ttl := created.ExpiresAt.Sub(before)
+			if ttl < tt.wantTTL-time.Second || ttl > tt.wantTTL+time.Second {
+				t.Errorf("Expected expires_at about %v from now, got %v", tt.wantTTL, ttl)
+			}
+
+			tunnel, err := reg.Get(context.Background(), created.TunnelID)
+			if err != nil {
+				t.Fatalf("Expected tunnel to be registered: %v", err)
+			}
+			if !tunnel.ExpiresAt.Equal(created.ExpiresAt) {
+				t.Errorf("Expected stored expiry %v, got %v", created.ExpiresAt, tunnel.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestTunnelsHandlerOnCreate(t *testing.T) {
+	var created []string
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		OnCreate:    func(tunnel *registry.Tunnel) { created = append(created, tunnel.ID) },
+	})
+
+	_, first := createTunnel(t, handler, `{"local_port": 3000}`)
+	resume := `{"local_port": 3000, "tunnel_id": "` + first.TunnelID + `", "session_id": "` + first.SessionID + `"}`
+	createTunnel(t, handler, resume)
+	conflict := `{"local_port": 3000, "tunnel_id": "` + first.TunnelID + `", "session_id": "` + uuid.NewString() + `"}`
+	createTunnel(t, handler, conflict)
+
+	if !slices.Equal(created, []string{first.TunnelID, first.TunnelID}) {
+		t.Errorf("Expected OnCreate for the creation and the resume of %s, got %v", first.TunnelID, created)
+	}
+}
+
+func TestTunnelsHandlerResumeKeepsExpiry(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg, MaxTTL: time.Hour})
+	_, created := createTunnel(t, handler, `{"local_port": 3000, "ttl": 600}`)
+
+	// Resuming with a longer TTL does not extend the tunnel
+	body := `{"local_port": 3000, "ttl": 3600, "tunnel_id": "` + created.TunnelID +
+		`", "session_id": "` + created.SessionID + `"}`
+	status, resumed := createTunnel(t, handler, body)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if !resumed.ExpiresAt.Equal(created.ExpiresAt) {
+		t.Errorf("Expected resumed tunnel to keep expiry %v, got %v", created.ExpiresAt, resumed.ExpiresAt)
+	}
+
+	// Once expired, the tunnel can no longer be resumed
+	tunnel, _ := reg.Get(context.Background(), created.TunnelID)
+	tunnel.ExpiresAt = time.Now().Add(-time.Second)
+	_ = reg.Delete(context.Background(), tunnel.ID)
+	_ = reg.Create(context.Background(), tunnel)
+
+	if status, _ := createTunnel(t, handler, body); status != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, status)
+	}
+}
+
+// createTunnelAs posts body to handler with the given API key and returns the recorded response
+func createTunnelAs(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/tunnels", strings.NewReader(body))
+	req.Header.Set(api.APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestTunnelsHandlerQuotaMaxTunnels(t *testing.T) {
+	keys, _ := apikey.ParseEntries("ci secret-1, ops secret-2")
+	reg := registry.NewMemoryRegistry()
+	handler := middleware.APIKey(keys)(NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    reg,
+		Quotas:      quota.NewEnforcer(&quota.Options{Default: quota.Limits{MaxTunnels: 1}}),
+	}))
+
+	var created api.TunnelResponse
+	w := createTunnelAs(handler, "secret-1", `{"local_port": 3000}`)
+	_ = json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = createTunnelAs(handler, "secret-1", `{"local_port": 3000}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	var quotaResp api.QuotaErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&quotaResp); err != nil {
+		t.Fatalf("Failed to decode quota error: %v", err)
+	}
+	if quotaResp.Quota != quota.Tunnels || quotaResp.Limit != 1 || quotaResp.Current != 1 || quotaResp.Error == "" {
+		t.Errorf("Expected a max_tunnels quota error, got %+v", quotaResp)
+	}
+
+	// Other keys and resumed sessions are not limited
+	if w := createTunnelAs(handler, "secret-2", `{"local_port": 3000}`); w.Code != http.StatusOK {
+		t.Errorf("Expected another key to create a tunnel, got status %d", w.Code)
+	}
+	body := `{"local_port": 3000, "tunnel_id": "` + created.TunnelID + `", "session_id": "` + created.SessionID + `"}`
+	if w := createTunnelAs(handler, "secret-1", body); w.Code != http.StatusOK {
+		t.Errorf("Expected resuming to be allowed, got status %d", w.Code)
+	}
+
+	// Revoking a tunnel frees the quota
+	_ = reg.Delete(context.Background(), created.TunnelID)
+	if w := createTunnelAs(handler, "secret-1", `{"local_port": 3000}`); w.Code != http.StatusOK {
+		t.Errorf("Expected a creation after revoking, got status %d", w.Code)
+	}
+}
+
+func TestTunnelsHandlerQuotaCreationRate(t *testing.T) {
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Quotas:      quota.NewEnforcer(&quota.Options{Default: quota.Limits{CreationsPerHour: 1}}),
+	})
+
+	if status, _ := createTunnel(t, handler, `{"local_port": 3000}`); status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	w := createTunnelAs(handler, "", `{"local_port": 3000}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	var quotaResp api.QuotaErrorResponse
+	_ = json.NewDecoder(w.Body).Decode(&quotaResp)
+	if quotaResp.Quota != quota.Creations || quotaResp.RetryAfter <= 0 || quotaResp.RetryAfter > 3600 {
+		t.Errorf("Expected a creations_per_hour quota error, got %+v", quotaResp)
+	}
+	if got := w.Header().Get("Retry-After"); got != strconv.Itoa(quotaResp.RetryAfter) {
+		t.Errorf("Expected Retry-After %d, got %q", quotaResp.RetryAfter, got)
+	}
+}
+
+func TestTunnelsHandlerQuotaCountsRegisteredTunnels(t *testing.T) {
+	reg := &collidingRegistry{TunnelRegistry: registry.NewMemoryRegistry(), collisions: maxCreateAttempts}
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    reg,
+		Quotas:      quota.NewEnforcer(&quota.Options{Default: quota.Limits{CreationsPerHour: 1}}),
+	})
+
+	// A creation that fails to register does not use up the creation rate
+	if w := createTunnelAs(handler, "", `{"local_port": 3000}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
 	}
+	if w := createTunnelAs(handler, "", `{"local_port": 3000}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// slowListRegistry takes a while to list tunnels, widening the window between counting and registering
+type slowListRegistry struct {
+	registry.TunnelRegistry
+}
 
-	expectedToken := "mock-listener-token"
-	if response.ListenerToken != expectedToken {
-		t.Errorf("Expected listener_token '%s', got '%s'", expectedToken, response.ListenerToken)
+func (s *slowListRegistry) List(ctx context.Context) ([]*registry.Tunnel, error) {
+	time.Sleep(10 * time.Millisecond)
+	return s.TunnelRegistry.List(ctx)
+}
+
+func TestTunnelsHandlerQuotaConcurrentCreations(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    &slowListRegistry{TunnelRegistry: reg},
+		Quotas:      quota.NewEnforcer(&quota.Options{Default: quota.Limits{MaxTunnels: 2}}),
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			createTunnelAs(handler, "", `{"local_port": 3000}`)
+		}()
+	}
+	wg.Wait()
+
+	tunnels, _ := reg.List(context.Background())
+	if len(tunnels) != 2 {
+		t.Errorf("Expected concurrent creations to stop at 2 tunnels, got %d", len(tunnels))
 	}
+}
 
-	expectedSessionID := "mock-session-id"
-	if response.SessionID != expectedSessionID {
-		t.Errorf("Expected session_id '%s', got '%s'", expectedSessionID, response.SessionID)
+func TestTunnelsHandlerQuotaMaxTTL(t *testing.T) {
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		MaxTTL:      time.Hour,
+		Quotas:      quota.NewEnforcer(&quota.Options{Default: quota.Limits{MaxTTL: 10 * time.Minute}}),
+	})
+
+	before := time.Now()
+	_, created := createTunnel(t, handler, `{"local_port": 3000, "ttl": 3600}`)
+	if ttl := created.ExpiresAt.Sub(before); ttl < 9*time.Minute || ttl > 11*time.Minute {
+		t.Errorf("Expected the key maximum TTL of 10m to apply, got %v", ttl)
+	}
+}
+
+func TestTunnelsHandlerRateLimit(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{
+		ListenerKey: testListenerKey,
+		Registry:    reg,
+		RateLimits: ratelimit.Policy{
+			Default: ratelimit.Limit{RequestsPerSecond: 10, Burst: 20},
+			Max:     ratelimit.Limit{RequestsPerSecond: 100, Burst: 200},
+		},
+	})
+
+	tests := []struct {
+		name string
+		body string
+		want api.RateLimit
+	}{
+		{name: "default", body: `{"local_port": 3000}`, want: api.RateLimit{RequestsPerSecond: 10, Burst: 20}},
+		{
+			name: "requested per IP",
+			body: `{"local_port": 3000, "rate_limit": {"requests_per_second": 5, "burst": 5, "per_ip": true}}`,
+			want: api.RateLimit{RequestsPerSecond: 5, Burst: 5, PerIP: true},
+		},
+		{
+			name: "capped",
+			body: `{"local_port": 3000, "rate_limit": {"requests_per_second": 1000, "burst": 1000}}`,
+			want: api.RateLimit{RequestsPerSecond: 100, Burst: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, created := createTunnel(t, handler, tt.body)
+			if status != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+			}
+			if created.RateLimit == nil || *created.RateLimit != tt.want {
+				t.Errorf("Expected rate limit %+v, got %+v", tt.want, created.RateLimit)
+			}
+
+			tunnel, err := reg.Get(context.Background(), created.TunnelID)
+			if err != nil {
+				t.Fatalf("Expected tunnel to be registered: %v", err)
+			}
+			if tunnel.RateLimit != tt.want.RequestsPerSecond || tunnel.RateBurst != tt.want.Burst ||
+				tunnel.RateLimitPerIP != tt.want.PerIP {
+				t.Errorf("Expected stored rate limit %+v, got %+v", tt.want, tunnel)
+			}
+		})
+	}
+
+	status, _ := createTunnel(t, handler, `{"local_port": 3000, "rate_limit": {"requests_per_second": -1}}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a negative rate, got %d", http.StatusBadRequest, status)
+	}
+
+	// Unlimited tunnels report no rate limit
+	_, created := createTunnel(t, newTestTunnelsHandler(), `{"local_port": 3000}`)
+	if created.RateLimit != nil {
+		t.Errorf("Expected no rate limit without a policy, got %+v", created.RateLimit)
+	}
+}
+
+func TestTunnelsHandlerBasicAuth(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+
+	status, created := createTunnel(t, handler,
+		`{"local_port": 3000, "basic_auth": {"username": "alice", "password": "s3cret"}}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if !created.BasicAuth {
+		t.Error("Expected the response to report basic auth")
+	}
+
+	tunnel, err := reg.Get(context.Background(), created.TunnelID)
+	if err != nil {
+		t.Fatalf("Expected tunnel to be registered: %v", err)
+	}
+	if tunnel.BasicAuthHash == "" || strings.Contains(tunnel.BasicAuthHash, "s3cret") {
+		t.Fatalf("Expected a hash of the credentials to be stored, got %q", tunnel.BasicAuthHash)
+	}
+	if ok, err := basicauth.Verify(tunnel.BasicAuthHash, "alice", "s3cret"); err != nil || !ok {
+		t.Errorf("Expected the stored hash to match the credentials, got %v, %v", ok, err)
+	}
+
+	// Resuming keeps the stored hash
+	status, resumed := createTunnel(t, handler, `{"local_port": 3000, "tunnel_id": "`+created.TunnelID+
+		`", "session_id": "`+created.SessionID+`", "basic_auth": {"username": "alice", "password": "s3cret"}}`)
+	if status != http.StatusOK || !resumed.BasicAuth {
+		t.Errorf("Expected the resumed tunnel to keep basic auth, got %d %+v", status, resumed)
+	}
+	if again, _ := reg.Get(context.Background(), created.TunnelID); again.BasicAuthHash != tunnel.BasicAuthHash {
+		t.Error("Expected resuming not to change the stored hash")
+	}
+
+	_, open := createTunnel(t, handler, `{"local_port": 3000}`)
+	if open.BasicAuth {
+		t.Error("Expected a tunnel created without credentials to be open")
+	}
+}
+
+func TestTunnelsHandlerIPFilter(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	handler := NewTunnelsHandler(&TunnelsOptions{ListenerKey: testListenerKey, Registry: reg})
+
+	status, created := createTunnel(t, handler,
+		`{"local_port": 3000, "allow_cidrs": ["198.51.100.7/24", "2001:db8::1"], "deny_cidrs": ["198.51.100.66"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	// Ranges are stored and reported normalized
+	wantAllow := []string{"198.51.100.0/24", "2001:db8::1/128"}
+	wantDeny := []string{"198.51.100.66/32"}
+	if !slices.Equal(created.AllowCIDRs, wantAllow) || !slices.Equal(created.DenyCIDRs, wantDeny) {
+		t.Errorf("Expected allow %v and deny %v, got %v and %v",
+			wantAllow, wantDeny, created.AllowCIDRs, created.DenyCIDRs)
+	}
+
+	tunnel, err := reg.Get(context.Background(), created.TunnelID)
+	if err != nil {
+		t.Fatalf("Expected tunnel to be registered: %v", err)
+	}
+	if !slices.Equal(tunnel.AllowCIDRs, wantAllow) || !slices.Equal(tunnel.DenyCIDRs, wantDeny) {
+		t.Errorf("Expected stored allow %v and deny %v, got %v and %v",
+			wantAllow, wantDeny, tunnel.AllowCIDRs, tunnel.DenyCIDRs)
 	}
 }
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+// APIKeyIDKey is the context key for the ID of the API key that authenticated the request
+const APIKeyIDKey contextKey = "api-key-id"
+
+// APIKey is a middleware that rejects requests without a valid X-AzHexGate-ApiKey header
+// The ID of the matching key is stored in the request context
+func APIKey(store *apikey.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID, ok := store.Verify(r.Header.Get(api.APIKeyHeader))
+			if !ok {
+				logging.FromContext(r.Context()).Warn("Rejected unauthenticated API request",
+					logging.String("remote_addr", r.RemoteAddr),
+					logging.Bool("key_present", r.Header.Get(api.APIKeyHeader) != ""))
+				http.Error(w, "Missing or invalid "+api.APIKeyHeader+" header", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), APIKeyIDKey, keyID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetAPIKeyID retrieves the ID of the authenticating API key from the context
+func GetAPIKeyID(ctx context.Context) string {
+	if id, ok := ctx.Value(APIKeyIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+)
+
+func TestAPIKey(t *testing.T) {
+	store, err := apikey.ParseEntries("ci secret-1")
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+
+	var seenKeyID string
+	handler := APIKey(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKeyID = GetAPIKeyID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantKeyID  string
+	}{
+		{name: "valid key", key: "secret-1", wantStatus: http.StatusOK, wantKeyID: "ci"},
+		{name: "invalid key", key: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "missing key", key: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenKeyID = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+			if tt.key != "" {
+				req.Header.Set(api.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if seenKeyID != tt.wantKeyID {
+				t.Errorf("Expected key ID %q in context, got %q", tt.wantKeyID, seenKeyID)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/gateway/jwtauth"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+const (
+	// IdentityKey is the context key for the identity of the caller authenticated by a bearer token
+	IdentityKey contextKey = "identity"
+
+	// bearerRealm is the realm advertised to callers without a valid bearer token
+	bearerRealm = `Bearer realm="azhexgate"`
+)
+
+// OIDC is a middleware that rejects requests without a valid "Authorization: Bearer" token
+// The identity the token was issued to is stored in the request context and added to the request logger
+func OIDC(validator *jwtauth.Validator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := logging.FromContext(r.Context())
+
+			token, ok := bearerToken(r)
+			if !ok {
+				logger.Warn("Rejected unauthenticated API request", logging.String("remote_addr", r.RemoteAddr))
+				w.Header().Set("WWW-Authenticate", bearerRealm)
+				http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			identity, err := validator.Validate(r.Context(), token)
+			switch {
+			case errors.Is(err, jwtauth.ErrKeysUnavailable):
+				logger.Error("Failed to fetch token signing keys", logging.Error(err))
+				http.Error(w, "Unable to validate bearer token", http.StatusServiceUnavailable)
+				return
+			case err != nil:
+				logger.Warn("Rejected invalid bearer token",
+					logging.String("remote_addr", r.RemoteAddr),
+					logging.Error(err))
+				w.Header().Set("WWW-Authenticate", bearerRealm+`, error="invalid_token"`)
+				http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), IdentityKey, identity)
+			ctx = logging.WithContext(ctx, logger.With(logging.String("subject", identity.Subject)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// GetIdentity retrieves the identity of the caller authenticated by a bearer token from the context
+func GetIdentity(ctx context.Context) *jwtauth.Identity {
+	if identity, ok := ctx.Value(IdentityKey).(*jwtauth.Identity); ok {
+		return identity
+	}
+	return nil
+}
+
+// GetOwner retrieves the caller that owns the tunnels created by the request: the subject of its bearer token,
+// or else the ID of its API key. It is empty for unauthenticated requests.
+func GetOwner(ctx context.Context) string {
+	if identity := GetIdentity(ctx); identity != nil {
+		return identity.Subject
+	}
+	return GetAPIKeyID(ctx)
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/gateway/jwtauth"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+func TestOIDC(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{Subject: "alice"})
+	defer issuer.Close()
+	validator := jwtauth.NewValidator(&jwtauth.Options{Issuer: issuer.URL, Audience: issuer.Audience()})
+
+	var seenOwner string
+	handler := OIDC(validator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenOwner = GetOwner(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantOwner     string
+		wantChallenge string
+	}{
+		{name: "valid token", authorization: "Bearer " + issuer.Token(nil), wantStatus: http.StatusOK, wantOwner: "alice"},
+		{name: "lowercase scheme", authorization: "bearer " + issuer.Token(nil), wantStatus: http.StatusOK,
+			wantOwner: "alice"},
+		{name: "missing token", wantStatus: http.StatusUnauthorized, wantChallenge: `Bearer realm="azhexgate"`},
+		{name: "basic credentials", authorization: "Basic YWxpY2U6c2VjcmV0", wantStatus: http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="azhexgate"`},
+		{name: "wrong audience", authorization: "Bearer " + issuer.Token(map[string]any{"aud": "another-app"}),
+			wantStatus: http.StatusUnauthorized, wantChallenge: `Bearer realm="azhexgate", error="invalid_token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenOwner = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if seenOwner != tt.wantOwner {
+				t.Errorf("Expected owner %q in context, got %q", tt.wantOwner, seenOwner)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("Expected WWW-Authenticate %q, got %q", tt.wantChallenge, got)
+			}
+		})
+	}
+}
+
+func TestOIDC_IdentityNextToTelemetry(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{Subject: "alice"})
+	defer issuer.Close()
+	validator := jwtauth.NewValidator(&jwtauth.Options{Issuer: issuer.URL, Audience: issuer.Audience()})
+
+	buf := &bytes.Buffer{}
+	var identity *jwtauth.Identity
+	var requestID string
+	handler := Telemetry(Logger(logging.NewWithOutput(logging.InfoLevel, buf))(
+		OIDC(validator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity = GetIdentity(r.Context())
+			requestID = GetRequestID(r.Context())
+			logging.FromContext(r.Context()).Info("Handled")
+		}))))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.Token(map[string]any{"email": "alice@example.com"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if identity == nil || identity.Subject != "alice" || identity.Email != "alice@example.com" {
+		t.Fatalf("Expected the identity of alice in context, got %+v", identity)
+	}
+	if requestID == "" {
+		t.Error("Expected the request ID next to the identity in context")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, "Handled") && !strings.Contains(line, "subject=alice") {
+			t.Errorf("Expected the handler log line to carry the subject, got: %s", line)
+		}
+	}
+}
+
+func TestOIDC_KeysUnavailable(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	validator := jwtauth.NewValidator(&jwtauth.Options{Issuer: issuer.URL, Audience: issuer.Audience()})
+	token := issuer.Token(nil)
+	issuer.Close()
+
+	handler := OIDC(validator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the request not to reach the handler")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestGetOwner(t *testing.T) {
+	if owner := GetOwner(context.Background()); owner != "" {
+		t.Errorf("Expected no owner for an unauthenticated request, got %q", owner)
+	}
+
+	ctx := context.WithValue(context.Background(), APIKeyIDKey, "ci")
+	if owner := GetOwner(ctx); owner != "ci" {
+		t.Errorf("Expected the API key ID as owner, got %q", owner)
+	}
+
+	ctx = context.WithValue(ctx, IdentityKey, &jwtauth.Identity{Subject: "alice"})
+	if owner := GetOwner(ctx); owner != "alice" {
+		t.Errorf("Expected the token subject as owner, got %q", owner)
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 func TestServer_MiddlewareIntegration(t *testing.T) {
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(9999, logger)
+	server := NewServer(&Options{Port: 9999, Logger: logger})
 
 	// Test that telemetry headers are added
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
@@ -41,7 +41,7 @@ func TestServer_MiddlewareIntegration(t *testing.T) {
 
 func TestServer_MiddlewareContextPropagation(t *testing.T) {
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(9999, logger)
+	server := NewServer(&Options{Port: 9999, Logger: logger})
 
 	// Create a custom handler to verify context values
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -84,7 +84,7 @@ func TestServer_MiddlewareContextPropagation(t *testing.T) {
 
 func TestServer_MiddlewareWithoutClientRequestID(t *testing.T) {
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(9999, logger)
+	server := NewServer(&Options{Port: 9999, Logger: logger})
 
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	w := httptest.NewRecorder()
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+)
+
+// apiSubdomain is the reserved subdomain serving the management API next to the apex domain
+const apiSubdomain = "api"
+
+// reservedSubdomains are never treated as tunnel IDs
+var reservedSubdomains = map[string]bool{
+	apiSubdomain: true,
+	"www":        true,
+}
+
+// Router dispatches requests by Host header.
+// Requests for <tunnel-id>.<base domain> go to the tunnel handler; the apex domain,
+// the api subdomain and hosts outside the base domain (e.g. health probes on the
+// App Service hostname) go to the management API.
+type Router struct {
+	baseDomain string
+	api        http.Handler
+	tunnel     http.Handler
+}
+
+// NewRouter creates a new host-based router
+func NewRouter(baseDomain string, api, tunnel http.Handler) *Router {
+	return &Router{
+		baseDomain: strings.ToLower(strings.Trim(baseDomain, ".")),
+		api:        api,
+		tunnel:     tunnel,
+	}
+}
+
+// ServeHTTP routes the request to the management API or to a tunnel
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tunnelID, isTunnelHost := rt.TunnelID(r.Host)
+	if !isTunnelHost {
+		rt.api.ServeHTTP(w, r)
+		return
+	}
+
+	if tunnelID == "" {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+
+	rt.tunnel.ServeHTTP(w, r.WithContext(handlers.WithTunnelID(r.Context(), tunnelID)))
+}
+
+// TunnelID extracts the tunnel ID from a Host header.
+// isTunnelHost reports whether the host is a subdomain of the base domain other than a
+// reserved one; tunnelID is empty when such a host does not name a valid tunnel.
+func (rt *Router) TunnelID(host string) (tunnelID string, isTunnelHost bool) {
+	if rt.baseDomain == "" {
+		return "", false
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	suffix := "." + rt.baseDomain
+	if !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+
+	label := strings.TrimSuffix(host, suffix)
+	if reservedSubdomains[label] {
+		return "", false
+	}
+	if label == "" || strings.Contains(label, ".") {
+		return "", true
+	}
+	return label, true
+}
@@ -0,0 +1,280 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
+)
+
+func TestRouter_TunnelID(t *testing.T) {
+	router := NewRouter("azhexgate.com", nil, nil)
+
+	tests := []struct {
+		host         string
+		wantID       string
+		wantIsTunnel bool
+	}{
+		{host: "63873749.azhexgate.com", wantID: "63873749", wantIsTunnel: true},
+		{host: "63873749.azhexgate.com:443", wantID: "63873749", wantIsTunnel: true},
+		{host: "63873749.AzHexGate.com.", wantID: "63873749", wantIsTunnel: true},
+		{host: "a.b.azhexgate.com", wantID: "", wantIsTunnel: true},
+		{host: "azhexgate.com", wantIsTunnel: false},
+		{host: "api.azhexgate.com", wantIsTunnel: false},
+		{host: "www.azhexgate.com", wantIsTunnel: false},
+		{host: "localhost:8080", wantIsTunnel: false},
+		{host: "azhexgate-gw.azurewebsites.net", wantIsTunnel: false},
+		{host: "evilazhexgate.com", wantIsTunnel: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			id, isTunnel := router.TunnelID(tt.host)
+			if id != tt.wantID || isTunnel != tt.wantIsTunnel {
+				t.Errorf("TunnelID(%q) = (%q, %v), want (%q, %v)", tt.host, id, isTunnel, tt.wantID, tt.wantIsTunnel)
+			}
+		})
+	}
+}
+
+func TestRouter_NoBaseDomain(t *testing.T) {
+	router := NewRouter("", nil, nil)
+
+	if _, isTunnel := router.TunnelID("63873749.azhexgate.com"); isTunnel {
+		t.Error("Expected no tunnel routing without a base domain")
+	}
+}
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("api"))
+	})
+	tunnel := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tunnel:" + handlers.GetTunnelID(r.Context())))
+	})
+	router := NewRouter("azhexgate.com", api, tunnel)
+
+	tests := []struct {
+		name       string
+		host       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "apex serves api", host: "azhexgate.com", path: "/api/tunnels", wantStatus: 200, wantBody: "api"},
+		{name: "api host serves api", host: "api.azhexgate.com", path: "/healthz", wantStatus: 200, wantBody: "api"},
+		{name: "tunnel subdomain", host: "63873749.azhexgate.com", path: "/foo", wantStatus: 200,
+			wantBody: "tunnel:63873749"},
+		{name: "management paths on tunnel host go to the tunnel", host: "63873749.azhexgate.com",
+			path: "/api/tunnels", wantStatus: 200, wantBody: "tunnel:63873749"},
+		{name: "nested subdomain", host: "a.b.azhexgate.com", path: "/", wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("Expected body %q, got %q", tt.wantBody, string(body))
+				}
+			}
+		})
+	}
+}
+
+// offlineSender is a relay.Sender whose listener is never online
+type offlineSender struct{}
+
+func (offlineSender) Dial(ctx context.Context) (relay.Connection, error) {
+	return nil, relay.ErrListenerOffline
+}
+func (offlineSender) Close() error { return nil }
+
+func TestServer_RoutesTunnelTrafficThroughMiddleware(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{ID: "63873749", HybridConnectionName: "hc-63873749"})
+
+	server := NewServer(&Options{
+		Logger:     logging.New(logging.ErrorLevel),
+		BaseDomain: "azhexgate.com",
+		Registry:   reg,
+		Proxy: &handlers.ProxyOptions{
+			NewSender: func(string) *gatewayrelay.Sender {
+				return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: offlineSender{}})
+			},
+		},
+	})
+	public := httptest.NewServer(server.server.Handler)
+	defer public.Close()
+
+	// Tunnel host is hijacked through the middleware chain and forwarded to the relay
+	req, _ := http.NewRequest(http.MethodGet, public.URL+"/foo", nil)
+	req.Host = "63873749.azhexgate.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for an offline tunnel, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	// Unknown tunnels are not forwarded
+	req, _ = http.NewRequest(http.MethodGet, public.URL+"/foo", nil)
+	req.Host = "unknown.azhexgate.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown tunnel, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// Management API is still served on the apex host
+	resp, err = http.Get(public.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d for health check, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+// relayToLocal accepts memory relay connections and pipes them raw to the local address
+func relayToLocal(ctx context.Context, listener relay.Listener, localAddr string) {
+	for {
+		relayConn, err := listener.Accept(ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = relayConn.Close() }()
+			localConn, err := net.Dial("tcp", localAddr)
+			if err != nil {
+				return
+			}
+			defer func() { _ = localConn.Close() }()
+
+			done := make(chan struct{}, 2)
+			go func() { _, _ = io.Copy(localConn, relayConn); done <- struct{}{} }()
+			go func() { _, _ = io.Copy(relayConn, localConn); done <- struct{}{} }()
+			<-done
+		}()
+	}
+}
+
+func TestServer_RevokedTunnelStopsRouting(t *testing.T) {
+	// Local app streams a first chunk and then holds the response open
+	release := make(chan struct{})
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer local.Close()
+	defer close(release)
+
+	memoryListener := relay.NewMemoryListener()
+	defer func() { _ = memoryListener.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relayToLocal(ctx, memoryListener, strings.TrimPrefix(local.URL, "http://"))
+
+	server := NewServer(&Options{
+		Logger:     logging.New(logging.ErrorLevel),
+		BaseDomain: "azhexgate.com",
+		Tunnels:    &handlers.TunnelsOptions{ListenerKey: sas.Key{Name: "test", Value: "secret"}},
+		Proxy: &handlers.ProxyOptions{
+			NewSender: func(string) *gatewayrelay.Sender {
+				return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+			},
+		},
+	})
+	public := httptest.NewServer(server.server.Handler)
+	defer public.Close()
+
+	// Create a tunnel through the management API
+	resp, err := http.Post(public.URL+"/api/tunnels", "application/json", strings.NewReader(`{"local_port": 3000}`))
+	if err != nil {
+		t.Fatalf("Create request failed: %v", err)
+	}
+	var created api.TunnelResponse
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	_ = resp.Body.Close()
+	tunnelHost := created.TunnelID + ".azhexgate.com"
+
+	// Open a long-lived request through the tunnel
+	req, _ := http.NewRequest(http.MethodGet, public.URL+"/stream", nil)
+	req.Host = tunnelHost
+	streamResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Tunnel request failed: %v", err)
+	}
+	defer func() { _ = streamResp.Body.Close() }()
+	first := make([]byte, len("first chunk"))
+	if _, err := io.ReadFull(streamResp.Body, first); err != nil {
+		t.Fatalf("Failed to read first chunk: %v", err)
+	}
+
+	// Revoke the tunnel
+	req, _ = http.NewRequest(http.MethodDelete, public.URL+"/api/tunnels/"+created.TunnelID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Delete request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	// The open connection is closed
+	readDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, streamResp.Body)
+		close(readDone)
+	}()
+	select {
+	case <-readDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the open tunnel connection to be closed on revocation")
+	}
+
+	// New requests are no longer routed
+	req, _ = http.NewRequest(http.MethodGet, public.URL+"/stream", nil)
+	req.Host = tunnelHost
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for a revoked tunnel, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
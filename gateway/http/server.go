@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
 	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
 	"github.com/julienstroheker/AzHexGate/gateway/http/middleware"
+	"github.com/julienstroheker/AzHexGate/gateway/jwtauth"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 )
 
@@ -16,40 +19,173 @@ type Server struct {
 	server *http.Server
 	port   int
 	logger *logging.Logger
+	reaper *registry.Reaper
+}
+
+// Options contains configuration for the Server
+type Options struct {
+	// Port is the port the server listens on
+	Port int
+
+	// Logger is used for request logging
+	Logger *logging.Logger
+
+	// Tunnels configures the tunnel management endpoints (optional)
+	Tunnels *handlers.TunnelsOptions
+
+	// BaseDomain is the domain tunnels are exposed under, e.g. "azhexgate.com" (optional).
+	// When empty, every request is served by the management API.
+	BaseDomain string
+
+	// Proxy configures forwarding of tunnel traffic through the relay (optional)
+	Proxy *handlers.ProxyOptions
+
+	// Registry stores tunnels shared by the management API and the proxy
+	// (optional, defaults to an in-memory registry)
+	Registry registry.TunnelRegistry
+
+	// APIKeys authenticates management API calls (optional).
+	// When nil, the management API is not authenticated.
+	APIKeys *apikey.Store
+
+	// OIDC authenticates management API calls with bearer tokens instead of API keys (optional).
+	// It takes precedence over APIKeys.
+	OIDC *jwtauth.Validator
+
+	// Reaper expires tunnels whose client stopped sending heartbeats or whose TTL elapsed while the server runs
+	// (optional, disabled when nil). Its Registry is replaced by the server registry.
+	Reaper *registry.ReaperOptions
 }
 
 // NewServer creates a new HTTP server instance
-func NewServer(port int, logger *logging.Logger) *Server {
+func NewServer(opts *Options) *Server {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.New(logging.InfoLevel)
+	}
+
+	reg := opts.Registry
+	if reg == nil {
+		reg = registry.NewMemoryRegistry()
+	}
+
+	tunnelsOpts := handlers.TunnelsOptions{}
+	if opts.Tunnels != nil {
+		tunnelsOpts = *opts.Tunnels
+	}
+	tunnelsOpts.Registry = reg
+	if tunnelsOpts.BaseDomain == "" {
+		tunnelsOpts.BaseDomain = opts.BaseDomain
+	}
+
+	proxyOpts := handlers.ProxyOptions{}
+	if opts.Proxy != nil {
+		proxyOpts = *opts.Proxy
+	}
+	proxyOpts.Registry = reg
+	proxy := handlers.NewProxyHandler(&proxyOpts)
+
+	connectProxy(&tunnelsOpts, proxy)
+
+	var reaper *registry.Reaper
+	if opts.Reaper != nil {
+		reaperOpts := *opts.Reaper
+		reaperOpts.Registry = reg
+		if reaperOpts.Logger == nil {
+			reaperOpts.Logger = logger
+		}
+		// Expired tunnels lose their open connections like revoked ones
+		onExpire := reaperOpts.OnExpire
+		reaperOpts.OnExpire = func(tunnelID string) {
+			proxy.CloseTunnel(tunnelID)
+			if onExpire != nil {
+				onExpire(tunnelID)
+			}
+		}
+		reaper = registry.NewReaper(&reaperOpts)
+	}
+
 	mux := http.NewServeMux()
 
 	// Register health check endpoint
 	mux.HandleFunc("/healthz", handlers.HealthHandler)
 
 	// Register management API endpoints
-	mux.HandleFunc("/api/tunnels", handlers.TunnelsHandler)
+	tunnelsHandler := handlers.NewTunnelsHandler(&tunnelsOpts)
+	tunnels := authenticate(opts, tunnelsHandler)
+	mux.Handle("/api/tunnels", tunnels)
+	mux.Handle("/api/tunnels/{id}", tunnels)
+	mux.Handle("/api/tunnels/{id}/heartbeat", authenticate(opts, http.HandlerFunc(tunnelsHandler.Heartbeat)))
+	mux.Handle("/api/relay/pool", authenticate(opts, handlers.PoolStatsHandler(proxy)))
+
+	// Route tunnel subdomains to the relay, everything else to the management API
+	router := NewRouter(opts.BaseDomain, mux, proxy)
 
 	// Chain middlewares: Telemetry -> Logger -> Metrics -> handlers
 	// Telemetry is first to ensure all requests get tracking IDs
 	// Logger is second to log requests with telemetry IDs
 	// Metrics is third as a placeholder for future metrics collection
-	var handler http.Handler = mux
+	var handler http.Handler = router
 	handler = middleware.Metrics(handler)
 	handler = middleware.Logger(logger)(handler)
 	handler = middleware.Telemetry(handler)
 
 	return &Server{
 		server: &http.Server{
-			Addr:              fmt.Sprintf(":%d", port),
+			Addr:              fmt.Sprintf(":%d", opts.Port),
 			Handler:           handler,
 			ReadHeaderTimeout: 10 * time.Second,
 		},
-		port:   port,
+		port:   opts.Port,
 		logger: logger,
+		reaper: reaper,
 	}
 }
 
-// ListenAndServe starts the HTTP server
+// connectProxy hooks the proxy to the tunnel lifecycle. Registering or resuming a tunnel starts filling
+// its relay connection pool ahead of the first request, and revoking it closes the connections the
+// proxy holds open for it.
+func connectProxy(tunnelsOpts *handlers.TunnelsOptions, proxy *handlers.ProxyHandler) {
+	onCreate := tunnelsOpts.OnCreate
+	tunnelsOpts.OnCreate = func(tunnel *registry.Tunnel) {
+		proxy.Warm(tunnel)
+		if onCreate != nil {
+			onCreate(tunnel)
+		}
+	}
+
+	onDelete := tunnelsOpts.OnDelete
+	tunnelsOpts.OnDelete = func(tunnelID string) {
+		proxy.CloseTunnel(tunnelID)
+		if onDelete != nil {
+			onDelete(tunnelID)
+		}
+	}
+}
+
+// authenticate wraps a management API handler with the configured authentication, if any
+func authenticate(opts *Options, handler http.Handler) http.Handler {
+	switch {
+	case opts.OIDC != nil:
+		return middleware.OIDC(opts.OIDC)(handler)
+	case opts.APIKeys != nil:
+		return middleware.APIKey(opts.APIKeys)(handler)
+	default:
+		return handler
+	}
+}
+
+// ListenAndServe starts the HTTP server, and the reaper when configured, until the server is closed
 func (s *Server) ListenAndServe() error {
+	if s.reaper != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.reaper.Run(ctx)
+	}
 	return s.server.ListenAndServe()
 }
 
@@ -3,16 +3,24 @@ package http
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/julienstroheker/AzHexGate/gateway/apikey"
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+	"github.com/julienstroheker/AzHexGate/gateway/jwtauth"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	"github.com/julienstroheker/AzHexGate/internal/api"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
 )
 
 func TestNewServer(t *testing.T) {
 	port := 9999
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(port, logger)
+	server := NewServer(&Options{Port: port, Logger: logger})
 
 	if server == nil {
 		t.Fatal("Expected server to be created, got nil")
@@ -34,7 +42,7 @@ func TestNewServer(t *testing.T) {
 func TestServerLifecycle(t *testing.T) {
 	port := 9998
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(port, logger)
+	server := NewServer(&Options{Port: port, Logger: logger})
 
 	// Start server in a goroutine
 	serverErrors := make(chan error, 1)
@@ -80,7 +88,7 @@ func TestServerLifecycle(t *testing.T) {
 func TestServerShutdownTimeout(t *testing.T) {
 	port := 9997
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(port, logger)
+	server := NewServer(&Options{Port: port, Logger: logger})
 
 	// Start server
 	go func() {
@@ -106,7 +114,7 @@ func TestServerShutdownTimeout(t *testing.T) {
 func TestServerClose(t *testing.T) {
 	port := 9996
 	logger := logging.New(logging.InfoLevel)
-	server := NewServer(port, logger)
+	server := NewServer(&Options{Port: port, Logger: logger})
 
 	// Start server
 	go func() {
@@ -122,3 +130,153 @@ func TestServerClose(t *testing.T) {
 		t.Errorf("Expected clean close, got error: %v", err)
 	}
 }
+
+func TestServer_APIKeyAuthentication(t *testing.T) {
+	keys, err := apikey.ParseEntries("ci secret-1")
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+	server := NewServer(&Options{
+		Logger:  logging.New(logging.ErrorLevel),
+		APIKeys: keys,
+		Tunnels: &handlers.TunnelsOptions{ListenerKey: sas.Key{Name: "test", Value: "secret"}},
+	})
+	public := httptest.NewServer(server.server.Handler)
+	defer public.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{name: "create without key", method: http.MethodPost, path: "/api/tunnels", wantStatus: http.StatusUnauthorized},
+		{name: "create with wrong key", method: http.MethodPost, path: "/api/tunnels", key: "wrong",
+			wantStatus: http.StatusUnauthorized},
+		{name: "create with key", method: http.MethodPost, path: "/api/tunnels", key: "secret-1",
+			wantStatus: http.StatusOK},
+		{name: "list without key", method: http.MethodGet, path: "/api/tunnels", wantStatus: http.StatusUnauthorized},
+		{name: "delete without key", method: http.MethodDelete, path: "/api/tunnels/12345678",
+			wantStatus: http.StatusUnauthorized},
+		{name: "heartbeat without key", method: http.MethodPut, path: "/api/tunnels/12345678/heartbeat",
+			wantStatus: http.StatusUnauthorized},
+		{name: "pool stats without key", method: http.MethodGet, path: "/api/relay/pool",
+			wantStatus: http.StatusUnauthorized},
+		{name: "health check is public", method: http.MethodGet, path: "/healthz", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, public.URL+tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(api.APIKeyHeader, tt.key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServer_OIDCAuthentication(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{Subject: "alice"})
+	defer issuer.Close()
+	keys, err := apikey.ParseEntries("ci secret-1")
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+
+	reg := registry.NewMemoryRegistry()
+	server := NewServer(&Options{
+		Logger:   logging.New(logging.ErrorLevel),
+		Registry: reg,
+		APIKeys:  keys,
+		OIDC:     jwtauth.NewValidator(&jwtauth.Options{Issuer: issuer.URL, Audience: issuer.Audience()}),
+		Tunnels:  &handlers.TunnelsOptions{ListenerKey: sas.Key{Name: "test", Value: "secret"}},
+	})
+	public := httptest.NewServer(server.server.Handler)
+	defer public.Close()
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "create without token", wantStatus: http.StatusUnauthorized},
+		{name: "create with API key", header: api.APIKeyHeader, value: "secret-1", wantStatus: http.StatusUnauthorized},
+		{name: "create with expired token", header: "Authorization",
+			value:      "Bearer " + issuer.Token(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}),
+			wantStatus: http.StatusUnauthorized},
+		{name: "create with token", header: "Authorization", value: "Bearer " + issuer.Token(nil),
+			wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, public.URL+"/api/tunnels", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	tunnels, err := reg.List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list tunnels: %v", err)
+	}
+	if len(tunnels) != 1 || tunnels[0].Owner != "alice" {
+		t.Errorf("Expected a single tunnel owned by the token subject, got %+v", tunnels)
+	}
+}
+
+func TestServer_ReaperReleasesStaleTunnels(t *testing.T) {
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{
+		ID:            "12345678",
+		LastHeartbeat: time.Now().Add(-time.Hour),
+	})
+
+	expired := make(chan string, 1)
+	server := NewServer(&Options{
+		Port:     9995,
+		Logger:   logging.New(logging.ErrorLevel),
+		Registry: reg,
+		Reaper: &registry.ReaperOptions{
+			Timeout:     time.Millisecond,
+			GracePeriod: time.Millisecond,
+			Interval:    10 * time.Millisecond,
+			OnExpire:    func(tunnelID string) { expired <- tunnelID },
+		},
+	})
+	go func() { _ = server.ListenAndServe() }()
+	defer func() { _ = server.Close() }()
+
+	select {
+	case id := <-expired:
+		if id != "12345678" {
+			t.Errorf("Expected tunnel 12345678 to expire, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the reaper to run with the server")
+	}
+	if _, err := reg.Get(context.Background(), "12345678"); err == nil {
+		t.Error("Expected the stale tunnel to be deleted")
+	}
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienstroheker/AzHexGate/client/tunnel"
+	"github.com/julienstroheker/AzHexGate/gateway/http/handlers"
+	"github.com/julienstroheker/AzHexGate/gateway/registry"
+	gatewayrelay "github.com/julienstroheker/AzHexGate/gateway/relay"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// newWebSocketTunnel runs gateway -> memory relay -> client listener -> local echo server
+// and returns the public gateway address
+func newWebSocketTunnel(t *testing.T, mode tunnel.Mode) string {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(local.Close)
+
+	memoryListener := relay.NewMemoryListener()
+	listener := tunnel.NewListener(&tunnel.Options{
+		Relay:     memoryListener,
+		LocalAddr: strings.TrimPrefix(local.URL, "http://"),
+		Mode:      mode,
+	})
+	t.Cleanup(func() { _ = listener.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = listener.Start(ctx, nil) }()
+
+	reg := registry.NewMemoryRegistry()
+	_ = reg.Create(context.Background(), &registry.Tunnel{ID: "63873749", HybridConnectionName: "hc-63873749"})
+
+	server := NewServer(&Options{
+		Logger:     logging.New(logging.ErrorLevel),
+		BaseDomain: "azhexgate.com",
+		Registry:   reg,
+		Proxy: &handlers.ProxyOptions{
+			NewSender: func(string) *gatewayrelay.Sender {
+				return gatewayrelay.NewSender(&gatewayrelay.Options{Relay: relay.NewMemorySender(memoryListener)})
+			},
+		},
+	})
+	public := httptest.NewServer(server.server.Handler)
+	t.Cleanup(public.Close)
+
+	return strings.TrimPrefix(public.URL, "http://")
+}
+
+func TestServer_WebSocketThroughTunnel(t *testing.T) {
+	for _, mode := range []tunnel.Mode{tunnel.ModeHTTP, tunnel.ModeRaw} {
+		t.Run(mode.String(), func(t *testing.T) {
+			publicAddr := newWebSocketTunnel(t, mode)
+
+			// Resolve the tunnel host to the public test server
+			dialer := websocket.Dialer{
+				NetDial: func(network, addr string) (net.Conn, error) {
+					return net.Dial(network, publicAddr)
+				},
+				HandshakeTimeout: 5 * time.Second,
+			}
+			conn, resp, err := dialer.Dial("ws://63873749.azhexgate.com/ws", nil)
+			if err != nil {
+				t.Fatalf("WebSocket handshake failed: %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Errorf("Expected status %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+			}
+
+			messages := []struct {
+				messageType int
+				payload     string
+			}{
+				{messageType: websocket.TextMessage, payload: "reload"},
+				{messageType: websocket.BinaryMessage, payload: "\x00\x01\x02"},
+				{messageType: websocket.TextMessage, payload: strings.Repeat("x", 128*1024)},
+			}
+			for _, message := range messages {
+				if err := conn.WriteMessage(message.messageType, []byte(message.payload)); err != nil {
+					t.Fatalf("Failed to write message: %v", err)
+				}
+				_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				messageType, echoed, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatalf("Failed to read message: %v", err)
+				}
+				if messageType != message.messageType || string(echoed) != message.payload {
+					t.Errorf("Expected echo of a %d byte message, got type %d with %d bytes",
+						len(message.payload), messageType, len(echoed))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package ipfilter decides which client IP addresses may reach a tunnel from CIDR allow and deny lists
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// MaxEntries bounds how many ranges each list of a tunnel may hold
+const MaxEntries = 100
+
+// ErrInvalidCIDR is returned when a list entry is neither an IP address nor a CIDR range
+var ErrInvalidCIDR = errors.New("invalid CIDR")
+
+// Filter admits client addresses by CIDR lists. A deny match always wins; when the allow
+// list is not empty, only addresses in one of its ranges are admitted. A nil *Filter admits everyone.
+type Filter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// New creates a filter from allow and deny lists of IP addresses and CIDR ranges.
+// It returns nil when both lists are empty.
+func New(allow, deny []string) (*Filter, error) {
+	allowed, err := parseList(allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := parseList(deny)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil, nil
+	}
+	return &Filter{allow: allowed, deny: denied}, nil
+}
+
+// Parse parses IP addresses and CIDR ranges. Addresses become single-address ranges and
+// host bits of ranges are cleared, e.g. "10.1.2.3/8" is "10.0.0.0/8".
+func Parse(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, entry)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseList parses a list of a tunnel, which holds at most MaxEntries ranges
+func parseList(entries []string) ([]netip.Prefix, error) {
+	if len(entries) > MaxEntries {
+		return nil, fmt.Errorf("%w: at most %d ranges are allowed, got %d", ErrInvalidCIDR, MaxEntries, len(entries))
+	}
+	return Parse(entries)
+}
+
+// Canonical returns the entries as the CIDR ranges they parse to, e.g. to store them
+func Canonical(entries []string) ([]string, error) {
+	prefixes, err := parseList(entries)
+	if err != nil || len(prefixes) == 0 {
+		return nil, err
+	}
+
+	canonical := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		canonical = append(canonical, prefix.String())
+	}
+	return canonical, nil
+}
+
+// Allows reports whether the client address may reach the tunnel.
+// Unknown addresses are refused unless the filter is empty.
+func (f *Filter) Allows(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	if !addr.IsValid() {
+		return false
+	}
+
+	addr = addr.Unmap()
+	if contains(f.deny, addr) {
+		return false
+	}
+	return len(f.allow) == 0 || contains(f.allow, addr)
+}
+
+// contains reports whether addr belongs to one of the ranges
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package ipfilter
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	filter, err := New(nil, nil)
+	if err != nil || filter != nil {
+		t.Errorf("Expected no filter for empty lists, got %v, %v", filter, err)
+	}
+
+	for _, entry := range []string{"", "10.0.0.0/33", "not-an-ip", "10.0.0.1/"} {
+		if _, err := New([]string{entry}, nil); !errors.Is(err, ErrInvalidCIDR) {
+			t.Errorf("Expected ErrInvalidCIDR for allow entry %q, got %v", entry, err)
+		}
+		if _, err := New(nil, []string{entry}); !errors.Is(err, ErrInvalidCIDR) {
+			t.Errorf("Expected ErrInvalidCIDR for deny entry %q, got %v", entry, err)
+		}
+	}
+
+	tooMany := strings.Split(strings.Repeat("10.0.0.1,", MaxEntries+1), ",")[:MaxEntries+1]
+	if _, err := New(tooMany, nil); !errors.Is(err, ErrInvalidCIDR) {
+		t.Errorf("Expected ErrInvalidCIDR for %d ranges, got %v", len(tooMany), err)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	got, err := Canonical([]string{" 10.1.2.3/8", "192.0.2.7", "2001:db8::1/32", "::ffff:198.51.100.1"})
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32", "198.51.100.1/32"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFilter_Allows(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		addr  string
+		want  bool
+	}{
+		{name: "in allow list", allow: []string{"203.0.113.0/24"}, addr: "203.0.113.9", want: true},
+		{name: "outside allow list", allow: []string{"203.0.113.0/24"}, addr: "198.51.100.1", want: false},
+		{name: "deny list only", deny: []string{"198.51.100.0/24"}, addr: "203.0.113.9", want: true},
+		{name: "in deny list", deny: []string{"198.51.100.0/24"}, addr: "198.51.100.1", want: false},
+		{
+			name: "deny wins over allow", allow: []string{"10.0.0.0/8"}, deny: []string{"10.6.0.0/16"},
+			addr: "10.6.1.1", want: false,
+		},
+		{name: "IPv4-mapped IPv6 address", allow: []string{"203.0.113.0/24"}, addr: "::ffff:203.0.113.9", want: true},
+		{name: "IPv6 range", allow: []string{"2001:db8::/32"}, addr: "2001:db8::42", want: true},
+		{name: "unknown address", deny: []string{"198.51.100.0/24"}, addr: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := New(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			var addr netip.Addr
+			if tt.addr != "" {
+				addr = netip.MustParseAddr(tt.addr)
+			}
+			if got := filter.Allows(addr); got != tt.want {
+				t.Errorf("Expected %s allowed: %v, got %v", tt.addr, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	var filter *Filter
+	if !filter.Allows(netip.Addr{}) {
+		t.Error("Expected a nil filter to allow every address")
+	}
+}
@@ -0,0 +1,249 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc"
+)
+
+const (
+	// maxJWKSSize bounds the JWKS document
+	maxJWKSSize = 1 << 20
+
+	// minRSAKeyBits refuses RSA keys too short to be trusted
+	minRSAKeyBits = 2048
+)
+
+// curves are the elliptic curves of EC keys by their JWK name
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// jsonWebKey is a public key of a JWKS (RFC 7517)
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// Curve, X and Y are the curve and the point of EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// publicKey is a signature verification key
+type publicKey struct {
+	// algorithm is the only algorithm the key may be used with, empty when the JWK does not say
+	algorithm string
+
+	key crypto.PublicKey
+}
+
+// parseJWKS returns the signature keys of a JWKS by key ID.
+// Keys that cannot be used, e.g. encryption keys or unsupported key types, are skipped.
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = publicKey{algorithm: jwk.Algorithm, key: key}
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key material of the JWK
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key shorter than %d bits", minRSAKeyBits)
+		}
+		return key, nil
+	case "EC":
+		curve, ok := curves[k.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		// Coordinates are fixed-size, so the uncompressed point is 0x04 || x || y
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid EC point size")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// keySet caches the keys of the issuer. Keys are fetched again once they are older than the refresh
+// interval, or when a token names an unknown key, e.g. after the issuer rotated its keys.
+type keySet struct {
+	client             *http.Client
+	issuer             string
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	// fetchMu serializes fetches, so concurrent requests for a new key fetch the JWKS once
+	fetchMu sync.Mutex
+
+	mu        sync.Mutex
+	jwksURL   string
+	keys      map[string]publicKey
+	fetched   time.Time
+	attempted time.Time
+}
+
+// key returns the key named by a token header
+func (s *keySet) key(ctx context.Context, keyID string, now time.Time) (publicKey, error) {
+	key, found, fresh, attempted := s.lookup(keyID, now)
+	if found && fresh {
+		return key, nil
+	}
+	// Unknown key IDs only trigger a fetch now and then, so made-up IDs cannot flood the issuer
+	if !found && now.Sub(attempted) < s.minRefreshInterval {
+		return publicKey{}, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, keyID)
+	}
+
+	if err := s.refresh(ctx, attempted, now); err != nil {
+		// Stale keys keep being used while the issuer cannot be reached
+		if found {
+			return key, nil
+		}
+		return publicKey{}, err
+	}
+
+	key, found, _, _ = s.lookup(keyID, now)
+	if !found {
+		return publicKey{}, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, keyID)
+	}
+	return key, nil
+}
+
+// lookup returns the cached key with the ID, whether the cache is fresh and when it was last fetched.
+// Tokens without a key ID match the only key of a single-key set.
+func (s *keySet) lookup(keyID string, now time.Time) (key publicKey, found, fresh bool, attempted time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, found = s.keys[keyID]
+	if !found && keyID == "" && len(s.keys) == 1 {
+		for _, only := range s.keys {
+			key, found = only, true
+		}
+	}
+	return key, found, now.Sub(s.fetched) < s.refreshInterval, s.attempted
+}
+
+// refresh fetches the JWKS unless another caller did since the given attempt
+func (s *keySet) refresh(ctx context.Context, attempted time.Time, now time.Time) error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	s.mu.Lock()
+	if s.attempted.After(attempted) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.attempted = now
+	jwksURL := s.jwksURL
+	s.mu.Unlock()
+
+	if jwksURL == "" {
+		provider, err := oidc.Discover(ctx, s.client, s.issuer)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrKeysUnavailable, err)
+		}
+		jwksURL = provider.JWKSURI
+	}
+
+	keys, err := s.fetch(ctx, jwksURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeysUnavailable, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwksURL = jwksURL
+	s.keys = keys
+	s.fetched = now
+	return nil
+}
+
+// fetch downloads and parses the JWKS
+func (s *keySet) fetch(ctx context.Context, jwksURL string) (map[string]publicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", jwksURL, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,60 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestParseJWKS(t *testing.T) {
+	data := []byte(`{"keys": [
+		{"kty": "EC", "kid": "ec", "use": "sig", "alg": "ES256", "crv": "P-256",
+		 "x": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "y": "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"},
+		{"kty": "RSA", "kid": "short", "n": "sXchDaQebHnPiGvyDOAT4saGEUetSyo9MKLOoWFsueri23bOdgWp4Dy1Wl", "e": "AQAB"},
+		{"kty": "EC", "kid": "encryption", "use": "enc", "crv": "P-256",
+		 "x": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "y": "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"},
+		{"kty": "EC", "kid": "off-curve", "crv": "P-256",
+		 "x": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "y": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU"},
+		{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"}
+	]}`)
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Expected only the EC signing key to be kept, got %d keys", len(keys))
+	}
+	key, ok := keys["ec"]
+	if !ok {
+		t.Fatal("Expected the EC key to be kept")
+	}
+	if _, ok := key.key.(*ecdsa.PublicKey); !ok || key.algorithm != "ES256" {
+		t.Errorf("Expected an ES256 ECDSA key, got %T for %q", key.key, key.algorithm)
+	}
+}
+
+func TestParseJWKS_RSA(t *testing.T) {
+	n := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3" +
+		"oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZH" +
+		"zu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kE" +
+		"gU8awapJzKnqDKgw"
+	keys, err := parseJWKS([]byte(`{"keys": [{"kty": "RSA", "kid": "rsa", "n": "` + n + `", "e": "AQAB"}]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	key, ok := keys["rsa"].key.(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("Expected an RSA key, got %T", keys["rsa"].key)
+	}
+	if key.N.BitLen() != 2048 || key.E != 65537 {
+		t.Errorf("Expected a 2048-bit key with exponent 65537, got %d bits and %d", key.N.BitLen(), key.E)
+	}
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	if _, err := parseJWKS([]byte(`not json`)); err == nil {
+		t.Error("Expected an error for a document that is not JSON")
+	}
+}
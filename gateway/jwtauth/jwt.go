@@ -0,0 +1,155 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+// maxTokenSize bounds the tokens the validator parses
+const maxTokenSize = 16 << 10
+
+// algorithm is a JWS signature algorithm the validator accepts
+type algorithm struct {
+	hash    crypto.Hash
+	newHash func() hash.Hash
+
+	// curve is the curve of ECDSA algorithms, nil for RSA ones
+	curve elliptic.Curve
+}
+
+// algorithms are the accepted signature algorithms. Symmetric algorithms and "none" are refused,
+// so a token can never be signed with public key material.
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256, newHash: sha256.New},
+	"RS384": {hash: crypto.SHA384, newHash: sha512.New384},
+	"RS512": {hash: crypto.SHA512, newHash: sha512.New},
+	"ES256": {hash: crypto.SHA256, newHash: sha256.New, curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, newHash: sha512.New384, curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, newHash: sha512.New, curve: elliptic.P521()},
+}
+
+// header is the JOSE header of a token
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// claims are the claims of a token the validator reads
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expiry    *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+}
+
+// audience is the aud claim, a single string or an array of strings
+type audience []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+// token is a parsed, not yet verified, JWS compact serialization
+type token struct {
+	header    header
+	claims    claims
+	signed    string
+	signature []byte
+}
+
+// parse splits and decodes a token without verifying it
+func parse(raw string) (*token, error) {
+	if len(raw) > maxTokenSize {
+		return nil, fmt.Errorf("%w: token larger than %d bytes", ErrInvalidToken, maxTokenSize)
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var t token
+	if err := decodeSegment(parts[0], &t.header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %w", ErrInvalidToken, err)
+	}
+	if err := decodeSegment(parts[1], &t.claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %w", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	t.signed = parts[0] + "." + parts[1]
+	t.signature = signature
+	return &t, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verify checks the signature of the token with key
+func (t *token) verify(key publicKey) error {
+	alg, ok := algorithms[t.header.Algorithm]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, t.header.Algorithm)
+	}
+	if key.algorithm != "" && key.algorithm != t.header.Algorithm {
+		return fmt.Errorf("%w: key %q is for %s, not %s", ErrInvalidToken, t.header.KeyID, key.algorithm,
+			t.header.Algorithm)
+	}
+
+	h := alg.newHash()
+	h.Write([]byte(t.signed))
+	digest := h.Sum(nil)
+
+	switch public := key.key.(type) {
+	case *rsa.PublicKey:
+		if alg.curve == nil && rsa.VerifyPKCS1v15(public, alg.hash, digest, t.signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		// ECDSA signatures are the fixed-size big-endian r and s, concatenated (RFC 7518, section 3.4)
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if alg.curve == public.Curve && len(t.signature) == 2*size {
+			r := new(big.Int).SetBytes(t.signature[:size])
+			s := new(big.Int).SetBytes(t.signature[size:])
+			if ecdsa.Verify(public, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+}
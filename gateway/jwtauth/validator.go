@@ -0,0 +1,173 @@
+// Package jwtauth validates OAuth 2.0 bearer tokens issued as signed JWTs by an OpenID Connect provider
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// defaultCacheTTL is how long fetched keys are used before they are fetched again
+	defaultCacheTTL = time.Hour
+
+	// defaultLeeway is the clock skew tolerated between the issuer and the gateway
+	defaultLeeway = time.Minute
+
+	// minRefreshInterval is the least time between fetches triggered by unknown key IDs
+	minRefreshInterval = 30 * time.Second
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed, badly signed, expired or not meant for the gateway
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrKeysUnavailable is returned when the signing keys of the issuer cannot be fetched
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+)
+
+// Options contains configuration for the Validator
+type Options struct {
+	// Issuer is the URL tokens must be issued by, e.g. "https://login.example.com/tenant/v2.0"
+	Issuer string
+
+	// Audience is the value the aud claim of tokens must contain, e.g. the client ID of the gateway
+	Audience string
+
+	// JWKSURL is where the signing keys of the issuer are published
+	// (optional, discovered from the issuer metadata when empty)
+	JWKSURL string
+
+	// HTTPClient fetches the issuer metadata and keys (optional, defaults to a client with a 10s timeout)
+	HTTPClient *http.Client
+
+	// CacheTTL is how long fetched keys are used before they are fetched again (optional, defaults to 1h).
+	// Tokens signed with an unknown key fetch the keys early, so rotations are picked up at once.
+	CacheTTL time.Duration
+
+	// Leeway is the clock skew tolerated when checking exp and nbf (optional, defaults to 1m)
+	Leeway time.Duration
+}
+
+// Identity is the caller a token was issued to
+type Identity struct {
+	// Subject is the sub claim, the stable ID of the caller at the issuer
+	Subject string
+
+	// Issuer is the iss claim
+	Issuer string
+
+	// Email and Name are the email and name claims, when the issuer includes them
+	Email string
+	Name  string
+
+	// ExpiresAt is when the token expires
+	ExpiresAt time.Time
+}
+
+// Validator validates bearer tokens against the keys of a single issuer
+type Validator struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	keys     *keySet
+}
+
+// NewValidator creates a new validator; keys are fetched on first use
+func NewValidator(opts *Options) *Validator {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	cacheTTL := opts.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultCacheTTL
+	}
+
+	leeway := opts.Leeway
+	if leeway <= 0 {
+		leeway = defaultLeeway
+	}
+
+	return &Validator{
+		issuer:   opts.Issuer,
+		audience: opts.Audience,
+		leeway:   leeway,
+		keys: &keySet{
+			client:             client,
+			issuer:             opts.Issuer,
+			jwksURL:            opts.JWKSURL,
+			refreshInterval:    cacheTTL,
+			minRefreshInterval: minRefreshInterval,
+		},
+	}
+}
+
+// Validate checks the signature and claims of a token and returns the identity it was issued to.
+// It returns an error wrapping ErrInvalidToken when the token must be refused,
+// and one wrapping ErrKeysUnavailable when it cannot be checked.
+func (v *Validator) Validate(ctx context.Context, raw string) (*Identity, error) {
+	return v.validate(ctx, raw, time.Now())
+}
+
+// validate checks a token at now
+func (v *Validator) validate(ctx context.Context, raw string, now time.Time) (*Identity, error) {
+	t, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	// Claims are checked before the signature, so tokens of other issuers never trigger key fetches
+	if err := v.checkClaims(t.claims, now); err != nil {
+		return nil, err
+	}
+
+	key, err := v.keys.key(ctx, t.header.KeyID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.verify(key); err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		Subject:   t.claims.Subject,
+		Issuer:    t.claims.Issuer,
+		Email:     t.claims.Email,
+		Name:      t.claims.Name,
+		ExpiresAt: unixTime(*t.claims.Expiry),
+	}, nil
+}
+
+// checkClaims checks the registered claims of a token at now
+func (v *Validator) checkClaims(c claims, now time.Time) error {
+	switch {
+	case c.Issuer != v.issuer:
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	case !slices.Contains(c.Audience, v.audience):
+		return fmt.Errorf("%w: token not issued for audience %q", ErrInvalidToken, v.audience)
+	case c.Expiry == nil:
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	case !now.Before(unixTime(*c.Expiry).Add(v.leeway)):
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case c.NotBefore != nil && now.Add(v.leeway).Before(unixTime(*c.NotBefore)):
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	case c.Subject == "":
+		return fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	return nil
+}
+
+// unixTime converts a NumericDate claim, seconds since the epoch, to a time
+func unixTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second)))
+}
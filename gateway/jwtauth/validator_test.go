@@ -0,0 +1,215 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+func newTestValidator(issuer *oidctest.Issuer) *Validator {
+	return NewValidator(&Options{Issuer: issuer.URL, Audience: issuer.Audience()})
+}
+
+func TestValidator_Validate(t *testing.T) {
+	for _, algorithm := range []string{"ES256", "RS256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(&oidctest.Options{Algorithm: algorithm, Subject: "alice"})
+			defer issuer.Close()
+
+			identity, err := newTestValidator(issuer).Validate(context.Background(),
+				issuer.Token(map[string]any{"email": "alice@example.com", "name": "Alice"}))
+			if err != nil {
+				t.Fatalf("Expected the token to be valid, got %v", err)
+			}
+			if identity.Subject != "alice" || identity.Issuer != issuer.URL {
+				t.Errorf("Expected subject alice from %s, got %s from %s", issuer.URL, identity.Subject, identity.Issuer)
+			}
+			if identity.Email != "alice@example.com" || identity.Name != "Alice" {
+				t.Errorf("Expected the email and name claims, got %q and %q", identity.Email, identity.Name)
+			}
+			if time.Until(identity.ExpiresAt) <= 0 {
+				t.Errorf("Expected the token to expire in the future, got %v", identity.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestValidator_InvalidTokens(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	validator := newTestValidator(issuer)
+
+	now := time.Now()
+	valid := issuer.Token(nil)
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "not-a-token"},
+		{name: "wrong issuer", token: issuer.Token(map[string]any{"iss": "https://elsewhere.example.com"})},
+		{name: "wrong audience", token: issuer.Token(map[string]any{"aud": "another-app"})},
+		{name: "audience list without gateway", token: issuer.Token(map[string]any{"aud": []string{"a", "b"}})},
+		{name: "expired", token: issuer.Token(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})},
+		{name: "missing exp", token: issuer.Token(map[string]any{"exp": nil})},
+		{name: "not valid yet", token: issuer.Token(map[string]any{"nbf": now.Add(time.Hour).Unix()})},
+		{name: "missing sub", token: issuer.Token(map[string]any{"sub": nil})},
+		{name: "tampered claims", token: tamper(valid, issuer.Token(map[string]any{"sub": "mallory"}))},
+		{name: "unsigned", token: unsigned(valid)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validator.Validate(context.Background(), tt.token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidator_AudienceList(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	token := issuer.Token(map[string]any{"aud": []string{"another-app", issuer.Audience()}})
+	if _, err := newTestValidator(issuer).Validate(context.Background(), token); err != nil {
+		t.Errorf("Expected a token for several audiences including the gateway to be valid, got %v", err)
+	}
+}
+
+func TestValidator_Leeway(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	validator := newTestValidator(issuer)
+
+	token := issuer.Token(map[string]any{"exp": time.Now().Add(-30 * time.Second).Unix()})
+	if _, err := validator.Validate(context.Background(), token); err != nil {
+		t.Errorf("Expected a token expired within the leeway to be valid, got %v", err)
+	}
+}
+
+func TestValidator_CachesKeys(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{TokenLifetime: 24 * time.Hour})
+	defer issuer.Close()
+	validator := newTestValidator(issuer)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := validator.validate(context.Background(), issuer.Token(nil), now); err != nil {
+			t.Fatalf("Expected the token to be valid, got %v", err)
+		}
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Errorf("Expected the JWKS to be fetched once, got %d", got)
+	}
+
+	// Keys older than the cache TTL are fetched again
+	if _, err := validator.validate(context.Background(), issuer.Token(nil), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Errorf("Expected the JWKS to be fetched again after the TTL, got %d fetches", got)
+	}
+}
+
+func TestValidator_KeyRotation(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+	validator := newTestValidator(issuer)
+
+	now := time.Now()
+	old := issuer.Token(nil)
+	if _, err := validator.validate(context.Background(), old, now); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+
+	issuer.RotateKey(true)
+	rotated := issuer.Token(nil)
+
+	// Unknown keys are not fetched again right after a fetch
+	_, err := validator.validate(context.Background(), rotated, now.Add(time.Second))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken right after a fetch, got %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Errorf("Expected no fetch within the minimum refresh interval, got %d fetches", got)
+	}
+
+	later := now.Add(minRefreshInterval)
+	if _, err := validator.validate(context.Background(), rotated, later); err != nil {
+		t.Errorf("Expected the token signed with the new key to be valid, got %v", err)
+	}
+	if _, err := validator.validate(context.Background(), old, later); err != nil {
+		t.Errorf("Expected the token signed with the still published key to be valid, got %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Errorf("Expected the JWKS to be fetched again for the new key, got %d fetches", got)
+	}
+
+	// Tokens signed with a retired key are refused once the keys are fetched again
+	issuer.RotateKey(false)
+	latest := later.Add(minRefreshInterval)
+	if _, err := validator.validate(context.Background(), issuer.Token(nil), latest); err != nil {
+		t.Fatalf("Expected the token signed with the new key to be valid, got %v", err)
+	}
+	if _, err := validator.validate(context.Background(), old, latest); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a token signed with a retired key to be refused, got %v", err)
+	}
+}
+
+func TestValidator_KeysUnavailable(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	validator := newTestValidator(issuer)
+	token := issuer.Token(nil)
+	issuer.Close()
+
+	if _, err := validator.Validate(context.Background(), token); !errors.Is(err, ErrKeysUnavailable) {
+		t.Errorf("Expected ErrKeysUnavailable when the issuer is down, got %v", err)
+	}
+}
+
+func TestValidator_StaleKeys(t *testing.T) {
+	issuer := oidctest.NewIssuer(&oidctest.Options{TokenLifetime: 24 * time.Hour})
+	validator := newTestValidator(issuer)
+	token := issuer.Token(nil)
+
+	now := time.Now()
+	if _, err := validator.validate(context.Background(), token, now); err != nil {
+		t.Fatalf("Expected the token to be valid, got %v", err)
+	}
+	issuer.Close()
+
+	// Cached keys keep being used when they cannot be fetched again
+	if _, err := validator.validate(context.Background(), token, now.Add(2*time.Hour)); err != nil {
+		t.Errorf("Expected stale keys to be used while the issuer is down, got %v", err)
+	}
+}
+
+func TestValidator_JWKSURL(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	validator := NewValidator(&Options{
+		Issuer:   issuer.URL,
+		Audience: issuer.Audience(),
+		JWKSURL:  issuer.URL + "/missing",
+	})
+	if _, err := validator.Validate(context.Background(), issuer.Token(nil)); !errors.Is(err, ErrKeysUnavailable) {
+		t.Errorf("Expected the configured JWKS URL to be used instead of discovery, got %v", err)
+	}
+}
+
+// tamper returns token with the claims of other, so its signature does not match
+func tamper(token, other string) string {
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+}
+
+// unsigned returns the claims of token with an alg "none" header and no signature
+func unsigned(token string) string {
+	return "eyJhbGciOiJub25lIn0." + strings.Split(token, ".")[1] + "."
+}
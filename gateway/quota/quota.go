@@ -0,0 +1,213 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Tunnels names the limit on concurrent tunnels of a key
+	Tunnels = "max_tunnels"
+
+	// Creations names the limit on tunnels a key creates per hour
+	Creations = "creations_per_hour"
+
+	// TTL names the limit on the lifetime of the tunnels of a key
+	TTL = "max_ttl"
+
+	// creationWindow is the sliding window creations are counted over
+	creationWindow = time.Hour
+)
+
+// ErrMalformedEntry is returned when a quota entry cannot be parsed
+var ErrMalformedEntry = errors.New("malformed quota entry")
+
+// Limits bounds what a single API key may do; zero fields are unlimited
+type Limits struct {
+	// MaxTunnels is how many tunnels the key may have registered at once
+	MaxTunnels int
+
+	// CreationsPerHour is how many tunnels the key may create in any hour
+	CreationsPerHour int
+
+	// MaxTTL caps the lifetime of the tunnels of the key
+	MaxTTL time.Duration
+}
+
+// Error reports a creation refused because a quota is exhausted
+type Error struct {
+	// Quota names the exhausted limit, e.g. Tunnels or Creations
+	Quota string
+
+	// Limit is the configured value of the quota
+	Limit int
+
+	// Current is the usage counted against the quota
+	Current int
+
+	// RetryAfter is how long until the quota allows a creation again (zero when only freeing tunnels helps)
+	RetryAfter time.Duration
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	switch e.Quota {
+	case Tunnels:
+		return fmt.Sprintf("quota exceeded: %d of %d concurrent tunnels in use", e.Current, e.Limit)
+	case Creations:
+		return fmt.Sprintf("quota exceeded: %d of %d tunnel creations per hour used, retry in %s",
+			e.Current, e.Limit, e.RetryAfter.Round(time.Second))
+	default:
+		return fmt.Sprintf("quota exceeded: %s %d of %d", e.Quota, e.Current, e.Limit)
+	}
+}
+
+// Options contains configuration for the Enforcer
+type Options struct {
+	// Default applies to keys without their own limits
+	Default Limits
+
+	// Keys holds the limits of individual keys by key ID, or token subject, replacing Default (optional)
+	Keys map[string]Limits
+}
+
+// Enforcer checks tunnel creations against the limits of the API key creating them
+type Enforcer struct {
+	defaults Limits
+	keys     map[string]Limits
+
+	mu        sync.Mutex
+	creations map[string][]time.Time
+}
+
+// NewEnforcer creates a new quota enforcer
+func NewEnforcer(opts *Options) *Enforcer {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	keys := make(map[string]Limits, len(opts.Keys))
+	for id, limits := range opts.Keys {
+		keys[id] = limits
+	}
+
+	return &Enforcer{
+		defaults:  opts.Default,
+		keys:      keys,
+		creations: make(map[string][]time.Time),
+	}
+}
+
+// Limits returns the limits of the key with the given ID
+func (e *Enforcer) Limits(keyID string) Limits {
+	if limits, ok := e.keys[keyID]; ok {
+		return limits
+	}
+	return e.defaults
+}
+
+// Allow checks whether the key may create a tunnel at now while it has active tunnels registered.
+// It returns an *Error when a quota is exhausted. The creation only counts once it is recorded.
+func (e *Enforcer) Allow(keyID string, active int, now time.Time) error {
+	limits := e.Limits(keyID)
+	if limits.MaxTunnels > 0 && active >= limits.MaxTunnels {
+		return &Error{Quota: Tunnels, Limit: limits.MaxTunnels, Current: active}
+	}
+	if limits.CreationsPerHour <= 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	recent := e.recent(keyID, now)
+	if len(recent) >= limits.CreationsPerHour {
+		return &Error{
+			Quota:      Creations,
+			Limit:      limits.CreationsPerHour,
+			Current:    len(recent),
+			RetryAfter: recent[0].Add(creationWindow).Sub(now),
+		}
+	}
+	return nil
+}
+
+// Record counts a tunnel the key created at now against its creation rate
+func (e *Enforcer) Record(keyID string, now time.Time) {
+	if e.Limits(keyID).CreationsPerHour <= 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.creations[keyID] = append(e.recent(keyID, now), now)
+}
+
+// recent forgets the creations of the key that left the window at now and returns the others.
+// The caller must hold mu.
+func (e *Enforcer) recent(keyID string, now time.Time) []time.Time {
+	recent := e.creations[keyID]
+	cutoff := now.Add(-creationWindow)
+	for len(recent) > 0 && !recent[0].After(cutoff) {
+		recent = recent[1:]
+	}
+	if len(recent) == 0 {
+		delete(e.creations, keyID)
+		return nil
+	}
+	e.creations[keyID] = recent
+	return recent
+}
+
+// ParseEntries parses comma-separated per-key limits of the form
+// "<key-id> max_tunnels=<n> creations_per_hour=<n> max_ttl=<seconds>", e.g. the AZHEXGATE_API_KEY_QUOTAS value.
+// Limits an entry leaves out are taken from defaults.
+func ParseEntries(entries string, defaults Limits) (map[string]Limits, error) {
+	keys := make(map[string]Limits)
+	for _, entry := range strings.Split(entries, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("%w: %q sets no limit", ErrMalformedEntry, fields[0])
+		}
+
+		limits := defaults
+		for _, field := range fields[1:] {
+			if err := limits.set(field); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrMalformedEntry, fields[0], err)
+			}
+		}
+		keys[fields[0]] = limits
+	}
+	return keys, nil
+}
+
+// set applies a "<name>=<value>" limit
+func (l *Limits) set(field string) error {
+	name, value, ok := strings.Cut(field, "=")
+	if !ok {
+		return fmt.Errorf("expected <name>=<value>, got %q", field)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+
+	switch name {
+	case Tunnels:
+		l.MaxTunnels = n
+	case Creations:
+		l.CreationsPerHour = n
+	case TTL:
+		l.MaxTTL = time.Duration(n) * time.Second
+	default:
+		return fmt.Errorf("unknown limit %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnforcer_MaxTunnels(t *testing.T) {
+	enforcer := NewEnforcer(&Options{Default: Limits{MaxTunnels: 2}})
+	now := time.Now()
+
+	if err := enforcer.Allow("ci", 1, now); err != nil {
+		t.Fatalf("Expected a creation below the limit to be allowed, got %v", err)
+	}
+
+	err := enforcer.Allow("ci", 2, now)
+	var quotaErr *Error
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("Expected a quota error, got %v", err)
+	}
+	if quotaErr.Quota != Tunnels || quotaErr.Limit != 2 || quotaErr.Current != 2 {
+		t.Errorf("Expected max_tunnels 2 of 2, got %+v", quotaErr)
+	}
+	if quotaErr.RetryAfter != 0 {
+		t.Errorf("Expected no retry delay for concurrent tunnels, got %v", quotaErr.RetryAfter)
+	}
+}
+
+func TestEnforcer_CreationsPerHour(t *testing.T) {
+	enforcer := NewEnforcer(&Options{Default: Limits{CreationsPerHour: 2}})
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Allowed creations that were never recorded (e.g. registering failed) do not count
+	for i := 0; i < 3; i++ {
+		if err := enforcer.Allow("ci", 0, start); err != nil {
+			t.Fatalf("Expected unrecorded creation %d to be allowed, got %v", i+1, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		at := start.Add(time.Duration(i) * 10 * time.Minute)
+		if err := enforcer.Allow("ci", 0, at); err != nil {
+			t.Fatalf("Expected creation %d to be allowed, got %v", i+1, err)
+		}
+		enforcer.Record("ci", at)
+	}
+
+	err := enforcer.Allow("ci", 0, start.Add(30*time.Minute))
+	var quotaErr *Error
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("Expected a quota error, got %v", err)
+	}
+	if quotaErr.Quota != Creations || quotaErr.Current != 2 {
+		t.Errorf("Expected creations_per_hour 2 of 2, got %+v", quotaErr)
+	}
+	if quotaErr.RetryAfter != 30*time.Minute {
+		t.Errorf("Expected to retry once the first creation leaves the window, got %v", quotaErr.RetryAfter)
+	}
+
+	// Other keys have their own window
+	if err := enforcer.Allow("ops", 0, start.Add(30*time.Minute)); err != nil {
+		t.Errorf("Expected another key to be allowed, got %v", err)
+	}
+
+	// Refused creations are not counted, so the window frees up an hour after the first one
+	if err := enforcer.Allow("ci", 0, start.Add(time.Hour)); err != nil {
+		t.Errorf("Expected a creation after the window to be allowed, got %v", err)
+	}
+}
+
+func TestEnforcer_KeyLimits(t *testing.T) {
+	enforcer := NewEnforcer(&Options{
+		Default: Limits{MaxTunnels: 1},
+		Keys:    map[string]Limits{"ci": {MaxTunnels: 5, MaxTTL: time.Hour}},
+	})
+
+	if limits := enforcer.Limits("ci"); limits.MaxTunnels != 5 || limits.MaxTTL != time.Hour {
+		t.Errorf("Expected the limits of key ci, got %+v", limits)
+	}
+	if limits := enforcer.Limits("other"); limits.MaxTunnels != 1 {
+		t.Errorf("Expected the default limits, got %+v", limits)
+	}
+	if err := enforcer.Allow("ci", 3, time.Now()); err != nil {
+		t.Errorf("Expected key ci to be allowed its own limit, got %v", err)
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	defaults := Limits{MaxTunnels: 2, CreationsPerHour: 10}
+	keys, err := ParseEntries("ci max_tunnels=5 max_ttl=3600, ops creations_per_hour=0,,", defaults)
+	if err != nil {
+		t.Fatalf("ParseEntries failed: %v", err)
+	}
+
+	want := map[string]Limits{
+		"ci":  {MaxTunnels: 5, CreationsPerHour: 10, MaxTTL: time.Hour},
+		"ops": {MaxTunnels: 2},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %v", len(want), keys)
+	}
+	for id, limits := range want {
+		if keys[id] != limits {
+			t.Errorf("Expected limits %+v for %s, got %+v", limits, id, keys[id])
+		}
+	}
+}
+
+func TestParseEntries_Malformed(t *testing.T) {
+	tests := []string{
+		"ci",
+		"ci max_tunnels",
+		"ci max_tunnels=-1",
+		"ci max_tunnels=many",
+		"ci bandwidth=10",
+	}
+
+	for _, entries := range tests {
+		t.Run(entries, func(t *testing.T) {
+			if _, err := ParseEntries(entries, Limits{}); !errors.Is(err, ErrMalformedEntry) {
+				t.Errorf("Expected ErrMalformedEntry, got %v", err)
+			}
+		})
+	}
+}
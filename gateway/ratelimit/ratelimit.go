@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is how many per-source buckets a limiter keeps before dropping the refilled ones
+const maxIdleBuckets = 10000
+
+// Limit is a token bucket configuration; the zero value is unlimited
+type Limit struct {
+	// RequestsPerSecond is the sustained rate at which tokens are added
+	RequestsPerSecond float64
+
+	// Burst is how many tokens the bucket holds, i.e. how many requests may arrive at once
+	Burst int
+
+	// PerSource gives every source its own bucket instead of sharing one
+	PerSource bool
+}
+
+// Unlimited reports whether the limit allows every request
+func (l Limit) Unlimited() bool {
+	return l.RequestsPerSecond <= 0
+}
+
+// Bucket is a token bucket refilled continuously at a fixed rate
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket. A burst below one is raised to one so a single request can pass.
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	capacity := math.Max(float64(burst), 1)
+	return &Bucket{rate: rate, burst: capacity, tokens: capacity, last: now}
+}
+
+// Take removes a token at now. When the bucket is empty it returns false and how long until a token is available.
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// full reports whether the bucket has refilled completely at now, i.e. forgetting it changes nothing
+func (b *Bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens earned since the last update
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// Limiter applies a Limit to requests, either through one shared bucket or a bucket per source
+type Limiter struct {
+	limit Limit
+
+	mu      sync.Mutex
+	shared  *Bucket
+	sources map[string]*Bucket
+}
+
+// NewLimiter creates a limiter enforcing limit
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{limit: limit, sources: make(map[string]*Bucket)}
+}
+
+// Limit returns the limit the limiter enforces
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow reports whether a request from source may pass at now, and otherwise how long to wait
+func (l *Limiter) Allow(source string, now time.Time) (bool, time.Duration) {
+	if l.limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.limit.PerSource {
+		if l.shared == nil {
+			l.shared = NewBucket(l.limit.RequestsPerSecond, l.limit.Burst, now)
+		}
+		return l.shared.Take(now)
+	}
+
+	bucket, ok := l.sources[source]
+	if !ok {
+		if len(l.sources) >= maxIdleBuckets {
+			l.forgetFull(now)
+		}
+		bucket = NewBucket(l.limit.RequestsPerSecond, l.limit.Burst, now)
+		l.sources[source] = bucket
+	}
+	return bucket.Take(now)
+}
+
+// forgetFull drops the buckets of sources that have been quiet long enough to refill
+func (l *Limiter) forgetFull(now time.Time) {
+	for source, bucket := range l.sources {
+		if bucket.full(now) {
+			delete(l.sources, source)
+		}
+	}
+}
+
+// Policy holds the operator defaults and ceilings the limits requested for tunnels are resolved against
+type Policy struct {
+	// Default applies where a tunnel requests no rate or burst
+	Default Limit
+
+	// Max caps the requested rate and burst; zero fields leave them unbounded
+	Max Limit
+}
+
+// Resolve returns the limit a tunnel requesting requested gets.
+// Tunnels requesting no rate get the default, or the ceiling when there is no default.
+func (p Policy) Resolve(requested Limit) Limit {
+	rate := requested.RequestsPerSecond
+	if rate <= 0 {
+		rate = p.Default.RequestsPerSecond
+	}
+	if p.Max.RequestsPerSecond > 0 && (rate <= 0 || rate > p.Max.RequestsPerSecond) {
+		rate = p.Max.RequestsPerSecond
+	}
+	if rate <= 0 {
+		return Limit{}
+	}
+
+	burst := requested.Burst
+	if burst <= 0 {
+		burst = p.Default.Burst
+	}
+	if burst <= 0 {
+		// Allow one second worth of requests at once
+		burst = int(math.Ceil(rate))
+	}
+	if p.Max.Burst > 0 && burst > p.Max.Burst {
+		burst = p.Max.Burst
+	}
+
+	return Limit{
+		RequestsPerSecond: rate,
+		Burst:             burst,
+		PerSource:         requested.PerSource || p.Default.PerSource,
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_Take(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	bucket := NewBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := bucket.Take(now); !ok {
+			t.Fatalf("Expected request %d of the burst to pass", i+1)
+		}
+	}
+
+	ok, wait := bucket.Take(now)
+	if ok {
+		t.Fatal("Expected the request after the burst to be refused")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for a token at 2/s, got %v", wait)
+	}
+
+	if ok, _ := bucket.Take(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("Expected a request to pass once a token was added")
+	}
+	if ok, _ := bucket.Take(now.Add(500 * time.Millisecond)); ok {
+		t.Error("Expected the bucket to be empty again")
+	}
+
+	// An idle bucket refills up to its burst only
+	for i := 0; i < 3; i++ {
+		if ok, _ := bucket.Take(now.Add(time.Hour)); !ok {
+			t.Fatalf("Expected request %d after a long pause to pass", i+1)
+		}
+	}
+	if ok, _ := bucket.Take(now.Add(time.Hour)); ok {
+		t.Error("Expected the refilled bucket to hold no more than its burst")
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		limit     Limit
+		wantOther bool
+	}{
+		{name: "shared", limit: Limit{RequestsPerSecond: 1, Burst: 1}, wantOther: false},
+		{name: "per source", limit: Limit{RequestsPerSecond: 1, Burst: 1, PerSource: true}, wantOther: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(tt.limit)
+
+			if ok, _ := limiter.Allow("198.51.100.1", now); !ok {
+				t.Fatal("Expected the first request to pass")
+			}
+			if ok, _ := limiter.Allow("198.51.100.1", now); ok {
+				t.Error("Expected the second request from the same source to be refused")
+			}
+			if ok, _ := limiter.Allow("198.51.100.2", now); ok != tt.wantOther {
+				t.Errorf("Expected a request from another source to pass: %v, got %v", tt.wantOther, ok)
+			}
+		})
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	limiter := NewLimiter(Limit{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiter.Allow("198.51.100.1", time.Now()); !ok {
+			t.Fatal("Expected an unlimited limiter to allow every request")
+		}
+	}
+}
+
+func TestPolicy_Resolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		requested Limit
+		want      Limit
+	}{
+		{name: "no policy, no request", want: Limit{}},
+		{
+			name:      "request without policy",
+			requested: Limit{RequestsPerSecond: 5},
+			want:      Limit{RequestsPerSecond: 5, Burst: 5},
+		},
+		{
+			name:   "default applied",
+			policy: Policy{Default: Limit{RequestsPerSecond: 10, Burst: 20, PerSource: true}},
+			want:   Limit{RequestsPerSecond: 10, Burst: 20, PerSource: true},
+		},
+		{
+			name:      "request below the ceiling",
+			policy:    Policy{Default: Limit{RequestsPerSecond: 10}, Max: Limit{RequestsPerSecond: 50, Burst: 100}},
+			requested: Limit{RequestsPerSecond: 20, Burst: 40, PerSource: true},
+			want:      Limit{RequestsPerSecond: 20, Burst: 40, PerSource: true},
+		},
+		{
+			name:      "request above the ceiling",
+			policy:    Policy{Max: Limit{RequestsPerSecond: 50, Burst: 100}},
+			requested: Limit{RequestsPerSecond: 500, Burst: 1000},
+			want:      Limit{RequestsPerSecond: 50, Burst: 100},
+		},
+		{
+			name:   "ceiling without default",
+			policy: Policy{Max: Limit{RequestsPerSecond: 2.5}},
+			want:   Limit{RequestsPerSecond: 2.5, Burst: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Resolve(tt.requested); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
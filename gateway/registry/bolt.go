@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// tunnelsBucket is the bucket holding tunnels keyed by ID
+	tunnelsBucket = "tunnels"
+
+	// openTimeout bounds how long Open waits for the file lock held by another process
+	openTimeout = 5 * time.Second
+)
+
+// BoltRegistry is a TunnelRegistry persisted to a BoltDB file so tunnels survive restarts
+type BoltRegistry struct {
+	db *bolt.DB
+}
+
+// NewBoltRegistry opens (or creates) the registry stored at path
+func NewBoltRegistry(path string) (*BoltRegistry, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(tunnelsBucket))
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize registry %s: %w", path, err)
+	}
+
+	return &BoltRegistry{db: db}, nil
+}
+
+// Create registers a new tunnel
+func (b *BoltRegistry) Create(_ context.Context, tunnel *Tunnel) error {
+	data, err := json.Marshal(tunnel)
+	if err != nil {
+		return fmt.Errorf("failed to encode tunnel: %w", err)
+	}
+
+	return b.update(func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(tunnel.ID)) != nil {
+			return ErrAlreadyExists
+		}
+		return bucket.Put([]byte(tunnel.ID), data)
+	})
+}
+
+// Get returns the tunnel with the given ID
+func (b *BoltRegistry) Get(_ context.Context, id string) (*Tunnel, error) {
+	var tunnel *Tunnel
+	err := b.view(func(bucket *bolt.Bucket) error {
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var err error
+		tunnel, err = decodeTunnel(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// List returns all registered tunnels ordered by ID
+func (b *BoltRegistry) List(_ context.Context) ([]*Tunnel, error) {
+	tunnels := []*Tunnel{}
+	err := b.view(func(bucket *bolt.Bucket) error {
+		return bucket.ForEach(func(_, data []byte) error {
+			tunnel, err := decodeTunnel(data)
+			if err != nil {
+				return err
+			}
+			tunnels = append(tunnels, tunnel)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tunnels, nil
+}
+
+// Delete removes the tunnel with the given ID
+func (b *BoltRegistry) Delete(_ context.Context, id string) error {
+	return b.update(func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// Touch records a heartbeat for the tunnel with the given ID and marks it active
+func (b *BoltRegistry) Touch(_ context.Context, id string, at time.Time) error {
+	return b.modify(id, func(tunnel *Tunnel) {
+		tunnel.LastHeartbeat = at
+		tunnel.Inactive = false
+	})
+}
+
+// MarkInactive flags the tunnel with the given ID as inactive
+func (b *BoltRegistry) MarkInactive(_ context.Context, id string) error {
+	return b.modify(id, func(tunnel *Tunnel) {
+		tunnel.Inactive = true
+	})
+}
+
+// modify applies fn to the stored tunnel with the given ID in a single transaction
+func (b *BoltRegistry) modify(id string, fn func(tunnel *Tunnel)) error {
+	return b.update(func(bucket *bolt.Bucket) error {
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		tunnel, err := decodeTunnel(data)
+		if err != nil {
+			return err
+		}
+		fn(tunnel)
+		data, err = json.Marshal(tunnel)
+		if err != nil {
+			return fmt.Errorf("failed to encode tunnel: %w", err)
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// Close closes the underlying database file
+func (b *BoltRegistry) Close() error {
+	return b.db.Close()
+}
+
+// view runs fn in a read-only transaction on the tunnels bucket
+func (b *BoltRegistry) view(fn func(bucket *bolt.Bucket) error) error {
+	return mapClosed(b.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(tunnelsBucket)))
+	}))
+}
+
+// update runs fn in a read-write transaction on the tunnels bucket
+func (b *BoltRegistry) update(fn func(bucket *bolt.Bucket) error) error {
+	return mapClosed(b.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(tunnelsBucket)))
+	}))
+}
+
+// mapClosed translates bbolt's closed-database error to ErrRegistryClosed
+func mapClosed(err error) error {
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrRegistryClosed
+	}
+	return err
+}
+
+// decodeTunnel decodes a stored tunnel
+func decodeTunnel(data []byte) (*Tunnel, error) {
+	var tunnel Tunnel
+	if err := json.Unmarshal(data, &tunnel); err != nil {
+		return nil, fmt.Errorf("failed to decode tunnel: %w", err)
+	}
+	return &tunnel, nil
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRegistry is an in-memory TunnelRegistry.
+// Tunnels are lost when the process exits; use BoltRegistry to persist them.
+type MemoryRegistry struct {
+	mu      sync.RWMutex
+	tunnels map[string]*Tunnel
+	closed  bool
+}
+
+// NewMemoryRegistry creates a new empty in-memory registry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		tunnels: make(map[string]*Tunnel),
+	}
+}
+
+// Create registers a new tunnel
+func (m *MemoryRegistry) Create(_ context.Context, tunnel *Tunnel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrRegistryClosed
+	}
+	if _, exists := m.tunnels[tunnel.ID]; exists {
+		return ErrAlreadyExists
+	}
+	m.tunnels[tunnel.ID] = tunnel.clone()
+	return nil
+}
+
+// Get returns the tunnel with the given ID
+func (m *MemoryRegistry) Get(_ context.Context, id string) (*Tunnel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrRegistryClosed
+	}
+	tunnel, ok := m.tunnels[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return tunnel.clone(), nil
+}
+
+// List returns all registered tunnels ordered by ID
+func (m *MemoryRegistry) List(_ context.Context) ([]*Tunnel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrRegistryClosed
+	}
+	tunnels := make([]*Tunnel, 0, len(m.tunnels))
+	for _, tunnel := range m.tunnels {
+		tunnels = append(tunnels, tunnel.clone())
+	}
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].ID < tunnels[j].ID })
+	return tunnels, nil
+}
+
+// Delete removes the tunnel with the given ID
+func (m *MemoryRegistry) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrRegistryClosed
+	}
+	if _, ok := m.tunnels[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.tunnels, id)
+	return nil
+}
+
+// Touch records a heartbeat for the tunnel with the given ID and marks it active
+func (m *MemoryRegistry) Touch(_ context.Context, id string, at time.Time) error {
+	return m.modify(id, func(tunnel *Tunnel) {
+		tunnel.LastHeartbeat = at
+		tunnel.Inactive = false
+	})
+}
+
+// MarkInactive flags the tunnel with the given ID as inactive
+func (m *MemoryRegistry) MarkInactive(_ context.Context, id string) error {
+	return m.modify(id, func(tunnel *Tunnel) {
+		tunnel.Inactive = true
+	})
+}
+
+// modify applies fn to the stored tunnel with the given ID
+func (m *MemoryRegistry) modify(id string, fn func(tunnel *Tunnel)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrRegistryClosed
+	}
+	tunnel, ok := m.tunnels[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(tunnel)
+	return nil
+}
+
+// Close marks the registry as closed
+func (m *MemoryRegistry) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	return nil
+}
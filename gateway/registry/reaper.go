@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+const (
+	// DefaultHeartbeatTimeout is how long a tunnel may go without a heartbeat before it is marked inactive
+	DefaultHeartbeatTimeout = 90 * time.Second
+
+	// DefaultGracePeriod is how long an inactive tunnel keeps its subdomain before it is deleted
+	DefaultGracePeriod = 15 * time.Minute
+
+	// defaultExpiryInterval is the time between sweeps when only TTLs are enforced
+	defaultExpiryInterval = 30 * time.Second
+)
+
+// ReaperOptions contains configuration for the Reaper
+type ReaperOptions struct {
+	// Registry holds the tunnels to check
+	Registry TunnelRegistry
+
+	// Timeout is how long a tunnel may go without a heartbeat before it is marked inactive
+	// (optional, defaults to DefaultHeartbeatTimeout, negative to only delete tunnels past their TTL)
+	Timeout time.Duration
+
+	// GracePeriod is how long an inactive tunnel keeps its subdomain before it is deleted
+	// (optional, defaults to DefaultGracePeriod)
+	GracePeriod time.Duration
+
+	// Interval is the time between sweeps (optional, defaults to a third of Timeout, or 30s without one)
+	Interval time.Duration
+
+	// OnExpire is called after a tunnel is deleted, e.g. to close its open connections (optional)
+	OnExpire func(tunnelID string)
+
+	// Logger reports tunnels marked inactive or deleted (optional)
+	Logger *logging.Logger
+}
+
+// Reaper periodically marks tunnels whose client stopped sending heartbeats inactive,
+// and deletes them once the grace period has passed so their subdomain can be reused.
+// Tunnels that outlived their TTL are deleted right away.
+type Reaper struct {
+	registry    TunnelRegistry
+	timeout     time.Duration
+	gracePeriod time.Duration
+	interval    time.Duration
+	onExpire    func(tunnelID string)
+	logger      *logging.Logger
+}
+
+// NewReaper creates a new reaper
+func NewReaper(opts *ReaperOptions) *Reaper {
+	if opts == nil {
+		opts = &ReaperOptions{}
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultHeartbeatTimeout
+	}
+
+	gracePeriod := opts.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	interval := opts.Interval
+	if interval <= 0 && timeout > 0 {
+		interval = timeout / 3
+	}
+	if interval <= 0 {
+		interval = defaultExpiryInterval
+	}
+
+	reg := opts.Registry
+	if reg == nil {
+		reg = NewMemoryRegistry()
+	}
+
+	return &Reaper{
+		registry:    reg,
+		timeout:     timeout,
+		gracePeriod: gracePeriod,
+		interval:    interval,
+		onExpire:    opts.OnExpire,
+		logger:      opts.Logger,
+	}
+}
+
+// Run sweeps the registry every interval until ctx is cancelled
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, _, err := r.Sweep(ctx, time.Now().UTC()); err != nil && r.logger != nil {
+			r.logger.Error("Stale tunnel sweep failed", logging.Error(err))
+		}
+	}
+}
+
+// Sweep checks every tunnel against now and returns how many were marked inactive and deleted
+func (r *Reaper) Sweep(ctx context.Context, now time.Time) (inactive, expired int, err error) {
+	tunnels, err := r.registry.List(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	heartbeats := r.timeout > 0
+	for _, tunnel := range tunnels {
+		silence := now.Sub(tunnel.LastHeartbeat)
+
+		switch {
+		case tunnel.Expired(now):
+			deleted, err := r.delete(ctx, tunnel)
+			if err != nil {
+				return inactive, expired, err
+			}
+			if deleted {
+				expired++
+				r.log("Tunnel TTL elapsed, subdomain released", tunnel, silence)
+			}
+
+		case heartbeats && silence >= r.timeout+r.gracePeriod:
+			deleted, err := r.delete(ctx, tunnel)
+			if err != nil {
+				return inactive, expired, err
+			}
+			if deleted {
+				expired++
+				r.log("Stale tunnel deleted, subdomain released", tunnel, silence)
+			}
+
+		case heartbeats && silence >= r.timeout && !tunnel.Inactive:
+			err := r.registry.MarkInactive(ctx, tunnel.ID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return inactive, expired, err
+			}
+			inactive++
+			r.log("Tunnel missed its heartbeats, marked inactive", tunnel, silence)
+		}
+	}
+	return inactive, expired, nil
+}
+
+// delete removes a tunnel and notifies OnExpire, reporting false when it was already gone
+func (r *Reaper) delete(ctx context.Context, tunnel *Tunnel) (bool, error) {
+	err := r.registry.Delete(ctx, tunnel.ID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if r.onExpire != nil {
+		r.onExpire(tunnel.ID)
+	}
+	return true, nil
+}
+
+// log reports a state change of a tunnel
+func (r *Reaper) log(message string, tunnel *Tunnel, silence time.Duration) {
+	if r.logger == nil {
+		return
+	}
+	r.logger.Info(message,
+		logging.String("tunnel_id", tunnel.ID),
+		logging.String("owner", tunnel.Owner),
+		logging.String("last_heartbeat", tunnel.LastHeartbeat.Format(time.RFC3339)),
+		logging.String("silence", silence.Truncate(time.Second).String()))
+}
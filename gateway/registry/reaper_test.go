@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReaper_Sweep(t *testing.T) {
+	reg := NewMemoryRegistry()
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	heartbeats := map[string]time.Time{
+		"alive":   now.Add(-30 * time.Second),
+		"silent":  now.Add(-2 * time.Minute),
+		"expired": now.Add(-20 * time.Minute),
+	}
+	for id, at := range heartbeats {
+		tunnel := newTestTunnel(id)
+		tunnel.LastHeartbeat = at
+		if err := reg.Create(ctx, tunnel); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	var released []string
+	reaper := NewReaper(&ReaperOptions{
+		Registry:    reg,
+		Timeout:     time.Minute,
+		GracePeriod: 10 * time.Minute,
+		OnExpire:    func(tunnelID string) { released = append(released, tunnelID) },
+	})
+
+	inactive, expired, err := reaper.Sweep(ctx, now)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if inactive != 1 || expired != 1 {
+		t.Errorf("Expected 1 inactive and 1 expired tunnel, got %d and %d", inactive, expired)
+	}
+
+	if got, _ := reg.Get(ctx, "alive"); got.Inactive {
+		t.Error("Expected the tunnel with a recent heartbeat to stay active")
+	}
+	if got, _ := reg.Get(ctx, "silent"); !got.Inactive {
+		t.Error("Expected the tunnel that missed its heartbeats to be inactive")
+	}
+	if _, err := reg.Get(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the tunnel past its grace period to be deleted, got %v", err)
+	}
+	if len(released) != 1 || released[0] != "expired" {
+		t.Errorf("Expected OnExpire for the deleted tunnel, got %v", released)
+	}
+
+	// Tunnels already inactive are not reported again
+	if inactive, _, _ := reaper.Sweep(ctx, now); inactive != 0 {
+		t.Errorf("Expected no newly inactive tunnels, got %d", inactive)
+	}
+}
+
+func TestReaper_SweepExpiresTTL(t *testing.T) {
+	reg := NewMemoryRegistry()
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	expiries := map[string]time.Time{
+		"unlimited": {},
+		"valid":     now.Add(time.Minute),
+		"elapsed":   now.Add(-time.Second),
+	}
+	for id, at := range expiries {
+		tunnel := newTestTunnel(id)
+		tunnel.LastHeartbeat = now.Add(-24 * time.Hour)
+		tunnel.ExpiresAt = at
+		if err := reg.Create(ctx, tunnel); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	var released []string
+	// Heartbeat expiry is disabled, only TTLs are enforced
+	reaper := NewReaper(&ReaperOptions{
+		Registry: reg,
+		Timeout:  -1,
+		OnExpire: func(tunnelID string) { released = append(released, tunnelID) },
+	})
+
+	inactive, expired, err := reaper.Sweep(ctx, now)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if inactive != 0 || expired != 1 {
+		t.Errorf("Expected 0 inactive and 1 expired tunnel, got %d and %d", inactive, expired)
+	}
+	for _, id := range []string{"unlimited", "valid"} {
+		if got, err := reg.Get(ctx, id); err != nil || got.Inactive {
+			t.Errorf("Expected tunnel %s to stay registered and active, got %v", id, err)
+		}
+	}
+	if len(released) != 1 || released[0] != "elapsed" {
+		t.Errorf("Expected OnExpire for the elapsed tunnel, got %v", released)
+	}
+
+	if reaper.interval != defaultExpiryInterval {
+		t.Errorf("Expected the default interval %v without heartbeats, got %v", defaultExpiryInterval, reaper.interval)
+	}
+}
+
+func TestReaper_Run(t *testing.T) {
+	reg := NewMemoryRegistry()
+	tunnel := newTestTunnel("abc")
+	tunnel.LastHeartbeat = time.Now().Add(-time.Hour)
+	_ = reg.Create(context.Background(), tunnel)
+
+	expired := make(chan string, 1)
+	reaper := NewReaper(&ReaperOptions{
+		Registry:    reg,
+		Timeout:     time.Millisecond,
+		GracePeriod: time.Millisecond,
+		Interval:    10 * time.Millisecond,
+		OnExpire:    func(tunnelID string) { expired <- tunnelID },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reaper.Run(ctx)
+
+	select {
+	case id := <-expired:
+		if id != "abc" {
+			t.Errorf("Expected tunnel abc to expire, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the reaper to delete the stale tunnel")
+	}
+}
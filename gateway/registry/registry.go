@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a tunnel does not exist in the registry
+	ErrNotFound = errors.New("tunnel not found")
+	// ErrAlreadyExists is returned when creating a tunnel whose ID is already registered
+	ErrAlreadyExists = errors.New("tunnel already exists")
+	// ErrRegistryClosed is returned when using a closed registry
+	ErrRegistryClosed = errors.New("registry is closed")
+)
+
+// Tunnel is the state tying a public subdomain to its relay hybrid connection
+type Tunnel struct {
+	// ID is the tunnel ID, which is also its subdomain (e.g., "63873749")
+	ID string `json:"id"`
+
+	// HybridConnectionName is the relay hybrid connection traffic is forwarded to
+	HybridConnectionName string `json:"hybrid_connection_name"`
+
+	// SessionID identifies the client session that owns the tunnel
+	SessionID string `json:"session_id"`
+
+	// Owner identifies the caller that created the tunnel
+	Owner string `json:"owner,omitempty"`
+
+	// LocalPort is the local port reported by the client (informational)
+	LocalPort int `json:"local_port,omitempty"`
+
+	// CreatedAt is when the tunnel was registered
+	CreatedAt time.Time `json:"created_at"`
+
+	// LastHeartbeat is when the tunnel was last reported alive
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+
+	// Inactive is set when the client missed its heartbeats; the next heartbeat clears it
+	Inactive bool `json:"inactive,omitempty"`
+
+	// ExpiresAt is when the tunnel stops accepting traffic and is deleted (zero when it does not expire)
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// Multiplex is set when connections are carried as streams of one relay connection
+	Multiplex bool `json:"multiplex,omitempty"`
+
+	// RateLimit is the inbound request rate allowed, in requests per second (zero is unlimited)
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// RateBurst is how many requests may arrive at once
+	RateBurst int `json:"rate_burst,omitempty"`
+
+	// RateLimitPerIP applies the rate limit to each source IP separately
+	RateLimitPerIP bool `json:"rate_limit_per_ip,omitempty"`
+
+	// BasicAuthHash is the hash of the HTTP Basic credentials required on the public URL
+	// (empty when the tunnel is open)
+	BasicAuthHash string `json:"basic_auth_hash,omitempty"`
+
+	// AllowCIDRs and DenyCIDRs are the client IP ranges admitted to and refused from the tunnel
+	AllowCIDRs []string `json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `json:"deny_cidrs,omitempty"`
+}
+
+// TunnelRegistry stores tunnels by ID
+type TunnelRegistry interface {
+	// Create registers a new tunnel, failing with ErrAlreadyExists if its ID is taken
+	Create(ctx context.Context, tunnel *Tunnel) error
+
+	// Get returns the tunnel with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (*Tunnel, error)
+
+	// List returns all registered tunnels ordered by ID
+	List(ctx context.Context) ([]*Tunnel, error)
+
+	// Delete removes the tunnel with the given ID or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+
+	// Touch records a heartbeat for the tunnel with the given ID, marking it active again,
+	// or returns ErrNotFound
+	Touch(ctx context.Context, id string, at time.Time) error
+
+	// MarkInactive flags the tunnel with the given ID as inactive or returns ErrNotFound
+	MarkInactive(ctx context.Context, id string) error
+
+	// Close releases the resources held by the registry
+	Close() error
+}
+
+// Expired reports whether the tunnel has outlived its TTL at now
+func (t *Tunnel) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// clone returns a copy of the tunnel so callers cannot mutate stored state
+func (t *Tunnel) clone() *Tunnel {
+	c := *t
+	c.AllowCIDRs = slices.Clone(t.AllowCIDRs)
+	c.DenyCIDRs = slices.Clone(t.DenyCIDRs)
+	return &c
+}
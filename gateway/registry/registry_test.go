@@ -0,0 +1,272 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// registryFactories returns a constructor for every TunnelRegistry implementation
+func registryFactories(t *testing.T) map[string]func() TunnelRegistry {
+	return map[string]func() TunnelRegistry{
+		"memory": func() TunnelRegistry { return NewMemoryRegistry() },
+		"bolt": func() TunnelRegistry {
+			reg, err := NewBoltRegistry(filepath.Join(t.TempDir(), "tunnels.db"))
+			if err != nil {
+				t.Fatalf("Failed to open bolt registry: %v", err)
+			}
+			return reg
+		},
+	}
+}
+
+func newTestTunnel(id string) *Tunnel {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Tunnel{
+		ID:                   id,
+		HybridConnectionName: "hc-" + id,
+		SessionID:            "session-" + id,
+		LocalPort:            3000,
+		CreatedAt:            created,
+		LastHeartbeat:        created,
+		AllowCIDRs:           []string{"203.0.113.0/24"},
+		DenyCIDRs:            []string{"203.0.113.7/32"},
+	}
+}
+
+func TestRegistry_CreateGet(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			if err := reg.Create(ctx, newTestTunnel("abc")); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+
+			got, err := reg.Get(ctx, "abc")
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, newTestTunnel("abc")) {
+				t.Errorf("Expected %+v, got %+v", newTestTunnel("abc"), got)
+			}
+
+			if err := reg.Create(ctx, newTestTunnel("abc")); !errors.Is(err, ErrAlreadyExists) {
+				t.Errorf("Expected ErrAlreadyExists, got %v", err)
+			}
+			if _, err := reg.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistry_List(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			tunnels, err := reg.List(ctx)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if len(tunnels) != 0 {
+				t.Errorf("Expected empty registry, got %d tunnels", len(tunnels))
+			}
+
+			for _, id := range []string{"ccc", "aaa", "bbb"} {
+				if err := reg.Create(ctx, newTestTunnel(id)); err != nil {
+					t.Fatalf("Create failed: %v", err)
+				}
+			}
+
+			tunnels, err = reg.List(ctx)
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if len(tunnels) != 3 {
+				t.Fatalf("Expected 3 tunnels, got %d", len(tunnels))
+			}
+			for i, id := range []string{"aaa", "bbb", "ccc"} {
+				if tunnels[i].ID != id {
+					t.Errorf("Expected tunnel %d to be %q, got %q", i, id, tunnels[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_Delete(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			if err := reg.Create(ctx, newTestTunnel("abc")); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			if err := reg.Delete(ctx, "abc"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := reg.Get(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+			if err := reg.Delete(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistry_Touch(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			if err := reg.Create(ctx, newTestTunnel("abc")); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+
+			at := time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC)
+			if err := reg.Touch(ctx, "abc", at); err != nil {
+				t.Fatalf("Touch failed: %v", err)
+			}
+
+			got, err := reg.Get(ctx, "abc")
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if !got.LastHeartbeat.Equal(at) {
+				t.Errorf("Expected heartbeat %v, got %v", at, got.LastHeartbeat)
+			}
+			if !got.CreatedAt.Equal(newTestTunnel("abc").CreatedAt) {
+				t.Errorf("Expected CreatedAt to be unchanged, got %v", got.CreatedAt)
+			}
+
+			if err := reg.Touch(ctx, "missing", at); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistry_MarkInactive(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			if err := reg.Create(ctx, newTestTunnel("abc")); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+
+			if err := reg.MarkInactive(ctx, "abc"); err != nil {
+				t.Fatalf("MarkInactive failed: %v", err)
+			}
+			if got, _ := reg.Get(ctx, "abc"); !got.Inactive {
+				t.Error("Expected tunnel to be inactive")
+			}
+
+			// A heartbeat brings the tunnel back
+			if err := reg.Touch(ctx, "abc", time.Now()); err != nil {
+				t.Fatalf("Touch failed: %v", err)
+			}
+			if got, _ := reg.Get(ctx, "abc"); got.Inactive {
+				t.Error("Expected a heartbeat to mark the tunnel active")
+			}
+
+			if err := reg.MarkInactive(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistry_ReturnsCopies(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			defer func() { _ = reg.Close() }()
+			ctx := context.Background()
+
+			tunnel := newTestTunnel("abc")
+			if err := reg.Create(ctx, tunnel); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			tunnel.HybridConnectionName = "mutated"
+			tunnel.AllowCIDRs[0] = "0.0.0.0/0"
+
+			got, _ := reg.Get(ctx, "abc")
+			got.SessionID = "mutated"
+			got.DenyCIDRs[0] = "0.0.0.0/0"
+
+			got, _ = reg.Get(ctx, "abc")
+			if !reflect.DeepEqual(got, newTestTunnel("abc")) {
+				t.Errorf("Expected stored tunnel to be unaffected by caller mutation, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestRegistry_Closed(t *testing.T) {
+	for name, newRegistry := range registryFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry()
+			if err := reg.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			if _, err := reg.Get(context.Background(), "abc"); !errors.Is(err, ErrRegistryClosed) {
+				t.Errorf("Expected ErrRegistryClosed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBoltRegistry_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnels.db")
+	ctx := context.Background()
+
+	reg, err := NewBoltRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+	if err := reg.Create(ctx, newTestTunnel("abc")); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := reg.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reg, err = NewBoltRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	defer func() { _ = reg.Close() }()
+
+	got, err := reg.Get(ctx, "abc")
+	if err != nil {
+		t.Fatalf("Expected tunnel to survive reopen, got %v", err)
+	}
+	if !reflect.DeepEqual(got, newTestTunnel("abc")) {
+		t.Errorf("Expected %+v, got %+v", newTestTunnel("abc"), got)
+	}
+}
+
+func TestNewBoltRegistry_InvalidPath(t *testing.T) {
+	_, err := NewBoltRegistry(filepath.Join(t.TempDir(), "missing", "tunnels.db"))
+	if err == nil {
+		t.Error("Expected error opening a registry in a missing directory")
+	}
+}
@@ -0,0 +1,282 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+const (
+	// poolMinRetry is the first delay before refilling again after a failed dial
+	poolMinRetry = 500 * time.Millisecond
+
+	// poolMaxRetry caps the delay between failed refill dials, e.g. while the listener is offline
+	poolMaxRetry = 30 * time.Second
+)
+
+// PoolStats reports the activity of a relay connection pool
+type PoolStats struct {
+	// Size is how many idle connections the pool keeps
+	Size int
+
+	// Idle is how many connections are currently ready to use
+	Idle int
+
+	// Hits counts connections served from the pool
+	Hits uint64
+
+	// Misses counts connections dialed on demand because the pool was empty
+	Misses uint64
+
+	// Evictions counts idle connections dropped because the relay or listener closed them
+	Evictions uint64
+
+	// Dials and DialFailures count every relay dial, both refills and misses
+	Dials        uint64
+	DialFailures uint64
+
+	// DialLatency is the average duration of successful dials
+	DialLatency time.Duration
+}
+
+// pool is a relay.Sender that keeps idle relay connections dialed ahead of demand.
+// A background goroutine tops the pool up after every hit and whenever an idle connection dies.
+type pool struct {
+	relay  relay.Sender
+	size   int
+	refill chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	idle        []*pooledConn
+	closed      bool
+	stats       PoolStats
+	dialLatency time.Duration
+}
+
+// newPool creates a pool of size idle connections dialed from r and starts filling it
+func newPool(r relay.Sender, size int) *pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pool{
+		relay:  r,
+		size:   size,
+		refill: make(chan struct{}, 1),
+		cancel: cancel,
+	}
+	p.stats.Size = size
+
+	p.wg.Add(1)
+	go p.fill(ctx)
+	p.signal()
+	return p
+}
+
+// Dial returns an idle connection when one is ready and dials the relay otherwise
+func (p *pool) Dial(ctx context.Context) (relay.Connection, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, relay.ErrSenderClosed
+	}
+	if n := len(p.idle); n > 0 {
+		// The most recently dialed connection is the least likely to have gone stale
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		conn.taken = true
+		p.stats.Hits++
+		p.mu.Unlock()
+
+		p.signal()
+		return conn, nil
+	}
+	p.stats.Misses++
+	p.mu.Unlock()
+
+	p.signal()
+	return p.dial(ctx)
+}
+
+// Stats returns a snapshot of the pool counters
+func (p *pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	if successes := stats.Dials - stats.DialFailures; successes > 0 {
+		stats.DialLatency = p.dialLatency / time.Duration(successes)
+	}
+	return stats
+}
+
+// Close stops refilling, closes the idle connections and the underlying sender.
+// Connections already handed out stay open until their users close them.
+func (p *pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+	for _, conn := range idle {
+		_ = conn.Connection.Close()
+	}
+	return p.relay.Close()
+}
+
+// signal wakes the fill goroutine without blocking
+func (p *pool) signal() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+// dial dials the relay and records the outcome
+func (p *pool) dial(ctx context.Context) (relay.Connection, error) {
+	start := time.Now()
+	conn, err := p.relay.Dial(ctx)
+	elapsed := time.Since(start)
+
+	p.mu.Lock()
+	p.stats.Dials++
+	if err != nil {
+		p.stats.DialFailures++
+	} else {
+		p.dialLatency += elapsed
+	}
+	p.mu.Unlock()
+	return conn, err
+}
+
+// fill dials connections until the pool is full each time it is signalled, backing off while dials fail
+func (p *pool) fill(ctx context.Context) {
+	defer p.wg.Done()
+
+	retry := poolMinRetry
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.refill:
+		}
+
+		for p.missing() > 0 {
+			conn, err := p.dial(ctx)
+			if err != nil {
+				timer := time.NewTimer(retry)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				retry = min(2*retry, poolMaxRetry)
+				continue
+			}
+			retry = poolMinRetry
+
+			if !p.add(conn) {
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// missing returns how many connections the pool needs to be full
+func (p *pool) missing() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0
+	}
+	return p.size - len(p.idle)
+}
+
+// add makes conn available and starts watching it, reporting false when the pool is closed
+func (p *pool) add(conn relay.Connection) bool {
+	pooled := &pooledConn{Connection: conn, result: make(chan readResult, 1), pending: true}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.idle = append(p.idle, pooled)
+	go p.watch(pooled)
+	return true
+}
+
+// watch blocks reading from an idle connection. The peer does not send anything before the gateway
+// writes a request, so a read completing while the connection is idle means it is dead and is evicted.
+// Once the connection is handed out, the outcome of the read is passed on to its user.
+func (p *pool) watch(conn *pooledConn) {
+	var buf [1]byte
+	n, err := conn.Connection.Read(buf[:])
+
+	p.mu.Lock()
+	if conn.taken {
+		p.mu.Unlock()
+		conn.result <- readResult{b: buf[0], n: n, err: err}
+		return
+	}
+	for i, idle := range p.idle {
+		if idle == conn {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			p.stats.Evictions++
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	_ = conn.Connection.Close()
+	p.signal()
+}
+
+// readResult is the outcome of the read a pool performs on an idle connection
+type readResult struct {
+	b   byte
+	n   int
+	err error
+}
+
+// pooledConn is a relay connection dialed ahead of demand.
+// Its first Read returns the outcome of the read started while it was idle.
+type pooledConn struct {
+	relay.Connection
+
+	result  chan readResult
+	pending bool
+
+	// taken is set when the connection leaves the pool, guarded by the pool mutex
+	taken bool
+}
+
+// Read returns the byte read while the connection was idle before reading further
+func (c *pooledConn) Read(p []byte) (int, error) {
+	if !c.pending {
+		return c.Connection.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	c.pending = false
+	result := <-c.result
+	if result.n > 0 {
+		p[0] = result.b
+	}
+	return result.n, result.err
+}
@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// echoListener accepts relay connections, echoing their data, and keeps them for inspection
+type echoListener struct {
+	mu    sync.Mutex
+	conns []relay.Connection
+}
+
+// newEchoListener starts accepting on a memory listener and returns a sender dialing it
+func newEchoListener(t *testing.T) (*echoListener, *relay.MemorySender) {
+	t.Helper()
+
+	memoryListener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = memoryListener.Close() })
+
+	echo := &echoListener{}
+	go func() {
+		for {
+			conn, err := memoryListener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			echo.mu.Lock()
+			echo.conns = append(echo.conns, conn)
+			echo.mu.Unlock()
+			go func() { _, _ = io.Copy(conn, conn) }()
+		}
+	}()
+	return echo, relay.NewMemorySender(memoryListener)
+}
+
+// waitAccepted waits until n connections were accepted and returns them
+func (e *echoListener) waitAccepted(t *testing.T, n int) []relay.Connection {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.Lock()
+		conns := append([]relay.Connection(nil), e.conns...)
+		e.mu.Unlock()
+		if len(conns) >= n {
+			return conns
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d accepted connections, got %d", n, len(conns))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForStats polls the pool until cond holds
+func waitForStats(t *testing.T, sender *Sender, cond func(PoolStats) bool) PoolStats {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, _ := sender.PoolStats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for pool stats, last %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_ServesIdleConnections(t *testing.T) {
+	_, memorySender := newEchoListener(t)
+	sender := NewSender(&Options{Relay: memorySender}).Pooled(2)
+	defer func() { _ = sender.Close() }()
+
+	waitForStats(t, sender, func(s PoolStats) bool { return s.Idle == 2 })
+
+	conn, err := sender.relay.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Expected echo %q, got %q (%v)", "hello", string(buf), err)
+	}
+
+	// The pool is topped up after the hit
+	stats := waitForStats(t, sender, func(s PoolStats) bool { return s.Idle == 2 })
+	if stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Expected 1 hit and 0 misses, got %d and %d", stats.Hits, stats.Misses)
+	}
+	if stats.Dials != 3 {
+		t.Errorf("Expected 3 relay dials, got %d", stats.Dials)
+	}
+	if stats.DialLatency <= 0 {
+		t.Errorf("Expected a dial latency to be recorded, got %v", stats.DialLatency)
+	}
+}
+
+func TestPool_EvictsDeadConnections(t *testing.T) {
+	echo, memorySender := newEchoListener(t)
+	sender := NewSender(&Options{Relay: memorySender}).Pooled(1)
+	defer func() { _ = sender.Close() }()
+
+	waitForStats(t, sender, func(s PoolStats) bool { return s.Idle == 1 })
+
+	// The listener side drops the idle connection
+	_ = echo.waitAccepted(t, 1)[0].Close()
+
+	stats := waitForStats(t, sender, func(s PoolStats) bool { return s.Evictions == 1 && s.Idle == 1 })
+	if stats.Dials != 2 {
+		t.Errorf("Expected the evicted connection to be replaced, got %d dials", stats.Dials)
+	}
+}
+
+func TestPool_MissDialsOnDemand(t *testing.T) {
+	memoryListener := relay.NewMemoryListener()
+	_ = memoryListener.Close()
+
+	sender := NewSender(&Options{Relay: relay.NewMemorySender(memoryListener)}).Pooled(1)
+	defer func() { _ = sender.Close() }()
+
+	if _, err := sender.relay.Dial(context.Background()); !errors.Is(err, relay.ErrListenerClosed) {
+		t.Errorf("Expected the on-demand dial error, got %v", err)
+	}
+
+	stats, ok := sender.PoolStats()
+	if !ok {
+		t.Fatal("Expected pool stats for a pooled sender")
+	}
+	if stats.Misses != 1 || stats.Hits != 0 {
+		t.Errorf("Expected 1 miss and 0 hits, got %d and %d", stats.Misses, stats.Hits)
+	}
+	if stats.DialFailures == 0 || stats.Idle != 0 {
+		t.Errorf("Expected failed dials and an empty pool, got %+v", stats)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	echo, memorySender := newEchoListener(t)
+	sender := NewSender(&Options{Relay: memorySender}).Pooled(1)
+
+	waitForStats(t, sender, func(s PoolStats) bool { return s.Idle == 1 })
+	_ = sender.Close()
+
+	if _, err := sender.relay.Dial(context.Background()); !errors.Is(err, relay.ErrSenderClosed) {
+		t.Errorf("Expected ErrSenderClosed, got %v", err)
+	}
+	// Idle connections are closed with the pool
+	if _, err := echo.waitAccepted(t, 1)[0].Read(make([]byte, 1)); err == nil {
+		t.Error("Expected the idle connection to be closed")
+	}
+}
+
+func TestSender_PoolStatsWithoutPool(t *testing.T) {
+	sender := NewSender(nil)
+	if _, ok := sender.PoolStats(); ok {
+		t.Error("Expected no pool stats for an unpooled sender")
+	}
+}
@@ -2,16 +2,24 @@ package relay
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 
 	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/mux"
 	"github.com/julienstroheker/AzHexGate/internal/relay"
 )
 
+// ErrDialFailed is returned by Dial and ForwardRequestRaw when no relay connection could be opened.
+// No bytes have been exchanged with the client connection when it is returned.
+var ErrDialFailed = errors.New("failed to dial relay")
+
 // Sender handles outgoing connections to the relay and forwards traffic
 type Sender struct {
 	relay relay.Sender
+	pool  *pool
 }
 
 // Options contains configuration for the Sender
@@ -31,6 +39,37 @@ func NewSender(opts *Options) *Sender {
 	}
 }
 
+// Multiplexed returns a sender that opens every connection as a stream of one relay connection.
+// The returned sender takes ownership of the underlying relay sender; s must not be used afterwards.
+func (s *Sender) Multiplexed() *Sender {
+	return &Sender{relay: mux.NewSender(s.relay, nil)}
+}
+
+// Pooled returns a sender that keeps size idle relay connections dialed ahead of demand,
+// so forwarded requests skip the relay rendezvous. The returned sender takes ownership of the
+// underlying relay sender; s must not be used afterwards.
+func (s *Sender) Pooled(size int) *Sender {
+	p := newPool(s.relay, size)
+	return &Sender{relay: p, pool: p}
+}
+
+// PoolStats returns the activity of the connection pool, or false when the sender is not pooled
+func (s *Sender) PoolStats() (PoolStats, bool) {
+	if s.pool == nil {
+		return PoolStats{}, false
+	}
+	return s.pool.Stats(), true
+}
+
+// Dial opens a relay connection to the listener
+func (s *Sender) Dial(ctx context.Context) (relay.Connection, error) {
+	relayConn, err := s.relay.Dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDialFailed, err)
+	}
+	return relayConn, nil
+}
+
 // ForwardRequestRaw forwards traffic through the relay using raw TCP connection
 // This method provides bidirectional streaming between the client and relay,
 // maintaining a transparent tunnel that mirrors the behavior of client/tunnel/listener.go
@@ -40,7 +79,7 @@ func (s *Sender) ForwardRequestRaw(ctx context.Context, clientConn net.Conn, log
 	}
 
 	// Dial the relay to create a connection
-	relayConn, err := s.relay.Dial(ctx)
+	relayConn, err := s.Dial(ctx)
 	if err != nil {
 		if logger != nil {
 			logger.Error("Failed to dial relay", logging.Error(err))
@@ -3,6 +3,7 @@ package relay
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -284,6 +285,29 @@ func TestSender_ForwardRequestListenerOffline(t *testing.T) {
 	}
 }
 
+func TestSender_ForwardRequestRawDialFailed(t *testing.T) {
+	memoryListener := relay.NewMemoryListener()
+	_ = memoryListener.Close()
+	memorySender := relay.NewMemorySender(memoryListener)
+
+	sender := NewSender(&Options{
+		Relay: memorySender,
+	})
+	defer func() { _ = sender.Close() }()
+
+	clientConn, peerConn := net.Pipe()
+	defer func() { _ = clientConn.Close() }()
+	defer func() { _ = peerConn.Close() }()
+
+	err := sender.ForwardRequestRaw(context.Background(), clientConn, nil)
+	if !errors.Is(err, ErrDialFailed) {
+		t.Fatalf("Expected ErrDialFailed, got %v", err)
+	}
+	if !errors.Is(err, relay.ErrListenerClosed) {
+		t.Errorf("Expected underlying relay error to be wrapped, got %v", err)
+	}
+}
+
 func TestSender_ForwardRequestMultipleRequests(t *testing.T) {
 	requestCount := 0
 	var mu sync.Mutex
@@ -1,10 +1,149 @@
 package api
 
+import "time"
+
+// APIKeyHeader is the header clients authenticate Gateway API calls with
+const APIKeyHeader = "X-AzHexGate-ApiKey"
+
+// CreateTunnelRequest represents the request body of the Gateway API tunnel creation endpoint
+type CreateTunnelRequest struct {
+	// LocalPort is the local port the client forwards traffic to
+	LocalPort int `json:"local_port"`
+
+	// Name is an optional hint used as a prefix of the generated subdomain
+	Name string `json:"name,omitempty"`
+
+	// TunnelID and SessionID resume an existing session with a fresh listener token (optional).
+	// When the tunnel no longer exists, a new one is created.
+	TunnelID  string `json:"tunnel_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+
+	// Multiplex asks the gateway to carry all public connections as streams of one relay
+	// connection instead of a relay connection each (optional)
+	Multiplex bool `json:"multiplex,omitempty"`
+
+	// TTL is the requested lifetime of the tunnel in seconds (optional).
+	// The gateway caps it to its maximum; zero requests the maximum.
+	TTL int `json:"ttl,omitempty"`
+
+	// RateLimit bounds inbound requests to the tunnel (optional).
+	// The gateway fills in its defaults and caps the values to its ceilings.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
+	// BasicAuth protects the public URL with HTTP Basic authentication (optional).
+	// The gateway keeps only a hash of the credentials.
+	BasicAuth *BasicAuth `json:"basic_auth,omitempty"`
+
+	// AllowCIDRs restricts the tunnel to client IPs in these ranges (optional).
+	// Entries are CIDR ranges or single IP addresses.
+	AllowCIDRs []string `json:"allow_cidrs,omitempty"`
+
+	// DenyCIDRs refuses client IPs in these ranges, even when they are allowed (optional)
+	DenyCIDRs []string `json:"deny_cidrs,omitempty"`
+}
+
+// BasicAuth holds the credentials visitors of a protected tunnel must present
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RateLimit is a token bucket limit on the requests reaching a tunnel
+type RateLimit struct {
+	// RequestsPerSecond is the sustained request rate
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+
+	// Burst is how many requests may arrive at once
+	Burst int `json:"burst,omitempty"`
+
+	// PerIP applies the limit to each source IP separately instead of the whole tunnel
+	PerIP bool `json:"per_ip,omitempty"`
+}
+
 // TunnelResponse represents the response from the Gateway API tunnel creation endpoint
 type TunnelResponse struct {
+	TunnelID             string `json:"tunnel_id"`
 	PublicURL            string `json:"public_url"`
 	RelayEndpoint        string `json:"relay_endpoint"`
 	HybridConnectionName string `json:"hybrid_connection_name"`
 	ListenerToken        string `json:"listener_token"`
 	SessionID            string `json:"session_id"`
+
+	// Multiplex reports whether the gateway multiplexes connections; the listener must match it
+	Multiplex bool `json:"multiplex,omitempty"`
+
+	// HeartbeatInterval is how often, in seconds, the client should report the tunnel alive
+	HeartbeatInterval int `json:"heartbeat_interval,omitempty"`
+
+	// ExpiresAt is when the gateway stops routing to the tunnel and closes its connections
+	// (zero when the tunnel does not expire)
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// RateLimit is the limit the gateway enforces on requests to the tunnel (nil when unlimited)
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
+	// BasicAuth reports whether the gateway requires HTTP Basic authentication on the public URL
+	BasicAuth bool `json:"basic_auth,omitempty"`
+
+	// AllowCIDRs and DenyCIDRs are the client IP ranges the gateway admits and refuses, normalized
+	AllowCIDRs []string `json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `json:"deny_cidrs,omitempty"`
+}
+
+// QuotaErrorResponse is the body of a tunnel creation refused because a quota of the API key is exhausted.
+// It is returned with 403 Forbidden for the concurrent tunnel limit and 429 Too Many Requests,
+// with a Retry-After header, for the creation rate limit.
+type QuotaErrorResponse struct {
+	Error      string `json:"error"`
+	Quota      string `json:"quota"`
+	Limit      int    `json:"limit"`
+	Current    int    `json:"current"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// HeartbeatRequest represents the request body of the Gateway API tunnel heartbeat endpoint
+type HeartbeatRequest struct {
+	// SessionID is the session returned when the tunnel was created
+	SessionID string `json:"session_id"`
+}
+
+// TunnelInfo describes a registered tunnel returned by the Gateway API lifecycle endpoints
+type TunnelInfo struct {
+	TunnelID             string     `json:"tunnel_id"`
+	PublicURL            string     `json:"public_url"`
+	HybridConnectionName string     `json:"hybrid_connection_name"`
+	Owner                string     `json:"owner,omitempty"`
+	LocalPort            int        `json:"local_port,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	LastHeartbeat        time.Time  `json:"last_heartbeat"`
+	Active               bool       `json:"active"`
+	ExpiresAt            time.Time  `json:"expires_at,omitzero"`
+	Multiplex            bool       `json:"multiplex,omitempty"`
+	RateLimit            *RateLimit `json:"rate_limit,omitempty"`
+	BasicAuth            bool       `json:"basic_auth,omitempty"`
+	AllowCIDRs           []string   `json:"allow_cidrs,omitempty"`
+	DenyCIDRs            []string   `json:"deny_cidrs,omitempty"`
+}
+
+// TunnelListResponse represents the response from the Gateway API tunnel list endpoint
+type TunnelListResponse struct {
+	Tunnels []TunnelInfo `json:"tunnels"`
+}
+
+// RelayPoolStats reports the activity of the relay connection pool of a tunnel
+type RelayPoolStats struct {
+	TunnelID      string  `json:"tunnel_id"`
+	Size          int     `json:"size"`
+	Idle          int     `json:"idle"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	Evictions     uint64  `json:"evictions"`
+	Dials         uint64  `json:"dials"`
+	DialFailures  uint64  `json:"dial_failures"`
+	DialLatencyMs float64 `json:"dial_latency_ms"`
+}
+
+// RelayPoolStatsResponse represents the response from the Gateway API relay pool endpoint
+type RelayPoolStatsResponse struct {
+	Pools []RelayPoolStats `json:"pools"`
 }
@@ -14,9 +14,57 @@ type Config struct {
 	// APIKey is the authentication key for the Management API
 	APIKey string
 
+	// APIKeys are additional keys the gateway accepts, as comma-separated "[id] <key|sha256:hex>" entries
+	APIKeys string
+
+	// APIKeysFile is a file of API keys the gateway accepts, one "[id] <key|sha256:hex>" entry per line
+	APIKeysFile string
+
+	// APIKeyQuotas are comma-separated per-key quota overrides,
+	// "<key-id> max_tunnels=<n> creations_per_hour=<n> max_ttl=<seconds>" entries
+	APIKeyQuotas string
+
+	// OIDCIssuer is the OpenID Connect provider bearer tokens are issued by, e.g. "https://login.example.com/v2.0"
+	OIDCIssuer string
+
+	// OIDCAudience is the audience the gateway requires in bearer tokens
+	OIDCAudience string
+
+	// OIDCJWKSURL is where the provider publishes its signing keys (discovered from the issuer when empty)
+	OIDCJWKSURL string
+
+	// OIDCClientID is the client ID the CLI logs in with
+	OIDCClientID string
+
+	// TokenFile is where the CLI stores the tokens obtained by login
+	// (defaults to azhexgate/token.json in the user config directory)
+	TokenFile string
+
 	// RelayNamespace is the Azure Relay namespace URL
 	RelayNamespace string
 
+	// RelayKeyName is the name of the shared access policy the gateway signs its Relay sender tokens with
+	RelayKeyName string
+
+	// RelayKey is the shared access key the gateway signs its Relay sender tokens with
+	RelayKey string
+
+	// RelayListenKeyName is the name of the listen-only shared access policy used to sign client listener tokens
+	RelayListenKeyName string
+
+	// RelayListenKey is the listen-only shared access key used to sign client listener tokens
+	RelayListenKey string
+
+	// BaseDomain is the domain public tunnel URLs are created under
+	BaseDomain string
+
+	// RegistryPath is the file the gateway persists tunnels to (in-memory when empty)
+	RegistryPath string
+
+	// TrustedProxies are comma-separated IPs and CIDR ranges of upstream proxies whose
+	// forwarding headers the gateway keeps
+	TrustedProxies string
+
 	// LogLevel controls logging verbosity (debug, info, warn, error)
 	LogLevel string
 }
@@ -25,10 +73,25 @@ type Config struct {
 // and applying defaults where values are not set
 func Load() *Config {
 	return &Config{
-		APIBaseURL:     getEnvOrDefault("AZHEXGATE_API_URL", ""),
-		APIKey:         getEnvOrDefault("AZHEXGATE_API_KEY", ""),
-		RelayNamespace: getEnvOrDefault("AZHEXGATE_RELAY_NAMESPACE", ""),
-		LogLevel:       getEnvOrDefault("AZHEXGATE_LOG_LEVEL", "info"),
+		APIBaseURL:         getEnvOrDefault("AZHEXGATE_API_URL", ""),
+		APIKey:             getEnvOrDefault("AZHEXGATE_API_KEY", ""),
+		APIKeys:            getEnvOrDefault("AZHEXGATE_API_KEYS", ""),
+		APIKeysFile:        getEnvOrDefault("AZHEXGATE_API_KEYS_FILE", ""),
+		APIKeyQuotas:       getEnvOrDefault("AZHEXGATE_API_KEY_QUOTAS", ""),
+		OIDCIssuer:         getEnvOrDefault("AZHEXGATE_OIDC_ISSUER", ""),
+		OIDCAudience:       getEnvOrDefault("AZHEXGATE_OIDC_AUDIENCE", ""),
+		OIDCJWKSURL:        getEnvOrDefault("AZHEXGATE_OIDC_JWKS_URL", ""),
+		OIDCClientID:       getEnvOrDefault("AZHEXGATE_OIDC_CLIENT_ID", ""),
+		TokenFile:          getEnvOrDefault("AZHEXGATE_TOKEN_FILE", ""),
+		RelayNamespace:     getEnvOrDefault("AZHEXGATE_RELAY_NAMESPACE", ""),
+		RelayKeyName:       getEnvOrDefault("AZHEXGATE_RELAY_KEY_NAME", "RootManageSharedAccessKey"),
+		RelayKey:           getEnvOrDefault("AZHEXGATE_RELAY_KEY", ""),
+		RelayListenKeyName: getEnvOrDefault("AZHEXGATE_RELAY_LISTEN_KEY_NAME", "Listen"),
+		RelayListenKey:     getEnvOrDefault("AZHEXGATE_RELAY_LISTEN_KEY", ""),
+		BaseDomain:         getEnvOrDefault("AZHEXGATE_BASE_DOMAIN", "azhexgate.com"),
+		RegistryPath:       getEnvOrDefault("AZHEXGATE_REGISTRY_PATH", ""),
+		TrustedProxies:     getEnvOrDefault("AZHEXGATE_TRUSTED_PROXIES", ""),
+		LogLevel:           getEnvOrDefault("AZHEXGATE_LOG_LEVEL", "info"),
 	}
 }
 
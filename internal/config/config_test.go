@@ -11,7 +11,27 @@ func TestLoad(t *testing.T) {
 	originalAPIKey := os.Getenv("AZHEXGATE_API_KEY")
 	originalRelay := os.Getenv("AZHEXGATE_RELAY_NAMESPACE")
 	originalLogLevel := os.Getenv("AZHEXGATE_LOG_LEVEL")
+	originalRelayKeyName := os.Getenv("AZHEXGATE_RELAY_KEY_NAME")
+	originalRelayKey := os.Getenv("AZHEXGATE_RELAY_KEY")
+	originalRelayListenKeyName := os.Getenv("AZHEXGATE_RELAY_LISTEN_KEY_NAME")
+	originalRelayListenKey := os.Getenv("AZHEXGATE_RELAY_LISTEN_KEY")
+	originalBaseDomain := os.Getenv("AZHEXGATE_BASE_DOMAIN")
+	originalRegistryPath := os.Getenv("AZHEXGATE_REGISTRY_PATH")
+	originalAPIKeys := os.Getenv("AZHEXGATE_API_KEYS")
+	originalAPIKeysFile := os.Getenv("AZHEXGATE_API_KEYS_FILE")
+	originalTrustedProxies := os.Getenv("AZHEXGATE_TRUSTED_PROXIES")
+	originalAPIKeyQuotas := os.Getenv("AZHEXGATE_API_KEY_QUOTAS")
 	defer func() {
+		_ = os.Setenv("AZHEXGATE_API_KEY_QUOTAS", originalAPIKeyQuotas)
+		_ = os.Setenv("AZHEXGATE_TRUSTED_PROXIES", originalTrustedProxies)
+		_ = os.Setenv("AZHEXGATE_API_KEYS", originalAPIKeys)
+		_ = os.Setenv("AZHEXGATE_API_KEYS_FILE", originalAPIKeysFile)
+		_ = os.Setenv("AZHEXGATE_REGISTRY_PATH", originalRegistryPath)
+		_ = os.Setenv("AZHEXGATE_BASE_DOMAIN", originalBaseDomain)
+		_ = os.Setenv("AZHEXGATE_RELAY_KEY_NAME", originalRelayKeyName)
+		_ = os.Setenv("AZHEXGATE_RELAY_KEY", originalRelayKey)
+		_ = os.Setenv("AZHEXGATE_RELAY_LISTEN_KEY_NAME", originalRelayListenKeyName)
+		_ = os.Setenv("AZHEXGATE_RELAY_LISTEN_KEY", originalRelayListenKey)
 		_ = os.Setenv("AZHEXGATE_API_URL", originalAPIURL)
 		_ = os.Setenv("AZHEXGATE_API_KEY", originalAPIKey)
 		_ = os.Setenv("AZHEXGATE_RELAY_NAMESPACE", originalRelay)
@@ -23,6 +43,16 @@ func TestLoad(t *testing.T) {
 	_ = os.Unsetenv("AZHEXGATE_API_KEY")
 	_ = os.Unsetenv("AZHEXGATE_RELAY_NAMESPACE")
 	_ = os.Unsetenv("AZHEXGATE_LOG_LEVEL")
+	_ = os.Unsetenv("AZHEXGATE_RELAY_KEY_NAME")
+	_ = os.Unsetenv("AZHEXGATE_RELAY_KEY")
+	_ = os.Unsetenv("AZHEXGATE_RELAY_LISTEN_KEY_NAME")
+	_ = os.Unsetenv("AZHEXGATE_RELAY_LISTEN_KEY")
+	_ = os.Unsetenv("AZHEXGATE_BASE_DOMAIN")
+	_ = os.Unsetenv("AZHEXGATE_REGISTRY_PATH")
+	_ = os.Unsetenv("AZHEXGATE_API_KEYS")
+	_ = os.Unsetenv("AZHEXGATE_API_KEYS_FILE")
+	_ = os.Unsetenv("AZHEXGATE_TRUSTED_PROXIES")
+	_ = os.Unsetenv("AZHEXGATE_API_KEY_QUOTAS")
 
 	t.Run("defaults", func(t *testing.T) {
 		cfg := Load()
@@ -39,6 +69,31 @@ func TestLoad(t *testing.T) {
 		if cfg.LogLevel != "info" {
 			t.Errorf("Expected default LogLevel 'info', got: %s", cfg.LogLevel)
 		}
+		if cfg.RelayKeyName != "RootManageSharedAccessKey" {
+			t.Errorf("Expected default RelayKeyName 'RootManageSharedAccessKey', got: %s", cfg.RelayKeyName)
+		}
+		if cfg.RelayKey != "" {
+			t.Errorf("Expected empty RelayKey, got: %s", cfg.RelayKey)
+		}
+		if cfg.RelayListenKeyName != "Listen" || cfg.RelayListenKey != "" {
+			t.Errorf("Expected default RelayListenKeyName 'Listen' and empty RelayListenKey, got: %s, %s",
+				cfg.RelayListenKeyName, cfg.RelayListenKey)
+		}
+		if cfg.BaseDomain != "azhexgate.com" {
+			t.Errorf("Expected default BaseDomain 'azhexgate.com', got: %s", cfg.BaseDomain)
+		}
+		if cfg.RegistryPath != "" {
+			t.Errorf("Expected empty RegistryPath, got: %s", cfg.RegistryPath)
+		}
+		if cfg.APIKeys != "" || cfg.APIKeysFile != "" {
+			t.Errorf("Expected empty APIKeys and APIKeysFile, got: %s, %s", cfg.APIKeys, cfg.APIKeysFile)
+		}
+		if cfg.TrustedProxies != "" {
+			t.Errorf("Expected empty TrustedProxies, got: %s", cfg.TrustedProxies)
+		}
+		if cfg.APIKeyQuotas != "" {
+			t.Errorf("Expected empty APIKeyQuotas, got: %s", cfg.APIKeyQuotas)
+		}
 	})
 
 	t.Run("from environment", func(t *testing.T) {
@@ -46,6 +101,16 @@ func TestLoad(t *testing.T) {
 		_ = os.Setenv("AZHEXGATE_API_KEY", "test-key-123")
 		_ = os.Setenv("AZHEXGATE_RELAY_NAMESPACE", "test-relay.servicebus.windows.net")
 		_ = os.Setenv("AZHEXGATE_LOG_LEVEL", "debug")
+		_ = os.Setenv("AZHEXGATE_RELAY_KEY_NAME", "SendPolicy")
+		_ = os.Setenv("AZHEXGATE_RELAY_KEY", "relay-secret")
+		_ = os.Setenv("AZHEXGATE_RELAY_LISTEN_KEY_NAME", "ListenPolicy")
+		_ = os.Setenv("AZHEXGATE_RELAY_LISTEN_KEY", "listen-secret")
+		_ = os.Setenv("AZHEXGATE_BASE_DOMAIN", "tunnels.example.com")
+		_ = os.Setenv("AZHEXGATE_REGISTRY_PATH", "/var/lib/azhexgate/tunnels.db")
+		_ = os.Setenv("AZHEXGATE_API_KEYS", "ci secret-1")
+		_ = os.Setenv("AZHEXGATE_API_KEYS_FILE", "/etc/azhexgate/keys")
+		_ = os.Setenv("AZHEXGATE_TRUSTED_PROXIES", "10.0.0.0/8")
+		_ = os.Setenv("AZHEXGATE_API_KEY_QUOTAS", "ci max_tunnels=5")
 
 		cfg := Load()
 
@@ -61,6 +126,34 @@ func TestLoad(t *testing.T) {
 		if cfg.LogLevel != "debug" {
 			t.Errorf("Expected LogLevel from env, got: %s", cfg.LogLevel)
 		}
+		if cfg.RelayKeyName != "SendPolicy" {
+			t.Errorf("Expected RelayKeyName from env, got: %s", cfg.RelayKeyName)
+		}
+		if cfg.RelayKey != "relay-secret" {
+			t.Errorf("Expected RelayKey from env, got: %s", cfg.RelayKey)
+		}
+		if cfg.RelayListenKeyName != "ListenPolicy" || cfg.RelayListenKey != "listen-secret" {
+			t.Errorf("Expected RelayListenKeyName and RelayListenKey from env, got: %s, %s",
+				cfg.RelayListenKeyName, cfg.RelayListenKey)
+		}
+		if cfg.BaseDomain != "tunnels.example.com" {
+			t.Errorf("Expected BaseDomain from env, got: %s", cfg.BaseDomain)
+		}
+		if cfg.RegistryPath != "/var/lib/azhexgate/tunnels.db" {
+			t.Errorf("Expected RegistryPath from env, got: %s", cfg.RegistryPath)
+		}
+		if cfg.APIKeys != "ci secret-1" {
+			t.Errorf("Expected APIKeys from env, got: %s", cfg.APIKeys)
+		}
+		if cfg.APIKeysFile != "/etc/azhexgate/keys" {
+			t.Errorf("Expected APIKeysFile from env, got: %s", cfg.APIKeysFile)
+		}
+		if cfg.TrustedProxies != "10.0.0.0/8" {
+			t.Errorf("Expected TrustedProxies from env, got: %s", cfg.TrustedProxies)
+		}
+		if cfg.APIKeyQuotas != "ci max_tunnels=5" {
+			t.Errorf("Expected APIKeyQuotas from env, got: %s", cfg.APIKeyQuotas)
+		}
 	})
 }
 
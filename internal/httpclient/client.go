@@ -31,6 +31,12 @@ type Options struct {
 	// UserAgent is the User-Agent header value
 	UserAgent string
 
+	// APIKey is sent in the X-AzHexGate-ApiKey header when set
+	APIKey string
+
+	// TokenSource provides the bearer token sent in the Authorization header when set
+	TokenSource TokenSource
+
 	// Transport allows customizing the underlying HTTP transport
 	Transport http.RoundTripper
 
@@ -66,10 +72,12 @@ func NewClient(opts *Options) *Client {
 	// Build policy chain in order:
 	// 1. Error handling (outermost)
 	// 2. Retry logic
-	// 3. Logging
-	// 4. Request ID
-	// 5. User Agent
-	// 6. Custom policies
+	// 3. Request ID
+	// 4. User Agent
+	// 5. API key
+	// 6. Bearer token
+	// 7. Logging
+	// 8. Custom policies
 	policies := make([]Policy, 0)
 
 	// Error policy (outermost)
@@ -92,12 +100,23 @@ func NewClient(opts *Options) *Client {
 		policies = append(policies, NewUserAgentPolicy(opts.UserAgent))
 	}
 
+	// API key policy
+	if opts.APIKey != "" {
+		policies = append(policies, NewAPIKeyPolicy(opts.APIKey))
+	}
+
+	// Bearer token policy
+	if opts.TokenSource != nil {
+		policies = append(policies, NewBearerTokenPolicy(opts.TokenSource))
+	}
+
 	// Logging policy (only if logger is provided)
 	// This should be last so it logs after all other policies have modified the request
 	if opts.Logger != nil {
 		policies = append(policies, NewLoggingPolicy(opts.Logger, &LoggingOptions{
-			LogHeaders: true,
-			LogBody:    true,
+			LogHeaders:    true,
+			LogBody:       true,
+			HeaderFilters: DefaultHeaderFilters,
 		}))
 	}
 
@@ -0,0 +1,28 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+)
+
+// APIKeyPolicy adds the X-AzHexGate-ApiKey header to requests
+type APIKeyPolicy struct {
+	apiKey string
+}
+
+// NewAPIKeyPolicy creates a new APIKeyPolicy
+func NewAPIKeyPolicy(apiKey string) *APIKeyPolicy {
+	return &APIKeyPolicy{apiKey: apiKey}
+}
+
+// Do implements Policy interface
+func (p *APIKeyPolicy) Do(
+	req *http.Request,
+	next func(*http.Request) (*http.Response, error),
+) (*http.Response, error) {
+	if p.apiKey != "" {
+		req.Header.Set(api.APIKeyHeader, p.apiKey)
+	}
+	return next(req)
+}
@@ -0,0 +1,67 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/internal/api"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+func TestAPIKeyPolicyDo(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantKey string
+	}{
+		{name: "key set", apiKey: "secret-1", wantKey: "secret-1"},
+		{name: "no key", apiKey: "", wantKey: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewAPIKeyPolicy(tt.apiKey)
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+			var seen string
+			_, _ = policy.Do(req, func(r *http.Request) (*http.Response, error) {
+				seen = r.Header.Get(api.APIKeyHeader)
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			})
+
+			if seen != tt.wantKey {
+				t.Errorf("Expected API key header %q, got %q", tt.wantKey, seen)
+			}
+		})
+	}
+}
+
+func TestClientAPIKeyIsRedactedFromLogs(t *testing.T) {
+	var seen string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(api.APIKeyHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var logs strings.Builder
+	client := NewClient(&Options{
+		APIKey: "secret-1",
+		Logger: logging.NewWithOutput(logging.DebugLevel, &logs),
+	})
+
+	resp, err := client.Get(t.Context(), server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if seen != "secret-1" {
+		t.Errorf("Expected API key to be sent, got %q", seen)
+	}
+	if strings.Contains(logs.String(), "secret-1") {
+		t.Errorf("Expected API key to be redacted from logs, got: %s", logs.String())
+	}
+}
@@ -0,0 +1,34 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// TokenSource returns a current access token, refreshing it when needed
+type TokenSource func(ctx context.Context) (string, error)
+
+// BearerTokenPolicy adds an "Authorization: Bearer" header with a token of its source to requests.
+// The token is fetched for every attempt, so retries pick up refreshed tokens.
+type BearerTokenPolicy struct {
+	source TokenSource
+}
+
+// NewBearerTokenPolicy creates a new BearerTokenPolicy
+func NewBearerTokenPolicy(source TokenSource) *BearerTokenPolicy {
+	return &BearerTokenPolicy{source: source}
+}
+
+// Do implements Policy interface
+func (p *BearerTokenPolicy) Do(
+	req *http.Request,
+	next func(*http.Request) (*http.Response, error),
+) (*http.Response, error) {
+	token, err := p.source(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return next(req)
+}
@@ -0,0 +1,75 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+)
+
+func TestBearerTokenPolicyDo(t *testing.T) {
+	policy := NewBearerTokenPolicy(func(ctx context.Context) (string, error) {
+		return "token-1", nil
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	var seen string
+	_, err := policy.Do(req, func(r *http.Request) (*http.Response, error) {
+		seen = r.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if seen != "Bearer token-1" {
+		t.Errorf("Expected Authorization header %q, got %q", "Bearer token-1", seen)
+	}
+}
+
+func TestBearerTokenPolicyDo_SourceError(t *testing.T) {
+	errSource := errors.New("not logged in")
+	policy := NewBearerTokenPolicy(func(ctx context.Context) (string, error) {
+		return "", errSource
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	_, err := policy.Do(req, func(r *http.Request) (*http.Response, error) {
+		t.Error("Expected the request not to be sent without a token")
+		return nil, nil
+	})
+	if !errors.Is(err, errSource) {
+		t.Errorf("Expected the token source error, got %v", err)
+	}
+}
+
+func TestClientBearerTokenIsRedactedFromLogs(t *testing.T) {
+	var seen string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var logs strings.Builder
+	client := NewClient(&Options{
+		TokenSource: func(ctx context.Context) (string, error) { return "token-1", nil },
+		Logger:      logging.NewWithOutput(logging.DebugLevel, &logs),
+	})
+
+	resp, err := client.Get(t.Context(), server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if seen != "Bearer token-1" {
+		t.Errorf("Expected the bearer token to be sent, got %q", seen)
+	}
+	if strings.Contains(logs.String(), "token-1") {
+		t.Errorf("Expected the bearer token to be redacted from logs, got: %s", logs.String())
+	}
+}
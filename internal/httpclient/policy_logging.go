@@ -8,9 +8,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/julienstroheker/AzHexGate/internal/api"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 )
 
+// RedactedValue replaces the values of filtered headers
+const RedactedValue = "[REDACTED]"
+
+// DefaultHeaderFilters are the credential headers the client redacts by default
+var DefaultHeaderFilters = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", api.APIKeyHeader}
+
 // LoggingPolicy logs requests and responses in debug mode
 type LoggingPolicy struct {
 	logger        *logging.Logger
@@ -136,25 +143,25 @@ func (p *LoggingPolicy) formatBody(key string, bodyContent []byte) logging.Field
 // formatHeaders formats headers for logging, applying redaction filters
 func (p *LoggingPolicy) formatHeaders(key string, headers http.Header) logging.Field {
 	var headerStrings []string
-	for name, values := range headers {
-		value := strings.Join(values, ", ")
+	for name, values := range RedactHeaders(headers, p.headerFilters) {
+		headerStrings = append(headerStrings, fmt.Sprintf("%s: %s", name, strings.Join(values, ", ")))
+	}
+	return logging.String(key, strings.Join(headerStrings, "; "))
+}
 
-		// Check if this header should be redacted
-		shouldRedact := false
-		for _, filter := range p.headerFilters {
+// RedactHeaders returns a copy of headers in which the values of the headers named by filters,
+// compared case-insensitively, are replaced by a single RedactedValue
+func RedactHeaders(headers http.Header, filters []string) http.Header {
+	redacted := headers.Clone()
+	for name := range redacted {
+		for _, filter := range filters {
 			if strings.EqualFold(name, filter) {
-				shouldRedact = true
+				redacted[name] = []string{RedactedValue}
 				break
 			}
 		}
-
-		if shouldRedact {
-			value = "[REDACTED]"
-		}
-
-		headerStrings = append(headerStrings, fmt.Sprintf("%s: %s", name, value))
 	}
-	return logging.String(key, strings.Join(headerStrings, "; "))
+	return redacted
 }
 
 // readAndRestoreBody reads the request body and restores it
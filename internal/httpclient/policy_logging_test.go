@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/julienstroheker/AzHexGate/internal/api"
 	"github.com/julienstroheker/AzHexGate/internal/logging"
 )
 
@@ -306,3 +307,26 @@ func TestLoggingPolicyFormatHeaders(t *testing.T) {
 		t.Error("Expected Content-Type header to be visible")
 	}
 }
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Add("Cookie", "a=1")
+	headers.Add("Cookie", "b=2")
+	headers.Set("X-Azhexgate-Apikey", "secret")
+	headers.Set("Content-Type", "application/json")
+
+	redacted := RedactHeaders(headers, DefaultHeaderFilters)
+
+	if got := redacted.Values("Cookie"); len(got) != 1 || got[0] != RedactedValue {
+		t.Errorf("Expected Cookie to be redacted to a single value, got %v", got)
+	}
+	if got := redacted.Get(api.APIKeyHeader); got != RedactedValue {
+		t.Errorf("Expected the API key header to be redacted, got %q", got)
+	}
+	if got := redacted.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type to be kept, got %q", got)
+	}
+	if headers.Get("Cookie") != "a=1" {
+		t.Error("Expected the original headers to be left unchanged")
+	}
+}
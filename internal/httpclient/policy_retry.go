@@ -2,6 +2,7 @@ package httpclient
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/julienstroheker/AzHexGate/internal/logging"
@@ -24,7 +25,8 @@ type RetryOptions struct {
 	RetryDelay time.Duration
 
 	// RetryStatusCodes defines which HTTP status codes should trigger a retry
-	// Default: 500-599 (server errors) and 429 (Too Many Requests)
+	// Default: 500-599 (server errors) and 429 (Too Many Requests).
+	// Responses asking, with Retry-After, to wait longer than the longest backoff are not retried.
 	RetryStatusCodes []int
 
 	// Logger for debug logging (optional)
@@ -119,6 +121,13 @@ func (p *RetryPolicy) shouldRetry(resp *http.Response) bool {
 		return true
 	}
 
+	// The server asks to come back later than any retry would
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		if time.Duration(seconds)*time.Second > p.retryDelay*time.Duration(1<<(p.maxRetries-1)) {
+			return false
+		}
+	}
+
 	// Check if status code is in the retry list
 	for _, code := range p.retryStatusCodes {
 		if resp.StatusCode == code {
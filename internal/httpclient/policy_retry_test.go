@@ -297,3 +297,31 @@ func TestShouldRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestShouldRetryRetryAfter(t *testing.T) {
+	policy := NewRetryPolicy(&RetryOptions{MaxRetries: 3, RetryDelay: time.Second})
+
+	tests := []struct {
+		name        string
+		retryAfter  string
+		shouldRetry bool
+	}{
+		{"no Retry-After", "", true},
+		{"within the backoff", "4", true},
+		{"beyond the backoff", "3600", false},
+		{"HTTP date", "Wed, 21 Oct 2015 07:28:00 GMT", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			if result := policy.shouldRetry(resp); result != tt.shouldRetry {
+				t.Errorf("shouldRetry with Retry-After %q = %v, want %v", tt.retryAfter, result, tt.shouldRetry)
+			}
+		})
+	}
+}
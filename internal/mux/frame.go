@@ -0,0 +1,95 @@
+// Package mux carries many logical streams over a single relay connection.
+//
+// Every frame starts with a fixed header: a version byte, a type byte, a 32-bit stream ID
+// and a 32-bit length, all big-endian. Data frames are followed by length bytes of payload;
+// for window updates the length is the number of bytes the receiver is ready to accept.
+// Streams opened by the client side use odd IDs and streams opened by the server side even IDs.
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// protocolVersion is the frame format version written in every header
+	protocolVersion = 1
+
+	// headerSize is the length of a frame header in bytes
+	headerSize = 10
+
+	// maxFrameSize is the largest data payload carried by a single frame
+	maxFrameSize = 16 * 1024
+)
+
+// frameType identifies what a frame does to its stream
+type frameType uint8
+
+const (
+	// frameOpen opens a new stream
+	frameOpen frameType = iota + 1
+	// frameData carries stream payload
+	frameData
+	// frameWindowUpdate lets the peer send more data on a stream
+	frameWindowUpdate
+	// frameClose ends a stream; the sender neither reads nor writes it anymore
+	frameClose
+)
+
+// String returns the string representation of a frameType
+func (t frameType) String() string {
+	switch t {
+	case frameOpen:
+		return "open"
+	case frameData:
+		return "data"
+	case frameWindowUpdate:
+		return "window-update"
+	case frameClose:
+		return "close"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// frameHeader is the decoded fixed-size header of a frame
+type frameHeader struct {
+	typ      frameType
+	streamID uint32
+	length   uint32
+}
+
+// encodeFrame returns a frame with the given header and payload
+func encodeFrame(typ frameType, streamID, length uint32, payload []byte) []byte {
+	buf := make([]byte, headerSize+len(payload))
+	buf[0] = protocolVersion
+	buf[1] = byte(typ)
+	binary.BigEndian.PutUint32(buf[2:6], streamID)
+	binary.BigEndian.PutUint32(buf[6:10], length)
+	copy(buf[headerSize:], payload)
+	return buf
+}
+
+// readHeader reads and validates the next frame header
+func readHeader(r io.Reader, buf []byte) (frameHeader, error) {
+	if _, err := io.ReadFull(r, buf[:headerSize]); err != nil {
+		return frameHeader{}, err
+	}
+	if buf[0] != protocolVersion {
+		return frameHeader{}, fmt.Errorf("%w: unsupported version %d", ErrProtocol, buf[0])
+	}
+
+	header := frameHeader{
+		typ:      frameType(buf[1]),
+		streamID: binary.BigEndian.Uint32(buf[2:6]),
+		length:   binary.BigEndian.Uint32(buf[6:10]),
+	}
+	if header.typ < frameOpen || header.typ > frameClose {
+		return frameHeader{}, fmt.Errorf("%w: %s frame", ErrProtocol, header.typ)
+	}
+	if header.typ == frameData && header.length > maxFrameSize {
+		return frameHeader{}, fmt.Errorf("%w: %d byte data frame exceeds %d", ErrProtocol, header.length, maxFrameSize)
+	}
+	return header, nil
+}
@@ -0,0 +1,65 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrame_RoundTrip(t *testing.T) {
+	frame := encodeFrame(frameData, 7, 5, []byte("hello"))
+	if len(frame) != headerSize+5 {
+		t.Fatalf("Expected %d byte frame, got %d", headerSize+5, len(frame))
+	}
+
+	reader := bytes.NewReader(frame)
+	header, err := readHeader(reader, make([]byte, headerSize))
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	if header.typ != frameData || header.streamID != 7 || header.length != 5 {
+		t.Errorf("Expected data frame for stream 7 with 5 bytes, got %+v", header)
+	}
+
+	payload, _ := io.ReadAll(reader)
+	if string(payload) != "hello" {
+		t.Errorf("Expected payload %q, got %q", "hello", string(payload))
+	}
+}
+
+func TestFrame_InvalidHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{name: "unknown version", frame: append([]byte{9}, encodeFrame(frameOpen, 1, 0, nil)[1:]...)},
+		{name: "unknown type", frame: encodeFrame(frameType(42), 1, 0, nil)},
+		{name: "oversized data frame", frame: encodeFrame(frameData, 1, maxFrameSize+1, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readHeader(bytes.NewReader(tt.frame), make([]byte, headerSize))
+			if !errors.Is(err, ErrProtocol) {
+				t.Errorf("Expected ErrProtocol, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFrame_TruncatedHeader(t *testing.T) {
+	_, err := readHeader(bytes.NewReader([]byte{protocolVersion, byte(frameOpen)}), make([]byte, headerSize))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestFrameType_String(t *testing.T) {
+	if frameWindowUpdate.String() != "window-update" {
+		t.Errorf("Expected %q, got %q", "window-update", frameWindowUpdate.String())
+	}
+	if frameType(0).String() != "unknown(0)" {
+		t.Errorf("Expected %q, got %q", "unknown(0)", frameType(0).String())
+	}
+}
@@ -0,0 +1,252 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+// Sender is a relay.Sender that opens every connection as a stream of one persistent session.
+// The underlying relay connection is dialed on first use and again after it is lost.
+type Sender struct {
+	relay relay.Sender
+	opts  Options
+
+	mu      sync.Mutex
+	session *Session
+	closed  bool
+}
+
+// NewSender creates a multiplexing sender over r. Its sessions always use the client role.
+func NewSender(r relay.Sender, opts *Options) *Sender {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	sessionOpts := *opts
+	sessionOpts.Client = true
+
+	return &Sender{
+		relay: r,
+		opts:  sessionOpts,
+	}
+}
+
+// Dial opens a stream on the current session, establishing a new session when needed
+func (s *Sender) Dial(ctx context.Context) (relay.Connection, error) {
+	for attempt := 0; ; attempt++ {
+		session, err := s.currentSession(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := session.Open(ctx)
+		if errors.Is(err, ErrSessionClosed) && attempt == 0 {
+			// The session died since it was last used; start a new one once
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// currentSession returns the live session, dialing the relay when there is none
+func (s *Sender) currentSession(ctx context.Context) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, relay.ErrSenderClosed
+	}
+	if s.session != nil && s.session.Err() == nil {
+		return s.session, nil
+	}
+
+	conn, err := s.relay.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.session = NewSession(conn, &s.opts)
+	return s.session, nil
+}
+
+// Close closes the session and the underlying sender
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	session := s.session
+	s.mu.Unlock()
+
+	if session != nil {
+		_ = session.Close()
+	}
+	return s.relay.Close()
+}
+
+// acceptResult is the outcome of an Accept on the underlying relay listener
+type acceptResult struct {
+	conn relay.Connection
+	err  error
+}
+
+// Listener is a relay.Listener that accepts streams from every session opened by Senders.
+// Each relay connection accepted from the underlying listener becomes a session in the server role.
+// Errors from the underlying listener are returned by Accept unchanged.
+type Listener struct {
+	relay relay.Listener
+	opts  Options
+
+	streams chan *Stream
+	results chan acceptResult
+	done    chan struct{}
+
+	mu        sync.Mutex
+	accepting bool
+	cancel    context.CancelFunc
+	pending   sync.WaitGroup
+	sessions  map[*Session]struct{}
+	closed    bool
+}
+
+// NewListener creates a multiplexing listener over r. Its sessions always use the server role.
+func NewListener(r relay.Listener, opts *Options) *Listener {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	sessionOpts := *opts
+	sessionOpts.Client = false
+
+	return &Listener{
+		relay:    r,
+		opts:     sessionOpts,
+		streams:  make(chan *Stream),
+		results:  make(chan acceptResult, 1),
+		done:     make(chan struct{}),
+		sessions: make(map[*Session]struct{}),
+	}
+}
+
+// Accept waits for the next stream from any session
+func (l *Listener) Accept(ctx context.Context) (relay.Connection, error) {
+	for {
+		if err := l.acceptRelay(); err != nil {
+			return nil, err
+		}
+
+		select {
+		case stream := <-l.streams:
+			return stream, nil
+		case result := <-l.results:
+			l.mu.Lock()
+			l.accepting = false
+			l.mu.Unlock()
+
+			if result.err != nil {
+				return nil, result.err
+			}
+			l.serve(result.conn)
+		case <-l.done:
+			return nil, relay.ErrListenerClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// acceptRelay starts accepting the next relay connection unless an accept is already pending.
+// The pending accept outlives the Accept call that started it; its result is picked up by the next one.
+func (l *Listener) acceptRelay() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return relay.ErrListenerClosed
+	}
+	if l.accepting {
+		return nil
+	}
+	l.accepting = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		defer cancel()
+		conn, err := l.relay.Accept(ctx)
+		l.results <- acceptResult{conn: conn, err: err}
+	}()
+	return nil
+}
+
+// serve starts a session over conn and forwards its streams to Accept
+func (l *Listener) serve(conn relay.Connection) {
+	session := NewSession(conn, &l.opts)
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		_ = session.Close()
+		return
+	}
+	l.sessions[session] = struct{}{}
+	l.mu.Unlock()
+
+	go func() {
+		defer func() {
+			l.mu.Lock()
+			delete(l.sessions, session)
+			l.mu.Unlock()
+		}()
+
+		for {
+			stream, err := session.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			select {
+			case l.streams <- stream:
+			case <-l.done:
+				_ = stream.Close()
+				return
+			}
+		}
+	}()
+}
+
+// Close closes every session and the underlying listener
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	if l.cancel != nil {
+		l.cancel()
+	}
+	sessions := l.sessions
+	l.sessions = make(map[*Session]struct{})
+	l.mu.Unlock()
+
+	for session := range sessions {
+		_ = session.Close()
+	}
+
+	// A connection accepted after the last Accept call is not served
+	l.pending.Wait()
+	select {
+	case result := <-l.results:
+		if result.conn != nil {
+			_ = result.conn.Close()
+		}
+	default:
+	}
+	return l.relay.Close()
+}
@@ -0,0 +1,182 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+var (
+	_ relay.Sender   = (*Sender)(nil)
+	_ relay.Listener = (*Listener)(nil)
+)
+
+// countingSender records every relay connection it dials
+type countingSender struct {
+	relay.Sender
+
+	mu    sync.Mutex
+	conns []relay.Connection
+}
+
+func (c *countingSender) Dial(ctx context.Context) (relay.Connection, error) {
+	conn, err := c.Sender.Dial(ctx)
+	if err == nil {
+		c.mu.Lock()
+		c.conns = append(c.conns, conn)
+		c.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (c *countingSender) dialed() []relay.Connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]relay.Connection(nil), c.conns...)
+}
+
+// newMuxPair returns a multiplexing sender and listener over an in-memory relay,
+// with a goroutine echoing every accepted stream
+func newMuxPair(t *testing.T) (*Sender, *countingSender) {
+	t.Helper()
+
+	memoryListener := relay.NewMemoryListener()
+	listener := NewListener(memoryListener, nil)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	counting := &countingSender{Sender: relay.NewMemorySender(memoryListener)}
+	sender := NewSender(counting, nil)
+	t.Cleanup(func() { _ = sender.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return sender, counting
+}
+
+// roundTrip writes message on a new stream and reads the echo
+func roundTrip(t *testing.T, sender relay.Sender, message string) {
+	t.Helper()
+
+	conn, err := sender.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = conn.Write([]byte(message))
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != message {
+		t.Fatalf("Expected echo %q, got %q (%v)", message, string(buf), err)
+	}
+}
+
+func TestSender_SharesOneRelayConnection(t *testing.T) {
+	sender, counting := newMuxPair(t)
+
+	for _, message := range []string{"one", "two", "three", "four"} {
+		roundTrip(t, sender, message)
+	}
+	if dialed := len(counting.dialed()); dialed != 1 {
+		t.Errorf("Expected 1 relay connection for all streams, got %d", dialed)
+	}
+}
+
+func TestSender_RedialsLostSession(t *testing.T) {
+	sender, counting := newMuxPair(t)
+	roundTrip(t, sender, "before")
+
+	// Drop the relay connection under the session
+	sender.mu.Lock()
+	session := sender.session
+	sender.mu.Unlock()
+	_ = counting.dialed()[0].Close()
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session to end with its relay connection")
+	}
+
+	roundTrip(t, sender, "after")
+	if dialed := len(counting.dialed()); dialed != 2 {
+		t.Errorf("Expected a second relay connection after the first was lost, got %d", dialed)
+	}
+}
+
+func TestSender_Closed(t *testing.T) {
+	sender, _ := newMuxPair(t)
+	_ = sender.Close()
+
+	if _, err := sender.Dial(context.Background()); !errors.Is(err, relay.ErrSenderClosed) {
+		t.Errorf("Expected ErrSenderClosed, got %v", err)
+	}
+}
+
+// failingListener fails every Accept with err
+type failingListener struct {
+	err error
+}
+
+func (f *failingListener) Accept(ctx context.Context) (relay.Connection, error) { return nil, f.err }
+func (f *failingListener) Close() error                                         { return nil }
+
+func TestListener_ReturnsRelayErrors(t *testing.T) {
+	relayErr := errors.New("relay unavailable")
+	listener := NewListener(&failingListener{err: relayErr}, nil)
+	defer func() { _ = listener.Close() }()
+
+	for i := 0; i < 2; i++ {
+		if _, err := listener.Accept(context.Background()); !errors.Is(err, relayErr) {
+			t.Errorf("Attempt %d: expected the relay error, got %v", i, err)
+		}
+	}
+}
+
+func TestListener_Close(t *testing.T) {
+	listener := NewListener(relay.NewMemoryListener(), nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept(context.Background())
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = listener.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, relay.ErrListenerClosed) {
+			t.Errorf("Expected ErrListenerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Accept to return after Close")
+	}
+	if _, err := listener.Accept(context.Background()); !errors.Is(err, relay.ErrListenerClosed) {
+		t.Errorf("Expected ErrListenerClosed after Close, got %v", err)
+	}
+}
+
+func TestListener_AcceptContextCancelled(t *testing.T) {
+	listener := NewListener(relay.NewMemoryListener(), nil)
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := listener.Accept(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
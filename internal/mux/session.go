@@ -0,0 +1,286 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+const (
+	// defaultWindowSize is how many unread bytes each stream buffers before the sender waits
+	defaultWindowSize = 256 * 1024
+
+	// defaultAcceptBacklog is how many opened streams may wait for Accept before new ones are refused
+	defaultAcceptBacklog = 64
+)
+
+var (
+	// ErrSessionClosed is returned when using a session, or a stream of a session, that is closed
+	ErrSessionClosed = errors.New("mux session is closed")
+
+	// ErrStreamClosed is returned when using a stream that was closed by either side
+	ErrStreamClosed = errors.New("mux stream is closed")
+
+	// ErrProtocol is returned when the peer sends a malformed or unexpected frame
+	ErrProtocol = errors.New("mux protocol error")
+
+	// ErrStreamsExhausted is returned by Open when the session ran out of stream IDs
+	ErrStreamsExhausted = errors.New("mux stream IDs exhausted")
+)
+
+// Options contains configuration for a Session
+type Options struct {
+	// Client selects odd stream IDs for streams opened by this side. The two ends of a
+	// connection must use opposite values.
+	Client bool
+
+	// WindowSize is how many unread bytes a stream buffers (optional, defaults to 256 KiB)
+	WindowSize uint32
+
+	// AcceptBacklog is how many streams may wait for Accept (optional, defaults to 64)
+	AcceptBacklog int
+}
+
+// Session multiplexes streams over a single relay connection.
+// It satisfies both relay.Sender (Dial opens a stream) and relay.Listener (Accept
+// returns streams opened by the peer).
+type Session struct {
+	conn       relay.Connection
+	client     bool
+	windowSize uint32
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	err     error
+
+	accept    chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession starts a session over conn. The session owns conn and closes it on Close.
+func NewSession(conn relay.Connection, opts *Options) *Session {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	windowSize := opts.WindowSize
+	if windowSize == 0 {
+		windowSize = defaultWindowSize
+	}
+
+	backlog := opts.AcceptBacklog
+	if backlog <= 0 {
+		backlog = defaultAcceptBacklog
+	}
+
+	nextID := uint32(2)
+	if opts.Client {
+		nextID = 1
+	}
+
+	s := &Session{
+		conn:       conn,
+		client:     opts.Client,
+		windowSize: windowSize,
+		streams:    make(map[uint32]*Stream),
+		nextID:     nextID,
+		accept:     make(chan *Stream, backlog),
+		done:       make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Open opens a new stream to the peer
+func (s *Session) Open(ctx context.Context) (*Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if s.nextID > math.MaxUint32-2 {
+		s.mu.Unlock()
+		return nil, ErrStreamsExhausted
+	}
+	stream := newStream(s, s.nextID)
+	s.streams[stream.id] = stream
+	s.nextID += 2
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameOpen, stream.id, 0, nil); err != nil {
+		s.forget(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Dial opens a new stream, satisfying relay.Sender
+func (s *Session) Dial(ctx context.Context) (relay.Connection, error) {
+	return s.Open(ctx)
+}
+
+// Accept waits for the next stream opened by the peer, satisfying relay.Listener
+func (s *Session) Accept(ctx context.Context) (relay.Connection, error) {
+	return s.AcceptStream(ctx)
+}
+
+// AcceptStream waits for the next stream opened by the peer
+func (s *Session) AcceptStream(ctx context.Context) (*Stream, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the session ends
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended, or nil while it is open
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close closes the session, its streams and the underlying connection
+func (s *Session) Close() error {
+	s.closeWithError(ErrSessionClosed)
+	return nil
+}
+
+// closeWithError ends the session once, recording err as the reason
+func (s *Session) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+
+		close(s.done)
+		_ = s.conn.Close()
+		for _, stream := range streams {
+			stream.sessionClosed()
+		}
+	})
+}
+
+// readLoop reads frames off the connection and dispatches them to streams until the session ends
+func (s *Session) readLoop() {
+	buf := make([]byte, headerSize)
+	for {
+		header, err := readHeader(s.conn, buf)
+		if err == nil {
+			err = s.handleFrame(header)
+		}
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+	}
+}
+
+// handleFrame applies a frame to its stream
+func (s *Session) handleFrame(header frameHeader) error {
+	switch header.typ {
+	case frameOpen:
+		return s.handleOpen(header.streamID)
+	case frameData:
+		payload := make([]byte, header.length)
+		if _, err := io.ReadFull(s.conn, payload); err != nil {
+			return err
+		}
+		if stream := s.stream(header.streamID); stream != nil {
+			return stream.receive(payload)
+		}
+	case frameWindowUpdate:
+		if stream := s.stream(header.streamID); stream != nil {
+			return stream.grow(header.length)
+		}
+	case frameClose:
+		if stream := s.stream(header.streamID); stream != nil {
+			stream.remoteClose()
+		}
+	}
+	// Frames for streams this side already closed are dropped
+	return nil
+}
+
+// handleOpen registers a stream opened by the peer and queues it for Accept
+func (s *Session) handleOpen(id uint32) error {
+	if (id%2 == 1) == s.client || id == 0 {
+		return fmt.Errorf("%w: peer opened stream %d with this side's parity", ErrProtocol, id)
+	}
+
+	s.mu.Lock()
+	if _, exists := s.streams[id]; exists {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: stream %d opened twice", ErrProtocol, id)
+	}
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	select {
+	case s.accept <- stream:
+	default:
+		// Nobody is accepting fast enough; refuse the stream rather than stall every other one
+		s.forget(id)
+		return s.writeFrame(frameClose, id, 0, nil)
+	}
+	return nil
+}
+
+// stream returns the open stream with the given ID, or nil
+func (s *Session) stream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+// forget removes a stream from the session
+func (s *Session) forget(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// writeFrame writes a single frame; frames from concurrent streams never interleave
+func (s *Session) writeFrame(typ frameType, streamID, length uint32, payload []byte) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	frame := encodeFrame(typ, streamID, length, payload)
+
+	s.writeMu.Lock()
+	_, err := s.conn.Write(frame)
+	s.writeMu.Unlock()
+
+	if err != nil {
+		s.closeWithError(err)
+		return ErrSessionClosed
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+)
+
+var (
+	_ relay.Connection = (*Stream)(nil)
+	_ relay.Sender     = (*Session)(nil)
+	_ relay.Listener   = (*Session)(nil)
+)
+
+// connPair returns the two ends of an in-memory relay connection
+func connPair(t *testing.T) (relay.Connection, relay.Connection) {
+	t.Helper()
+
+	listener := relay.NewMemoryListener()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	senderConn, err := relay.NewMemorySender(listener).Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	listenerConn, err := listener.Accept(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	return senderConn, listenerConn
+}
+
+// sessionPair returns a client and a server session over one in-memory connection
+func sessionPair(t *testing.T, opts *Options) (*Session, *Session) {
+	t.Helper()
+
+	if opts == nil {
+		opts = &Options{}
+	}
+	clientOpts, serverOpts := *opts, *opts
+	clientOpts.Client = true
+	serverOpts.Client = false
+
+	clientConn, serverConn := connPair(t)
+	client := NewSession(clientConn, &clientOpts)
+	server := NewSession(serverConn, &serverOpts)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+// echo copies everything read from each accepted stream back to it
+func echo(session *Session) {
+	for {
+		stream, err := session.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = stream.Close() }()
+			_, _ = io.Copy(stream, stream)
+		}()
+	}
+}
+
+func TestSession_OpenAccept(t *testing.T) {
+	client, server := sessionPair(t, nil)
+
+	stream, err := client.Open(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	if stream.ID()%2 != 1 {
+		t.Errorf("Expected an odd stream ID from the client, got %d", stream.ID())
+	}
+	_, _ = stream.Write([]byte("ping"))
+
+	accepted, err := server.AcceptStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to accept stream: %v", err)
+	}
+	if accepted.ID() != stream.ID() {
+		t.Errorf("Expected stream %d, got %d", stream.ID(), accepted.ID())
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(accepted, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("Expected %q, got %q (%v)", "ping", string(buf), err)
+	}
+	_, _ = accepted.Write([]byte("pong"))
+	if _, err := io.ReadFull(stream, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("Expected %q, got %q (%v)", "pong", string(buf), err)
+	}
+}
+
+func TestSession_ServerOpensStreams(t *testing.T) {
+	client, server := sessionPair(t, nil)
+	go echo(client)
+
+	stream, err := server.Open(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+	if stream.ID()%2 != 0 {
+		t.Errorf("Expected an even stream ID from the server, got %d", stream.ID())
+	}
+
+	_, _ = stream.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(stream, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("Expected echo %q, got %q (%v)", "hello", string(buf), err)
+	}
+}
+
+func TestSession_ConcurrentStreams(t *testing.T) {
+	// A small window forces many window updates per stream
+	client, server := sessionPair(t, &Options{WindowSize: 4096})
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			stream, err := client.Open(context.Background())
+			if err != nil {
+				t.Errorf("Failed to open stream: %v", err)
+				return
+			}
+			defer func() { _ = stream.Close() }()
+
+			payload := make([]byte, 100*1024)
+			_, _ = rand.Read(payload)
+			go func() { _, _ = stream.Write(payload) }()
+
+			echoed := make([]byte, len(payload))
+			if _, err := io.ReadFull(stream, echoed); err != nil {
+				t.Errorf("Stream %d: failed to read echo: %v", stream.ID(), err)
+				return
+			}
+			if !bytes.Equal(echoed, payload) {
+				t.Errorf("Stream %d: echoed payload differs", stream.ID())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSession_FlowControl(t *testing.T) {
+	client, server := sessionPair(t, &Options{WindowSize: 1024})
+
+	stream, _ := client.Open(context.Background())
+	accepted, _ := server.AcceptStream(context.Background())
+
+	written := make(chan struct{})
+	go func() {
+		_, _ = stream.Write(make([]byte, 3000))
+		close(written)
+	}()
+
+	// The writer stops once the receiver's window is full
+	select {
+	case <-written:
+		t.Fatal("Expected Write to block while the peer does not read")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := io.ReadFull(accepted, make([]byte, 3000)); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Write to complete once the peer reads")
+	}
+}
+
+func TestStream_Close(t *testing.T) {
+	client, server := sessionPair(t, nil)
+
+	stream, _ := client.Open(context.Background())
+	_, _ = stream.Write([]byte("last words"))
+	_ = stream.Close()
+
+	accepted, _ := server.AcceptStream(context.Background())
+
+	// Buffered data is still delivered before EOF
+	data, err := io.ReadAll(accepted)
+	if err != nil || string(data) != "last words" {
+		t.Errorf("Expected %q then EOF, got %q (%v)", "last words", string(data), err)
+	}
+	if _, err := accepted.Write([]byte("too late")); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Expected ErrStreamClosed writing to a stream closed by the peer, got %v", err)
+	}
+	if _, err := stream.Read(make([]byte, 1)); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Expected ErrStreamClosed reading a closed stream, got %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %v", err)
+	}
+}
+
+func TestSession_Close(t *testing.T) {
+	client, server := sessionPair(t, nil)
+
+	stream, _ := client.Open(context.Background())
+	accepted, _ := server.AcceptStream(context.Background())
+
+	_ = client.Close()
+
+	if _, err := stream.Read(make([]byte, 1)); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Expected ErrSessionClosed on the local stream, got %v", err)
+	}
+	if _, err := accepted.Read(make([]byte, 1)); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Expected ErrSessionClosed on the peer's stream, got %v", err)
+	}
+	if _, err := server.AcceptStream(context.Background()); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Expected Accept to fail on the peer, got %v", err)
+	}
+	if _, err := client.Open(context.Background()); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Expected Open to fail after Close, got %v", err)
+	}
+	select {
+	case <-server.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the peer session to end")
+	}
+}
+
+func TestSession_RefusesStreamsBeyondBacklog(t *testing.T) {
+	client, _ := sessionPair(t, &Options{AcceptBacklog: 1})
+
+	first, _ := client.Open(context.Background())
+	second, _ := client.Open(context.Background())
+
+	// The second stream is closed by the peer without being accepted
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected EOF on the refused stream, got %v", err)
+	}
+	if _, err := first.Write([]byte("still open")); err != nil {
+		t.Errorf("Expected the queued stream to stay open, got %v", err)
+	}
+}
+
+func TestSession_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{name: "wrong parity", frame: encodeFrame(frameOpen, 2, 0, nil)},
+		{name: "unsupported version", frame: append([]byte{2}, encodeFrame(frameOpen, 1, 0, nil)[1:]...)},
+		{name: "window exceeded", frame: append(encodeFrame(frameOpen, 1, 0, nil),
+			encodeFrame(frameData, 1, maxFrameSize, make([]byte, maxFrameSize))...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, conn := connPair(t)
+			server := NewSession(conn, &Options{WindowSize: 1024})
+			defer func() { _ = server.Close() }()
+
+			go func() { _, _ = peer.Write(tt.frame) }()
+
+			select {
+			case <-server.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the session to end on a protocol error")
+			}
+			if !errors.Is(server.Err(), ErrProtocol) {
+				t.Errorf("Expected ErrProtocol, got %v", server.Err())
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package mux
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// Stream is a logical connection carried by a Session. It satisfies relay.Connection.
+// Writes block while the peer's receive window is full; reads return io.EOF once the
+// peer closed the stream and every buffered byte was read.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// buf holds received bytes not yet read
+	buf []byte
+	// recvWindow is how many more bytes the peer may send before it waits for a window update
+	recvWindow uint32
+	// unacked is how many bytes were read since the last window update
+	unacked uint32
+	// sendWindow is how many more bytes this side may send
+	sendWindow uint32
+
+	localClosed  bool
+	remoteClosed bool
+	sessionEnded bool
+}
+
+// newStream creates a stream with full windows in both directions
+func newStream(session *Session, id uint32) *Stream {
+	stream := &Stream{
+		id:         id,
+		session:    session,
+		recvWindow: session.windowSize,
+		sendWindow: session.windowSize,
+	}
+	stream.cond = sync.NewCond(&stream.mu)
+	return stream
+}
+
+// ID returns the stream ID within its session
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read reads data sent by the peer
+func (st *Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for len(st.buf) == 0 && !st.localClosed && !st.remoteClosed && !st.sessionEnded {
+		st.cond.Wait()
+	}
+
+	switch {
+	case st.localClosed:
+		st.mu.Unlock()
+		return 0, ErrStreamClosed
+	case len(st.buf) == 0 && st.remoteClosed:
+		st.mu.Unlock()
+		return 0, io.EOF
+	case len(st.buf) == 0:
+		st.mu.Unlock()
+		return 0, ErrSessionClosed
+	}
+
+	n := copy(p, st.buf)
+	st.buf = st.buf[n:]
+	st.unacked += uint32(n) //nolint:gosec // n is bounded by the receive window
+
+	// Return consumed space to the peer in batches rather than per read
+	var update uint32
+	if st.unacked >= st.session.windowSize/2 && !st.remoteClosed {
+		update = st.unacked
+		st.unacked = 0
+		st.recvWindow += update
+	}
+	st.mu.Unlock()
+
+	if update > 0 {
+		_ = st.session.writeFrame(frameWindowUpdate, st.id, update, nil)
+	}
+	return n, nil
+}
+
+// Write sends data to the peer, waiting for window updates as needed
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		st.mu.Lock()
+		for st.sendWindow == 0 && !st.localClosed && !st.remoteClosed && !st.sessionEnded {
+			st.cond.Wait()
+		}
+
+		switch {
+		case st.localClosed, st.remoteClosed:
+			st.mu.Unlock()
+			return written, ErrStreamClosed
+		case st.sessionEnded:
+			st.mu.Unlock()
+			return written, ErrSessionClosed
+		}
+
+		n := min(len(p)-written, int(st.sendWindow), maxFrameSize)
+		length := uint32(n) //nolint:gosec // n is at most sendWindow
+		st.sendWindow -= length
+		st.mu.Unlock()
+
+		if err := st.session.writeFrame(frameData, st.id, length, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close closes the stream in both directions and tells the peer
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	st.buf = nil
+	ended := st.sessionEnded
+	st.cond.Broadcast()
+	st.mu.Unlock()
+
+	st.session.forget(st.id)
+	if !ended {
+		// A failed write ends the session, which closes the stream on the peer as well
+		_ = st.session.writeFrame(frameClose, st.id, 0, nil)
+	}
+	return nil
+}
+
+// receive buffers a data payload from the peer
+func (st *Stream) receive(payload []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.localClosed {
+		return nil
+	}
+	if uint64(len(payload)) > uint64(st.recvWindow) {
+		return fmt.Errorf("%w: stream %d sent %d bytes with a window of %d",
+			ErrProtocol, st.id, len(payload), st.recvWindow)
+	}
+
+	st.recvWindow -= uint32(len(payload)) //nolint:gosec // bounded by recvWindow above
+	st.buf = append(st.buf, payload...)
+	st.cond.Broadcast()
+	return nil
+}
+
+// grow adds a window update from the peer to the send window
+func (st *Stream) grow(increment uint32) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if uint64(st.sendWindow)+uint64(increment) > math.MaxUint32 {
+		return fmt.Errorf("%w: stream %d window overflow", ErrProtocol, st.id)
+	}
+	st.sendWindow += increment
+	st.cond.Broadcast()
+	return nil
+}
+
+// remoteClose records that the peer closed the stream
+func (st *Stream) remoteClose() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.remoteClosed = true
+	st.cond.Broadcast()
+}
+
+// sessionClosed wakes every reader and writer after the session ended
+func (st *Stream) sessionClosed() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessionEnded = true
+	st.cond.Broadcast()
+}
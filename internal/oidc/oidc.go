@@ -0,0 +1,64 @@
+// Package oidc discovers the endpoints of OpenID Connect providers
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// discoveryPath is where providers publish their metadata, relative to the issuer URL
+const discoveryPath = "/.well-known/openid-configuration"
+
+// maxDiscoverySize bounds the provider metadata document
+const maxDiscoverySize = 1 << 20
+
+// ErrDiscovery is returned when the metadata of a provider cannot be fetched or is invalid
+var ErrDiscovery = errors.New("OIDC discovery failed")
+
+// Doer sends HTTP requests, e.g. an *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Provider is the metadata of an OpenID Connect provider (OpenID Connect Discovery 1.0)
+type Provider struct {
+	Issuer                      string `json:"issuer"`
+	JWKSURI                     string `json:"jwks_uri"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+}
+
+// Discover fetches the metadata of the provider at issuer.
+// The metadata must name the same issuer, so tokens are only trusted from the configured one.
+func Discover(ctx context.Context, client Doer, issuer string) (*Provider, error) {
+	url := strings.TrimSuffix(issuer, "/") + discoveryPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned status %d", ErrDiscovery, url, resp.StatusCode)
+	}
+
+	var provider Provider
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDiscoverySize)).Decode(&provider); err != nil {
+		return nil, fmt.Errorf("%w: invalid metadata: %w", ErrDiscovery, err)
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("%w: metadata names issuer %q instead of %q", ErrDiscovery, provider.Issuer, issuer)
+	}
+	return &provider, nil
+}
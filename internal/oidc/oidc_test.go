@@ -0,0 +1,58 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienstroheker/AzHexGate/internal/oidc/oidctest"
+)
+
+func TestDiscover(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	provider, err := Discover(context.Background(), http.DefaultClient, issuer.URL)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if provider.Issuer != issuer.URL || provider.JWKSURI != issuer.URL+"/jwks" ||
+		provider.TokenEndpoint != issuer.URL+"/token" || provider.DeviceAuthorizationEndpoint != issuer.URL+"/device" {
+		t.Errorf("Unexpected provider metadata %+v", provider)
+	}
+}
+
+func TestDiscover_Errors(t *testing.T) {
+	issuer := oidctest.NewIssuer(nil)
+	defer issuer.Close()
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not json"))
+	}))
+	defer invalid.Close()
+
+	tests := []struct {
+		name   string
+		issuer string
+	}{
+		// The metadata names the issuer without the trailing slash, so it does not match
+		{name: "other issuer", issuer: issuer.URL + "/"},
+		{name: "not found", issuer: notFound.URL},
+		{name: "invalid metadata", issuer: invalid.URL},
+		{name: "unreachable", issuer: "http://127.0.0.1:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Discover(context.Background(), http.DefaultClient, tt.issuer)
+			if !errors.Is(err, ErrDiscovery) {
+				t.Errorf("Expected ErrDiscovery, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+// Package oidctest provides an in-process OpenID Connect provider for tests. It serves discovery, JWKS,
+// device authorization and token endpoints, and signs tokens with keys that can be rotated.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DeviceCode is the device code handed out by the device authorization endpoint
+	DeviceCode = "test-device-code"
+
+	// UserCode is the code users are asked to enter on the verification page
+	UserCode = "TEST-CODE"
+
+	// grantDeviceCode is the grant type of device access token requests (RFC 8628)
+	grantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// Options contains configuration for the Issuer
+type Options struct {
+	// Audience is the aud claim of access tokens (optional, defaults to "azhexgate")
+	Audience string
+
+	// Algorithm signs tokens, "ES256" or "RS256" (optional, defaults to ES256)
+	Algorithm string
+
+	// Subject is the sub claim of issued tokens (optional, defaults to "test-user")
+	Subject string
+
+	// Interval is the polling interval in seconds returned for device authorizations (optional, defaults to 1)
+	Interval int
+
+	// TokenLifetime is how long issued tokens are valid (optional, defaults to an hour)
+	TokenLifetime time.Duration
+}
+
+// Issuer is an OpenID Connect provider listening on a local test server
+type Issuer struct {
+	// URL is the issuer identifier and the base URL of its endpoints
+	URL string
+
+	server    *httptest.Server
+	audience  string
+	algorithm string
+	subject   string
+	interval  int
+	lifetime  time.Duration
+
+	mu           sync.Mutex
+	keys         []signingKey
+	nextKeyID    int
+	jwksRequests int
+	pendingPolls int
+	denied       bool
+	refreshes    int
+}
+
+// signingKey is a key published in the JWKS
+type signingKey struct {
+	id     string
+	signer crypto.Signer
+}
+
+// NewIssuer starts a new issuer; Close it when done
+func NewIssuer(opts *Options) *Issuer {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	i := &Issuer{
+		audience:  opts.Audience,
+		algorithm: opts.Algorithm,
+		subject:   opts.Subject,
+		interval:  opts.Interval,
+		lifetime:  opts.TokenLifetime,
+	}
+	if i.audience == "" {
+		i.audience = "azhexgate"
+	}
+	if i.algorithm == "" {
+		i.algorithm = "ES256"
+	}
+	if i.subject == "" {
+		i.subject = "test-user"
+	}
+	if i.interval <= 0 {
+		i.interval = 1
+	}
+	if i.lifetime <= 0 {
+		i.lifetime = time.Hour
+	}
+	i.keys = []signingKey{i.newKey()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET /jwks", i.jwks)
+	mux.HandleFunc("POST /device", i.device)
+	mux.HandleFunc("POST /token", i.token)
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+	return i
+}
+
+// Close shuts the issuer down
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// Audience returns the aud claim of access tokens
+func (i *Issuer) Audience() string {
+	return i.audience
+}
+
+// Token returns a token signed with the current key. It carries iss, aud, sub, iat and exp claims for a
+// valid access token, replaced by the given claims; claims set to nil are left out.
+func (i *Issuer) Token(claims map[string]any) string {
+	now := time.Now()
+	merged := map[string]any{
+		"iss": i.URL,
+		"aud": i.audience,
+		"sub": i.subject,
+		"iat": now.Unix(),
+		"exp": now.Add(i.lifetime).Unix(),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = value
+	}
+	return i.Sign(merged)
+}
+
+// Sign returns a token holding exactly the given claims, signed with the current key
+func (i *Issuer) Sign(claims map[string]any) string {
+	i.mu.Lock()
+	key := i.keys[0]
+	i.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": i.algorithm, "kid": key.id, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := encode(header) + "." + encode(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	var signature []byte
+	switch signer := key.signer.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, signer, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + encode(signature)
+}
+
+// RotateKey starts signing with a new key. The previous key stays published when keepPrevious is set
+// and is dropped from the JWKS otherwise.
+func (i *Issuer) RotateKey(keepPrevious bool) {
+	key := i.newKey()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if keepPrevious {
+		i.keys = append([]signingKey{key}, i.keys...)
+	} else {
+		i.keys = []signingKey{key}
+	}
+}
+
+// JWKSRequests returns how many times the JWKS was fetched
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+// SetPendingPolls makes the token endpoint answer authorization_pending to the next n device code polls
+func (i *Issuer) SetPendingPolls(n int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pendingPolls = n
+}
+
+// Deny makes the token endpoint answer access_denied to device code polls, as if the user declined
+func (i *Issuer) Deny() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.denied = true
+}
+
+// Refreshes returns how many tokens were issued for refresh tokens
+func (i *Issuer) Refreshes() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.refreshes
+}
+
+// newKey generates a signing key for the configured algorithm
+func (i *Issuer) newKey() signingKey {
+	var signer crypto.Signer
+	if i.algorithm == "RS256" {
+		signer, _ = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		signer, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.nextKeyID++
+	return signingKey{id: "key-" + strconv.Itoa(i.nextKeyID), signer: signer}
+}
+
+// discovery serves the provider metadata
+func (i *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                        i.URL,
+		"jwks_uri":                      i.URL + "/jwks",
+		"token_endpoint":                i.URL + "/token",
+		"device_authorization_endpoint": i.URL + "/device",
+	})
+}
+
+// jwks serves the published keys
+func (i *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	i.mu.Lock()
+	i.jwksRequests++
+	keys := make([]map[string]string, 0, len(i.keys))
+	for _, key := range i.keys {
+		keys = append(keys, jwk(key, i.algorithm))
+	}
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+// device starts a device authorization
+func (i *Issuer) device(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("client_id") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"device_code":               DeviceCode,
+		"user_code":                 UserCode,
+		"verification_uri":          i.URL + "/activate",
+		"verification_uri_complete": i.URL + "/activate?user_code=" + UserCode,
+		"expires_in":                600,
+		"interval":                  i.interval,
+	})
+}
+
+// token issues tokens for approved device codes and refresh tokens
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	switch r.PostFormValue("grant_type") {
+	case grantDeviceCode:
+		if r.PostFormValue("device_code") != DeviceCode {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		i.mu.Lock()
+		denied, pending := i.denied, i.pendingPolls > 0
+		if pending {
+			i.pendingPolls--
+		}
+		i.mu.Unlock()
+
+		switch {
+		case denied:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "access_denied"})
+		case pending:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+		default:
+			i.issue(w, r.PostFormValue("client_id"))
+		}
+	case "refresh_token":
+		if !strings.HasPrefix(r.PostFormValue("refresh_token"), "refresh-") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		i.mu.Lock()
+		i.refreshes++
+		i.mu.Unlock()
+		i.issue(w, r.PostFormValue("client_id"))
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	}
+}
+
+// issue writes a token response with an access token, an ID token for the client and a refresh token
+func (i *Issuer) issue(w http.ResponseWriter, clientID string) {
+	i.mu.Lock()
+	refresh := "refresh-" + strconv.Itoa(i.refreshes)
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  i.Token(nil),
+		"id_token":      i.Token(map[string]any{"aud": clientID}),
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    int(i.lifetime / time.Second),
+	})
+}
+
+// jwk returns the public JSON Web Key of a signing key
+func jwk(key signingKey, algorithm string) map[string]string {
+	switch public := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "kid": key.id, "use": "sig", "alg": algorithm,
+			"n": encode(public.N.Bytes()),
+			"e": encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		point, _ := public.Bytes()
+		return map[string]string{
+			"kty": "EC", "kid": key.id, "use": "sig", "alg": algorithm, "crv": "P-256",
+			"x": encode(point[1:33]),
+			"y": encode(point[33:]),
+		}
+	default:
+		return nil
+	}
+}
+
+// encode returns data base64url-encoded without padding
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
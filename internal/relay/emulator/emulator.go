@@ -0,0 +1,434 @@
+package emulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/julienstroheker/AzHexGate/internal/logging"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
+)
+
+const (
+	// hybridConnectionPathPrefix is the path prefix of every Hybrid Connections endpoint
+	hybridConnectionPathPrefix = "/$hc/"
+
+	// defaultRendezvousTimeout bounds how long a sender waits for a listener to accept
+	defaultRendezvousTimeout = 30 * time.Second
+
+	// closeTimeout bounds how long we wait to send a close frame before dropping a socket
+	closeTimeout = time.Second
+
+	// authorizationHeader carries the SAS token on listen and connect handshakes
+	authorizationHeader = "ServiceBusAuthorization"
+
+	// tokenQueryParameter carries the SAS token when it is not sent as a header
+	tokenQueryParameter = "sb-hc-token"
+)
+
+// Hybrid Connections actions, received as the sb-hc-action query parameter
+const (
+	actionListen  = "listen"
+	actionAccept  = "accept"
+	actionConnect = "connect"
+)
+
+// Options contains configuration for the Emulator
+type Options struct {
+	// Logger is used for debug logging (optional)
+	Logger *logging.Logger
+
+	// RendezvousTimeout bounds how long a sender waits for a listener to accept (optional, defaults to 30s)
+	RendezvousTimeout time.Duration
+
+	// Keys are the shared access keys SAS tokens must be signed with.
+	// When empty, token validation is disabled and any client is accepted.
+	Keys []sas.Key
+
+	// ListenKeys are shared access keys whose tokens may only listen, like a policy with Listen rights (optional)
+	ListenKeys []sas.Key
+}
+
+// acceptMessage is sent to a listener on its control channel when a sender connects
+type acceptMessage struct {
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+// controlMessage is the envelope of every message sent on the control channel
+type controlMessage struct {
+	Accept *acceptMessage `json:"accept,omitempty"`
+}
+
+// listener is a registered control channel for a hybrid connection
+type listener struct {
+	ws      *websocket.Conn
+	baseURL string
+	writeMu sync.Mutex
+}
+
+// Emulator is a local stand-in for Azure Relay Hybrid Connections.
+// It speaks the listener and sender WebSocket protocols and pairs each sender
+// with a listener registered on the same hybrid connection name.
+type Emulator struct {
+	logger            *logging.Logger
+	rendezvousTimeout time.Duration
+	validator         *sas.Validator
+	listenOnly        map[string]bool
+	upgrader          websocket.Upgrader
+
+	mu        sync.Mutex
+	listeners map[string][]*listener
+	next      map[string]int
+	pending   map[string]*rendezvous
+}
+
+// rendezvous pairs a sender waiting in handleConnect with the socket a listener opens through handleAccept
+type rendezvous struct {
+	// conn hands the listener socket to the sender
+	conn chan *websocket.Conn
+
+	// abandoned is closed once the sender stops waiting, so a socket accepted too late is closed, not leaked
+	abandoned chan struct{}
+}
+
+// New creates a new relay emulator
+func New(opts *Options) *Emulator {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	rendezvousTimeout := opts.RendezvousTimeout
+	if rendezvousTimeout == 0 {
+		rendezvousTimeout = defaultRendezvousTimeout
+	}
+
+	var validator *sas.Validator
+	if len(opts.Keys) > 0 || len(opts.ListenKeys) > 0 {
+		validator = sas.NewValidator(append(slices.Clone(opts.Keys), opts.ListenKeys...)...)
+	}
+	listenOnly := make(map[string]bool, len(opts.ListenKeys))
+	for _, key := range opts.ListenKeys {
+		listenOnly[key.Name] = true
+	}
+
+	return &Emulator{
+		logger:            opts.Logger,
+		rendezvousTimeout: rendezvousTimeout,
+		validator:         validator,
+		listenOnly:        listenOnly,
+		listeners:         make(map[string][]*listener),
+		next:              make(map[string]int),
+		pending:           make(map[string]*rendezvous),
+	}
+}
+
+// ServeHTTP dispatches Hybrid Connections requests by their sb-hc-action
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, hybridConnectionPathPrefix) {
+		writeError(w, http.StatusNotFound, "The Hybrid Connection path is invalid")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, hybridConnectionPathPrefix)
+	if name == "" {
+		writeError(w, http.StatusNotFound, "The Hybrid Connection path is invalid")
+		return
+	}
+
+	switch r.URL.Query().Get("sb-hc-action") {
+	case actionListen:
+		if e.authorize(w, r, name, actionListen) {
+			e.handleListen(w, r, name)
+		}
+	case actionAccept:
+		// The rendezvous address is single use and unguessable, so it carries no token
+		e.handleAccept(w, r)
+	case actionConnect:
+		if e.authorize(w, r, name, actionConnect) {
+			e.handleConnect(w, r, name)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "Missing or unsupported sb-hc-action")
+	}
+}
+
+// authorize validates the SAS token of a listen or connect request against the hybrid connection.
+// It writes a 401 response and returns false when the token is missing, invalid, expired, wrongly scoped
+// or signed with a listen-only key for a connect request.
+func (e *Emulator) authorize(w http.ResponseWriter, r *http.Request, name, action string) bool {
+	if e.validator == nil {
+		return true
+	}
+
+	token := r.Header.Get(authorizationHeader)
+	if token == "" {
+		token = r.URL.Query().Get(tokenQueryParameter)
+	}
+	if token == "" {
+		writeError(w, http.StatusUnauthorized, "Missing SAS token")
+		return false
+	}
+
+	resourceURI, err := sas.ResourceURI(websocketBaseURL(r), name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	parsed, err := e.validator.Validate(token, resourceURI)
+	if err != nil {
+		e.debug("Rejected relay token",
+			logging.String("hybrid_connection", name),
+			logging.Error(err))
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return false
+	}
+	if action == actionConnect && e.listenOnly[parsed.KeyName] {
+		writeError(w, http.StatusUnauthorized, "The token does not grant Send rights")
+		return false
+	}
+	return true
+}
+
+// Close drops every registered control channel
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, listeners := range e.listeners {
+		for _, l := range listeners {
+			_ = l.ws.Close()
+		}
+		delete(e.listeners, name)
+	}
+	return nil
+}
+
+// ListenerCount returns the number of listeners registered on a hybrid connection
+func (e *Emulator) ListenerCount(name string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.listeners[name])
+}
+
+// handleListen registers a control channel and keeps it open until the listener goes away
+func (e *Emulator) handleListen(w http.ResponseWriter, r *http.Request, name string) {
+	ws, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	l := &listener{
+		ws:      ws,
+		baseURL: websocketBaseURL(r),
+	}
+	e.register(name, l)
+	defer e.unregister(name, l)
+
+	e.debug("Listener connected", logging.String("hybrid_connection", name))
+
+	// Read until the control channel fails; pings are answered by the WebSocket library
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	e.debug("Listener disconnected", logging.String("hybrid_connection", name))
+}
+
+// handleAccept completes a rendezvous started by handleConnect
+func (e *Emulator) handleAccept(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("sb-hc-id")
+
+	e.mu.Lock()
+	rv, ok := e.pending[id]
+	delete(e.pending, id)
+	e.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown or expired rendezvous")
+		return
+	}
+
+	ws, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	select {
+	case rv.conn <- ws:
+	case <-rv.abandoned:
+		// The sender gave up while the listener was connecting
+		_ = ws.Close()
+	}
+}
+
+// handleConnect asks a listener to accept, then pairs the sender with the rendezvous socket
+func (e *Emulator) handleConnect(w http.ResponseWriter, r *http.Request, name string) {
+	l := e.pick(name)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "There are no listeners connected for the endpoint")
+		return
+	}
+
+	id := uuid.New().String()
+	rv := &rendezvous{conn: make(chan *websocket.Conn), abandoned: make(chan struct{})}
+	e.mu.Lock()
+	e.pending[id] = rv
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.pending, id)
+		e.mu.Unlock()
+		close(rv.abandoned)
+	}()
+
+	if err := l.sendAccept(name, id); err != nil {
+		writeError(w, http.StatusNotFound, "There are no listeners connected for the endpoint")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), e.rendezvousTimeout)
+	defer cancel()
+
+	var listenerWS *websocket.Conn
+	select {
+	case listenerWS = <-rv.conn:
+	case <-ctx.Done():
+		writeError(w, http.StatusGatewayTimeout, "The listener did not accept the connection in time")
+		return
+	}
+	defer func() { _ = listenerWS.Close() }()
+
+	senderWS, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = senderWS.Close() }()
+
+	e.debug("Rendezvous established",
+		logging.String("hybrid_connection", name),
+		logging.String("id", id))
+
+	pipe(senderWS, listenerWS)
+}
+
+// register adds a listener to the hybrid connection
+func (e *Emulator) register(name string, l *listener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners[name] = append(e.listeners[name], l)
+}
+
+// unregister removes a listener from the hybrid connection
+func (e *Emulator) unregister(name string, l *listener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	listeners := e.listeners[name]
+	for i, candidate := range listeners {
+		if candidate == l {
+			listeners = append(listeners[:i], listeners[i+1:]...)
+			break
+		}
+	}
+	if len(listeners) == 0 {
+		delete(e.listeners, name)
+		delete(e.next, name)
+		return
+	}
+	e.listeners[name] = listeners
+}
+
+// pick selects the next listener for a hybrid connection in round-robin order
+func (e *Emulator) pick(name string) *listener {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	listeners := e.listeners[name]
+	if len(listeners) == 0 {
+		return nil
+	}
+	l := listeners[e.next[name]%len(listeners)]
+	e.next[name]++
+	return l
+}
+
+// debug logs a debug message when a logger is configured
+func (e *Emulator) debug(msg string, fields ...logging.Field) {
+	if e.logger != nil {
+		e.logger.Debug(msg, fields...)
+	}
+}
+
+// sendAccept writes an accept message pointing at the rendezvous address to the control channel
+func (l *listener) sendAccept(name, id string) error {
+	query := url.Values{}
+	query.Set("sb-hc-action", actionAccept)
+	query.Set("sb-hc-id", id)
+	address := l.baseURL + hybridConnectionPathPrefix + name + "?" + query.Encode()
+
+	data, err := json.Marshal(controlMessage{
+		Accept: &acceptMessage{Address: address, ID: id},
+	})
+	if err != nil {
+		return err
+	}
+
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	return l.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// pipe copies messages between two sockets until either side closes,
+// then forwards a normal close frame to the other side
+func pipe(a, b *websocket.Conn) {
+	done := make(chan struct{}, 2)
+	copyMessages := func(dst, src *websocket.Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			msgType, data, err := src.ReadMessage()
+			if err != nil {
+				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				_ = dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+				return
+			}
+			if err := dst.WriteMessage(msgType, data); err != nil {
+				return
+			}
+		}
+	}
+
+	go copyMessages(a, b)
+	go copyMessages(b, a)
+	<-done
+}
+
+// websocketBaseURL returns the ws:// or wss:// base URL a client used to reach the emulator
+func websocketBaseURL(r *http.Request) string {
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// writeError writes a relay-style error response
+func writeError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("X-Ms-Error-Description", description)
+	w.WriteHeader(status)
+}
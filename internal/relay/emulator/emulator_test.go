@@ -0,0 +1,416 @@
+package emulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienstroheker/AzHexGate/internal/relay"
+	"github.com/julienstroheker/AzHexGate/internal/relay/sas"
+)
+
+// startEmulator runs an emulator on a local TCP port and returns its endpoint
+func startEmulator(t *testing.T, opts *Options) (*Emulator, string) {
+	t.Helper()
+
+	e := New(opts)
+	server := httptest.NewServer(e)
+	t.Cleanup(func() {
+		_ = e.Close()
+		server.Close()
+	})
+	return e, server.URL
+}
+
+// waitForListeners blocks until the expected number of listeners are registered
+func waitForListeners(t *testing.T, e *Emulator, name string, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.ListenerCount(name) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d listeners on %s", count, name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serveListener accepts streams on a hybrid connection and answers each one with prefix + payload
+func serveListener(t *testing.T, endpoint, name, prefix string) *relay.HybridConnectionListener {
+	t.Helper()
+
+	listener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: name,
+	})
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				buf := make([]byte, 64)
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte(prefix + string(buf[:n])))
+			}()
+		}
+	}()
+	return listener
+}
+
+// roundTrip dials the hybrid connection, writes payload and reads the reply until EOF
+func roundTrip(t *testing.T, endpoint, name, payload string) string {
+	t.Helper()
+
+	sender := relay.NewHybridConnectionSender(&relay.SenderOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: name,
+	})
+	defer func() { _ = sender.Close() }()
+
+	conn, err := sender.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	return string(reply)
+}
+
+func TestEmulator_SenderToListener(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	serveListener(t, endpoint, "hc-12345678", "echo:")
+	waitForListeners(t, e, "hc-12345678", 1)
+
+	if reply := roundTrip(t, endpoint, "hc-12345678", "hello"); reply != "echo:hello" {
+		t.Errorf("Expected %q, got %q", "echo:hello", reply)
+	}
+}
+
+func TestEmulator_MatchesByName(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	serveListener(t, endpoint, "hc-a", "a:")
+	serveListener(t, endpoint, "hc-b", "b:")
+	waitForListeners(t, e, "hc-a", 1)
+	waitForListeners(t, e, "hc-b", 1)
+
+	if reply := roundTrip(t, endpoint, "hc-a", "x"); reply != "a:x" {
+		t.Errorf("Expected %q, got %q", "a:x", reply)
+	}
+	if reply := roundTrip(t, endpoint, "hc-b", "y"); reply != "b:y" {
+		t.Errorf("Expected %q, got %q", "b:y", reply)
+	}
+}
+
+func TestEmulator_ConcurrentStreams(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	serveListener(t, endpoint, "hc-1", "ok:")
+	waitForListeners(t, e, "hc-1", 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := fmt.Sprintf("req-%d", i)
+			if reply := roundTrip(t, endpoint, "hc-1", payload); reply != "ok:"+payload {
+				t.Errorf("Expected %q, got %q", "ok:"+payload, reply)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestEmulator_RoundRobinAcrossListeners(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	serveListener(t, endpoint, "hc-1", "first:")
+	serveListener(t, endpoint, "hc-1", "second:")
+	waitForListeners(t, e, "hc-1", 2)
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[roundTrip(t, endpoint, "hc-1", "x")] = true
+	}
+	if !seen["first:x"] || !seen["second:x"] {
+		t.Errorf("Expected both listeners to receive streams, got %v", seen)
+	}
+}
+
+func TestEmulator_ListenerOffline(t *testing.T) {
+	_, endpoint := startEmulator(t, nil)
+
+	sender := relay.NewHybridConnectionSender(&relay.SenderOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-nobody",
+	})
+	defer func() { _ = sender.Close() }()
+
+	if _, err := sender.Dial(context.Background()); !errors.Is(err, relay.ErrListenerOffline) {
+		t.Errorf("Expected ErrListenerOffline, got %v", err)
+	}
+}
+
+func TestEmulator_ListenerUnregisteredOnClose(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	listener := serveListener(t, endpoint, "hc-1", "")
+	waitForListeners(t, e, "hc-1", 1)
+
+	_ = listener.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.ListenerCount("hc-1") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Listener was not unregistered after close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEmulator_RendezvousTimeout(t *testing.T) {
+	e, endpoint := startEmulator(t, &Options{RendezvousTimeout: 100 * time.Millisecond})
+
+	// A listener that registers its control channel but never accepts
+	listener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _ = listener.Accept(ctx)
+	waitForListeners(t, e, "hc-1", 1)
+
+	sender := relay.NewHybridConnectionSender(&relay.SenderOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = sender.Close() }()
+
+	_, err := sender.Dial(context.Background())
+	if err == nil {
+		t.Fatal("Expected rendezvous timeout error")
+	}
+	if errors.Is(err, relay.ErrListenerOffline) {
+		t.Errorf("Rendezvous timeout should not be reported as listener offline: %v", err)
+	}
+}
+
+func TestEmulator_LateAcceptClosed(t *testing.T) {
+	e, endpoint := startEmulator(t, nil)
+
+	// A rendezvous the sender gave up on after the listener took it, but before its socket was handed over
+	rv := &rendezvous{conn: make(chan *websocket.Conn), abandoned: make(chan struct{})}
+	close(rv.abandoned)
+	e.mu.Lock()
+	e.pending["late"] = rv
+	e.mu.Unlock()
+
+	url := "ws" + strings.TrimPrefix(endpoint, "http") + "/$hc/hc-1?sb-hc-action=accept&sb-hc-id=late"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer func() { _ = ws.Close() }()
+
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = ws.ReadMessage()
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("Expected the emulator to close the late listener socket, got %v", err)
+	}
+}
+
+func TestEmulator_InvalidRequests(t *testing.T) {
+	_, endpoint := startEmulator(t, nil)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "health", path: "/healthz", status: http.StatusOK},
+		{name: "not a hybrid connection path", path: "/foo", status: http.StatusNotFound},
+		{name: "missing name", path: "/$hc/", status: http.StatusNotFound},
+		{name: "missing action", path: "/$hc/hc-1", status: http.StatusBadRequest},
+		{name: "unknown rendezvous", path: "/$hc/hc-1?sb-hc-action=accept&sb-hc-id=nope", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(endpoint + tt.path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestEmulator_SASValidation(t *testing.T) {
+	key := sas.Key{Name: "RootManageSharedAccessKey", Value: "emulator-secret"}
+	e, endpoint := startEmulator(t, &Options{Keys: []sas.Key{key}})
+
+	tokenFor := func(entity string, expiry time.Time) string {
+		resourceURI, err := sas.ResourceURI(endpoint, entity)
+		if err != nil {
+			t.Fatalf("ResourceURI failed: %v", err)
+		}
+		token, err := sas.Generate(resourceURI, key, expiry)
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		return token
+	}
+
+	listener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-1",
+		Token:                tokenFor("hc-1", time.Now().Add(time.Hour)),
+	})
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	waitForListeners(t, e, "hc-1", 1)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: tokenFor("hc-1", time.Now().Add(time.Hour))},
+		{name: "missing", token: "", wantErr: true},
+		{name: "expired", token: tokenFor("hc-1", time.Now().Add(-time.Minute)), wantErr: true},
+		{name: "wrong scope", token: tokenFor("hc-2", time.Now().Add(time.Hour)), wantErr: true},
+		{name: "wrong key", token: "SharedAccessSignature sr=x&sig=y&se=9999999999&skn=other", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := relay.NewHybridConnectionSender(&relay.SenderOptions{
+				Endpoint:             endpoint,
+				HybridConnectionName: "hc-1",
+				Token:                tt.token,
+			})
+			defer func() { _ = sender.Close() }()
+
+			conn, err := sender.Dial(context.Background())
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected dial to succeed, got %v", err)
+				}
+				_ = conn.Close()
+				return
+			}
+			if !errors.Is(err, relay.ErrUnauthorized) {
+				t.Errorf("Expected ErrUnauthorized, got %v", err)
+			}
+		})
+	}
+
+	// A listener with a token for another hybrid connection is rejected
+	wrongListener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-1",
+		Token:                tokenFor("hc-2", time.Now().Add(time.Hour)),
+	})
+	defer func() { _ = wrongListener.Close() }()
+	if _, err := wrongListener.Accept(context.Background()); !errors.Is(err, relay.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for wrongly scoped listener, got %v", err)
+	}
+}
+
+func TestEmulator_ListenOnlyKeys(t *testing.T) {
+	sendKey := sas.Key{Name: "RootManageSharedAccessKey", Value: "send-secret"}
+	listenKey := sas.Key{Name: "Listen", Value: "listen-secret"}
+	e, endpoint := startEmulator(t, &Options{Keys: []sas.Key{sendKey}, ListenKeys: []sas.Key{listenKey}})
+
+	tokenFor := func(key sas.Key) string {
+		resourceURI, _ := sas.ResourceURI(endpoint, "hc-1")
+		token, err := sas.Generate(resourceURI, key, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		return token
+	}
+
+	// A listen-only token may listen
+	listener := relay.NewHybridConnectionListener(&relay.ListenerOptions{
+		Endpoint:             endpoint,
+		HybridConnectionName: "hc-1",
+		Token:                tokenFor(listenKey),
+	})
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	waitForListeners(t, e, "hc-1", 1)
+
+	dial := func(key sas.Key) error {
+		sender := relay.NewHybridConnectionSender(&relay.SenderOptions{
+			Endpoint:             endpoint,
+			HybridConnectionName: "hc-1",
+			Token:                tokenFor(key),
+		})
+		defer func() { _ = sender.Close() }()
+
+		conn, err := sender.Dial(context.Background())
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err
+	}
+
+	// but not send
+	if err := dial(listenKey); !errors.Is(err, relay.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized sending with a listen-only token, got %v", err)
+	}
+	if err := dial(sendKey); err != nil {
+		t.Errorf("Expected sending with the send key to succeed, got %v", err)
+	}
+}
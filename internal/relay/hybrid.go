@@ -0,0 +1,175 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// authorizationHeader carries the SAS or AAD token on Hybrid Connections handshakes
+	authorizationHeader = "ServiceBusAuthorization"
+
+	// handshakeTimeout bounds the WebSocket opening handshake with the relay
+	handshakeTimeout = 30 * time.Second
+
+	// closeTimeout bounds how long we wait to send a close frame before dropping the socket
+	closeTimeout = time.Second
+)
+
+// Hybrid Connections actions, sent as the sb-hc-action query parameter
+const (
+	actionListen  = "listen"
+	actionAccept  = "accept"
+	actionConnect = "connect"
+)
+
+var (
+	// ErrListenerOffline is returned when no listener is connected to the hybrid connection
+	ErrListenerOffline = errors.New("relay listener is offline")
+	// ErrUnauthorized is returned when the relay rejects the presented token
+	ErrUnauthorized = errors.New("relay authorization failed")
+)
+
+// hybridConnectionURL builds the WebSocket URL for a Hybrid Connections action.
+// The endpoint may use the https, sb or wss schemes (secure) or http and ws (plain, for local stand-ins).
+func hybridConnectionURL(endpoint, name, action, id string) (*url.URL, error) {
+	if name == "" {
+		return nil, errors.New("hybrid connection name is required")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay endpoint %q: %w", endpoint, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid relay endpoint %q: missing host", endpoint)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https", "sb", "wss":
+		u.Scheme = "wss"
+	case "http", "ws":
+		u.Scheme = "ws"
+	default:
+		return nil, fmt.Errorf("invalid relay endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+	}
+
+	u.Path = "/$hc/" + name
+	u.RawPath = ""
+	query := url.Values{}
+	query.Set("sb-hc-action", action)
+	if id != "" {
+		query.Set("sb-hc-id", id)
+	}
+	u.RawQuery = query.Encode()
+
+	return u, nil
+}
+
+// newDialer returns the WebSocket dialer used for relay handshakes
+func newDialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: handshakeTimeout,
+	}
+}
+
+// handshakeError converts a failed WebSocket handshake into a descriptive error.
+// Authorization failures wrap ErrUnauthorized, and a missing listener on connect wraps ErrListenerOffline.
+func handshakeError(action string, resp *http.Response, err error) error {
+	if resp == nil {
+		return fmt.Errorf("relay %s failed: %w", action, err)
+	}
+
+	description := resp.Header.Get("X-Ms-Error-Description")
+	if description == "" {
+		description = http.StatusText(resp.StatusCode)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: relay %s failed with status %d: %s",
+			ErrUnauthorized, action, resp.StatusCode, description)
+	case resp.StatusCode == http.StatusNotFound && action == actionConnect:
+		return fmt.Errorf("%w: relay %s failed with status %d: %s",
+			ErrListenerOffline, action, resp.StatusCode, description)
+	}
+	return fmt.Errorf("relay %s failed with status %d: %s", action, resp.StatusCode, description)
+}
+
+// websocketConnection adapts a rendezvous WebSocket to the Connection interface.
+// The stream is carried as binary messages; message boundaries are not significant.
+type websocketConnection struct {
+	ws *websocket.Conn
+
+	readMu sync.Mutex
+	reader io.Reader
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// newWebsocketConnection wraps an established WebSocket
+func newWebsocketConnection(ws *websocket.Conn) *websocketConnection {
+	return &websocketConnection{ws: ws}
+}
+
+// Read reads stream data from the next available message
+func (c *websocketConnection) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			// Current message exhausted, continue with the next one
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write sends p as a single binary message
+func (c *websocketConnection) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame and closes the underlying socket
+func (c *websocketConnection) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		_ = c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+		err = c.ws.Close()
+	})
+	return err
+}
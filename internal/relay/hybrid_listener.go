@@ -0,0 +1,311 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// controlPingInterval keeps the control channel alive across idle periods
+const controlPingInterval = 30 * time.Second
+
+var (
+	// ErrControlChannelClosed is returned by Accept when the control channel to the relay is lost
+	ErrControlChannelClosed = errors.New("relay control channel closed")
+
+	// ErrRendezvousFailed is returned by an accepted connection whose rendezvous could not be dialed,
+	// e.g. because the sender gave up waiting
+	ErrRendezvousFailed = errors.New("relay rendezvous failed")
+)
+
+// ListenerOptions contains configuration for a HybridConnectionListener
+type ListenerOptions struct {
+	// Endpoint is the relay namespace endpoint (e.g., "https://ns.servicebus.windows.net")
+	Endpoint string
+
+	// HybridConnectionName is the name of the hybrid connection to listen on
+	HybridConnectionName string
+
+	// Token is the Listener SAS token presented to the relay
+	Token string
+}
+
+// acceptMessage is sent by the relay on the control channel when a sender connects
+type acceptMessage struct {
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+// controlMessage is the envelope of every message received on the control channel
+type controlMessage struct {
+	Accept *acceptMessage `json:"accept,omitempty"`
+}
+
+// controlChannel is a single listen WebSocket and the accept messages read from it
+type controlChannel struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+	accepts chan *acceptMessage
+	done    chan struct{}
+	err     error
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// HybridConnectionListener is a Listener backed by an Azure Relay Hybrid Connection.
+// It keeps a control channel open to the relay and, for every accept message,
+// dials the rendezvous address to obtain the stream for that sender. Each rendezvous is dialed
+// in the background, so a slow or failed one does not hold up the next Accept.
+type HybridConnectionListener struct {
+	endpoint string
+	name     string
+	token    string
+	dialer   *websocket.Dialer
+
+	mu      sync.Mutex
+	control *controlChannel
+	closed  bool
+	closeCh chan struct{}
+}
+
+// NewHybridConnectionListener creates a new Azure Relay Hybrid Connections listener.
+// The control channel is opened on the first call to Accept.
+func NewHybridConnectionListener(opts *ListenerOptions) *HybridConnectionListener {
+	if opts == nil {
+		opts = &ListenerOptions{}
+	}
+
+	return &HybridConnectionListener{
+		endpoint: opts.Endpoint,
+		name:     opts.HybridConnectionName,
+		token:    opts.Token,
+		dialer:   newDialer(),
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Accept waits for the next sender and returns its rendezvous stream.
+// The stream is dialed in the background; its first Read or Write waits for it and fails with
+// ErrRendezvousFailed when the rendezvous could not be completed.
+func (l *HybridConnectionListener) Accept(ctx context.Context) (Connection, error) {
+	control, err := l.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.closeCh:
+		return nil, ErrListenerClosed
+	case <-control.done:
+		return nil, fmt.Errorf("%w: %v", ErrControlChannelClosed, control.err)
+	case msg := <-control.accepts:
+		return l.rendezvous(msg), nil
+	}
+}
+
+// Close closes the control channel and stops accepting connections
+func (l *HybridConnectionListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.closeCh)
+
+	if l.control != nil {
+		l.control.close()
+		l.control = nil
+	}
+	return nil
+}
+
+// open returns the current control channel, establishing a new one if needed
+func (l *HybridConnectionListener) open(ctx context.Context) (*controlChannel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrListenerClosed
+	}
+
+	if l.control != nil {
+		select {
+		case <-l.control.done:
+			// Previous control channel was lost, establish a new one
+			l.control = nil
+		default:
+			return l.control, nil
+		}
+	}
+
+	u, err := hybridConnectionURL(l.endpoint, l.name, actionListen, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if l.token != "" {
+		header.Set(authorizationHeader, l.token)
+	}
+
+	ws, resp, err := l.dialer.DialContext(ctx, u.String(), header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, handshakeError(actionListen, resp, err)
+	}
+
+	control := &controlChannel{
+		ws:      ws,
+		accepts: make(chan *acceptMessage, 16),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go control.readLoop()
+	go control.pingLoop()
+
+	l.control = control
+	return control, nil
+}
+
+// rendezvous starts dialing the address from an accept message and returns the sender's stream
+func (l *HybridConnectionListener) rendezvous(msg *acceptMessage) Connection {
+	conn := &rendezvousConnection{ready: make(chan struct{}), closing: make(chan struct{})}
+	go conn.dial(l.dialer, msg.Address)
+	return conn
+}
+
+// rendezvousConnection is the stream of an accepted sender while its rendezvous is being dialed
+type rendezvousConnection struct {
+	ready chan struct{}
+
+	// conn and err hold the outcome of the dial once ready is closed
+	conn *websocketConnection
+	err  error
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// dial dials the rendezvous address and records the outcome, closing the stream if it was closed meanwhile
+func (c *rendezvousConnection) dial(dialer *websocket.Dialer, address string) {
+	ws, resp, err := dialer.DialContext(context.Background(), address, nil)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		c.err = fmt.Errorf("%w: %w", ErrRendezvousFailed, handshakeError(actionAccept, resp, err))
+		close(c.ready)
+		return
+	}
+	c.conn = newWebsocketConnection(ws)
+	close(c.ready)
+
+	select {
+	case <-c.closing:
+		_ = c.conn.Close()
+	default:
+	}
+}
+
+// Read waits for the rendezvous and reads from the stream
+func (c *rendezvousConnection) Read(p []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(p)
+}
+
+// Write waits for the rendezvous and writes to the stream
+func (c *rendezvousConnection) Write(p []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Write(p)
+}
+
+// Close closes the stream without waiting for a rendezvous still being dialed; that one is closed once it completes
+func (c *rendezvousConnection) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	select {
+	case <-c.ready:
+		if c.conn != nil {
+			return c.conn.Close()
+		}
+	default:
+	}
+	return nil
+}
+
+// readLoop reads control messages until the channel fails, queuing accept messages
+func (c *controlChannel) readLoop() {
+	defer close(c.done)
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		var msg controlMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		// Only accept messages are handled; relayed HTTP requests are not supported
+		if msg.Accept != nil {
+			select {
+			case c.accepts <- msg.Accept:
+			case <-c.closing:
+				return
+			}
+		}
+	}
+}
+
+// pingLoop periodically pings the relay so idle control channels are not dropped
+func (c *controlChannel) pingLoop() {
+	ticker := time.NewTicker(controlPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(closeTimeout))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close sends a close frame and closes the control WebSocket
+func (c *controlChannel) close() {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	c.writeMu.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+	c.writeMu.Unlock()
+	_ = c.ws.Close()
+}
@@ -0,0 +1,293 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// acceptAsync runs Accept in a goroutine so the test can drive the fake relay meanwhile
+func acceptAsync(ctx context.Context, listener *HybridConnectionListener) (<-chan Connection, <-chan error) {
+	connCh := make(chan Connection, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		connCh <- conn
+	}()
+	return connCh, errCh
+}
+
+// waitForAccept waits for the result of acceptAsync
+func waitForAccept(t *testing.T, connCh <-chan Connection, errCh <-chan error) Connection {
+	t.Helper()
+
+	select {
+	case conn := <-connCh:
+		return conn
+	case err := <-errCh:
+		t.Fatalf("Accept failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for Accept")
+	}
+	return nil
+}
+
+func TestHybridConnectionListener_AcceptAndStream(t *testing.T) {
+	fake := newFakeRelay(t)
+	fake.token = "SharedAccessSignature sr=test"
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-12345678",
+		Token:                "SharedAccessSignature sr=test",
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx := context.Background()
+	connCh, errCh := acceptAsync(ctx, listener)
+
+	name := fake.waitForListener()
+	if name != "hc-12345678" {
+		t.Fatalf("Expected listener on hc-12345678, got %s", name)
+	}
+
+	relaySide := fake.connect(name)
+	defer func() { _ = relaySide.Close() }()
+
+	conn := waitForAccept(t, connCh, errCh)
+	defer func() { _ = conn.Close() }()
+
+	// Sender to listener
+	if err := relaySide.WriteMessage(websocket.BinaryMessage, []byte("hello from sender")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	buf := make([]byte, len("hello from sender"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(buf) != "hello from sender" {
+		t.Errorf("Expected %q, got %q", "hello from sender", string(buf))
+	}
+
+	// Listener to sender
+	if _, err := conn.Write([]byte("hello from listener")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	msgType, data, err := relaySide.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if msgType != websocket.BinaryMessage {
+		t.Errorf("Expected binary message, got type %d", msgType)
+	}
+	if string(data) != "hello from listener" {
+		t.Errorf("Expected %q, got %q", "hello from listener", string(data))
+	}
+}
+
+func TestHybridConnectionListener_ReadAcrossMessages(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	connCh, errCh := acceptAsync(context.Background(), listener)
+	relaySide := fake.connect(fake.waitForListener())
+	defer func() { _ = relaySide.Close() }()
+	conn := waitForAccept(t, connCh, errCh)
+	defer func() { _ = conn.Close() }()
+
+	for _, part := range []string{"GET / HTTP/1.1\r\n", "Host: example.com\r\n", "\r\n"} {
+		if err := relaySide.WriteMessage(websocket.BinaryMessage, []byte(part)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	expected := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(buf) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(buf))
+	}
+}
+
+func TestHybridConnectionListener_EOFOnSenderClose(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	connCh, errCh := acceptAsync(context.Background(), listener)
+	relaySide := fake.connect(fake.waitForListener())
+	conn := waitForAccept(t, connCh, errCh)
+	defer func() { _ = conn.Close() }()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = relaySide.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("Expected io.EOF after sender close, got %v", err)
+	}
+	_ = relaySide.Close()
+}
+
+func TestHybridConnectionListener_InvalidToken(t *testing.T) {
+	fake := newFakeRelay(t)
+	fake.token = "expected-token"
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+		Token:                "wrong-token",
+	})
+	defer func() { _ = listener.Close() }()
+
+	_, err := listener.Accept(context.Background())
+	if err == nil {
+		t.Fatal("Expected error for invalid token")
+	}
+	if !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected error to mention status 401, got: %v", err)
+	}
+}
+
+func TestHybridConnectionListener_CloseUnblocksAccept(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+
+	_, errCh := acceptAsync(context.Background(), listener)
+	fake.waitForListener()
+
+	if err := listener.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrListenerClosed) {
+			t.Errorf("Expected ErrListenerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept was not unblocked by Close")
+	}
+
+	// Accept after close fails immediately
+	if _, err := listener.Accept(context.Background()); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("Expected ErrListenerClosed, got %v", err)
+	}
+
+	// Close is idempotent
+	if err := listener.Close(); err != nil {
+		t.Errorf("Second close failed: %v", err)
+	}
+}
+
+func TestHybridConnectionListener_ContextCancellation(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := listener.Accept(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestHybridConnectionListener_ControlChannelLost(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	_, errCh := acceptAsync(context.Background(), listener)
+	name := fake.waitForListener()
+	fake.dropListener(name)
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrControlChannelClosed) {
+			t.Errorf("Expected ErrControlChannelClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept did not report the lost control channel")
+	}
+
+	// The next Accept re-establishes the control channel
+	connCh, errCh := acceptAsync(context.Background(), listener)
+	relaySide := fake.connect(fake.waitForListener())
+	defer func() { _ = relaySide.Close() }()
+	conn := waitForAccept(t, connCh, errCh)
+	_ = conn.Close()
+}
+
+func TestHybridConnectionListener_FailedRendezvous(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+	})
+	defer func() { _ = listener.Close() }()
+
+	connCh, errCh := acceptAsync(context.Background(), listener)
+	name := fake.waitForListener()
+	fake.abandon(name)
+
+	// The failed rendezvous is reported by the connection, not by Accept
+	abandoned := waitForAccept(t, connCh, errCh)
+	defer func() { _ = abandoned.Close() }()
+	if _, err := abandoned.Read(make([]byte, 1)); !errors.Is(err, ErrRendezvousFailed) {
+		t.Errorf("Expected ErrRendezvousFailed, got %v", err)
+	}
+
+	// The next sender is accepted at once
+	start := time.Now()
+	connCh, errCh = acceptAsync(context.Background(), listener)
+	relaySide := fake.connect(name)
+	defer func() { _ = relaySide.Close() }()
+	conn := waitForAccept(t, connCh, errCh)
+	defer func() { _ = conn.Close() }()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the next accept to succeed at once, took %v", elapsed)
+	}
+
+	if err := relaySide.WriteMessage(websocket.BinaryMessage, []byte("ping")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("Expected to read %q, got %q (%v)", "ping", string(buf), err)
+	}
+}
@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// TokenProvider returns the token to present on a relay handshake.
+// It is called for every Dial so that short-lived AAD tokens can be refreshed.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// SenderOptions contains configuration for a HybridConnectionSender
+type SenderOptions struct {
+	// Endpoint is the relay namespace endpoint (e.g., "https://ns.servicebus.windows.net")
+	Endpoint string
+
+	// HybridConnectionName is the name of the hybrid connection to send to
+	HybridConnectionName string
+
+	// Token is a static SAS or AAD token presented to the relay (optional if TokenProvider is set)
+	Token string
+
+	// TokenProvider supplies a fresh token for each Dial and takes precedence over Token (optional)
+	TokenProvider TokenProvider
+}
+
+// HybridConnectionSender is a Sender backed by an Azure Relay Hybrid Connection.
+// Each Dial opens a new sender WebSocket which the relay pairs with the listener.
+type HybridConnectionSender struct {
+	endpoint      string
+	name          string
+	token         string
+	tokenProvider TokenProvider
+	dialer        *websocket.Dialer
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewHybridConnectionSender creates a new Azure Relay Hybrid Connections sender
+func NewHybridConnectionSender(opts *SenderOptions) *HybridConnectionSender {
+	if opts == nil {
+		opts = &SenderOptions{}
+	}
+
+	return &HybridConnectionSender{
+		endpoint:      opts.Endpoint,
+		name:          opts.HybridConnectionName,
+		token:         opts.Token,
+		tokenProvider: opts.TokenProvider,
+		dialer:        newDialer(),
+	}
+}
+
+// Dial opens a sender WebSocket to the hybrid connection and returns it as a stream.
+// It returns an error wrapping ErrListenerOffline when no listener is connected
+// and an error wrapping ErrUnauthorized when the relay rejects the token.
+func (s *HybridConnectionSender) Dial(ctx context.Context) (Connection, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSenderClosed
+	}
+	s.mu.Unlock()
+
+	u, err := hybridConnectionURL(s.endpoint, s.name, actionConnect, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	token := s.token
+	if s.tokenProvider != nil {
+		token, err = s.tokenProvider(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get relay token: %w", err)
+		}
+	}
+
+	header := http.Header{}
+	if token != "" {
+		header.Set(authorizationHeader, token)
+	}
+
+	ws, resp, err := s.dialer.DialContext(ctx, u.String(), header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, handshakeError(actionConnect, resp, err)
+	}
+
+	return newWebsocketConnection(ws), nil
+}
+
+// Close closes the sender. Connections already dialed are not affected.
+func (s *HybridConnectionSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,165 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// startHybridListener registers a listener with the fake relay and echoes every accepted stream
+func startHybridListener(t *testing.T, fake *fakeRelay, name string) {
+	t.Helper()
+
+	listener := NewHybridConnectionListener(&ListenerOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: name,
+		Token:                fake.token,
+	})
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	fake.waitForListener()
+}
+
+func TestHybridConnectionSender_DialAndStream(t *testing.T) {
+	fake := newFakeRelay(t)
+	fake.token = "SharedAccessSignature sr=test"
+	startHybridListener(t, fake, "hc-12345678")
+
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-12345678",
+		Token:                "SharedAccessSignature sr=test",
+	})
+	defer func() { _ = sender.Close() }()
+
+	conn, err := sender.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte("ping through relay")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	buf := make([]byte, len("ping through relay"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(buf) != "ping through relay" {
+		t.Errorf("Expected %q, got %q", "ping through relay", string(buf))
+	}
+}
+
+func TestHybridConnectionSender_TokenProvider(t *testing.T) {
+	fake := newFakeRelay(t)
+	fake.token = "Bearer aad-token"
+	startHybridListener(t, fake, "hc-1")
+
+	calls := 0
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+		Token:                "ignored-static-token",
+		TokenProvider: func(ctx context.Context) (string, error) {
+			calls++
+			return "Bearer aad-token", nil
+		},
+	})
+	defer func() { _ = sender.Close() }()
+
+	conn, err := sender.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	_ = conn.Close()
+
+	if calls != 1 {
+		t.Errorf("Expected token provider to be called once, got %d", calls)
+	}
+}
+
+func TestHybridConnectionSender_TokenProviderError(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	providerErr := errors.New("no managed identity")
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+		TokenProvider: func(ctx context.Context) (string, error) {
+			return "", providerErr
+		},
+	})
+	defer func() { _ = sender.Close() }()
+
+	if _, err := sender.Dial(context.Background()); !errors.Is(err, providerErr) {
+		t.Errorf("Expected token provider error, got %v", err)
+	}
+}
+
+func TestHybridConnectionSender_ListenerOffline(t *testing.T) {
+	fake := newFakeRelay(t)
+
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-offline",
+	})
+	defer func() { _ = sender.Close() }()
+
+	_, err := sender.Dial(context.Background())
+	if !errors.Is(err, ErrListenerOffline) {
+		t.Fatalf("Expected ErrListenerOffline, got %v", err)
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		t.Error("Listener offline error should not be reported as unauthorized")
+	}
+}
+
+func TestHybridConnectionSender_Unauthorized(t *testing.T) {
+	fake := newFakeRelay(t)
+	fake.token = "expected-token"
+	startHybridListener(t, fake, "hc-1")
+
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             fake.endpoint(),
+		HybridConnectionName: "hc-1",
+		Token:                "wrong-token",
+	})
+	defer func() { _ = sender.Close() }()
+
+	_, err := sender.Dial(context.Background())
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected ErrUnauthorized, got %v", err)
+	}
+	if errors.Is(err, ErrListenerOffline) {
+		t.Error("Unauthorized error should not be reported as listener offline")
+	}
+}
+
+func TestHybridConnectionSender_DialAfterClose(t *testing.T) {
+	sender := NewHybridConnectionSender(&SenderOptions{
+		Endpoint:             "https://ns.servicebus.windows.net",
+		HybridConnectionName: "hc-1",
+	})
+
+	if err := sender.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := sender.Dial(context.Background()); !errors.Is(err, ErrSenderClosed) {
+		t.Errorf("Expected ErrSenderClosed, got %v", err)
+	}
+}
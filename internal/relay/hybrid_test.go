@@ -0,0 +1,337 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// fakeRelay is a local stand-in for the Azure Relay Hybrid Connections service.
+// It implements just enough of the listener protocol to exercise the client side without Azure.
+type fakeRelay struct {
+	t        *testing.T
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	// token, when set, is required on listen and connect requests
+	token string
+
+	controlMu  sync.Mutex
+	mu         sync.Mutex
+	listeners  map[string]*websocket.Conn
+	pending    map[string]chan *websocket.Conn
+	registered chan string
+}
+
+// newFakeRelay starts a fake relay on a local httptest server
+func newFakeRelay(t *testing.T) *fakeRelay {
+	t.Helper()
+
+	f := &fakeRelay{
+		t:          t,
+		listeners:  make(map[string]*websocket.Conn),
+		pending:    make(map[string]chan *websocket.Conn),
+		registered: make(chan string, 16),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// endpoint returns the relay endpoint URL to configure listeners and senders with
+func (f *fakeRelay) endpoint() string {
+	return f.server.URL
+}
+
+func (f *fakeRelay) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/$hc/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/$hc/")
+
+	switch r.URL.Query().Get("sb-hc-action") {
+	case actionListen:
+		f.handleListen(w, r, name)
+	case actionAccept:
+		f.handleAccept(w, r)
+	case actionConnect:
+		f.handleConnect(w, r, name)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// authorize rejects the request with 401 when it does not carry the expected token
+func (f *fakeRelay) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if f.token != "" && r.Header.Get(authorizationHeader) != f.token {
+		w.Header().Set("X-Ms-Error-Description", "invalid token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (f *fakeRelay) handleListen(w http.ResponseWriter, r *http.Request, name string) {
+	if !f.authorize(w, r) {
+		return
+	}
+
+	ws, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.listeners[name] = ws
+	f.mu.Unlock()
+	f.registered <- name
+
+	// Drain the control channel so pings and close frames are processed
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	f.mu.Lock()
+	if f.listeners[name] == ws {
+		delete(f.listeners, name)
+	}
+	f.mu.Unlock()
+}
+
+func (f *fakeRelay) handleAccept(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("sb-hc-id")
+
+	f.mu.Lock()
+	ch, ok := f.pending[id]
+	delete(f.pending, id)
+	f.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ws, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ch <- ws
+}
+
+// waitForListener blocks until a listener registers its control channel
+func (f *fakeRelay) waitForListener() string {
+	f.t.Helper()
+
+	select {
+	case name := <-f.registered:
+		return name
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("Timed out waiting for listener control channel")
+		return ""
+	}
+}
+
+func (f *fakeRelay) handleConnect(w http.ResponseWriter, r *http.Request, name string) {
+	if !f.authorize(w, r) {
+		return
+	}
+
+	f.mu.Lock()
+	_, ok := f.listeners[name]
+	f.mu.Unlock()
+	if !ok {
+		w.Header().Set("X-Ms-Error-Description", "There are no listeners connected for the endpoint")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	senderWS, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = senderWS.Close() }()
+
+	ch, err := f.sendAccept(name)
+	if err != nil {
+		return
+	}
+
+	var listenerWS *websocket.Conn
+	select {
+	case listenerWS = <-ch:
+	case <-time.After(5 * time.Second):
+		return
+	}
+	defer func() { _ = listenerWS.Close() }()
+
+	// Pump messages in both directions until either side goes away
+	done := make(chan struct{}, 2)
+	pump := func(dst, src *websocket.Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			msgType, data, err := src.ReadMessage()
+			if err != nil {
+				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				_ = dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+				return
+			}
+			if err := dst.WriteMessage(msgType, data); err != nil {
+				return
+			}
+		}
+	}
+	go pump(listenerWS, senderWS)
+	go pump(senderWS, listenerWS)
+	<-done
+}
+
+// sendAccept sends an accept message to the named listener and returns the channel
+// on which the relay side of the rendezvous WebSocket is delivered
+func (f *fakeRelay) sendAccept(name string) (chan *websocket.Conn, error) {
+	id := uuid.New().String()
+	ch := make(chan *websocket.Conn, 1)
+	f.mu.Lock()
+	f.pending[id] = ch
+	f.mu.Unlock()
+
+	if err := f.writeAccept(name, id); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// abandon simulates a sender that gave up before the listener reached the rendezvous:
+// it sends an accept message whose rendezvous address is no longer served
+func (f *fakeRelay) abandon(name string) {
+	f.t.Helper()
+
+	if err := f.writeAccept(name, uuid.New().String()); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// writeAccept writes an accept message for the rendezvous id to the control channel of the named listener
+func (f *fakeRelay) writeAccept(name, id string) error {
+	f.mu.Lock()
+	control, ok := f.listeners[name]
+	f.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no listener registered for %q", name)
+	}
+
+	address := strings.Replace(f.server.URL, "http://", "ws://", 1) +
+		"/$hc/" + name + "?sb-hc-action=accept&sb-hc-id=" + id
+	msg, _ := json.Marshal(map[string]any{
+		"accept": map[string]any{
+			"address": address,
+			"id":      id,
+		},
+	})
+
+	f.controlMu.Lock()
+	defer f.controlMu.Unlock()
+	if err := control.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return fmt.Errorf("failed to send accept message: %w", err)
+	}
+	return nil
+}
+
+// connect simulates a sender: it sends an accept message to the listener and
+// returns the relay side of the rendezvous WebSocket once the listener dials it
+func (f *fakeRelay) connect(name string) *websocket.Conn {
+	f.t.Helper()
+
+	ch, err := f.sendAccept(name)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	select {
+	case ws := <-ch:
+		return ws
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("Timed out waiting for rendezvous")
+		return nil
+	}
+}
+
+// dropListener closes the control channel of the named listener from the relay side
+func (f *fakeRelay) dropListener(name string) {
+	f.mu.Lock()
+	control, ok := f.listeners[name]
+	f.mu.Unlock()
+	if ok {
+		_ = control.Close()
+	}
+}
+
+func TestHybridConnectionURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "https endpoint",
+			endpoint: "https://ns.servicebus.windows.net",
+			want:     "wss://ns.servicebus.windows.net/$hc/hc-1?sb-hc-action=listen&sb-hc-id=abc",
+		},
+		{
+			name:     "sb endpoint",
+			endpoint: "sb://ns.servicebus.windows.net/",
+			want:     "wss://ns.servicebus.windows.net/$hc/hc-1?sb-hc-action=listen&sb-hc-id=abc",
+		},
+		{
+			name:     "plain http endpoint",
+			endpoint: "http://127.0.0.1:9090",
+			want:     "ws://127.0.0.1:9090/$hc/hc-1?sb-hc-action=listen&sb-hc-id=abc",
+		},
+		{
+			name:     "unsupported scheme",
+			endpoint: "ftp://ns.servicebus.windows.net",
+			wantErr:  true,
+		},
+		{
+			name:     "missing host",
+			endpoint: "ns.servicebus.windows.net",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := hybridConnectionURL(tt.endpoint, "hc-1", actionListen, "abc")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got URL %s", u)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if u.String() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, u.String())
+			}
+		})
+	}
+}
+
+func TestHybridConnectionURL_MissingName(t *testing.T) {
+	if _, err := hybridConnectionURL("https://ns.servicebus.windows.net", "", actionListen, ""); err == nil {
+		t.Error("Expected error for missing hybrid connection name")
+	}
+}
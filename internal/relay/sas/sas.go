@@ -0,0 +1,202 @@
+package sas
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenPrefix starts every Shared Access Signature token
+const tokenPrefix = "SharedAccessSignature "
+
+var (
+	// ErrMalformedToken is returned when a token cannot be parsed
+	ErrMalformedToken = errors.New("malformed SAS token")
+	// ErrTokenExpired is returned when a token is past its expiry
+	ErrTokenExpired = errors.New("SAS token expired")
+	// ErrUnknownKey is returned when a token is signed with a key name the validator does not know
+	ErrUnknownKey = errors.New("unknown SAS key name")
+	// ErrInvalidSignature is returned when a token signature does not match its content
+	ErrInvalidSignature = errors.New("invalid SAS signature")
+	// ErrInvalidScope is returned when a token does not grant access to the requested resource
+	ErrInvalidScope = errors.New("SAS token not valid for resource")
+)
+
+// Key is a named shared access key used to sign tokens
+type Key struct {
+	// Name is the shared access policy name (sent as skn)
+	Name string
+
+	// Value is the shared access key
+	Value string
+}
+
+// Token is a parsed Shared Access Signature
+type Token struct {
+	// ResourceURI is the resource the token grants access to (sr)
+	ResourceURI string
+
+	// KeyName is the name of the key that signed the token (skn)
+	KeyName string
+
+	// Signature is the base64 HMAC-SHA256 signature (sig)
+	Signature string
+
+	// Expiry is when the token stops being valid (se)
+	Expiry time.Time
+}
+
+// String formats the token in its wire format
+func (t *Token) String() string {
+	return fmt.Sprintf("%ssr=%s&sig=%s&se=%d&skn=%s",
+		tokenPrefix,
+		url.QueryEscape(t.ResourceURI),
+		url.QueryEscape(t.Signature),
+		t.Expiry.Unix(),
+		url.QueryEscape(t.KeyName))
+}
+
+// Generate mints a token for resourceURI signed with key that is valid until expiry
+func Generate(resourceURI string, key Key, expiry time.Time) (string, error) {
+	if resourceURI == "" {
+		return "", errors.New("resource URI is required")
+	}
+	if key.Name == "" || key.Value == "" {
+		return "", errors.New("key name and value are required")
+	}
+
+	token := &Token{
+		ResourceURI: resourceURI,
+		KeyName:     key.Name,
+		Expiry:      time.Unix(expiry.Unix(), 0),
+	}
+	token.Signature = sign(key.Value, resourceURI, token.Expiry)
+	return token.String(), nil
+}
+
+// Parse decodes a token in its wire format without validating it
+func Parse(token string) (*Token, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, fmt.Errorf("%w: missing %q prefix", ErrMalformedToken, strings.TrimSpace(tokenPrefix))
+	}
+
+	values, err := url.ParseQuery(strings.TrimPrefix(token, tokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+
+	for _, field := range []string{"sr", "sig", "se", "skn"} {
+		if values.Get(field) == "" {
+			return nil, fmt.Errorf("%w: missing %s", ErrMalformedToken, field)
+		}
+	}
+
+	expiry, err := strconv.ParseInt(values.Get("se"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid expiry %q", ErrMalformedToken, values.Get("se"))
+	}
+
+	return &Token{
+		ResourceURI: values.Get("sr"),
+		KeyName:     values.Get("skn"),
+		Signature:   values.Get("sig"),
+		Expiry:      time.Unix(expiry, 0),
+	}, nil
+}
+
+// ResourceURI builds the resource URI of an entity in a relay namespace.
+// The endpoint may use the https, sb, wss, http or ws schemes.
+func ResourceURI(endpoint, entity string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid relay endpoint %q: %w", endpoint, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid relay endpoint %q: missing host", endpoint)
+	}
+
+	scheme := "https"
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/%s", scheme, strings.ToLower(u.Host), strings.Trim(entity, "/")), nil
+}
+
+// Validator checks tokens against a set of known keys
+type Validator struct {
+	keys map[string]string
+	now  func() time.Time
+}
+
+// NewValidator creates a validator that accepts tokens signed by any of keys
+func NewValidator(keys ...Key) *Validator {
+	v := &Validator{
+		keys: make(map[string]string, len(keys)),
+		now:  time.Now,
+	}
+	for _, key := range keys {
+		v.keys[key.Name] = key.Value
+	}
+	return v
+}
+
+// Validate parses token and checks its signature, expiry and scope.
+// A token scoped to a namespace or parent path also grants access to resources below it.
+func (v *Validator) Validate(token, resourceURI string) (*Token, error) {
+	parsed, err := Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := v.keys[parsed.KeyName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, parsed.KeyName)
+	}
+
+	expected := sign(value, parsed.ResourceURI, parsed.Expiry)
+	if !hmac.Equal([]byte(expected), []byte(parsed.Signature)) {
+		return nil, ErrInvalidSignature
+	}
+
+	if !v.now().Before(parsed.Expiry) {
+		return nil, fmt.Errorf("%w at %s", ErrTokenExpired, parsed.Expiry.UTC().Format(time.RFC3339))
+	}
+
+	if !inScope(parsed.ResourceURI, resourceURI) {
+		return nil, fmt.Errorf("%w: token is scoped to %s", ErrInvalidScope, parsed.ResourceURI)
+	}
+
+	return parsed, nil
+}
+
+// sign computes the base64 HMAC-SHA256 signature of the string to sign
+func sign(key, resourceURI string, expiry time.Time) string {
+	stringToSign := url.QueryEscape(resourceURI) + "\n" + strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// inScope reports whether a token scoped to scope grants access to resource.
+// Schemes are ignored and hosts compared case-insensitively, as the relay does.
+func inScope(scope, resource string) bool {
+	scope = normalize(scope)
+	resource = normalize(resource)
+	return resource == scope || strings.HasPrefix(resource, scope+"/")
+}
+
+// normalize strips the scheme and trailing slash and lowercases a resource URI
+func normalize(uri string) string {
+	if i := strings.Index(uri, "://"); i >= 0 {
+		uri = uri[i+3:]
+	}
+	return strings.TrimSuffix(strings.ToLower(uri), "/")
+}
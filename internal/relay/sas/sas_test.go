@@ -0,0 +1,170 @@
+package sas
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = Key{Name: "ListenPolicy", Value: "c2VjcmV0LWtleS12YWx1ZQ=="}
+
+func TestGenerateAndParse(t *testing.T) {
+	expiry := time.Unix(1893456000, 0)
+	resource := "https://ns.servicebus.windows.net/hc-63873749"
+
+	token, err := Generate(resource, testKey, expiry)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if !strings.HasPrefix(token, "SharedAccessSignature ") {
+		t.Errorf("Expected SharedAccessSignature prefix, got %s", token)
+	}
+
+	parsed, err := Parse(token)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if parsed.ResourceURI != resource {
+		t.Errorf("Expected resource %s, got %s", resource, parsed.ResourceURI)
+	}
+	if parsed.KeyName != testKey.Name {
+		t.Errorf("Expected key name %s, got %s", testKey.Name, parsed.KeyName)
+	}
+	if !parsed.Expiry.Equal(expiry) {
+		t.Errorf("Expected expiry %v, got %v", expiry, parsed.Expiry)
+	}
+	if parsed.Signature == "" {
+		t.Error("Expected non-empty signature")
+	}
+
+	// Round-trip through String
+	if parsed.String() != token {
+		t.Errorf("Expected String() to reproduce token\nwant: %s\ngot:  %s", token, parsed.String())
+	}
+}
+
+func TestGenerateValidation(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+
+	if _, err := Generate("", testKey, expiry); err == nil {
+		t.Error("Expected error for empty resource URI")
+	}
+	if _, err := Generate("https://ns/hc", Key{Name: "policy"}, expiry); err == nil {
+		t.Error("Expected error for empty key value")
+	}
+	if _, err := Generate("https://ns/hc", Key{Value: "secret"}, expiry); err == nil {
+		t.Error("Expected error for empty key name")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "missing prefix", token: "sr=a&sig=b&se=1&skn=c"},
+		{name: "missing signature", token: "SharedAccessSignature sr=a&se=1&skn=c"},
+		{name: "missing expiry", token: "SharedAccessSignature sr=a&sig=b&skn=c"},
+		{name: "invalid expiry", token: "SharedAccessSignature sr=a&sig=b&se=soon&skn=c"},
+		{name: "invalid encoding", token: "SharedAccessSignature sr=%zz&sig=b&se=1&skn=c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.token); !errors.Is(err, ErrMalformedToken) {
+				t.Errorf("Expected ErrMalformedToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestResourceURI(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{endpoint: "https://NS.servicebus.windows.net", want: "https://ns.servicebus.windows.net/hc-1"},
+		{endpoint: "sb://ns.servicebus.windows.net/", want: "https://ns.servicebus.windows.net/hc-1"},
+		{endpoint: "http://localhost:9090", want: "http://localhost:9090/hc-1"},
+		{endpoint: "localhost:9090", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := ResourceURI(tt.endpoint, "hc-1")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidatorValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	validator := NewValidator(testKey)
+	validator.now = func() time.Time { return now }
+
+	resource := "https://ns.servicebus.windows.net/hc-1"
+	valid, _ := Generate(resource, testKey, now.Add(time.Hour))
+	expired, _ := Generate(resource, testKey, now.Add(-time.Second))
+	otherKey, _ := Generate(resource, Key{Name: "OtherPolicy", Value: "x"}, now.Add(time.Hour))
+	wrongValue, _ := Generate(resource, Key{Name: testKey.Name, Value: "wrong"}, now.Add(time.Hour))
+	namespaceScoped, _ := Generate("https://ns.servicebus.windows.net", testKey, now.Add(time.Hour))
+
+	tamperedToken, _ := Parse(valid)
+	tamperedToken.ResourceURI = "https://ns.servicebus.windows.net/hc-2"
+	tampered := tamperedToken.String()
+
+	tests := []struct {
+		name     string
+		token    string
+		resource string
+		wantErr  error
+	}{
+		{name: "valid", token: valid, resource: resource},
+		{name: "scheme and case insensitive", token: valid, resource: "http://NS.servicebus.windows.net/hc-1/"},
+		{name: "namespace scope covers entity", token: namespaceScoped, resource: resource},
+		{name: "expired", token: expired, resource: resource, wantErr: ErrTokenExpired},
+		{name: "unknown key", token: otherKey, resource: resource, wantErr: ErrUnknownKey},
+		{name: "wrong key value", token: wrongValue, resource: resource, wantErr: ErrInvalidSignature},
+		{name: "tampered resource", token: tampered, resource: "https://ns.servicebus.windows.net/hc-2",
+			wantErr: ErrInvalidSignature},
+		{name: "other entity", token: valid, resource: "https://ns.servicebus.windows.net/hc-2",
+			wantErr: ErrInvalidScope},
+		{name: "entity prefix is not a parent", token: valid, resource: "https://ns.servicebus.windows.net/hc-10",
+			wantErr: ErrInvalidScope},
+		{name: "malformed", token: "Bearer abc", resource: resource, wantErr: ErrMalformedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := validator.Validate(tt.token, tt.resource)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Expected valid token, got %v", err)
+				}
+				if parsed == nil {
+					t.Fatal("Expected parsed token")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}